@@ -0,0 +1,192 @@
+package gowsl
+
+// This file contains the audit hook, which is notified of every operation that
+// changes WSL.
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ubuntu/gowsl/backend"
+)
+
+type auditQueryType int
+
+const auditQuery auditQueryType = 0
+
+// AuditHook is notified of every operation that changes WSL. It is called once
+// the operation is over, whatever its outcome, and before it returns.
+type AuditHook func(AuditRecord)
+
+// AuditOutcome is how an audited operation ended.
+type AuditOutcome string
+
+const (
+	// AuditSuccess is the outcome of the operations that succeeded.
+	AuditSuccess AuditOutcome = "success"
+	// AuditFailure is the outcome of the operations that failed. See AuditRecord.Error.
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditRecord describes an operation that changed WSL, or attempted to.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`             // When the operation started
+	Operation string    `json:"operation"`        // Register, Unregister, Configure, Terminate, SetAsDefault or Shutdown
+	Distro    string    `json:"distro,omitempty"` // Name of the distro, except for Shutdown
+	GUID      uuid.UUID `json:"guid"`             // GUID of the distro, if it was registered before or after the operation
+
+	// Configuration of the distro before and after the operation. They are nil when it
+	// is not registered. For Configure, NewConfiguration is the one requested.
+	OldConfiguration *Configuration `json:"oldConfiguration,omitempty"`
+	NewConfiguration *Configuration `json:"newConfiguration,omitempty"`
+
+	Caller  AuditCaller  `json:"caller"`           // Who requested the operation
+	DryRun  bool         `json:"dryRun,omitempty"` // Whether the operation was only planned. See WithDryRun.
+	Outcome AuditOutcome `json:"outcome"`          // Whether the operation succeeded
+	Error   string       `json:"error,omitempty"`  // Why the operation failed, if it did
+}
+
+// AuditCaller identifies who requested an audited operation: the user and process
+// running GoWSL, and the code that called into it.
+type AuditCaller struct {
+	User     string `json:"user,omitempty"`
+	PID      int    `json:"pid"`
+	Function string `json:"function,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+// auditor holds the audit hook of a context. Distros keep a pointer to it so that
+// they remain comparable.
+type auditor struct {
+	hook AuditHook
+}
+
+// WithAuditHook adds an audit hook to the context. It is called with the operations
+// that change WSL made with this context or its children: Register, Unregister,
+// Terminate, SetAsDefault and the configuration setters of the distros created
+// with it, and Shutdown. A hook replaces the one of the parent context, if any.
+//
+// See the auditlog package for a tamper-evident log of these operations.
+func WithAuditHook(ctx context.Context, hook AuditHook) context.Context {
+	return context.WithValue(ctx, auditQuery, &auditor{hook: hook})
+}
+
+func selectAuditor(ctx context.Context) *auditor {
+	a, _ := ctx.Value(auditQuery).(*auditor)
+	return a
+}
+
+// audited runs an operation of the distro, reporting it to the audit hook.
+// The configuration requested by the operation, if any, is reported as the new one.
+func (d *Distro) audited(operation string, requested *Configuration, run func() error) error {
+	if d.auditor == nil || d.auditor.hook == nil {
+		return run()
+	}
+
+	rec := newAuditRecord(d.backend, operation)
+	rec.Distro = d.name
+	rec.GUID, rec.OldConfiguration = d.auditState()
+
+	err := run()
+
+	guid, conf := d.auditState()
+	if rec.GUID == uuid.Nil {
+		rec.GUID = guid
+	}
+	rec.NewConfiguration = conf
+	if requested != nil {
+		rec.NewConfiguration = requested
+	}
+
+	rec.setOutcome(err)
+	d.auditor.hook(rec)
+
+	return err
+}
+
+// audited runs an operation that is not specific to any distro, reporting it to
+// the audit hook.
+func (a *auditor) audited(b backend.Backend, operation string, run func() error) error {
+	if a == nil || a.hook == nil {
+		return run()
+	}
+
+	rec := newAuditRecord(b, operation)
+	err := run()
+	rec.setOutcome(err)
+	a.hook(rec)
+
+	return err
+}
+
+// auditState returns the GUID and configuration of the distro, or zero values if
+// they cannot be obtained: the audit must not prevent the operation.
+func (d *Distro) auditState() (uuid.UUID, *Configuration) {
+	guid, err := d.GUID()
+	if err != nil {
+		return uuid.Nil, nil
+	}
+
+	conf, err := d.GetConfiguration()
+	if err != nil {
+		return guid, nil
+	}
+
+	return guid, &conf
+}
+
+// newAuditRecord starts the record of an operation made through the back-end.
+func newAuditRecord(b backend.Backend, operation string) AuditRecord {
+	_, dryRun := dryRunPlanOf(b)
+
+	return AuditRecord{
+		Time:      time.Now(),
+		Operation: operation,
+		Caller:    auditCaller(),
+		DryRun:    dryRun,
+	}
+}
+
+func (rec *AuditRecord) setOutcome(err error) {
+	if err != nil {
+		rec.Outcome = AuditFailure
+		rec.Error = err.Error()
+		return
+	}
+	rec.Outcome = AuditSuccess
+}
+
+// gowslFunctions is the prefix of the functions of this package in stack traces.
+var gowslFunctions = reflect.TypeOf(Distro{}).PkgPath() + "."
+
+// auditCaller identifies the current user and process, and the first function in
+// the stack that is not part of this package.
+func auditCaller() AuditCaller {
+	c := AuditCaller{PID: os.Getpid()}
+
+	if u, err := user.Current(); err == nil {
+		c.User = u.Username
+	}
+
+	pc := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(2, pc)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, gowslFunctions) {
+			c.Function, c.File, c.Line = frame.Function, frame.File, frame.Line
+			break
+		}
+		if !more {
+			break
+		}
+	}
+
+	return c
+}
@@ -0,0 +1,110 @@
+package gowsl_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/mock"
+)
+
+func TestAuditHook(t *testing.T) {
+	if !wsl.MockAvailable() {
+		t.Skip("Skipping test because Shutdown would stop the other tests")
+	}
+	t.Parallel()
+
+	ctx := wsl.WithMock(context.Background(), mock.New())
+
+	var records []wsl.AuditRecord
+	auditCtx := wsl.WithAuditHook(ctx, func(rec wsl.AuditRecord) {
+		records = append(records, rec)
+	})
+
+	d := wsl.NewDistro(auditCtx, uniqueDistroName(t))
+	t.Cleanup(func() { _ = d.Unregister() })
+
+	start := time.Now()
+
+	_, file, line, _ := runtime.Caller(0)
+	require.NoError(t, d.Register(emptyRootFs), "Setup: could not register the test distro")
+	guid, err := d.GUID()
+	require.NoError(t, err, "Setup: could not get the GUID of the test distro")
+	conf, err := d.GetConfiguration()
+	require.NoError(t, err, "Setup: could not get the configuration of the test distro")
+
+	require.NoError(t, d.DefaultUID(1000), "DefaultUID should not have failed")
+	newConf := conf
+	newConf.DefaultUID = 1000
+
+	require.NoError(t, d.Terminate(), "Terminate should not have failed")
+	require.NoError(t, d.SetAsDefault(), "SetAsDefault should not have failed")
+	require.NoError(t, wsl.Shutdown(auditCtx), "Shutdown should not have failed")
+
+	// Operations are audited even if they fail, and also in dry runs
+	invalid := wsl.NewDistro(auditCtx, "Invalid name!")
+	require.Error(t, invalid.Register(emptyRootFs), "Register should have failed with an invalid name")
+	dry := wsl.NewDistro(wsl.WithDryRun(auditCtx), d.Name())
+	require.NoError(t, dry.Terminate(), "Terminate should not have failed in dry-run mode")
+
+	require.NoError(t, d.Unregister(), "Unregister should not have failed")
+
+	// Operations made with other contexts are not audited
+	other := wsl.NewDistro(ctx, d.Name())
+	require.ErrorIs(t, other.Unregister(), wsl.ErrNotRegistered, "Unregister should have failed with a distro that is not registered")
+	require.NoError(t, wsl.Shutdown(ctx), "Shutdown should not have failed")
+
+	type want struct {
+		operation string
+		distro    string
+		guid      uuid.UUID
+		oldConf   *wsl.Configuration
+		newConf   *wsl.Configuration
+		dryRun    bool
+		failed    bool
+	}
+	wants := []want{
+		{operation: "Register", distro: d.Name(), guid: guid, newConf: &conf},
+		{operation: "Configure", distro: d.Name(), guid: guid, oldConf: &conf, newConf: &newConf},
+		{operation: "Terminate", distro: d.Name(), guid: guid, oldConf: &newConf, newConf: &newConf},
+		{operation: "SetAsDefault", distro: d.Name(), guid: guid, oldConf: &newConf, newConf: &newConf},
+		{operation: "Shutdown"},
+		{operation: "Register", distro: "Invalid name!", failed: true},
+		{operation: "Terminate", distro: d.Name(), guid: guid, oldConf: &newConf, newConf: &newConf, dryRun: true},
+		{operation: "Unregister", distro: d.Name(), guid: guid, oldConf: &newConf},
+	}
+
+	require.Len(t, records, len(wants), "Unexpected number of audit records")
+	for i, w := range wants {
+		rec := records[i]
+
+		require.Equal(t, w.operation, rec.Operation, "Unexpected operation in record %d", i)
+		require.Equal(t, w.distro, rec.Distro, "Unexpected distro in the %s record", w.operation)
+		require.Equal(t, w.guid, rec.GUID, "Unexpected GUID in the %s record", w.operation)
+		require.Equal(t, w.oldConf, rec.OldConfiguration, "Unexpected old configuration in the %s record", w.operation)
+		require.Equal(t, w.newConf, rec.NewConfiguration, "Unexpected new configuration in the %s record", w.operation)
+		require.Equal(t, w.dryRun, rec.DryRun, "Unexpected dry-run flag in the %s record", w.operation)
+
+		require.WithinRange(t, rec.Time, start, time.Now(), "Unexpected time in the %s record", w.operation)
+		if i > 0 {
+			require.False(t, rec.Time.Before(records[i-1].Time), "Records should be in chronological order")
+		}
+
+		if w.failed {
+			require.Equal(t, wsl.AuditFailure, rec.Outcome, "Unexpected outcome in the %s record", w.operation)
+			require.NotEmpty(t, rec.Error, "The %s record should have an error", w.operation)
+		} else {
+			require.Equal(t, wsl.AuditSuccess, rec.Outcome, "Unexpected outcome in the %s record", w.operation)
+			require.Empty(t, rec.Error, "The %s record should have no error", w.operation)
+		}
+
+		require.NotZero(t, rec.Caller.PID, "The %s record should have the PID of the caller", w.operation)
+		require.Equal(t, "github.com/ubuntu/gowsl_test.TestAuditHook", rec.Caller.Function, "The %s record should point to the caller", w.operation)
+		require.Equal(t, file, rec.Caller.File, "The %s record should point to the file of the caller", w.operation)
+	}
+	require.Equal(t, line+1, records[0].Caller.Line, "The Register record should point to the line of the caller")
+}
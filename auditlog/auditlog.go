@@ -0,0 +1,228 @@
+// Package auditlog writes the audit records of GoWSL into a tamper-evident log.
+//
+// The log is made of JSON lines, one per record:
+//
+//	{"seq":1,"prev":"0000…","hash":"9f86…","record":{"time":"…","operation":"Register",…}}
+//
+// Records are hash-chained: the hash of each line is the SHA-256 of the hash of the
+// previous line (64 zeros for the first one) followed by the record, as written.
+// Verify detects lines edited, removed or reordered by mistake, or by someone who
+// did not fix the hashes of the following lines.
+//
+// The hashes are not keyed, so anyone who can write into the log can also recompute
+// them: the chain alone does not detect deliberate tampering. To detect it, keep a
+// copy of LastHash outside of the log, where whoever can write into the log cannot
+// change it, and compare it with the LastHash of the log reopened with Open. Any
+// edit, including removing lines at the end of the log, changes the last hash.
+//
+// To log the operations made with a context:
+//
+//	log, err := auditlog.Open(path)
+//	...
+//	defer log.Close()
+//	ctx = gowsl.WithAuditHook(ctx, log.Hook())
+package auditlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ubuntu/decorate"
+	wsl "github.com/ubuntu/gowsl"
+)
+
+// ErrTampered is returned by Verify and Open when the chain of hashes is broken.
+var ErrTampered = errors.New("audit log has been tampered with")
+
+// genesis is the previous hash of the first line of a log.
+var genesis = strings.Repeat("0", sha256.Size*2)
+
+// entry is a line of the log.
+type entry struct {
+	Seq    uint64          `json:"seq"`
+	Prev   string          `json:"prev"`
+	Hash   string          `json:"hash"`
+	Record json.RawMessage `json:"record"`
+}
+
+// chainHash returns the hash of a record that follows the one with hash prev.
+func chainHash(prev string, record []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write(record)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Writer appends audit records to a log. It is safe for concurrent use.
+type Writer struct {
+	mu sync.Mutex
+
+	w      io.Writer
+	closer io.Closer
+	seq    uint64
+	prev   string
+	err    error
+}
+
+// NewWriter returns a Writer that starts a new log in w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, prev: genesis}
+}
+
+// Open returns a Writer that appends to the log in the file at path, creating it
+// if it does not exist. The existing records are verified first, so that the
+// chain is not extended from a log that has been tampered with.
+func Open(path string) (w *Writer, err error) {
+	defer decorate.OnError(&err, "could not open audit log %s", path)
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	seq, prev, err := verify(f, nil)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return &Writer{w: f, closer: f, seq: seq, prev: prev}, nil
+}
+
+// Append writes the record at the end of the log.
+func (w *Writer) Append(rec wsl.AuditRecord) (err error) {
+	defer decorate.OnError(&err, "could not append %s record to audit log", rec.Operation)
+
+	record, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	e := entry{Seq: w.seq + 1, Prev: w.prev, Hash: chainHash(w.prev, record), Record: record}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	w.seq, w.prev = e.Seq, e.Hash
+	return nil
+}
+
+// Hook returns an audit hook that appends the records to the log. Hooks cannot
+// fail: the first error is kept and returned by Err.
+func (w *Writer) Hook() wsl.AuditHook {
+	return func(rec wsl.AuditRecord) {
+		err := w.Append(rec)
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.err == nil {
+			w.err = err
+		}
+	}
+}
+
+// Err returns the first error of the hook returned by Hook, if any.
+func (w *Writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// LastHash returns the hash of the last record in the log. Keep a copy of it
+// outside of the log to detect any change to the records written so far, as
+// explained in the package documentation.
+func (w *Writer) LastHash() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.prev
+}
+
+// Close closes the file of a Writer returned by Open. It does nothing for the
+// ones returned by NewWriter.
+func (w *Writer) Close() error {
+	if w.closer == nil {
+		return nil
+	}
+	return w.closer.Close()
+}
+
+// Verify reads a log, checks its chain of hashes, and returns its records. If the
+// chain is broken, the records up to the first broken line are returned along
+// with ErrTampered. A valid chain does not prove that the log was not tampered
+// with: see the package documentation.
+func Verify(r io.Reader) (records []wsl.AuditRecord, err error) {
+	defer decorate.OnError(&err, "could not verify audit log")
+
+	_, _, err = verify(r, func(record []byte) error {
+		var rec wsl.AuditRecord
+		if err := json.Unmarshal(record, &rec); err != nil {
+			return err
+		}
+		records = append(records, rec)
+		return nil
+	})
+
+	return records, err
+}
+
+// verify checks the chain of hashes of a log, calling f with each record, and
+// returns the sequence number and hash of its last line.
+func verify(r io.Reader, f func(record []byte) error) (seq uint64, prev string, err error) {
+	prev = genesis
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return seq, prev, fmt.Errorf("%w: line %d: %v", ErrTampered, seq+1, err)
+		}
+
+		switch {
+		case e.Seq != seq+1:
+			return seq, prev, fmt.Errorf("%w: line %d: sequence number is %d", ErrTampered, seq+1, e.Seq)
+		case e.Prev != prev:
+			return seq, prev, fmt.Errorf("%w: line %d: previous hash does not match the previous line", ErrTampered, e.Seq)
+		case e.Hash != chainHash(prev, e.Record):
+			return seq, prev, fmt.Errorf("%w: line %d: hash does not match the record", ErrTampered, e.Seq)
+		}
+
+		if f != nil {
+			if err := f(e.Record); err != nil {
+				return seq, prev, fmt.Errorf("line %d: %v", e.Seq, err)
+			}
+		}
+
+		seq, prev = e.Seq, e.Hash
+	}
+
+	if err := sc.Err(); err != nil {
+		return seq, prev, err
+	}
+
+	return seq, prev, nil
+}
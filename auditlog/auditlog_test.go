@@ -0,0 +1,174 @@
+package auditlog_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/auditlog"
+	"github.com/ubuntu/gowsl/mock"
+)
+
+func TestHook(t *testing.T) {
+	t.Parallel()
+
+	rootFs := filepath.Join(t.TempDir(), "rootfs.tar.gz")
+	require.NoError(t, os.WriteFile(rootFs, nil, 0600), "Setup: could not write rootfs")
+
+	var buff bytes.Buffer
+	log := auditlog.NewWriter(&buff)
+
+	ctx := wsl.WithAuditHook(wsl.WithBackend(context.Background(), mock.New()), log.Hook())
+	d := wsl.NewDistro(ctx, "Ubuntu")
+	require.NoError(t, d.Register(rootFs), "Setup: could not register distro")
+	require.NoError(t, d.InteropEnabled(false), "Setup: could not configure distro")
+	require.NoError(t, d.Unregister(), "Setup: could not unregister distro")
+	require.NoError(t, log.Err(), "The hook should not have failed")
+
+	require.Equal(t, 3, strings.Count(buff.String(), "\n"), "There should be one line per operation")
+
+	records, err := auditlog.Verify(&buff)
+	require.NoError(t, err, "Verify should not have failed")
+	require.Len(t, records, 3, "Verify should have returned all the records")
+	for i, op := range []string{"Register", "Configure", "Unregister"} {
+		require.Equal(t, op, records[i].Operation, "Unexpected operation in record %d", i)
+		require.Equal(t, "Ubuntu", records[i].Distro, "Unexpected distro in record %d", i)
+	}
+	require.NotNil(t, records[1].NewConfiguration, "The configuration should have been logged")
+	require.False(t, records[1].NewConfiguration.InteropEnabled, "Unexpected configuration in the log")
+}
+
+func TestHookError(t *testing.T) {
+	t.Parallel()
+
+	log := auditlog.NewWriter(failingWriter{})
+	hook := log.Hook()
+
+	hook(wsl.AuditRecord{Operation: "Shutdown"})
+	hook(wsl.AuditRecord{Operation: "Terminate"})
+
+	require.ErrorContains(t, log.Err(), "Shutdown", "Err should have returned the first error")
+	require.Equal(t, strings.Repeat("0", 64), log.LastHash(), "The chain should not have advanced after failing")
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	var buff bytes.Buffer
+	log := auditlog.NewWriter(&buff)
+
+	want := []wsl.AuditRecord{
+		{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Operation: "Register", Distro: "Ubuntu", Outcome: wsl.AuditSuccess},
+		{Time: time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC), Operation: "Terminate", Distro: "<Ubuntu & co>", Outcome: wsl.AuditFailure, Error: "oops"},
+		{Time: time.Date(2024, 1, 1, 0, 0, 2, 0, time.UTC), Operation: "Shutdown", Outcome: wsl.AuditSuccess},
+	}
+	for _, rec := range want {
+		require.NoError(t, log.Append(rec), "Setup: Append should not have failed")
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(buff.String(), "\n"), "\n")
+	require.Len(t, lines, 3, "Setup: there should be one line per record")
+
+	testCases := map[string]struct {
+		edit func(lines []string) []string
+
+		wantRecords int
+		wantErr     bool
+	}{
+		"Success with an intact log": {edit: func(l []string) []string { return l }, wantRecords: 3},
+		"Success with an empty log":  {edit: func([]string) []string { return nil }},
+		"Success with a truncated log, which cannot be detected": {
+			edit:        func(l []string) []string { return l[:2] },
+			wantRecords: 2,
+		},
+
+		"Error with an edited record": {
+			edit: func(l []string) []string {
+				return []string{l[0], strings.Replace(l[1], `"outcome":"failure"`, `"outcome":"success"`, 1), l[2]}
+			},
+			wantRecords: 1,
+			wantErr:     true,
+		},
+		"Error with a removed record": {
+			edit:        func(l []string) []string { return []string{l[0], l[2]} },
+			wantRecords: 1,
+			wantErr:     true,
+		},
+		"Error with reordered records": {
+			edit:        func(l []string) []string { return []string{l[1], l[0], l[2]} },
+			wantErr:     true,
+			wantRecords: 0,
+		},
+		"Error with a malformed line": {
+			edit:        func(l []string) []string { return []string{l[0], "not json\n", l[2]} },
+			wantRecords: 1,
+			wantErr:     true,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			edited := strings.Join(tc.edit(append([]string{}, lines...)), "")
+			got, err := auditlog.Verify(strings.NewReader(edited))
+			if tc.wantErr {
+				require.ErrorIs(t, err, auditlog.ErrTampered, "Verify should have detected the tampering")
+			} else {
+				require.NoError(t, err, "Verify should not have failed")
+			}
+			require.Len(t, got, tc.wantRecords, "Verify should have returned the records before the first broken line")
+			for i := range got {
+				require.Equal(t, want[i].Operation, got[i].Operation, "Unexpected record %d", i)
+				require.True(t, want[i].Time.Equal(got[i].Time), "Unexpected time in record %d", i)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	// Open creates the log, and then appends to it
+	for i, op := range []string{"Register", "Unregister"} {
+		log, err := auditlog.Open(path)
+		require.NoError(t, err, "Open should not have failed (iteration %d)", i)
+		require.NoError(t, log.Append(wsl.AuditRecord{Operation: op}), "Append should not have failed")
+		require.NoError(t, log.Close(), "Close should not have failed")
+	}
+
+	f, err := os.Open(path)
+	require.NoError(t, err, "Setup: could not open the log")
+	defer f.Close()
+
+	records, err := auditlog.Verify(f)
+	require.NoError(t, err, "The log should have been chained across Open calls")
+	require.Len(t, records, 2, "Unexpected number of records")
+	require.Equal(t, "Unregister", records[1].Operation, "Unexpected last record")
+
+	// Open refuses to extend a tampered log
+	out, err := os.ReadFile(path)
+	require.NoError(t, err, "Setup: could not read the log")
+	require.NoError(t, os.WriteFile(path, bytes.Replace(out, []byte("Unregister"), []byte("Terminate"), 1), 0600), "Setup: could not edit the log")
+
+	_, err = auditlog.Open(path)
+	require.ErrorIs(t, err, auditlog.ErrTampered, "Open should have failed with a tampered log")
+
+	_, err = auditlog.Open(t.TempDir())
+	require.Error(t, err, "Open should have failed with a directory")
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
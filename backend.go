@@ -0,0 +1,40 @@
+package gowsl
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/internal/backend/interop"
+	"github.com/ubuntu/gowsl/internal/backend/windows"
+)
+
+type backendQueryType int
+
+const backendQuery backendQueryType = 0
+
+// WithBackend adds a back-end to the context. GoWSL uses it instead of the
+// default one in all operations made with this context or its children.
+//
+// It can be used to plug in any implementation of backend.Backend, such as one
+// that wraps another back-end, without any build tag.
+func WithBackend(ctx context.Context, b backend.Backend) context.Context {
+	return context.WithValue(ctx, backendQuery, b)
+}
+
+func selectBackend(ctx context.Context) backend.Backend {
+	b, ok := ctx.Value(backendQuery).(backend.Backend)
+	if !ok {
+		b = DefaultBackend()
+	}
+	return dryRun(ctx, b)
+}
+
+// DefaultBackend returns the back-end used when the context has none: the interop
+// back-end when running inside a WSL distro, and the Windows one otherwise.
+func DefaultBackend() backend.Backend {
+	if runtime.GOOS == "linux" && interop.Available() {
+		return interop.New()
+	}
+	return windows.Backend{}
+}
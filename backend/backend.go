@@ -1,5 +1,8 @@
 // Package backend defines all the actions that a back-end to GoWSL must
 // be able to perform in order to run, or otherwise mock WSL.
+//
+// Any implementation of Backend can be used by GoWSL by adding it to the context
+// with gowsl.WithBackend.
 package backend
 
 import (
@@ -9,6 +12,22 @@ import (
 	"github.com/ubuntu/gowsl/internal/state"
 )
 
+// WslFlags is the bitmask of WSL_DISTRIBUTION_FLAGS, as used by the Win32 API.
+// https://learn.microsoft.com/en-us/windows/win32/api/wslapi/ne-wslapi-wsl_distribution_flags
+type WslFlags = flags.WslFlags
+
+// State is the state of a particular distro as seen in `wsl.exe -l -v`.
+type State = state.State
+
+// The states a back-end can report.
+const (
+	Stopped       = state.Stopped
+	Running       = state.Running
+	Installing    = state.Installing
+	Uninstalling  = state.Uninstalling
+	NotRegistered = state.NotRegistered
+)
+
 // RegistryKey mocks a very small subset of behaviours of a Windows Registry key, enough
 // for GoWSL to do the limited amount of traversal and reading that it needs.
 type RegistryKey interface {
@@ -23,14 +42,14 @@ type Backend interface {
 	OpenLxssRegistry(path string) (RegistryKey, error)
 
 	// wsl.exe
-	State(distributionName string) (state.State, error)
+	State(distributionName string) (State, error)
 	Shutdown() error
 	Terminate(distroName string) error
 	SetAsDefault(distroName string) error
 
 	// Win32
-	WslConfigureDistribution(distributionName string, defaultUID uint32, wslDistributionFlags flags.WslFlags) error
-	WslGetDistributionConfiguration(distroName string, distributionVersion *uint8, defaultUID *uint32, wslDistributionFlags *flags.WslFlags, defaultEnvironmentVariables *map[string]string) error
+	WslConfigureDistribution(distributionName string, defaultUID uint32, wslDistributionFlags WslFlags) error
+	WslGetDistributionConfiguration(distroName string, distributionVersion *uint8, defaultUID *uint32, wslDistributionFlags *WslFlags, defaultEnvironmentVariables *map[string]string) error
 	WslLaunch(distroName string, command string, useCWD bool, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error)
 	WslLaunchInteractive(distributionName string, command string, useCurrentWorkingDirectory bool) (uint32, error)
 	WslRegisterDistribution(distributionName string, tarGzFilename string) error
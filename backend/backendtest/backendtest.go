@@ -0,0 +1,228 @@
+// Package backendtest provides a conformance suite for GoWSL back-ends. Every
+// back-end is expected to behave like WSL, as seen through the Backend interface,
+// and this suite checks it.
+//
+// Run it from a test, with a factory that returns the back-end to validate:
+//
+//	func TestConformance(t *testing.T) {
+//		backendtest.Run(t, func(t *testing.T) backend.Backend {
+//			return mock.New()
+//		})
+//	}
+//
+// The suite registers, configures, launches and unregisters distros. Against a
+// back-end that talks to WSL, it also shuts WSL down and changes the default distro
+// for a moment, so it is best run in a disposable machine.
+package backendtest
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/backend"
+)
+
+// Factory returns the back-end to test. It is called once per test of the suite,
+// possibly in parallel.
+type Factory func(t *testing.T) backend.Backend
+
+type options struct {
+	rootFs     string
+	namePrefix string
+}
+
+// Option represents an optional function to override Run default values.
+type Option func(*options)
+
+// WithRootFs sets the tarball used to register distros. Back-ends that launch
+// commands in a real distro need a rootfs with a shell. Otherwise, an empty
+// tarball is used.
+func WithRootFs(path string) Option {
+	return func(o *options) {
+		o.rootFs = path
+	}
+}
+
+// WithNamePrefix sets the prefix of the names of the distros registered by the
+// suite, which is useful to clean them up after an interrupted run. Otherwise,
+// "backendtest" is used.
+func WithNamePrefix(prefix string) Option {
+	return func(o *options) {
+		o.namePrefix = prefix
+	}
+}
+
+// Run runs the conformance suite against the back-ends returned by newBackend.
+func Run(t *testing.T, newBackend Factory, args ...Option) {
+	t.Helper()
+
+	opts := options{
+		namePrefix: "backendtest",
+	}
+	for _, f := range args {
+		f(&opts)
+	}
+
+	if opts.rootFs == "" {
+		opts.rootFs = filepath.Join(t.TempDir(), "empty.tar.gz")
+		require.NoError(t, writeEmptyTarball(opts.rootFs), "Setup: could not write empty rootfs")
+	}
+
+	s := suite{newBackend: newBackend, opts: opts}
+
+	t.Run("Registration", s.testRegistration)
+	t.Run("Configuration", s.testConfiguration)
+	t.Run("Launch", s.testLaunch)
+	t.Run("State", s.testState)
+	t.Run("Registry", s.testRegistry)
+}
+
+// suite holds what the tests of the suite share.
+type suite struct {
+	newBackend Factory
+	opts       options
+}
+
+// distroName returns a new unique distro name.
+func (s suite) distroName() string {
+	//nolint:gosec // No need to be cryptographically secure for this
+	return fmt.Sprintf("%s_%d", s.opts.namePrefix, rand.Uint64())
+}
+
+// register registers a new distro with a unique name, which is unregistered
+// when the test finishes.
+func (s suite) register(t *testing.T, b backend.Backend) string {
+	t.Helper()
+
+	name := s.distroName()
+	require.NoError(t, b.WslRegisterDistribution(name, s.opts.rootFs), "Setup: could not register distro")
+
+	t.Cleanup(func() {
+		if st, err := b.State(name); err == nil && st == backend.NotRegistered {
+			return
+		}
+		if err := b.WslUnregisterDistribution(name); err != nil {
+			t.Logf("Cleanup: could not unregister %s: %v", name, err)
+		}
+	})
+
+	return name
+}
+
+// launch runs a command in the distro and returns its output and exit code.
+func launch(t *testing.T, b backend.Backend, distroName, command string) (stdout, stderr string, exitCode int) {
+	t.Helper()
+
+	stdin, err := os.Open(os.DevNull)
+	require.NoError(t, err, "Setup: could not open null device")
+	defer stdin.Close()
+
+	outR, outW, err := os.Pipe()
+	require.NoError(t, err, "Setup: could not create pipe")
+	defer outR.Close()
+
+	errR, errW, err := os.Pipe()
+	require.NoError(t, err, "Setup: could not create pipe")
+	defer errR.Close()
+
+	p, err := b.WslLaunch(distroName, command, false, stdin, outW, errW)
+	outW.Close()
+	errW.Close()
+	require.NoErrorf(t, err, "WslLaunch should not have failed to launch %q", command)
+
+	var outBuf, errBuf strings.Builder
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(&outBuf, outR)
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(&errBuf, errR)
+	}()
+
+	st, err := p.Wait()
+	require.NoErrorf(t, err, "Could not wait for %q", command)
+	wg.Wait()
+
+	return outBuf.String(), errBuf.String(), st.ExitCode()
+}
+
+// distroGUID returns the GUID of the registry key of a distro, or an empty string
+// if it is not in the registry.
+func distroGUID(t *testing.T, b backend.Backend, distroName string) string {
+	t.Helper()
+
+	root, err := b.OpenLxssRegistry(".")
+	require.NoError(t, err, "OpenLxssRegistry should not have failed to open the root key")
+	subkeys, err := root.SubkeyNames()
+	require.NoError(t, root.Close(), "Close should not have failed")
+	require.NoError(t, err, "SubkeyNames should not have failed")
+
+	for _, guid := range subkeys {
+		name, err := readField(b, guid, "DistributionName")
+		if err != nil {
+			// Not a distro
+			continue
+		}
+		if name == distroName {
+			return guid
+		}
+	}
+
+	return ""
+}
+
+// defaultDistroGUID returns the GUID of the default distro, or an empty string
+// if there is none.
+func defaultDistroGUID(t *testing.T, b backend.Backend) string {
+	t.Helper()
+
+	guid, err := readField(b, ".", "DefaultDistribution")
+	if err != nil {
+		// The field is missing until a distro is registered
+		return ""
+	}
+	return guid
+}
+
+// readField returns the value of a field of the registry key at path.
+func readField(b backend.Backend, path, field string) (value string, err error) {
+	k, err := b.OpenLxssRegistry(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		err = errors.Join(err, k.Close())
+	}()
+
+	return k.Field(field)
+}
+
+// writeEmptyTarball writes a gzipped tarball with no files into path.
+func writeEmptyTarball(path string) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	gz := gzip.NewWriter(f)
+	if err := tar.NewWriter(gz).Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,296 @@
+package backendtest
+
+// This file contains the tests of the conformance suite.
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/backend"
+)
+
+// wslVersionFlag is the undocumented flag set in WSL 2 distros.
+const wslVersionFlag backend.WslFlags = 0x8
+
+func (s suite) testRegistration(t *testing.T) {
+	// Not parallel: the default distro is shared by all the distros of a back-end
+	t.Run("Unregistering the default distro selects another one", func(t *testing.T) {
+		b := s.newBackend(t)
+
+		// Restoring the default distro of back-ends with distros of their own
+		if previous := defaultDistroGUID(t, b); previous != "" {
+			name, err := readField(b, previous, "DistributionName")
+			require.NoError(t, err, "Setup: could not read the name of the default distro")
+			t.Cleanup(func() {
+				if err := b.SetAsDefault(name); err != nil {
+					t.Logf("Cleanup: could not restore default distro %s: %v", name, err)
+				}
+			})
+		}
+
+		first := s.register(t, b)
+		second := s.register(t, b)
+
+		require.NoError(t, b.SetAsDefault(first), "SetAsDefault should not have failed")
+		firstGUID := distroGUID(t, b, first)
+		require.Equal(t, firstGUID, defaultDistroGUID(t, b), "SetAsDefault should have changed the default distro")
+
+		require.NoError(t, b.SetAsDefault(second), "SetAsDefault should not have failed")
+		require.Equal(t, distroGUID(t, b, second), defaultDistroGUID(t, b), "SetAsDefault should have changed the default distro")
+		require.NoError(t, b.SetAsDefault(first), "SetAsDefault should not have failed")
+
+		require.NoError(t, b.WslUnregisterDistribution(first), "WslUnregisterDistribution should not have failed")
+
+		// Which distro is selected is up to WSL, so we only check that it is a registered one
+		guid := defaultDistroGUID(t, b)
+		require.NotEqual(t, firstGUID, guid, "The unregistered distro should no longer be the default")
+		require.NotEmpty(t, guid, "Another distro should have been selected as default")
+		_, err := readField(b, guid, "DistributionName")
+		require.NoError(t, err, "The new default distro should be registered")
+	})
+
+	t.Run("Registering and unregistering a distro", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+
+		name := s.distroName()
+		st, err := b.State(name)
+		require.NoError(t, err, "State should not have failed")
+		require.Equal(t, backend.NotRegistered, st, "Distro should not be registered before registering it")
+
+		require.NoError(t, b.WslRegisterDistribution(name, s.opts.rootFs), "WslRegisterDistribution should not have failed")
+		st, err = b.State(name)
+		require.NoError(t, err, "State should not have failed")
+		require.Equal(t, backend.Stopped, st, "Distro should be stopped after registering it")
+		require.NotEmpty(t, distroGUID(t, b, name), "Distro should be in the registry after registering it")
+
+		err = b.WslRegisterDistribution(name, s.opts.rootFs)
+		require.Error(t, err, "WslRegisterDistribution should have failed to register the same name twice")
+
+		require.NoError(t, b.WslUnregisterDistribution(name), "WslUnregisterDistribution should not have failed")
+		st, err = b.State(name)
+		require.NoError(t, err, "State should not have failed")
+		require.Equal(t, backend.NotRegistered, st, "Distro should not be registered after unregistering it")
+		require.Empty(t, distroGUID(t, b, name), "Distro should not be in the registry after unregistering it")
+
+		err = b.WslUnregisterDistribution(name)
+		require.Error(t, err, "WslUnregisterDistribution should have failed on an unregistered distro")
+	})
+
+	t.Run("Registering a distro with an invalid name fails", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+
+		for _, name := range []string{"", "Has spaces", "Has/slashes", "Has:colons", "Has\x00null"} {
+			err := b.WslRegisterDistribution(name, s.opts.rootFs)
+			require.Errorf(t, err, "WslRegisterDistribution should have rejected name %q", name)
+		}
+	})
+}
+
+func (s suite) testConfiguration(t *testing.T) {
+	t.Run("Registered distros have a default configuration", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+		name := s.register(t, b)
+
+		var version uint8
+		var uid uint32
+		var f backend.WslFlags
+		var env map[string]string
+		err := b.WslGetDistributionConfiguration(name, &version, &uid, &f, &env)
+		require.NoError(t, err, "WslGetDistributionConfiguration should not have failed")
+
+		require.Contains(t, []uint8{1, 2}, version, "Unexpected version")
+		require.Equal(t, uint32(0), uid, "The default user should be root")
+		require.Contains(t, env, "PATH", "The default environment should contain PATH")
+	})
+
+	t.Run("Configuration is persisted", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+		name := s.register(t, b)
+
+		var version uint8
+		var uid uint32
+		var before, after backend.WslFlags
+		var env map[string]string
+		err := b.WslGetDistributionConfiguration(name, &version, &uid, &before, &env)
+		require.NoError(t, err, "Setup: WslGetDistributionConfiguration should not have failed")
+
+		// Toggling interop and drive mounting, and keeping the version
+		want := before ^ 0x5
+		require.NoError(t, b.WslConfigureDistribution(name, 1000, want), "WslConfigureDistribution should not have failed")
+
+		err = b.WslGetDistributionConfiguration(name, &version, &uid, &after, &env)
+		require.NoError(t, err, "WslGetDistributionConfiguration should not have failed")
+		require.Equal(t, uint32(1000), uid, "The default user should have changed")
+		require.Equal(t, want, after, "The flags should have changed")
+	})
+
+	t.Run("Configuring does not change the WSL version", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+		name := s.register(t, b)
+
+		var version uint8
+		var uid uint32
+		var before, after backend.WslFlags
+		var env map[string]string
+		err := b.WslGetDistributionConfiguration(name, &version, &uid, &before, &env)
+		require.NoError(t, err, "Setup: WslGetDistributionConfiguration should not have failed")
+
+		require.NoError(t, b.WslConfigureDistribution(name, uid, before^wslVersionFlag), "WslConfigureDistribution should not have failed")
+
+		err = b.WslGetDistributionConfiguration(name, &version, &uid, &after, &env)
+		require.NoError(t, err, "WslGetDistributionConfiguration should not have failed")
+		require.Equal(t, before, after, "The WSL version should not have changed")
+	})
+
+	t.Run("Configuring an unregistered distro fails", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+		name := s.distroName()
+
+		err := b.WslConfigureDistribution(name, 0, 0x7)
+		require.Error(t, err, "WslConfigureDistribution should have failed")
+
+		var version uint8
+		var uid uint32
+		var f backend.WslFlags
+		var env map[string]string
+		err = b.WslGetDistributionConfiguration(name, &version, &uid, &f, &env)
+		require.Error(t, err, "WslGetDistributionConfiguration should have failed")
+	})
+}
+
+func (s suite) testLaunch(t *testing.T) {
+	testCases := map[string]struct {
+		command string
+
+		wantStdout   string
+		wantStderr   string
+		wantExitCode int
+	}{
+		"Output is written to stdout":  {command: "echo 'Hello!'", wantStdout: "Hello!"},
+		"Errors are written to stderr": {command: "echo 'Error!' >&2", wantStderr: "Error!"},
+		"Exit code is returned":        {command: "exit 42", wantExitCode: 42},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			b := s.newBackend(t)
+			distro := s.register(t, b)
+
+			stdout, stderr, exitCode := launch(t, b, distro, tc.command)
+			require.Equal(t, tc.wantStdout, strings.TrimSpace(stdout), "Unexpected stdout")
+			require.Equal(t, tc.wantStderr, strings.TrimSpace(stderr), "Unexpected stderr")
+			require.Equal(t, tc.wantExitCode, exitCode, "Unexpected exit code")
+		})
+	}
+
+	t.Run("Interactive commands return their exit code", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+		distro := s.register(t, b)
+
+		exitCode, err := b.WslLaunchInteractive(distro, "exit 42", false)
+		require.NoError(t, err, "WslLaunchInteractive should not have failed")
+		require.Equal(t, uint32(42), exitCode, "Unexpected exit code")
+	})
+
+	t.Run("Launching in an unregistered distro fails", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+		distro := s.distroName()
+
+		null, err := os.Open(os.DevNull)
+		require.NoError(t, err, "Setup: could not open null device")
+		defer null.Close()
+
+		_, err = b.WslLaunch(distro, "exit 0", false, null, null, null)
+		require.Error(t, err, "WslLaunch should have failed")
+
+		_, err = b.WslLaunchInteractive(distro, "exit 0", false)
+		require.Error(t, err, "WslLaunchInteractive should have failed")
+	})
+}
+
+func (s suite) testState(t *testing.T) {
+	t.Run("Distros run until they are terminated", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+		name := s.register(t, b)
+
+		_, _, _ = launch(t, b, name, "exit 0")
+		st, err := b.State(name)
+		require.NoError(t, err, "State should not have failed")
+		require.Equal(t, backend.Running, st, "Distro should be running after launching a command")
+
+		require.NoError(t, b.Terminate(name), "Terminate should not have failed")
+		st, err = b.State(name)
+		require.NoError(t, err, "State should not have failed")
+		require.Equal(t, backend.Stopped, st, "Distro should be stopped after terminating it")
+	})
+
+	t.Run("Shutdown stops all distros", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+		names := []string{s.register(t, b), s.register(t, b)}
+
+		for _, name := range names {
+			_, _, _ = launch(t, b, name, "exit 0")
+		}
+
+		require.NoError(t, b.Shutdown(), "Shutdown should not have failed")
+		for _, name := range names {
+			st, err := b.State(name)
+			require.NoError(t, err, "State should not have failed")
+			require.Equal(t, backend.Stopped, st, "Distro should be stopped after shutting WSL down")
+		}
+	})
+
+	t.Run("Operating on unregistered distros fails", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+		name := s.distroName()
+
+		st, err := b.State(name)
+		require.NoError(t, err, "State should not have failed")
+		require.Equal(t, backend.NotRegistered, st, "Unexpected state")
+
+		require.Error(t, b.Terminate(name), "Terminate should have failed")
+		require.Error(t, b.SetAsDefault(name), "SetAsDefault should have failed")
+	})
+}
+
+func (s suite) testRegistry(t *testing.T) {
+	t.Run("Distros are listed in the registry", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+		name := s.register(t, b)
+
+		guid := distroGUID(t, b, name)
+		require.NotEmpty(t, guid, "Distro should be listed in the registry")
+		require.NotEmpty(t, defaultDistroGUID(t, b), "There should be a default distro")
+
+		k, err := b.OpenLxssRegistry(guid)
+		require.NoError(t, err, "OpenLxssRegistry should not have failed")
+		defer k.Close()
+
+		_, err = k.Field("ThisFieldDoesNotExist")
+		require.Error(t, err, "Field should have failed on a missing field")
+	})
+
+	t.Run("Opening a missing key fails", func(t *testing.T) {
+		t.Parallel()
+		b := s.newBackend(t)
+
+		_, err := b.OpenLxssRegistry("{00000000-0000-0000-0000-000000000000}")
+		require.Error(t, err, "OpenLxssRegistry should have failed")
+	})
+}
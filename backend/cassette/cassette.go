@@ -0,0 +1,188 @@
+// Package cassette records the calls made to a back-end into a JSON cassette,
+// and replays them later with no WSL installation.
+//
+// Record a cassette on a Windows machine once by wrapping the real back-end with
+// a Recorder, and replay it anywhere, such as in Linux CI, with a Replayer:
+//
+//	r := cassette.NewRecorder(realBackend)
+//	ctx := wsl.WithBackend(ctx, r)
+//	// Run the code under test...
+//	err := r.Save("testdata/cassette.json")
+//
+//	c, err := cassette.Load("testdata/cassette.json")
+//	ctx := wsl.WithBackend(ctx, cassette.NewReplayer(c, cassette.WithTestingT(t)))
+//	// Run the same code under test...
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/backend"
+)
+
+// formatVersion is the version of the cassette format.
+const formatVersion = 1
+
+// Cassette is a recording of the calls made to a back-end, in the order they
+// were made.
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a call to a back-end, or to one of the registry keys it opened,
+// together with its outcome.
+//
+// The registry keys are identified by a number assigned when they are opened,
+// which is the first argument of the calls to their methods.
+type Interaction struct {
+	Method string          `json:"method"`           // Name of the method, prefixed with "RegistryKey." for registry keys
+	Args   json.RawMessage `json:"args,omitempty"`   // Arguments, as a JSON array
+	Result json.RawMessage `json:"result,omitempty"` // Results, in a format that depends on the method
+	Error  *Error          `json:"error,omitempty"`  // Error returned by the call, if any
+}
+
+// Error is an error returned by a recorded call.
+type Error struct {
+	Message string `json:"message"`
+	HRESULT uint32 `json:"hresult,omitempty"` // HRESULT wrapped by the error, if any
+}
+
+// newError records err. It returns nil if err is nil.
+func newError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	e := &Error{Message: err.Error()}
+	var hr backend.HRESULTError
+	if errors.As(err, &hr) {
+		e.HRESULT = uint32(hr)
+	}
+	return e
+}
+
+// err returns an error with the same message as the recorded one, which wraps
+// the same HRESULT.
+func (e *Error) err() error {
+	if e == nil {
+		return nil
+	}
+	return replayedError{message: e.Message, hresult: backend.HRESULTError(e.HRESULT)}
+}
+
+// replayedError is an error returned by a replayed call.
+type replayedError struct {
+	message string
+	hresult backend.HRESULTError
+}
+
+func (e replayedError) Error() string {
+	return e.message
+}
+
+func (e replayedError) Unwrap() error {
+	if e.hresult == 0 {
+		return nil
+	}
+	return e.hresult
+}
+
+// Results of the methods that return anything other than an error.
+type (
+	keyResult struct {
+		Key int `json:"key"`
+	}
+
+	stateResult struct {
+		State string `json:"state"`
+	}
+
+	configurationResult struct {
+		Version     uint8             `json:"version"`
+		DefaultUID  uint32            `json:"defaultUID"`
+		Flags       backend.WslFlags  `json:"flags"`
+		Environment map[string]string `json:"environment"`
+	}
+
+	launchResult struct {
+		Stdout   string `json:"stdout,omitempty"`
+		Stderr   string `json:"stderr,omitempty"`
+		ExitCode int    `json:"exitCode"`
+	}
+
+	launchInteractiveResult struct {
+		ExitCode uint32 `json:"exitCode"`
+	}
+)
+
+// parseState returns the state with the name printed by State.String.
+func parseState(name string) (backend.State, error) {
+	for _, s := range []backend.State{backend.Stopped, backend.Running, backend.Installing, backend.Uninstalling, backend.NotRegistered} {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return backend.NotRegistered, fmt.Errorf("unknown state %q", name)
+}
+
+// marshalArgs returns the arguments of a call as a compact JSON array.
+func marshalArgs(args ...any) (json.RawMessage, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(args)
+}
+
+// sameArgs returns true if both JSON arrays contain the same arguments.
+func sameArgs(a, b json.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	if len(a) > 0 {
+		if err := json.Compact(&ca, a); err != nil {
+			return false
+		}
+	}
+	if len(b) > 0 {
+		if err := json.Compact(&cb, b); err != nil {
+			return false
+		}
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
+
+// Load reads a cassette from a JSON file.
+func Load(path string) (c *Cassette, err error) {
+	defer decorate.OnError(&err, "could not load cassette %s", path)
+
+	out, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c = &Cassette{}
+	if err := json.Unmarshal(out, c); err != nil {
+		return nil, err
+	}
+	if c.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported cassette version %d", c.Version)
+	}
+
+	return c, nil
+}
+
+// Save writes the cassette into a JSON file.
+func (c *Cassette) Save(path string) (err error) {
+	defer decorate.OnError(&err, "could not save cassette %s", path)
+
+	out, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(out, '\n'), 0600)
+}
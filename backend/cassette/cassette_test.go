@@ -0,0 +1,164 @@
+package cassette_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/backend/cassette"
+	"github.com/ubuntu/gowsl/mock"
+)
+
+const emptyRootFs = "../../images/empty.tar.gz"
+
+// session is the outcome of the calls made by useDistro.
+type session struct {
+	Registered []string
+	Config     wsl.Configuration
+	Stdout     string
+	Stderr     string
+	ExitCode   int
+}
+
+// useDistro registers a distro and uses it, through the back-end in ctx.
+func useDistro(ctx context.Context, t *testing.T) session {
+	t.Helper()
+
+	d := wsl.NewDistro(ctx, "Ubuntu")
+	require.NoError(t, d.Register(emptyRootFs), "Register should not have failed")
+
+	var s session
+	distros, err := wsl.RegisteredDistros(ctx)
+	require.NoError(t, err, "RegisteredDistros should not have failed")
+	for _, d := range distros {
+		s.Registered = append(s.Registered, d.Name())
+	}
+
+	s.Config, err = d.GetConfiguration()
+	require.NoError(t, err, "GetConfiguration should not have failed")
+
+	out, err := d.Command(ctx, "echo 'Hello!'").Output()
+	require.NoError(t, err, "Output should not have failed")
+	s.Stdout = string(out)
+
+	cmd := d.Command(ctx, "echo 'Error!' >&2 && exit 42")
+	out, err = cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr, "CombinedOutput should have failed with an exit error")
+	s.Stderr = string(out)
+	s.ExitCode = exitErr.ExitCode()
+
+	ghost := wsl.NewDistro(ctx, "Ghost")
+	require.Error(t, ghost.Terminate(), "Terminate should have failed on an unregistered distro")
+
+	return s
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	r := cassette.NewRecorder(mock.New())
+	recorded := useDistro(wsl.WithBackend(context.Background(), r), t)
+	require.Equal(t, []string{"Ubuntu"}, recorded.Registered, "Setup: unexpected registered distros")
+	require.Equal(t, "Hello!\n", recorded.Stdout, "Setup: unexpected output")
+	require.Equal(t, 42, recorded.ExitCode, "Setup: unexpected exit code")
+	require.NoError(t, r.Save(path), "Save should not have failed")
+
+	c, err := cassette.Load(path)
+	require.NoError(t, err, "Load should not have failed")
+	require.NotEmpty(t, c.Interactions, "Cassette should contain the recorded calls")
+
+	replayer := cassette.NewReplayer(c, cassette.WithTestingT(t))
+	replayed := useDistro(wsl.WithBackend(context.Background(), replayer), t)
+	require.Equal(t, recorded, replayed, "Replaying should return the same results as recording")
+	replayer.AssertExhausted(t)
+}
+
+// fakeT records the errors reported by the replayer.
+type fakeT struct {
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestReplayUnexpectedCall(t *testing.T) {
+	t.Parallel()
+
+	r := cassette.NewRecorder(mock.New())
+	require.Error(t, r.Terminate("Ghost"), "Setup: Terminate should have failed on an unregistered distro")
+	require.NoError(t, r.Shutdown(), "Setup: Shutdown should not have failed")
+	c, err := r.Cassette()
+	require.NoError(t, err, "Cassette should not have failed")
+
+	var ft fakeT
+	replayer := cassette.NewReplayer(c, cassette.WithTestingT(&ft))
+
+	err = replayer.Terminate("Ubuntu")
+	require.ErrorIs(t, err, cassette.ErrUnexpectedCall, "Terminate should have failed with different arguments")
+	require.Len(t, ft.errors, 1, "The unexpected call should have been reported")
+
+	require.NoError(t, replayer.Shutdown(), "Shutdown should have been replayed")
+	require.Len(t, replayer.Remaining(), 1, "Terminate should not have been replayed")
+
+	var exhausted fakeT
+	replayer.AssertExhausted(&exhausted)
+	require.Len(t, exhausted.errors, 1, "The interaction left should have been reported")
+
+	require.Error(t, replayer.Terminate("Ghost"), "The recorded error should have been replayed")
+	require.Empty(t, replayer.Remaining(), "All interactions should have been replayed")
+
+	err = replayer.Shutdown()
+	require.ErrorIs(t, err, cassette.ErrUnexpectedCall, "Interactions should only be replayed once")
+}
+
+func TestReplayHRESULT(t *testing.T) {
+	t.Parallel()
+
+	const serviceBusy = 0x800700AA
+
+	m := mock.New()
+	m.InjectFault("Shutdown", mock.Fault{HRESULT: serviceBusy, Times: 1})
+
+	r := cassette.NewRecorder(m)
+	recordedErr := r.Shutdown()
+	require.Error(t, recordedErr, "Setup: Shutdown should have failed")
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	require.NoError(t, r.Save(path), "Save should not have failed")
+	c, err := cassette.Load(path)
+	require.NoError(t, err, "Load should not have failed")
+
+	err = cassette.NewReplayer(c).Shutdown()
+	require.EqualError(t, err, recordedErr.Error(), "The error message should have been replayed")
+
+	var hr backend.HRESULTError
+	require.True(t, errors.As(err, &hr), "The replayed error should wrap the HRESULT")
+	require.Equal(t, backend.HRESULTError(serviceBusy), hr, "Unexpected HRESULT")
+	require.True(t, backend.IsTransient(err), "Middlewares should see the replayed error as the recorded one")
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Parallel()
+
+	c := &cassette.Cassette{Version: 42}
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	require.NoError(t, c.Save(path), "Setup: Save should not have failed")
+
+	_, err := cassette.Load(path)
+	require.Error(t, err, "Load should have failed on an unsupported version")
+
+	_, err = cassette.Load(filepath.Join(t.TempDir(), "does-not-exist.json"))
+	require.Error(t, err, "Load should have failed on a missing file")
+}
@@ -0,0 +1,316 @@
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/internal/bridge"
+)
+
+// Recorder is a back-end that records all calls made to the wrapped back-end.
+// It is safe for concurrent use.
+//
+// The output of commands launched with WslLaunch is recorded once they exit,
+// so wait for them before saving the cassette. The output of commands launched
+// with WslLaunchInteractive is not recorded, only their exit code.
+type Recorder struct {
+	next backend.Backend
+
+	records []*record
+	keys    int // Number of registry keys opened so far
+	mu      sync.Mutex
+}
+
+// record is a call recorded in memory. Its result may be updated after the call
+// returns, so it is only marshalled when the cassette is built.
+type record struct {
+	method string
+	args   json.RawMessage
+	result any
+	err    *Error
+}
+
+// NewRecorder returns a back-end that records the calls made to b.
+func NewRecorder(b backend.Backend) *Recorder {
+	return &Recorder{next: b}
+}
+
+// Cassette returns the calls recorded so far.
+func (r *Recorder) Cassette() (*Cassette, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := &Cassette{Version: formatVersion, Interactions: make([]Interaction, 0, len(r.records))}
+	for _, rec := range r.records {
+		i := Interaction{Method: rec.method, Args: rec.args, Error: rec.err}
+		if rec.result != nil {
+			out, err := json.Marshal(rec.result)
+			if err != nil {
+				return nil, err
+			}
+			i.Result = out
+		}
+		c.Interactions = append(c.Interactions, i)
+	}
+
+	return c, nil
+}
+
+// Save writes the calls recorded so far into a JSON cassette.
+func (r *Recorder) Save(path string) error {
+	c, err := r.Cassette()
+	if err != nil {
+		return err
+	}
+	return c.Save(path)
+}
+
+// record appends a call to the cassette. The result is not recorded if the call failed.
+func (r *Recorder) record(method string, result any, err error, args ...any) *record {
+	a, marshalErr := marshalArgs(args...)
+	if marshalErr != nil {
+		// All arguments are strings, integers, booleans and lists of strings
+		panic(marshalErr)
+	}
+
+	rec := &record{method: method, args: a, err: newError(err)}
+	if err == nil {
+		rec.result = result
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, rec)
+
+	return rec
+}
+
+// OpenLxssRegistry opens a registry key, and records the calls to its methods.
+func (r *Recorder) OpenLxssRegistry(path string) (backend.RegistryKey, error) {
+	k, err := r.next.OpenLxssRegistry(path)
+
+	r.mu.Lock()
+	r.keys++
+	id := r.keys
+	r.mu.Unlock()
+
+	r.record("OpenLxssRegistry", keyResult{Key: id}, err, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recordedKey{next: k, id: id, recorder: r}, nil
+}
+
+// State records the state of a distro.
+func (r *Recorder) State(distributionName string) (backend.State, error) {
+	s, err := r.next.State(distributionName)
+	r.record("State", stateResult{State: s.String()}, err, distributionName)
+	return s, err
+}
+
+// Shutdown records shutting down WSL.
+func (r *Recorder) Shutdown() error {
+	err := r.next.Shutdown()
+	r.record("Shutdown", nil, err)
+	return err
+}
+
+// Terminate records terminating a distro.
+func (r *Recorder) Terminate(distroName string) error {
+	err := r.next.Terminate(distroName)
+	r.record("Terminate", nil, err, distroName)
+	return err
+}
+
+// SetAsDefault records setting the default distro.
+func (r *Recorder) SetAsDefault(distroName string) error {
+	err := r.next.SetAsDefault(distroName)
+	r.record("SetAsDefault", nil, err, distroName)
+	return err
+}
+
+// WslConfigureDistribution records configuring a distro.
+func (r *Recorder) WslConfigureDistribution(distributionName string, defaultUID uint32, wslDistributionFlags backend.WslFlags) error {
+	err := r.next.WslConfigureDistribution(distributionName, defaultUID, wslDistributionFlags)
+	r.record("WslConfigureDistribution", nil, err, distributionName, defaultUID, wslDistributionFlags)
+	return err
+}
+
+// WslGetDistributionConfiguration records the configuration of a distro.
+func (r *Recorder) WslGetDistributionConfiguration(distroName string, distributionVersion *uint8, defaultUID *uint32, wslDistributionFlags *backend.WslFlags, defaultEnvironmentVariables *map[string]string) error {
+	err := r.next.WslGetDistributionConfiguration(distroName, distributionVersion, defaultUID, wslDistributionFlags, defaultEnvironmentVariables)
+	r.record("WslGetDistributionConfiguration", configurationResult{
+		Version:     *distributionVersion,
+		DefaultUID:  *defaultUID,
+		Flags:       *wslDistributionFlags,
+		Environment: *defaultEnvironmentVariables,
+	}, err, distroName)
+	return err
+}
+
+// WslLaunch launches a command, and records its output and exit code.
+//
+// The command writes into pipes owned by the recorder, which copies its output into
+// stdout and stderr. The returned process exits once the command exits and all of
+// its output has been copied.
+func (r *Recorder) WslLaunch(distroName string, command string, useCWD bool, stdin *os.File, stdout *os.File, stderr *os.File) (p *os.Process, err error) {
+	return r.launch(func(stdout, stderr *os.File) (*os.Process, error) {
+		return r.next.WslLaunch(distroName, command, useCWD, stdin, stdout, stderr)
+	}, stdin, stdout, stderr, "WslLaunch", distroName, command, useCWD)
+}
+
+// WslLaunchEnv launches a command with additional environment variables, and
+// records its output and exit code. The variables are part of the arguments of
+// the call, so they are written into the cassette.
+func (r *Recorder) WslLaunchEnv(distroName string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (p *os.Process, err error) {
+	return r.launch(func(stdout, stderr *os.File) (*os.Process, error) {
+		return backend.WslLaunchEnv(r.next, distroName, command, useCWD, env, stdin, stdout, stderr)
+	}, stdin, stdout, stderr, "WslLaunchEnv", distroName, command, useCWD, env)
+}
+
+// WslLaunchAs launches a command as the named user, and records its output and
+// exit code. Like with WslLaunchEnv, the variables are written into the cassette.
+func (r *Recorder) WslLaunchAs(distroName string, user string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (p *os.Process, err error) {
+	return r.launch(func(stdout, stderr *os.File) (*os.Process, error) {
+		return backend.WslLaunchAs(r.next, distroName, user, command, useCWD, env, stdin, stdout, stderr)
+	}, stdin, stdout, stderr, "WslLaunchAs", distroName, user, command, useCWD, env)
+}
+
+// launch launches a command with start, which is passed the pipes the command
+// writes into, and records the call with the method and arguments.
+func (r *Recorder) launch(start func(stdout, stderr *os.File) (*os.Process, error), stdin *os.File, stdout *os.File, stderr *os.File, method string, args ...any) (p *os.Process, err error) {
+	result := &launchResult{}
+	defer func() {
+		r.record(method, result, err, args...)
+	}()
+
+	// The same file is used for both streams by CombinedOutput
+	combined := stdout == stderr
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	errR, errW := outR, outW
+	if !combined {
+		if errR, errW, err = os.Pipe(); err != nil {
+			outR.Close()
+			outW.Close()
+			return nil, err
+		}
+	}
+
+	process, err := start(outW, errW)
+	outW.Close()
+	errW.Close()
+	if err != nil {
+		outR.Close()
+		errR.Close()
+		return nil, err
+	}
+
+	p, err = bridge.Start(context.Background(), func(ctx context.Context, _ io.Reader, o, e io.Writer) int {
+		// Kill the command if the caller kills the process
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = process.Kill()
+			case <-done:
+			}
+		}()
+
+		var outBuf, errBuf bytes.Buffer
+		var wg sync.WaitGroup
+		copyOutput := func(w io.Writer, buf *bytes.Buffer, r *os.File) {
+			defer wg.Done()
+			defer r.Close()
+			_, _ = io.Copy(io.MultiWriter(w, buf), r)
+		}
+
+		wg.Add(1)
+		go copyOutput(o, &outBuf, outR)
+		if !combined {
+			wg.Add(1)
+			go copyOutput(e, &errBuf, errR)
+		}
+
+		state, waitErr := process.Wait()
+		wg.Wait()
+
+		exitCode := 255
+		if waitErr == nil {
+			exitCode = state.ExitCode()
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		result.Stdout = outBuf.String()
+		result.Stderr = errBuf.String()
+		result.ExitCode = exitCode
+
+		return exitCode
+	}, stdin, stdout, stderr)
+
+	if err != nil {
+		_ = process.Kill()
+		outR.Close()
+		errR.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// WslLaunchInteractive launches an interactive command, and records its exit code.
+func (r *Recorder) WslLaunchInteractive(distributionName string, command string, useCurrentWorkingDirectory bool) (uint32, error) {
+	exitCode, err := r.next.WslLaunchInteractive(distributionName, command, useCurrentWorkingDirectory)
+	r.record("WslLaunchInteractive", launchInteractiveResult{ExitCode: exitCode}, err, distributionName, command, useCurrentWorkingDirectory)
+	return exitCode, err
+}
+
+// WslRegisterDistribution records registering a distro.
+func (r *Recorder) WslRegisterDistribution(distributionName string, tarGzFilename string) error {
+	err := r.next.WslRegisterDistribution(distributionName, tarGzFilename)
+	r.record("WslRegisterDistribution", nil, err, distributionName, tarGzFilename)
+	return err
+}
+
+// WslUnregisterDistribution records unregistering a distro.
+func (r *Recorder) WslUnregisterDistribution(distributionName string) error {
+	err := r.next.WslUnregisterDistribution(distributionName)
+	r.record("WslUnregisterDistribution", nil, err, distributionName)
+	return err
+}
+
+// recordedKey is a registry key whose calls are recorded.
+type recordedKey struct {
+	next     backend.RegistryKey
+	id       int
+	recorder *Recorder
+}
+
+func (k *recordedKey) Close() error {
+	err := k.next.Close()
+	k.recorder.record("RegistryKey.Close", nil, err, k.id)
+	return err
+}
+
+func (k *recordedKey) Field(name string) (string, error) {
+	value, err := k.next.Field(name)
+	k.recorder.record("RegistryKey.Field", value, err, k.id, name)
+	return value, err
+}
+
+func (k *recordedKey) SubkeyNames() ([]string, error) {
+	subkeys, err := k.next.SubkeyNames()
+	k.recorder.record("RegistryKey.SubkeyNames", subkeys, err, k.id)
+	return subkeys, err
+}
@@ -0,0 +1,271 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/internal/bridge"
+)
+
+// ErrUnexpectedCall is the error returned by a Replayer when a call does not
+// match any of the remaining interactions of its cassette.
+var ErrUnexpectedCall = errors.New("unexpected call")
+
+// TestingT is the subset of testing.TB used to report unexpected calls.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Replayer is a back-end that replays the calls recorded in a cassette. It is
+// safe for concurrent use.
+//
+// Every call consumes the first interaction of the cassette with the same method
+// and arguments that has not been replayed yet, so calls with different arguments
+// may be made in a different order than they were recorded.
+type Replayer struct {
+	interactions []Interaction
+	replayed     []bool
+	t            TestingT
+	mu           sync.Mutex
+}
+
+type options struct {
+	t TestingT
+}
+
+// Option represents an optional function to override Replayer default values.
+type Option func(*options)
+
+// WithTestingT makes the replayer report unexpected calls as test errors, on
+// top of returning an error to the caller.
+func WithTestingT(t TestingT) Option {
+	return func(o *options) {
+		o.t = t
+	}
+}
+
+// NewReplayer returns a back-end that replays the calls recorded in c.
+func NewReplayer(c *Cassette, args ...Option) *Replayer {
+	var opts options
+	for _, f := range args {
+		f(&opts)
+	}
+
+	return &Replayer{
+		interactions: c.Interactions,
+		replayed:     make([]bool, len(c.Interactions)),
+		t:            opts.t,
+	}
+}
+
+// Remaining returns the interactions that have not been replayed yet.
+func (r *Replayer) Remaining() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var remaining []Interaction
+	for i, done := range r.replayed {
+		if !done {
+			remaining = append(remaining, r.interactions[i])
+		}
+	}
+	return remaining
+}
+
+// AssertExhausted reports a test error if some interactions have not been replayed.
+func (r *Replayer) AssertExhausted(t TestingT) {
+	t.Helper()
+
+	for _, i := range r.Remaining() {
+		t.Errorf("cassette: interaction was not replayed: %s %s", i.Method, i.Args)
+	}
+}
+
+// replay consumes the interaction matching the call, and decodes its result into
+// result, if not nil. It returns the error of the recorded call.
+func (r *Replayer) replay(result any, method string, args ...any) error {
+	a, err := marshalArgs(args...)
+	if err != nil {
+		// All arguments are strings, integers, booleans and lists of strings
+		panic(err)
+	}
+
+	i, err := r.consume(method, a)
+	if err != nil {
+		return err
+	}
+
+	if i.Error != nil {
+		return i.Error.err()
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(i.Result, result); err != nil {
+			return fmt.Errorf("cassette: could not decode result of %s %s: %v", method, a, err)
+		}
+	}
+
+	return nil
+}
+
+// consume marks the first unplayed interaction matching the call as replayed
+// and returns it.
+func (r *Replayer) consume(method string, args json.RawMessage) (Interaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, done := range r.replayed {
+		if done {
+			continue
+		}
+		if r.interactions[i].Method != method || !sameArgs(r.interactions[i].Args, args) {
+			continue
+		}
+		r.replayed[i] = true
+		return r.interactions[i], nil
+	}
+
+	if r.t != nil {
+		r.t.Helper()
+		r.t.Errorf("cassette: unexpected call to %s %s", method, args)
+	}
+
+	return Interaction{}, fmt.Errorf("cassette: %w to %s %s", ErrUnexpectedCall, method, args)
+}
+
+// OpenLxssRegistry replays opening a registry key.
+func (r *Replayer) OpenLxssRegistry(path string) (backend.RegistryKey, error) {
+	var res keyResult
+	if err := r.replay(&res, "OpenLxssRegistry", path); err != nil {
+		return nil, err
+	}
+	return replayedKey{id: res.Key, replayer: r}, nil
+}
+
+// State replays querying the state of a distro.
+func (r *Replayer) State(distributionName string) (backend.State, error) {
+	var res stateResult
+	if err := r.replay(&res, "State", distributionName); err != nil {
+		return backend.NotRegistered, err
+	}
+	return parseState(res.State)
+}
+
+// Shutdown replays shutting down WSL.
+func (r *Replayer) Shutdown() error {
+	return r.replay(nil, "Shutdown")
+}
+
+// Terminate replays terminating a distro.
+func (r *Replayer) Terminate(distroName string) error {
+	return r.replay(nil, "Terminate", distroName)
+}
+
+// SetAsDefault replays setting the default distro.
+func (r *Replayer) SetAsDefault(distroName string) error {
+	return r.replay(nil, "SetAsDefault", distroName)
+}
+
+// WslConfigureDistribution replays configuring a distro.
+func (r *Replayer) WslConfigureDistribution(distributionName string, defaultUID uint32, wslDistributionFlags backend.WslFlags) error {
+	return r.replay(nil, "WslConfigureDistribution", distributionName, defaultUID, wslDistributionFlags)
+}
+
+// WslGetDistributionConfiguration replays reading the configuration of a distro.
+func (r *Replayer) WslGetDistributionConfiguration(distroName string, distributionVersion *uint8, defaultUID *uint32, wslDistributionFlags *backend.WslFlags, defaultEnvironmentVariables *map[string]string) error {
+	var res configurationResult
+	if err := r.replay(&res, "WslGetDistributionConfiguration", distroName); err != nil {
+		return err
+	}
+
+	*distributionVersion = res.Version
+	*defaultUID = res.DefaultUID
+	*wslDistributionFlags = res.Flags
+	*defaultEnvironmentVariables = res.Environment
+
+	return nil
+}
+
+// WslLaunch replays a command: the returned process writes the recorded output
+// into stdout and stderr, and exits with the recorded exit code.
+func (r *Replayer) WslLaunch(distroName string, command string, useCWD bool, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	return r.launch(stdin, stdout, stderr, "WslLaunch", distroName, command, useCWD)
+}
+
+// WslLaunchEnv replays a command launched with additional environment variables.
+// The variables must match the recorded ones.
+func (r *Replayer) WslLaunchEnv(distroName string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	return r.launch(stdin, stdout, stderr, "WslLaunchEnv", distroName, command, useCWD, env)
+}
+
+// WslLaunchAs replays a command launched as the named user. The user and the
+// variables must match the recorded ones.
+func (r *Replayer) WslLaunchAs(distroName string, user string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	return r.launch(stdin, stdout, stderr, "WslLaunchAs", distroName, user, command, useCWD, env)
+}
+
+// launch replays a command launched with the method and arguments.
+func (r *Replayer) launch(stdin *os.File, stdout *os.File, stderr *os.File, method string, args ...any) (*os.Process, error) {
+	var res launchResult
+	if err := r.replay(&res, method, args...); err != nil {
+		return nil, err
+	}
+
+	return bridge.Start(context.Background(), func(_ context.Context, _ io.Reader, o, e io.Writer) int {
+		_, _ = io.WriteString(o, res.Stdout)
+		_, _ = io.WriteString(e, res.Stderr)
+		return res.ExitCode
+	}, stdin, stdout, stderr)
+}
+
+// WslLaunchInteractive replays an interactive command, returning the recorded exit code.
+func (r *Replayer) WslLaunchInteractive(distributionName string, command string, useCurrentWorkingDirectory bool) (uint32, error) {
+	var res launchInteractiveResult
+	if err := r.replay(&res, "WslLaunchInteractive", distributionName, command, useCurrentWorkingDirectory); err != nil {
+		return 0, err
+	}
+	return res.ExitCode, nil
+}
+
+// WslRegisterDistribution replays registering a distro.
+func (r *Replayer) WslRegisterDistribution(distributionName string, tarGzFilename string) error {
+	return r.replay(nil, "WslRegisterDistribution", distributionName, tarGzFilename)
+}
+
+// WslUnregisterDistribution replays unregistering a distro.
+func (r *Replayer) WslUnregisterDistribution(distributionName string) error {
+	return r.replay(nil, "WslUnregisterDistribution", distributionName)
+}
+
+// replayedKey is a registry key whose calls are replayed.
+type replayedKey struct {
+	id       int
+	replayer *Replayer
+}
+
+func (k replayedKey) Close() error {
+	return k.replayer.replay(nil, "RegistryKey.Close", k.id)
+}
+
+func (k replayedKey) Field(name string) (string, error) {
+	var value string
+	if err := k.replayer.replay(&value, "RegistryKey.Field", k.id, name); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func (k replayedKey) SubkeyNames() ([]string, error) {
+	var subkeys []string
+	if err := k.replayer.replay(&subkeys, "RegistryKey.SubkeyNames", k.id); err != nil {
+		return nil, err
+	}
+	return subkeys, nil
+}
@@ -0,0 +1,69 @@
+package backend
+
+// This file contains the optional interface of the back-ends that can launch
+// commands with environment variables of their own.
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvLauncher is implemented by the back-ends that can launch commands with
+// additional environment variables. WSL forwards into the distro the variables
+// listed in WSLENV.
+//
+// WslLaunch launches commands with the environment of the current process, which
+// is shared by all goroutines. EnvLauncher lets GoWSL launch commands with other
+// variables without modifying it.
+type EnvLauncher interface {
+	// WslLaunchEnv is WslLaunch, except that the variables in env, in the form
+	// "key=value", are added to the environment of the process that launches WSL.
+	// See AppendEnv.
+	WslLaunchEnv(distroName string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error)
+}
+
+// WslLaunchEnv launches a command with additional environment variables if the
+// back-end is an EnvLauncher, and fails otherwise.
+func WslLaunchEnv(b Backend, distroName string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	l, ok := b.(EnvLauncher)
+	if !ok {
+		return nil, fmt.Errorf("back-end %T cannot launch commands with environment variables", b)
+	}
+	return l.WslLaunchEnv(distroName, command, useCWD, env, stdin, stdout, stderr)
+}
+
+// AppendEnv returns the environment base, such as os.Environ(), with the variables
+// in env added, as EnvLauncher implementations launch WSL with. Variables in env
+// replace those in base, except for WSLENV, which is appended to the one in base
+// so that the variables it already forwards still are.
+func AppendEnv(base []string, env []string) []string {
+	out := append([]string{}, base...)
+
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.EqualFold(name, "WSLENV") || value == "" {
+			out = append(out, kv)
+			continue
+		}
+
+		if current := lookupEnv(out, "WSLENV"); current != "" {
+			value = current + ":" + value
+		}
+		out = append(out, name+"="+value)
+	}
+
+	// Later entries take precedence when launching a process
+	return out
+}
+
+// lookupEnv returns the value of the last entry for the named variable in env.
+// Names are compared case-insensitively, as Windows does.
+func lookupEnv(env []string, name string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if n, value, _ := strings.Cut(env[i], "="); strings.EqualFold(n, name) {
+			return value
+		}
+	}
+	return ""
+}
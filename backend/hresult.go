@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HRESULTError is the error returned by a Win32 call that failed with this HRESULT.
+type HRESULTError uint32
+
+func (e HRESULTError) Error() string {
+	return fmt.Sprintf("HRESULT 0x%08X", uint32(e))
+}
+
+// HRESULTs that signal that the WSL service could not handle a call at the
+// time, but may handle it if retried.
+const (
+	hrErrorBusy               HRESULTError = 0x800700AA // HRESULT_FROM_WIN32(ERROR_BUSY)
+	hrWaitTimeout             HRESULTError = 0x80070102 // HRESULT_FROM_WIN32(WAIT_TIMEOUT)
+	hrServiceCannotAcceptCtrl HRESULTError = 0x80070425 // HRESULT_FROM_WIN32(ERROR_SERVICE_CANNOT_ACCEPT_CTRL)
+	hrRPCServerUnavailable    HRESULTError = 0x800706BA // HRESULT_FROM_WIN32(RPC_S_SERVER_UNAVAILABLE)
+	hrRPCServerTooBusy        HRESULTError = 0x800706BB // HRESULT_FROM_WIN32(RPC_S_SERVER_TOO_BUSY)
+	hrRPCCallRejected         HRESULTError = 0x80010001 // RPC_E_CALL_REJECTED
+	hrRPCServerCallRetryLater HRESULTError = 0x8001010A // RPC_E_SERVERCALL_RETRYLATER
+)
+
+// IsTransient returns true if err contains an HRESULTError that signals that
+// the WSL service was busy or unavailable, so the call may succeed if retried.
+func IsTransient(err error) bool {
+	var hr HRESULTError
+	if !errors.As(err, &hr) {
+		return false
+	}
+
+	switch hr {
+	case hrErrorBusy, hrWaitTimeout, hrServiceCannotAcceptCtrl, hrRPCServerUnavailable,
+		hrRPCServerTooBusy, hrRPCCallRejected, hrRPCServerCallRetryLater:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+package backend
+
+// This file contains the middleware mechanism, used to wrap a back-end with
+// behaviour common to all of its calls.
+
+import (
+	"os"
+	"sync"
+)
+
+// Middleware wraps a back-end, returning another one with added behaviour.
+type Middleware func(Backend) Backend
+
+// Chain wraps b with the middlewares. The first middleware is the outermost one,
+// so in Chain(b, Logging(l), Retry(p)) every attempt is retried within a single
+// logged call.
+func Chain(b Backend, mws ...Middleware) Backend {
+	for i := len(mws) - 1; i >= 0; i-- {
+		b = mws[i](b)
+	}
+	return b
+}
+
+// API is the interface through which a back-end call reaches WSL.
+type API string
+
+// The APIs through which a call can reach WSL.
+const (
+	APIRegistry API = "registry" // The registry, via OpenLxssRegistry and RegistryKey
+	APIWslExe   API = "wsl.exe"  // wsl.exe, via State, Shutdown, Terminate and SetAsDefault
+	APIWin32    API = "Win32"    // The Win32 API in wslapi.dll, via the Wsl* methods
+)
+
+// Call describes a call to a method of a back-end or of one of its registry keys.
+type Call struct {
+	Method string // Name of the method, such as "WslLaunch" or "Field"
+	API    API    // Interface through which the call reaches WSL
+	Args   []any  // Arguments of the call, except for streams and output pointers
+}
+
+// Interceptor intercepts a call to a back-end. It must call invoke to perform
+// the call (which may be done any number of times, including zero) and return
+// the error to report to the caller.
+//
+// The results of the call are only returned to the caller if the error is nil,
+// and only after invoke has returned.
+type Interceptor func(call Call, invoke func() error) error
+
+// Intercept returns a middleware that passes every call to the back-end and to
+// the registry keys it opens through the interceptor.
+func Intercept(i Interceptor) Middleware {
+	return func(b Backend) Backend {
+		return &intercepted{next: b, intercept: i}
+	}
+}
+
+// intercepted is a back-end that passes every call through an interceptor. It is
+// used through a pointer so that back-ends, and the distros that hold them,
+// remain comparable.
+type intercepted struct {
+	next      Backend
+	intercept Interceptor
+}
+
+func (b *intercepted) OpenLxssRegistry(path string) (RegistryKey, error) {
+	// Keys that are not returned to the caller must be closed, as they may hold
+	// resources such as the mock's locks.
+	k := newResult(func(k RegistryKey) { _ = k.Close() })
+	err := b.intercept(Call{Method: "OpenLxssRegistry", API: APIRegistry, Args: []any{path}}, func() error {
+		key, err := b.next.OpenLxssRegistry(path)
+		if err == nil {
+			k.set(key)
+		}
+		return err
+	})
+
+	key, ok := k.take(err)
+	if !ok {
+		return nil, err
+	}
+	return &interceptedKey{next: key, path: path, intercept: b.intercept}, nil
+}
+
+func (b *intercepted) State(distributionName string) (State, error) {
+	var s State
+	err := b.intercept(Call{Method: "State", API: APIWslExe, Args: []any{distributionName}}, func() (err error) {
+		s, err = b.next.State(distributionName)
+		return err
+	})
+	if err != nil {
+		return NotRegistered, err
+	}
+	return s, nil
+}
+
+func (b *intercepted) Shutdown() error {
+	return b.intercept(Call{Method: "Shutdown", API: APIWslExe}, b.next.Shutdown)
+}
+
+func (b *intercepted) Terminate(distroName string) error {
+	return b.intercept(Call{Method: "Terminate", API: APIWslExe, Args: []any{distroName}}, func() error {
+		return b.next.Terminate(distroName)
+	})
+}
+
+func (b *intercepted) SetAsDefault(distroName string) error {
+	return b.intercept(Call{Method: "SetAsDefault", API: APIWslExe, Args: []any{distroName}}, func() error {
+		return b.next.SetAsDefault(distroName)
+	})
+}
+
+func (b *intercepted) WslConfigureDistribution(distributionName string, defaultUID uint32, wslDistributionFlags WslFlags) error {
+	call := Call{Method: "WslConfigureDistribution", API: APIWin32, Args: []any{distributionName, defaultUID, wslDistributionFlags}}
+	return b.intercept(call, func() error {
+		return b.next.WslConfigureDistribution(distributionName, defaultUID, wslDistributionFlags)
+	})
+}
+
+func (b *intercepted) WslGetDistributionConfiguration(distroName string, distributionVersion *uint8, defaultUID *uint32, wslDistributionFlags *WslFlags, defaultEnvironmentVariables *map[string]string) error {
+	// The call writes into its own variables, so that the outputs are left untouched
+	// if the interceptor returns before it finishes.
+	var version uint8
+	var uid uint32
+	var f WslFlags
+	var env map[string]string
+
+	err := b.intercept(Call{Method: "WslGetDistributionConfiguration", API: APIWin32, Args: []any{distroName}}, func() error {
+		return b.next.WslGetDistributionConfiguration(distroName, &version, &uid, &f, &env)
+	})
+	if err != nil {
+		return err
+	}
+
+	*distributionVersion = version
+	*defaultUID = uid
+	*wslDistributionFlags = f
+	*defaultEnvironmentVariables = env
+
+	return nil
+}
+
+func (b *intercepted) WslLaunch(distroName string, command string, useCWD bool, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	return b.launch(Call{Method: "WslLaunch", API: APIWin32, Args: []any{distroName, command, useCWD}}, func() (*os.Process, error) {
+		return b.next.WslLaunch(distroName, command, useCWD, stdin, stdout, stderr)
+	})
+}
+
+func (b *intercepted) WslLaunchEnv(distroName string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	// The values of the variables are left out of the call, as they may be secrets
+	return b.launch(Call{Method: "WslLaunchEnv", API: APIWslExe, Args: []any{distroName, command, useCWD}}, func() (*os.Process, error) {
+		return WslLaunchEnv(b.next, distroName, command, useCWD, env, stdin, stdout, stderr)
+	})
+}
+
+func (b *intercepted) WslLaunchAs(distroName string, user string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	// The values of the variables are left out of the call, as they may be secrets
+	return b.launch(Call{Method: "WslLaunchAs", API: APIWslExe, Args: []any{distroName, user, command, useCWD}}, func() (*os.Process, error) {
+		return WslLaunchAs(b.next, distroName, user, command, useCWD, env, stdin, stdout, stderr)
+	})
+}
+
+// launch passes a call that launches a process through the interceptor.
+func (b *intercepted) launch(call Call, invoke func() (*os.Process, error)) (*os.Process, error) {
+	// Processes that are not returned to the caller must be killed and released,
+	// as nobody else will wait for them.
+	p := newResult(func(p *os.Process) {
+		_ = p.Kill()
+		_, _ = p.Wait()
+	})
+	err := b.intercept(call, func() error {
+		process, err := invoke()
+		if err == nil {
+			p.set(process)
+		}
+		return err
+	})
+
+	process, ok := p.take(err)
+	if !ok {
+		return nil, err
+	}
+	return process, nil
+}
+
+func (b *intercepted) WslLaunchInteractive(distributionName string, command string, useCurrentWorkingDirectory bool) (uint32, error) {
+	var exitCode uint32
+	call := Call{Method: "WslLaunchInteractive", API: APIWin32, Args: []any{distributionName, command, useCurrentWorkingDirectory}}
+	err := b.intercept(call, func() (err error) {
+		exitCode, err = b.next.WslLaunchInteractive(distributionName, command, useCurrentWorkingDirectory)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return exitCode, nil
+}
+
+func (b *intercepted) WslRegisterDistribution(distributionName string, tarGzFilename string) error {
+	return b.intercept(Call{Method: "WslRegisterDistribution", API: APIWin32, Args: []any{distributionName, tarGzFilename}}, func() error {
+		return b.next.WslRegisterDistribution(distributionName, tarGzFilename)
+	})
+}
+
+func (b *intercepted) WslUnregisterDistribution(distributionName string) error {
+	return b.intercept(Call{Method: "WslUnregisterDistribution", API: APIWin32, Args: []any{distributionName}}, func() error {
+		return b.next.WslUnregisterDistribution(distributionName)
+	})
+}
+
+// result holds a resource obtained by a call that the interceptor may give up on,
+// such as a registry key or a process. Resources that do not reach the caller are
+// released: the ones replaced by a later attempt, the ones obtained before the
+// interceptor failed, and the ones obtained after it returned.
+type result[T any] struct {
+	mu      sync.Mutex
+	value   T
+	ok      bool
+	taken   bool
+	release func(T)
+}
+
+func newResult[T any](release func(T)) *result[T] {
+	return &result[T]{release: release}
+}
+
+// set stores the resource obtained by an invocation of the call.
+func (r *result[T]) set(v T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.taken {
+		// The interceptor already returned: nobody will use the resource.
+		r.release(v)
+		return
+	}
+	if r.ok {
+		r.release(r.value)
+	}
+	r.value, r.ok = v, true
+}
+
+// take returns the resource if the interceptor succeeded, and releases it
+// otherwise. Any resource set afterwards is released.
+func (r *result[T]) take(err error) (v T, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.taken = true
+	if !r.ok {
+		return v, false
+	}
+	if err != nil {
+		r.release(r.value)
+		return v, false
+	}
+	return r.value, true
+}
+
+// interceptedKey is a registry key that passes every call through an interceptor.
+type interceptedKey struct {
+	next      RegistryKey
+	path      string // Path the key was opened with, for the calls' arguments
+	intercept Interceptor
+}
+
+func (k *interceptedKey) Close() error {
+	return k.intercept(Call{Method: "Close", API: APIRegistry, Args: []any{k.path}}, k.next.Close)
+}
+
+func (k *interceptedKey) Field(name string) (string, error) {
+	var value string
+	err := k.intercept(Call{Method: "Field", API: APIRegistry, Args: []any{k.path, name}}, func() (err error) {
+		value, err = k.next.Field(name)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func (k *interceptedKey) SubkeyNames() ([]string, error) {
+	var subkeys []string
+	err := k.intercept(Call{Method: "SubkeyNames", API: APIRegistry, Args: []any{k.path}}, func() (err error) {
+		subkeys, err = k.next.SubkeyNames()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subkeys, nil
+}
@@ -0,0 +1,290 @@
+package backend_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/mock"
+)
+
+const emptyRootFs = "../images/empty.tar.gz"
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	var order []string
+	tracer := func(name string) backend.Middleware {
+		return backend.Intercept(func(call backend.Call, invoke func() error) error {
+			order = append(order, name+" before "+call.Method)
+			err := invoke()
+			order = append(order, name+" after "+call.Method)
+			return err
+		})
+	}
+
+	b := backend.Chain(mock.New(), tracer("outer"), tracer("inner"))
+
+	err := b.Shutdown()
+	require.NoError(t, err, "Shutdown should not have failed")
+	require.Equal(t, []string{"outer before Shutdown", "inner before Shutdown", "inner after Shutdown", "outer after Shutdown"},
+		order, "Middlewares should have been called from the outermost to the innermost")
+
+	m := mock.New()
+	require.Same(t, m, backend.Chain(m), "Chain without middlewares should return the back-end itself")
+}
+
+func TestIntercept(t *testing.T) {
+	t.Parallel()
+
+	m := mock.New()
+	err := m.WslRegisterDistribution("Ubuntu", emptyRootFs)
+	require.NoError(t, err, "Setup: could not register distro")
+
+	var calls []backend.Call
+	b := backend.Chain(m, backend.Intercept(func(call backend.Call, invoke func() error) error {
+		calls = append(calls, call)
+		return invoke()
+	}))
+
+	root, err := b.OpenLxssRegistry(".")
+	require.NoError(t, err, "OpenLxssRegistry should not have failed")
+	guid, err := root.Field("DefaultDistribution")
+	require.NoError(t, err, "Field should not have failed")
+	require.NoError(t, root.Close(), "Close should not have failed")
+
+	var version uint8
+	var uid uint32
+	var f backend.WslFlags
+	var env map[string]string
+	err = b.WslGetDistributionConfiguration("Ubuntu", &version, &uid, &f, &env)
+	require.NoError(t, err, "WslGetDistributionConfiguration should not have failed")
+	require.Equal(t, uint8(2), version, "Outputs should have been written")
+	require.NotEmpty(t, env, "Outputs should have been written")
+
+	s, err := b.State("Ubuntu")
+	require.NoError(t, err, "State should not have failed")
+	require.Equal(t, backend.Stopped, s, "Unexpected state")
+
+	require.Equal(t, []backend.Call{
+		{Method: "OpenLxssRegistry", API: backend.APIRegistry, Args: []any{"."}},
+		{Method: "Field", API: backend.APIRegistry, Args: []any{".", "DefaultDistribution"}},
+		{Method: "Close", API: backend.APIRegistry, Args: []any{"."}},
+		{Method: "WslGetDistributionConfiguration", API: backend.APIWin32, Args: []any{"Ubuntu"}},
+		{Method: "State", API: backend.APIWslExe, Args: []any{"Ubuntu"}},
+	}, calls, "Unexpected intercepted calls")
+	require.NotEmpty(t, guid, "Field should have returned the value")
+
+	// An interceptor that does not invoke the call
+	failing := backend.Chain(m, backend.Intercept(func(call backend.Call, invoke func() error) error {
+		return errors.New("rejected")
+	}))
+
+	err = failing.Terminate("Ubuntu")
+	require.Error(t, err, "Terminate should have failed")
+	m.AssertNumberOfCalls(t, 0, "Terminate")
+}
+
+func TestLogging(t *testing.T) {
+	t.Parallel()
+
+	m := mock.New()
+	var out bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	b := backend.Chain(m, backend.Logging(logger))
+
+	err := b.WslRegisterDistribution("Ubuntu", emptyRootFs)
+	require.NoError(t, err, "WslRegisterDistribution should not have failed")
+
+	err = b.Terminate("Ghost")
+	require.Error(t, err, "Terminate should have failed on an unregistered distro")
+
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var e map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &e), "Log entries should be valid JSON")
+		entries = append(entries, e)
+	}
+	require.Len(t, entries, 2, "Every call should have been logged")
+
+	require.Equal(t, "DEBUG", entries[0]["level"], "Successful calls should be logged at the debug level")
+	require.Equal(t, "WslRegisterDistribution", entries[0]["msg"], "Unexpected method")
+	require.Equal(t, "Win32", entries[0]["api"], "Unexpected API")
+	require.Equal(t, []any{"Ubuntu", emptyRootFs}, entries[0]["args"], "Unexpected arguments")
+	require.Contains(t, entries[0], "duration", "The duration should have been logged")
+	require.NotContains(t, entries[0], "error", "No error should have been logged")
+
+	require.Equal(t, "WARN", entries[1]["level"], "Failed calls should be logged at the warning level")
+	require.Equal(t, "Terminate", entries[1]["msg"], "Unexpected method")
+	require.Equal(t, "wsl.exe", entries[1]["api"], "Unexpected API")
+	require.Contains(t, entries[1], "error", "The error should have been logged")
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	const (
+		serviceBusy  = 0x800700AA
+		accessDenied = 0x80070005
+	)
+
+	testCases := map[string]struct {
+		fault     mock.Fault
+		retryable func(error) bool
+
+		wantAttempts int
+		wantSleeps   []time.Duration
+		wantErr      bool
+	}{
+		"Success on the first attempt is not retried": {wantAttempts: 1},
+		"Transient error is retried with backoff":     {fault: mock.Fault{HRESULT: serviceBusy, Times: 2}, wantAttempts: 3, wantSleeps: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}},
+		"Backoff is capped":                           {fault: mock.Fault{HRESULT: serviceBusy, Times: 3}, wantAttempts: 4, wantSleeps: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond}},
+		"Custom retryable errors are retried":         {fault: mock.Fault{HRESULT: accessDenied, Times: 1}, retryable: func(error) bool { return true }, wantAttempts: 2, wantSleeps: []time.Duration{10 * time.Millisecond}},
+		"Error on exhausting the attempts":            {fault: mock.Fault{HRESULT: serviceBusy}, wantAttempts: 5, wantSleeps: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond, 25 * time.Millisecond}, wantErr: true},
+		"Error on non-transient errors without retry": {fault: mock.Fault{HRESULT: accessDenied}, wantAttempts: 1, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m := mock.New()
+			err := m.WslRegisterDistribution("Ubuntu", emptyRootFs)
+			require.NoError(t, err, "Setup: could not register distro")
+			if tc.fault != (mock.Fault{}) {
+				m.InjectFault("Terminate", tc.fault)
+			}
+
+			var sleeps []time.Duration
+			b := backend.Chain(m, backend.Retry(backend.RetryPolicy{
+				Attempts:       5,
+				InitialBackoff: 10 * time.Millisecond,
+				MaxBackoff:     25 * time.Millisecond,
+				Retryable:      tc.retryable,
+				Sleep:          func(d time.Duration) { sleeps = append(sleeps, d) },
+			}))
+
+			err = b.Terminate("Ubuntu")
+			if tc.wantErr {
+				require.Error(t, err, "Terminate should have failed")
+			} else {
+				require.NoError(t, err, "Terminate should not have failed")
+			}
+
+			m.AssertNumberOfCalls(t, tc.wantAttempts, "Terminate")
+			require.Equal(t, tc.wantSleeps, sleeps, "Unexpected waits between attempts")
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+
+	m := mock.New()
+	m.InjectFault("Shutdown", mock.Fault{Delay: time.Second, Times: 1})
+	b := backend.Chain(m, backend.Timeout(10*time.Millisecond))
+
+	err := b.Shutdown()
+	require.ErrorIs(t, err, backend.ErrTimeout, "Shutdown should have timed out")
+
+	err = b.Shutdown()
+	require.NoError(t, err, "Shutdown should not have timed out")
+
+	// A failing call is not a timeout
+	err = b.Terminate("Ghost")
+	require.Error(t, err, "Terminate should have failed on an unregistered distro")
+	require.NotErrorIs(t, err, backend.ErrTimeout, "Terminate should not have timed out")
+}
+
+func TestTimeoutReleasesLateResults(t *testing.T) {
+	t.Parallel()
+
+	m := mock.New()
+	require.NoError(t, m.WslRegisterDistribution("Ubuntu", emptyRootFs), "Setup: could not register distro")
+
+	killed := make(chan struct{})
+	m.HandleCommand("sleep infinity", func(ctx context.Context, _ io.Reader, _, _ io.Writer) int {
+		<-ctx.Done()
+		close(killed)
+		return 1
+	})
+
+	m.InjectFault("OpenLxssRegistry", mock.Fault{Delay: 100 * time.Millisecond, Times: 1})
+	m.InjectFault("WslLaunch", mock.Fault{Delay: 100 * time.Millisecond, Times: 1})
+	b := backend.Chain(m, backend.Timeout(10*time.Millisecond))
+
+	_, err := b.OpenLxssRegistry(".")
+	require.ErrorIs(t, err, backend.ErrTimeout, "OpenLxssRegistry should have timed out")
+
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	require.NoError(t, err, "Setup: could not open the null device")
+	defer null.Close()
+
+	_, err = b.WslLaunch("Ubuntu", "sleep infinity", false, null, null, null)
+	require.ErrorIs(t, err, backend.ErrTimeout, "WslLaunch should have timed out")
+
+	// The key opened late holds a read lock on the registry until it is closed
+	registered := make(chan error, 1)
+	go func() { registered <- m.WslRegisterDistribution("Debian", emptyRootFs) }()
+	select {
+	case err := <-registered:
+		require.NoError(t, err, "WslRegisterDistribution should not have failed")
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "The registry key opened after the timeout should have been closed")
+	}
+
+	select {
+	case <-killed:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "The process launched after the timeout should have been killed")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	type metric struct {
+		method string
+		failed bool
+	}
+
+	var mu sync.Mutex
+	var got []metric
+	b := backend.Chain(mock.New(), backend.Metrics(func(call backend.Call, d time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		require.GreaterOrEqual(t, d, time.Duration(0), "Durations should not be negative")
+		got = append(got, metric{method: call.Method, failed: err != nil})
+	}))
+
+	require.NoError(t, b.WslRegisterDistribution("Ubuntu", emptyRootFs), "WslRegisterDistribution should not have failed")
+	require.Error(t, b.SetAsDefault("Ghost"), "SetAsDefault should have failed on an unregistered distro")
+	require.NoError(t, b.WslUnregisterDistribution("Ubuntu"), "WslUnregisterDistribution should not have failed")
+
+	require.Equal(t, []metric{
+		{method: "WslRegisterDistribution"},
+		{method: "SetAsDefault", failed: true},
+		{method: "WslUnregisterDistribution"},
+	}, got, "Unexpected metrics")
+}
+
+func TestIsTransient(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, backend.IsTransient(backend.HRESULTError(0x800700AA)), "ERROR_BUSY should be transient")
+	require.True(t, backend.IsTransient(errors.Join(errors.New("failed syscall"), backend.HRESULTError(0x8001010A))), "Wrapped HRESULTs should be recognised")
+	require.False(t, backend.IsTransient(backend.HRESULTError(0x80070005)), "E_ACCESSDENIED should not be transient")
+	require.False(t, backend.IsTransient(errors.New("failed syscall")), "Errors without an HRESULT should not be transient")
+}
@@ -0,0 +1,137 @@
+package backend
+
+// This file contains the middlewares provided out of the box.
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Logging returns a middleware that logs every call with its arguments and
+// duration: successful calls at the debug level, and failed ones at the warning
+// level.
+func Logging(logger *slog.Logger) Middleware {
+	return Intercept(func(call Call, invoke func() error) error {
+		start := time.Now()
+		err := invoke()
+
+		attrs := []any{
+			slog.String("api", string(call.API)),
+			slog.Any("args", call.Args),
+			slog.Duration("duration", time.Since(start)),
+		}
+
+		if err != nil {
+			logger.Warn(call.Method, append(attrs, slog.Any("error", err))...)
+			return err
+		}
+
+		logger.Debug(call.Method, attrs...)
+		return nil
+	})
+}
+
+// RetryPolicy decides which failed calls are retried, and how long to wait
+// between attempts. The wait starts at InitialBackoff and is multiplied by
+// Multiplier after every attempt, up to MaxBackoff.
+type RetryPolicy struct {
+	Attempts       int           // Maximum number of attempts, including the first one. Defaults to 3.
+	InitialBackoff time.Duration // Wait before the second attempt. Defaults to 100ms.
+	MaxBackoff     time.Duration // Maximum wait between attempts. Defaults to 2s.
+	Multiplier     float64       // Growth of the wait after every attempt. Defaults to 2.
+
+	// Retryable returns true if a call that failed with err should be retried.
+	// Defaults to IsTransient.
+	Retryable func(err error) bool
+
+	// Sleep waits between attempts. Defaults to time.Sleep.
+	Sleep func(time.Duration)
+}
+
+// Retry returns a middleware that retries the calls that fail with a retryable
+// error, as decided by the policy. Unset fields of the policy take their default
+// values.
+func Retry(p RetryPolicy) Middleware {
+	if p.Attempts <= 0 {
+		p.Attempts = 3
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 2 * time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.Retryable == nil {
+		p.Retryable = IsTransient
+	}
+	if p.Sleep == nil {
+		p.Sleep = time.Sleep
+	}
+
+	return Intercept(func(call Call, invoke func() error) error {
+		backoff := p.InitialBackoff
+
+		var err error
+		for attempt := 1; ; attempt++ {
+			err = invoke()
+			if err == nil || attempt >= p.Attempts || !p.Retryable(err) {
+				return err
+			}
+
+			p.Sleep(backoff)
+			backoff = time.Duration(float64(backoff) * p.Multiplier)
+			if backoff > p.MaxBackoff {
+				backoff = p.MaxBackoff
+			}
+		}
+	})
+}
+
+// ErrTimeout is the error returned by calls that exceed the time allowed by
+// the Timeout middleware.
+var ErrTimeout = errors.New("back-end call timed out")
+
+// Timeout returns a middleware that makes calls fail with ErrTimeout when they
+// take longer than d.
+//
+// The calls cannot be cancelled, so they keep running in the background and their
+// results are discarded. A registry key opened or a process launched after the
+// timeout is released instead: the key is closed, and the process is killed and
+// waited for.
+func Timeout(d time.Duration) Middleware {
+	return Intercept(func(call Call, invoke func() error) error {
+		done := make(chan error, 1)
+		go func() { done <- invoke() }()
+
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case err := <-done:
+			return err
+		case <-timer.C:
+			// Wait for the call in the background, so that the back-end releases
+			// whatever it obtains once it returns.
+			go func() { <-done }()
+			return fmt.Errorf("%s: %w after %s", call.Method, ErrTimeout, d)
+		}
+	})
+}
+
+// MetricsHook receives the outcome of every call to a back-end.
+type MetricsHook func(call Call, duration time.Duration, err error)
+
+// Metrics returns a middleware that reports every call to the hook once it finishes.
+func Metrics(hook MetricsHook) Middleware {
+	return Intercept(func(call Call, invoke func() error) error {
+		start := time.Now()
+		err := invoke()
+		hook(call, time.Since(start), err)
+		return err
+	})
+}
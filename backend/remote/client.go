@@ -0,0 +1,337 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/internal/bridge"
+)
+
+// exitError is the exit code of the commands whose exit code could not be
+// obtained from the server: -1, truncated to a byte as in wsl.exe.
+const exitError = 255
+
+// Client is a back-end that forwards every call to a Server.
+type Client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+type options struct {
+	httpClient *http.Client
+}
+
+// Option represents an optional function to override Client default values.
+type Option func(*options)
+
+// WithHTTPClient sets the HTTP client used to make the requests, for instance to
+// trust the certificate of the server. Otherwise, http.DefaultClient is used.
+//
+// The client must not have a timeout, as the requests that stream the output of
+// commands last for as long as the commands run.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = c
+	}
+}
+
+// NewClient returns a back-end that forwards its calls to the server at url,
+// such as "https://agent:7070", authenticating with the token.
+func NewClient(url, token string, args ...Option) *Client {
+	opts := options{
+		httpClient: http.DefaultClient,
+	}
+	for _, f := range args {
+		f(&opts)
+	}
+
+	return &Client{
+		url:   strings.TrimSuffix(url, "/"),
+		token: token,
+		http:  opts.httpClient,
+	}
+}
+
+// call makes a call to the back-end of the server. It returns the error returned
+// by the back-end, or the one found while making the request.
+func (c *Client) call(method string, req request) (res response, err error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return response{}, err
+	}
+
+	resp, err := c.do(context.Background(), http.MethodPost, apiPrefix+method, bytes.NewReader(body))
+	if err != nil {
+		return response{}, fmt.Errorf("%s: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return response{}, fmt.Errorf("%s: could not decode response: %v", method, err)
+	}
+
+	if res.Error != nil {
+		return response{}, res.Error
+	}
+
+	return res, nil
+}
+
+// do makes an authenticated request to the server. It fails if the response is
+// not a success, otherwise the caller must close its body.
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("server responded %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
+
+// OpenLxssRegistry opens a registry key on the server. The key is opened anew
+// for every call to its methods, so it does not see a snapshot of the registry.
+func (c *Client) OpenLxssRegistry(path string) (backend.RegistryKey, error) {
+	if _, err := c.call("OpenLxssRegistry", request{Path: path}); err != nil {
+		return nil, err
+	}
+	return remoteKey{client: c, path: path}, nil
+}
+
+// State returns the state of a distro on the server.
+func (c *Client) State(distributionName string) (backend.State, error) {
+	res, err := c.call("State", request{Distro: distributionName})
+	if err != nil {
+		return backend.NotRegistered, err
+	}
+	return res.State, nil
+}
+
+// Shutdown shuts WSL down on the server.
+func (c *Client) Shutdown() error {
+	_, err := c.call("Shutdown", request{})
+	return err
+}
+
+// Terminate terminates a distro on the server.
+func (c *Client) Terminate(distroName string) error {
+	_, err := c.call("Terminate", request{Distro: distroName})
+	return err
+}
+
+// SetAsDefault sets the default distro on the server.
+func (c *Client) SetAsDefault(distroName string) error {
+	_, err := c.call("SetAsDefault", request{Distro: distroName})
+	return err
+}
+
+// WslConfigureDistribution configures a distro on the server.
+func (c *Client) WslConfigureDistribution(distributionName string, defaultUID uint32, wslDistributionFlags backend.WslFlags) error {
+	_, err := c.call("WslConfigureDistribution", request{Distro: distributionName, UID: defaultUID, Flags: wslDistributionFlags})
+	return err
+}
+
+// WslGetDistributionConfiguration reads the configuration of a distro on the server.
+func (c *Client) WslGetDistributionConfiguration(distroName string, distributionVersion *uint8, defaultUID *uint32, wslDistributionFlags *backend.WslFlags, defaultEnvironmentVariables *map[string]string) error {
+	res, err := c.call("WslGetDistributionConfiguration", request{Distro: distroName})
+	if err != nil {
+		return err
+	}
+
+	*distributionVersion = res.Version
+	*defaultUID = res.UID
+	*wslDistributionFlags = res.Flags
+	*defaultEnvironmentVariables = res.Environment
+
+	return nil
+}
+
+// WslLaunch launches a command on the server. The returned process streams the
+// standard streams to and from the server, and exits with the exit code of the
+// command. Killing it kills the command.
+//
+// The command writes into different pipes on the server, so the order in which
+// its output and errors were written is lost when stdout and stderr are the same file.
+func (c *Client) WslLaunch(distroName string, command string, useCWD bool, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	return c.launch("WslLaunch", request{Distro: distroName, Command: command, UseCWD: useCWD}, stdin, stdout, stderr)
+}
+
+// WslLaunchEnv is WslLaunch with additional environment variables, which are
+// added to the environment of the server when launching the command.
+func (c *Client) WslLaunchEnv(distroName string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	return c.launch("WslLaunchEnv", request{Distro: distroName, Command: command, UseCWD: useCWD, Env: env}, stdin, stdout, stderr)
+}
+
+// WslLaunchAs is WslLaunchEnv, except that the command runs as the named user
+// of the distro.
+func (c *Client) WslLaunchAs(distroName string, user string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	return c.launch("WslLaunchAs", request{Distro: distroName, User: user, Command: command, UseCWD: useCWD, Env: env}, stdin, stdout, stderr)
+}
+
+// launch launches a command on the server with the method, and returns a process
+// that streams its standard streams.
+func (c *Client) launch(method string, req request, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	res, err := c.call(method, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return bridge.Start(context.Background(), func(ctx context.Context, in io.Reader, out, errOut io.Writer) int {
+		exitCode, err := c.attach(ctx, res.ProcessID, in, out, errOut)
+		if err != nil {
+			fmt.Fprintf(errOut, "gowsl: lost connection with command %q: %v\n", req.Command, err)
+			return exitError
+		}
+		return exitCode
+	}, stdin, stdout, stderr)
+}
+
+// attach streams the standard streams of a command launched on the server, and
+// returns its exit code once it exits. The command is killed if ctx is cancelled.
+func (c *Client) attach(ctx context.Context, id string, stdin io.Reader, stdout, stderr io.Writer) (exitCode int, err error) {
+	defer decorate.OnError(&err, "process %s", id)
+
+	path := processesPath + id + "/"
+
+	// Killing the command on errors, so that it does not outlive the client and
+	// the output stops, before waiting for the output to be copied.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer func() {
+		if err != nil {
+			c.kill(path)
+		}
+	}()
+
+	// The request streaming stdin stops when the command exits
+	stdinCtx, cancelStdin := context.WithCancel(context.Background())
+	defer cancelStdin()
+	go func() {
+		resp, err := c.do(stdinCtx, http.MethodPost, path+endpointStdin, io.NopCloser(stdin))
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	// Requesting the output before waiting, as the server forgets about the command
+	// once it has been waited for
+	for _, s := range []struct {
+		endpoint string
+		w        io.Writer
+	}{{endpointStdout, stdout}, {endpointStderr, stderr}} {
+		resp, err := c.do(context.Background(), http.MethodGet, path+s.endpoint, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		wg.Add(1)
+		go func(w io.Writer, body io.ReadCloser) {
+			defer wg.Done()
+			defer body.Close()
+			_, _ = io.Copy(w, body)
+		}(s.w, resp.Body)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.kill(path)
+		case <-done:
+		}
+	}()
+
+	resp, err := c.do(context.Background(), http.MethodGet, path+endpointWait, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var res response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return 0, fmt.Errorf("could not decode exit code: %v", err)
+	}
+
+	return res.ExitCode, nil
+}
+
+// kill kills a command launched on the server. Errors are ignored, as the command
+// may have exited already.
+func (c *Client) kill(path string) {
+	resp, err := c.do(context.Background(), http.MethodPost, path+endpointKill, nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// WslLaunchInteractive launches a command on the server, attached to the
+// standard streams of the server.
+func (c *Client) WslLaunchInteractive(distributionName string, command string, useCurrentWorkingDirectory bool) (uint32, error) {
+	res, err := c.call("WslLaunchInteractive", request{Distro: distributionName, Command: command, UseCWD: useCurrentWorkingDirectory})
+	if err != nil {
+		return 0, err
+	}
+	//nolint:gosec // Exit codes are truncated just like in Windows.
+	return uint32(res.ExitCode), nil
+}
+
+// WslRegisterDistribution registers a distro on the server, from a tarball on the server.
+func (c *Client) WslRegisterDistribution(distributionName string, tarGzFilename string) error {
+	_, err := c.call("WslRegisterDistribution", request{Distro: distributionName, Tarball: tarGzFilename})
+	return err
+}
+
+// WslUnregisterDistribution unregisters a distro on the server.
+func (c *Client) WslUnregisterDistribution(distributionName string) error {
+	_, err := c.call("WslUnregisterDistribution", request{Distro: distributionName})
+	return err
+}
+
+// remoteKey is a registry key on the server.
+type remoteKey struct {
+	client *Client
+	path   string
+}
+
+// Close does nothing, as the server closes the key after every call.
+func (k remoteKey) Close() error {
+	return nil
+}
+
+func (k remoteKey) Field(name string) (string, error) {
+	res, err := k.client.call("RegistryKey.Field", request{Path: k.path, Field: name})
+	if err != nil {
+		return "", err
+	}
+	return res.Value, nil
+}
+
+func (k remoteKey) SubkeyNames() ([]string, error) {
+	res, err := k.client.call("RegistryKey.SubkeyNames", request{Path: k.path})
+	if err != nil {
+		return nil, err
+	}
+	return res.Subkeys, nil
+}
@@ -0,0 +1,103 @@
+// Package remote drives WSL from another machine over HTTP. A Server exposes a
+// back-end, typically the one of a Windows machine, and a Client is a back-end
+// that forwards every call to a Server:
+//
+//	// On the Windows machine
+//	http.ListenAndServeTLS(addr, cert, key, remote.NewServer(gowsl.DefaultBackend(), token))
+//
+//	// On the orchestrator
+//	ctx := gowsl.WithBackend(ctx, remote.NewClient("https://agent:7070", token))
+//
+// Every request is authenticated with the token as a bearer token. The calls are
+// made with a JSON body to /v1/<method>, and the error they return is part of the
+// JSON response. The standard streams of the commands launched with WslLaunch,
+// WslLaunchEnv and WslLaunchAs are streamed in separate requests. The server kills the commands that no client
+// waits for, for instance because it crashed: see WithOrphanTimeout.
+//
+// The paths passed to the back-end, such as the tarball to register a distro from,
+// are paths on the server.
+package remote
+
+import (
+	"errors"
+
+	"github.com/ubuntu/gowsl/backend"
+)
+
+// apiPrefix is the prefix of the path of all requests.
+const apiPrefix = "/v1/"
+
+// processesPath is the prefix of the requests about a launched command, which
+// is followed by its ID and one of the process endpoints.
+const processesPath = apiPrefix + "processes/"
+
+// The endpoints of a launched command.
+const (
+	endpointStdin  = "stdin"  // POST: the request body is written into the command's stdin.
+	endpointStdout = "stdout" // GET: the response body is the command's stdout.
+	endpointStderr = "stderr" // GET: the response body is the command's stderr.
+	endpointKill   = "kill"   // POST: kills the command.
+	endpointWait   = "wait"   // GET: waits for the command to exit, and returns its exit code.
+)
+
+// request holds the arguments of a call. Each method uses a subset of them.
+type request struct {
+	Distro  string           `json:"distro,omitempty"`
+	Path    string           `json:"path,omitempty"`    // Path of a registry key
+	Field   string           `json:"field,omitempty"`   // Name of a registry field
+	Command string           `json:"command,omitempty"` // Command to launch
+	UseCWD  bool             `json:"useCWD,omitempty"`
+	Env     []string         `json:"env,omitempty"`  // Environment variables of the command
+	User    string           `json:"user,omitempty"` // User to launch the command as
+	UID     uint32           `json:"uid,omitempty"`
+	Flags   backend.WslFlags `json:"flags,omitempty"`
+	Tarball string           `json:"tarball,omitempty"`
+}
+
+// response holds the results of a call. Each method uses a subset of them.
+type response struct {
+	Error *remoteError `json:"error,omitempty"`
+
+	Value       string            `json:"value,omitempty"`   // Value of a registry field
+	Subkeys     []string          `json:"subkeys,omitempty"` // Subkeys of a registry key
+	State       backend.State     `json:"state,omitempty"`
+	Version     uint8             `json:"version,omitempty"`
+	UID         uint32            `json:"uid,omitempty"`
+	Flags       backend.WslFlags  `json:"flags,omitempty"`
+	Environment map[string]string `json:"environment,omitempty"`
+	ProcessID   string            `json:"processID,omitempty"` // ID of a launched command
+	ExitCode    int               `json:"exitCode,omitempty"`
+}
+
+// remoteError is an error returned by the back-end of the server.
+type remoteError struct {
+	Message string `json:"message"`
+	HRESULT uint32 `json:"hresult,omitempty"` // HRESULT wrapped by the error, if any
+}
+
+// newRemoteError returns the error to send to the client. It returns nil if err is nil.
+func newRemoteError(err error) *remoteError {
+	if err == nil {
+		return nil
+	}
+
+	e := &remoteError{Message: err.Error()}
+	var hr backend.HRESULTError
+	if errors.As(err, &hr) {
+		e.HRESULT = uint32(hr)
+	}
+	return e
+}
+
+func (e *remoteError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the HRESULT wrapped by the error on the server, so that errors.As
+// and backend.IsTransient work as they would on the server.
+func (e *remoteError) Unwrap() error {
+	if e.HRESULT == 0 {
+		return nil
+	}
+	return backend.HRESULTError(e.HRESULT)
+}
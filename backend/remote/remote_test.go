@@ -0,0 +1,262 @@
+package remote_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/backend/backendtest"
+	"github.com/ubuntu/gowsl/backend/remote"
+	"github.com/ubuntu/gowsl/mock"
+)
+
+const (
+	emptyRootFs = "../../images/empty.tar.gz"
+	token       = "s3cr3t"
+)
+
+// newClient returns a client for a server over loopback that exposes m.
+func newClient(t *testing.T, m *mock.Backend) *remote.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(remote.NewServer(m, token))
+	t.Cleanup(srv.Close)
+
+	return remote.NewClient(srv.URL, token)
+}
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		t.Helper()
+		return newClient(t, mock.New())
+	})
+}
+
+func TestAuthentication(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		serverToken string
+		clientToken string
+
+		wantErr bool
+	}{
+		"Success with the token of the server": {serverToken: token, clientToken: token},
+
+		"Error with the wrong token":          {serverToken: token, clientToken: "wrong", wantErr: true},
+		"Error with no token":                 {serverToken: token, wantErr: true},
+		"Error with a server without a token": {clientToken: token, wantErr: true},
+		"Error with no token on either side":  {wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m := mock.New()
+			srv := httptest.NewServer(remote.NewServer(m, tc.serverToken))
+			defer srv.Close()
+
+			err := remote.NewClient(srv.URL, tc.clientToken).Shutdown()
+			if tc.wantErr {
+				require.Error(t, err, "Shutdown should have been rejected")
+				require.Empty(t, m.CallsTo("Shutdown"), "Rejected calls should not reach the back-end")
+				return
+			}
+			require.NoError(t, err, "Shutdown should not have failed")
+			m.AssertNumberOfCalls(t, 1, "Shutdown")
+		})
+	}
+}
+
+func TestUnknownEndpoints(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(remote.NewServer(mock.New(), token))
+	defer srv.Close()
+
+	for _, path := range []string{"/v1/NotAMethod", "/v2/Shutdown", "/v1/processes/not-a-process/wait"} {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader("{}"))
+		require.NoError(t, err, "Setup: could not create request")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err, "Request should not have failed")
+		resp.Body.Close()
+		require.Equalf(t, http.StatusNotFound, resp.StatusCode, "Unexpected status for %s", path)
+	}
+}
+
+func TestErrorsKeepTheirHRESULT(t *testing.T) {
+	t.Parallel()
+
+	const serviceBusy = 0x800700AA
+
+	m := mock.New()
+	m.InjectFault("Shutdown", mock.Fault{HRESULT: serviceBusy, Times: 1})
+	c := newClient(t, m)
+
+	err := c.Shutdown()
+	require.Error(t, err, "Shutdown should have failed")
+	require.Contains(t, err.Error(), "HRESULT 0x800700AA", "The message of the server's error should have been kept")
+
+	var hr backend.HRESULTError
+	require.True(t, errors.As(err, &hr), "The error should wrap the HRESULT")
+	require.True(t, backend.IsTransient(err), "Middlewares should see the error as the server's one")
+
+	require.NoError(t, c.Shutdown(), "Shutdown should not have failed once the fault is gone")
+}
+
+func TestLaunchStreams(t *testing.T) {
+	t.Parallel()
+
+	m := mock.New()
+	m.HandleCommand("cat", func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+		_, _ = io.WriteString(stderr, "Reading stdin\n")
+		_, _ = io.Copy(stdout, stdin)
+		return 3
+	})
+	killed := make(chan struct{})
+	m.HandleCommand("sleep infinity", func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+		<-ctx.Done()
+		close(killed)
+		return 1
+	})
+
+	ctx := wsl.WithBackend(context.Background(), newClient(t, m))
+	d := wsl.NewDistro(ctx, "Ubuntu")
+	require.NoError(t, d.Register(emptyRootFs), "Setup: Register should not have failed")
+
+	var stdout, stderr strings.Builder
+	cmd := d.Command(ctx, "cat")
+	cmd.Stdin = strings.NewReader("Hello from the client!")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	var exitErr interface{ ExitCode() int }
+	require.ErrorAs(t, err, &exitErr, "Run should have failed with the exit code of the command")
+	require.Equal(t, 3, exitErr.ExitCode(), "Unexpected exit code")
+	require.Equal(t, "Hello from the client!", stdout.String(), "Stdin should have been streamed to the command")
+	require.Equal(t, "Reading stdin\n", stderr.String(), "Stderr should have been streamed from the command")
+
+	// Cancelling the command kills it on the server
+	cmdCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	err = d.Command(cmdCtx, "sleep infinity").Run()
+	require.Error(t, err, "Run should have failed when the command was killed")
+
+	select {
+	case <-killed:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "The command should have been killed on the server")
+	}
+}
+
+func TestLaunchEnv(t *testing.T) {
+	t.Parallel()
+
+	m := mock.New()
+	m.HandleCommand("printenv", func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+		info, _ := mock.CommandInfoFromContext(ctx)
+		_, _ = io.WriteString(stdout, strings.Join(info.Env, "\n"))
+		return 0
+	})
+
+	ctx := wsl.WithBackend(context.Background(), newClient(t, m))
+	d := wsl.NewDistro(ctx, "Ubuntu")
+	require.NoError(t, d.Register(emptyRootFs), "Setup: Register should not have failed")
+
+	cmd := d.Command(ctx, "printenv")
+	cmd.Env = []string{"GOWSL_TEST_VAR=hello"}
+
+	out, err := cmd.Output()
+	require.NoError(t, err, "Output should not have failed")
+	require.Contains(t, string(out), "GOWSL_TEST_VAR=hello", "The variable should have been forwarded into the distro on the server")
+	m.AssertNumberOfCalls(t, 1, "WslLaunchEnv")
+}
+
+func TestOrphanedCommandsAreKilled(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		orphanTimeout time.Duration
+		stopWaiting   bool
+	}{
+		"When no client waits for the command": {orphanTimeout: 100 * time.Millisecond},
+		"When the client stops waiting":        {orphanTimeout: time.Hour, stopWaiting: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m := mock.New()
+			killed := make(chan struct{})
+			m.HandleCommand("sleep infinity", func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+				<-ctx.Done()
+				close(killed)
+				return 1
+			})
+			require.NoError(t, m.WslRegisterDistribution("Ubuntu", emptyRootFs), "Setup: could not register distro")
+
+			srv := httptest.NewServer(remote.NewServer(m, token, remote.WithOrphanTimeout(tc.orphanTimeout)))
+			defer srv.Close()
+
+			// Launching the command like a client that crashes right after
+			resp, err := do(context.Background(), http.MethodPost, srv.URL+"/v1/WslLaunch", `{"distro":"Ubuntu","command":"sleep infinity"}`)
+			require.NoError(t, err, "Setup: WslLaunch should not have failed")
+			var res struct {
+				ProcessID string `json:"processID"`
+			}
+			err = json.NewDecoder(resp.Body).Decode(&res)
+			resp.Body.Close()
+			require.NoError(t, err, "Setup: could not decode the response of WslLaunch")
+			require.NotEmpty(t, res.ProcessID, "Setup: WslLaunch should have returned a process ID")
+
+			waitURL := srv.URL + "/v1/processes/" + res.ProcessID + "/wait"
+			if tc.stopWaiting {
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				_, err := do(ctx, http.MethodGet, waitURL, "")
+				require.Error(t, err, "Setup: waiting should have been interrupted")
+			}
+
+			select {
+			case <-killed:
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "The orphaned command should have been killed")
+			}
+
+			resp, err = do(context.Background(), http.MethodGet, waitURL, "")
+			require.NoError(t, err, "Request should not have failed")
+			resp.Body.Close()
+			require.Equal(t, http.StatusNotFound, resp.StatusCode, "The server should have forgotten about the orphaned command")
+		})
+	}
+}
+
+// do makes an authenticated request to the server.
+func do(ctx context.Context, method, url, body string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return http.DefaultClient.Do(req)
+}
@@ -0,0 +1,381 @@
+package remote
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ubuntu/gowsl/backend"
+)
+
+// Server exposes a back-end over HTTP. It is safe for concurrent use.
+type Server struct {
+	backend backend.Backend
+	token   []byte
+
+	processes     map[string]*process // Commands launched and not waited for yet
+	orphanTimeout time.Duration
+	mu            sync.Mutex
+}
+
+// process is a command launched by a client.
+type process struct {
+	p *os.Process
+
+	stdin  *os.File // Write end of the command's stdin
+	stdout *os.File // Read end of the command's stdout
+	stderr *os.File // Read end of the command's stderr
+
+	done     chan struct{} // Closed when the command exits
+	exitCode int
+
+	expiry *time.Timer // Kills the command if no client waits for it
+}
+
+type serverOptions struct {
+	orphanTimeout time.Duration
+}
+
+// ServerOption represents an optional function to override Server default values.
+type ServerOption func(*serverOptions)
+
+// WithOrphanTimeout sets how long a launched command can go without a client
+// waiting for it before it is killed, which happens when a client crashes or loses
+// its connection. The default is one minute.
+func WithOrphanTimeout(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.orphanTimeout = d
+	}
+}
+
+// NewServer returns a server that exposes b to the clients with the token. An
+// empty token rejects all requests.
+func NewServer(b backend.Backend, token string, args ...ServerOption) *Server {
+	opts := serverOptions{
+		orphanTimeout: time.Minute,
+	}
+	for _, f := range args {
+		f(&opts)
+	}
+
+	return &Server{
+		backend:       b,
+		token:         []byte(token),
+		processes:     make(map[string]*process),
+		orphanTimeout: opts.orphanTimeout,
+	}
+}
+
+// ServeHTTP handles a request from a client.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if rest, ok := strings.CutPrefix(r.URL.Path, processesPath); ok {
+		id, endpoint, _ := strings.Cut(rest, "/")
+		s.serveProcess(w, r, id, endpoint)
+		return
+	}
+
+	method, ok := strings.CutPrefix(r.URL.Path, apiPrefix)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("could not decode request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	res, found := s.call(method, req)
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+// authorized returns true if the request carries the token of the server.
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || len(s.token) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), s.token) == 1
+}
+
+// call makes a call to the back-end. It returns false if there is no such method.
+func (s *Server) call(method string, req request) (res response, found bool) {
+	var err error
+
+	switch method {
+	case "OpenLxssRegistry":
+		// The keys are opened for every call, so that clients cannot leave them open
+		var k backend.RegistryKey
+		if k, err = s.backend.OpenLxssRegistry(req.Path); err == nil {
+			err = k.Close()
+		}
+	case "RegistryKey.Field":
+		err = s.withKey(req.Path, func(k backend.RegistryKey) (err error) {
+			res.Value, err = k.Field(req.Field)
+			return err
+		})
+	case "RegistryKey.SubkeyNames":
+		err = s.withKey(req.Path, func(k backend.RegistryKey) (err error) {
+			res.Subkeys, err = k.SubkeyNames()
+			return err
+		})
+	case "State":
+		res.State, err = s.backend.State(req.Distro)
+	case "Shutdown":
+		err = s.backend.Shutdown()
+	case "Terminate":
+		err = s.backend.Terminate(req.Distro)
+	case "SetAsDefault":
+		err = s.backend.SetAsDefault(req.Distro)
+	case "WslConfigureDistribution":
+		err = s.backend.WslConfigureDistribution(req.Distro, req.UID, req.Flags)
+	case "WslGetDistributionConfiguration":
+		err = s.backend.WslGetDistributionConfiguration(req.Distro, &res.Version, &res.UID, &res.Flags, &res.Environment)
+	case "WslLaunch":
+		res.ProcessID, err = s.launch(func(stdin, stdout, stderr *os.File) (*os.Process, error) {
+			return s.backend.WslLaunch(req.Distro, req.Command, req.UseCWD, stdin, stdout, stderr)
+		})
+	case "WslLaunchEnv":
+		res.ProcessID, err = s.launch(func(stdin, stdout, stderr *os.File) (*os.Process, error) {
+			return backend.WslLaunchEnv(s.backend, req.Distro, req.Command, req.UseCWD, req.Env, stdin, stdout, stderr)
+		})
+	case "WslLaunchAs":
+		res.ProcessID, err = s.launch(func(stdin, stdout, stderr *os.File) (*os.Process, error) {
+			return backend.WslLaunchAs(s.backend, req.Distro, req.User, req.Command, req.UseCWD, req.Env, stdin, stdout, stderr)
+		})
+	case "WslLaunchInteractive":
+		var exitCode uint32
+		exitCode, err = s.backend.WslLaunchInteractive(req.Distro, req.Command, req.UseCWD)
+		res.ExitCode = int(exitCode)
+	case "WslRegisterDistribution":
+		err = s.backend.WslRegisterDistribution(req.Distro, req.Tarball)
+	case "WslUnregisterDistribution":
+		err = s.backend.WslUnregisterDistribution(req.Distro)
+	default:
+		return response{}, false
+	}
+
+	if err != nil {
+		return response{Error: newRemoteError(err)}, true
+	}
+	return res, true
+}
+
+// withKey opens the registry key at path, and closes it after calling f.
+func (s *Server) withKey(path string, f func(backend.RegistryKey) error) (err error) {
+	k, err := s.backend.OpenLxssRegistry(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, k.Close())
+	}()
+
+	return f(k)
+}
+
+// launch launches a command with start, and returns the ID with which the client
+// accesses it.
+func (s *Server) launch(start func(stdin, stdout, stderr *os.File) (*os.Process, error)) (id string, err error) {
+	var files []*os.File
+	defer func() {
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+		}
+	}()
+
+	// Ends of the pipes kept by the server and the ones given to the command
+	var ours, theirs [3]*os.File
+	for i := range ours {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return "", err
+		}
+		files = append(files, r, w)
+
+		if i == 0 {
+			ours[i], theirs[i] = w, r
+		} else {
+			ours[i], theirs[i] = r, w
+		}
+	}
+
+	p, err := start(theirs[0], theirs[1], theirs[2])
+	if err != nil {
+		return "", err
+	}
+
+	for _, f := range theirs {
+		f.Close()
+	}
+
+	proc := &process{p: p, stdin: ours[0], stdout: ours[1], stderr: ours[2], done: make(chan struct{})}
+	go func() {
+		defer close(proc.done)
+
+		proc.exitCode = -1
+		if st, err := p.Wait(); err == nil {
+			proc.exitCode = st.ExitCode()
+		}
+	}()
+
+	id = uuid.NewString()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processes[id] = proc
+	proc.expiry = time.AfterFunc(s.orphanTimeout, func() { s.expire(id) })
+
+	return id, nil
+}
+
+// forget removes a command from the ones the server keeps track of, and returns it.
+func (s *Server) forget(id string) (proc *process, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	proc, ok = s.processes[id]
+	if !ok {
+		return nil, false
+	}
+	proc.expiry.Stop()
+	delete(s.processes, id)
+
+	return proc, true
+}
+
+// expire kills a command that no client waits for, and forgets about it.
+func (s *Server) expire(id string) {
+	proc, ok := s.forget(id)
+	if !ok {
+		return
+	}
+
+	// The command may have exited already
+	_ = proc.p.Kill()
+
+	// Ending the requests still streaming its standard streams, if any
+	for _, f := range []*os.File{proc.stdin, proc.stdout, proc.stderr} {
+		f.Close()
+	}
+}
+
+// serveProcess handles a request about a launched command.
+func (s *Server) serveProcess(w http.ResponseWriter, r *http.Request, id, endpoint string) {
+	s.mu.Lock()
+	proc, ok := s.processes[id]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	wantMethod := http.MethodGet
+	if endpoint == endpointStdin || endpoint == endpointKill {
+		wantMethod = http.MethodPost
+	}
+	if r.Method != wantMethod {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch endpoint {
+	case endpointStdin:
+		defer proc.stdin.Close()
+		// The command may exit without reading all of its input
+		_, _ = io.Copy(proc.stdin, r.Body)
+	case endpointStdout:
+		defer proc.stdout.Close()
+		stream(w, proc.stdout)
+	case endpointStderr:
+		defer proc.stderr.Close()
+		stream(w, proc.stderr)
+	case endpointKill:
+		if err := proc.p.Kill(); err != nil {
+			// The process may have exited already
+			select {
+			case <-proc.done:
+			default:
+				http.Error(w, fmt.Sprintf("could not kill process: %v", err), http.StatusInternalServerError)
+			}
+		}
+	case endpointWait:
+		// The command is not orphaned for as long as a client waits for it
+		proc.expiry.Stop()
+
+		select {
+		case <-proc.done:
+		case <-r.Context().Done():
+			// The client is gone, so nobody will wait for the command anymore
+			s.expire(id)
+			return
+		}
+
+		s.forget(id)
+
+		writeJSON(w, response{ExitCode: proc.exitCode})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// stream copies r into the response, flushing every write so that the client
+// receives the output as soon as it is written.
+func stream(w http.ResponseWriter, r io.Reader) {
+	flusher, _ := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeJSON writes the response of a call.
+func writeJSON(w http.ResponseWriter, res response) {
+	w.Header().Set("Content-Type", "application/json")
+	// Errors writing the response are the client's problem
+	_ = json.NewEncoder(w).Encode(res)
+}
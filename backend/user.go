@@ -0,0 +1,31 @@
+package backend
+
+// This file contains the optional interface of the back-ends that can launch
+// commands as a user other than the default one of the distro.
+
+import (
+	"fmt"
+	"os"
+)
+
+// UserLauncher is implemented by the back-ends that can launch commands as a
+// particular user of the distro.
+//
+// WslLaunch and WslLaunchEnv launch commands as the default user of the distro,
+// which is persisted in the registry. UserLauncher lets GoWSL launch a single
+// command as another user, such as root, without changing it.
+type UserLauncher interface {
+	// WslLaunchAs is WslLaunchEnv, except that the command runs as the named user
+	// of the distro. The env may be empty.
+	WslLaunchAs(distroName string, user string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error)
+}
+
+// WslLaunchAs launches a command as the named user if the back-end is a
+// UserLauncher, and fails otherwise.
+func WslLaunchAs(b Backend, distroName string, user string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	l, ok := b.(UserLauncher)
+	if !ok {
+		return nil, fmt.Errorf("back-end %T cannot launch commands as a particular user", b)
+	}
+	return l.WslLaunchAs(distroName, user, command, useCWD, env, stdin, stdout, stderr)
+}
@@ -5,15 +5,9 @@ package gowsl
 import (
 	"context"
 
-	"github.com/ubuntu/gowsl/internal/backend"
-	"github.com/ubuntu/gowsl/internal/backend/windows"
 	"github.com/ubuntu/gowsl/mock"
 )
 
-type backendQueryType int
-
-const backendQuery backendQueryType = 0
-
 // MockAvailable indicates if the mock can be accessed at runtime.
 // It is always accessible at compile-time to make writing tests easier, but you should use:
 //
@@ -29,17 +23,10 @@ func MockAvailable() bool {
 
 // WithMock adds the mock back-end to the context when GoWSL has been compiled with the gowslmock tag.
 // Otherwise, it panics.
+//
+// To use the mock back-end regardless of build tags, use WithBackend instead: the
+// mock is a regular back-end, and WithBackend is the entry point that does not
+// depend on the gowslmock tag.
 func WithMock(ctx context.Context, m *mock.Backend) context.Context {
-	return context.WithValue(ctx, backendQuery, m)
-}
-
-func selectBackend(ctx context.Context) backend.Backend {
-	v := ctx.Value(backendQuery)
-
-	if v == nil {
-		return windows.Backend{}
-	}
-
-	//nolint:forcetypeassert // The panic is expected and welcome
-	return v.(backend.Backend)
+	return WithBackend(ctx, m)
 }
@@ -5,8 +5,6 @@ package gowsl
 import (
 	"context"
 
-	"github.com/ubuntu/gowsl/internal/backend"
-	"github.com/ubuntu/gowsl/internal/backend/windows"
 	"github.com/ubuntu/gowsl/mock"
 )
 
@@ -25,10 +23,10 @@ func MockAvailable() bool {
 
 // WithMock adds the mock back-end to the context when GoWSL has been compiled with the gowslmock tag.
 // Otherwise, it panics.
+//
+// To use the mock back-end regardless of build tags, use WithBackend instead: the
+// mock is a regular back-end, and WithBackend is the entry point that does not
+// depend on the gowslmock tag.
 func WithMock(ctx context.Context, m *mock.Backend) context.Context {
 	panic("Cannot use mock without build flag gowslmock")
 }
-
-func selectBackend(ctx context.Context) backend.Backend {
-	return windows.Backend{}
-}
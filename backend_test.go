@@ -0,0 +1,102 @@
+package gowsl_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/backend/backendtest"
+	"github.com/ubuntu/gowsl/internal/backend/interop"
+	"github.com/ubuntu/gowsl/internal/backend/windows"
+	"github.com/ubuntu/gowsl/mock"
+	"github.com/ubuntu/gowsl/paths"
+)
+
+// stateOverride is a back-end that reports every distro in the same state, and
+// delegates everything else to the wrapped back-end.
+type stateOverride struct {
+	backend.Backend
+	state backend.State
+}
+
+func (b stateOverride) State(distroName string) (backend.State, error) {
+	return b.state, nil
+}
+
+func TestWithBackend(t *testing.T) {
+	t.Parallel()
+
+	// The mock is used as a regular back-end, so this works without the gowslmock tag
+	m := mock.New()
+	ctx := wsl.WithBackend(context.Background(), stateOverride{Backend: m, state: backend.Running})
+
+	d := wsl.NewDistro(ctx, uniqueDistroName(t))
+	err := d.Register(emptyRootFs)
+	require.NoError(t, err, "Register should have been delegated to the wrapped back-end")
+
+	s, err := d.State()
+	require.NoError(t, err, "State should not have failed")
+	require.Equal(t, wsl.Running, s, "State should have been returned by the custom back-end")
+
+	require.NotEmpty(t, m.CallsTo("WslRegisterDistribution"), "Register should have been called on the wrapped back-end")
+	require.Empty(t, m.CallsTo("State"), "State should not have been called on the wrapped back-end")
+
+	registered, err := wsl.RegisteredDistros(ctx)
+	require.NoError(t, err, "RegisteredDistros should not have failed")
+	require.Len(t, registered, 1, "RegisteredDistros should have used the custom back-end")
+
+	registered, err = wsl.RegisteredDistros(wsl.WithBackend(ctx, mock.New()))
+	require.NoError(t, err, "RegisteredDistros should not have failed")
+	require.Empty(t, registered, "The back-end of a child context should take precedence")
+}
+
+func TestDistrosAreComparable(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]backend.Backend{
+		"With the default back-end":             wsl.DefaultBackend(),
+		"With the Windows back-end":             windows.Backend{},
+		"With the Windows back-end and options": windows.New(windows.WithWslExe("wsl.exe")),
+		"With the interop back-end":             interop.New(interop.WithPathTranslator(paths.Translator{})),
+		"With the mock back-end":                mock.New(),
+		"With middlewares":                      backend.Chain(mock.New(), backend.Timeout(time.Second), backend.Retry(backend.RetryPolicy{})),
+	}
+
+	for name, b := range testCases {
+		b := b
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := wsl.WithBackend(context.Background(), b)
+
+			require.NotPanics(t, func() {
+				d1 := wsl.NewDistro(ctx, "Ubuntu")
+				d2 := wsl.NewDistro(ctx, "Ubuntu")
+				other := wsl.NewDistro(ctx, "Debian")
+
+				require.True(t, d1 == d2, "Distros with the same name and back-end should be equal")
+				require.False(t, d1 == other, "Distros with different names should not be equal")
+			}, "Comparing distros should not have panicked")
+		})
+	}
+}
+
+// TestBackendConformance is not parallel because, with the real back-end, the suite
+// changes the default distro and shuts WSL down.
+func TestBackendConformance(t *testing.T) {
+	newBackend := func(t *testing.T) backend.Backend {
+		t.Helper()
+		return windows.New()
+	}
+	if wsl.MockAvailable() {
+		newBackend = func(t *testing.T) backend.Backend {
+			t.Helper()
+			return mock.New()
+		}
+	}
+
+	backendtest.Run(t, newBackend, backendtest.WithRootFs(rootFs), backendtest.WithNamePrefix(namePrefix))
+}
@@ -0,0 +1,685 @@
+// Command fakewsl is a fake wsl.exe backed by the mocked back-end, so that tools
+// that invoke wsl.exe can be tested on Linux.
+//
+// The state of WSL is stored in the directory set by $FAKEWSL_STATE_DIR (by
+// default, fakewsl inside the user's cache directory), so it persists across
+// invocations. Concurrent invocations wait for each other, except while commands
+// run in the distros: the changes they make to the files of their distro are then
+// merged into the state once they exit.
+//
+// The supported commands are:
+//
+//	--list [--verbose] [--all] [--running] [--quiet]
+//	--terminate <distro>
+//	--shutdown
+//	--set-default <distro>
+//	--set-version <distro> <version>
+//	--import <distro> <install location> <tarball> [--version <version>]
+//	--export <distro> <tarball>
+//	--unregister <distro>
+//	[--distribution <distro>] [--user <user>] [--cd <directory>] [--exec|--] <command>...
+//
+// Commands run with `--exec sh -c <command>` run the command. The directory is
+// ignored, other than to launch the command outside of the current working one.
+// The user is passed to the mocked back-end, which does not check it.
+//
+// As in wsl.exe, the output is encoded in UTF-16 unless $WSL_UTF8 is set to 1.
+// The output of commands run in the distros is not affected. The commands run
+// are the ones supported by the mocked back-end. Any other one fails with exit
+// code 127.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing/fstest"
+	"time"
+	"unicode/utf16"
+
+	"github.com/ubuntu/gowsl/internal/flags"
+	"github.com/ubuntu/gowsl/mock"
+	"gopkg.in/yaml.v3"
+)
+
+// exitError is the exit code of wsl.exe on failure: -1, truncated to a byte.
+const exitError = 255
+
+// stateFile is the name of the fixture with the state of WSL, inside the state directory.
+const stateFile = "state.yaml"
+
+// lockFile is the file locked while an invocation uses the state directory.
+const lockFile = "state.lock"
+
+// lockTimeout is how long an invocation waits for the others to finish using the
+// state directory. Commands running in the distros do not hold it.
+const lockTimeout = 30 * time.Second
+
+// Messages printed by wsl.exe, which do not follow the conventions of Go errors.
+var (
+	errNoDistros        = errors.New("Windows Subsystem for Linux has no installed distributions.") //nolint:revive // This is the message of wsl.exe.
+	errNoRunningDistros = errors.New("There are no running distributions.")                         //nolint:revive // This is the message of wsl.exe.
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes wsl.exe with the provided arguments, and returns its exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	out := newOutput(stdout)
+
+	dir, err := stateDir()
+	if err != nil {
+		fmt.Fprintf(out, "%v\r\n", err)
+		return exitError
+	}
+
+	s, err := openState(dir)
+	if err != nil {
+		fmt.Fprintf(out, "%v\r\n", err)
+		return exitError
+	}
+	defer s.close()
+
+	exitCode, err := dispatch(s, args, stdin, stdout, stderr, out)
+	if err != nil {
+		fmt.Fprintf(out, "%v\r\n", err)
+		exitCode = exitError
+	}
+
+	if err := s.save(); err != nil {
+		fmt.Fprintf(newOutput(stderr), "fakewsl: could not save state: %v\r\n", err)
+		return exitError
+	}
+
+	return exitCode
+}
+
+// dispatch runs the command in args. Messages from wsl.exe are written into out,
+// and the output of commands run in the distros into stdout and stderr.
+func dispatch(s *state, args []string, stdin io.Reader, stdout, stderr, out io.Writer) (exitCode int, err error) {
+	b := s.backend
+	if len(args) == 0 {
+		return 0, errors.New("interactive shells are not supported")
+	}
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "-l", "--list":
+		return 0, list(b, args, out)
+	case "-t", "--terminate":
+		distro, err := oneArg(cmd, args)
+		if err != nil {
+			return 0, err
+		}
+		return 0, b.Terminate(distro)
+	case "--shutdown":
+		if len(args) != 0 {
+			return 0, fmt.Errorf("unexpected arguments for %s: %q", cmd, args)
+		}
+		return 0, b.Shutdown()
+	case "-s", "--set-default":
+		distro, err := oneArg(cmd, args)
+		if err != nil {
+			return 0, err
+		}
+		return 0, b.SetAsDefault(distro)
+	case "--set-version":
+		if len(args) != 2 {
+			return 0, fmt.Errorf("usage: %s <distro> <version>", cmd)
+		}
+		version, err := parseVersion(args[1])
+		if err != nil {
+			return 0, err
+		}
+		return 0, b.SetVersion(args[0], version)
+	case "--import":
+		return 0, importDistro(b, args)
+	case "--export":
+		if len(args) != 2 {
+			return 0, fmt.Errorf("usage: %s <distro> <tarball>", cmd)
+		}
+		return 0, b.Export(args[0], args[1])
+	case "--unregister":
+		distro, err := oneArg(cmd, args)
+		if err != nil {
+			return 0, err
+		}
+		return 0, b.WslUnregisterDistribution(distro)
+	case "-d", "--distribution":
+		if len(args) == 0 {
+			return 0, fmt.Errorf("usage: %s <distro> [--] <command>...", cmd)
+		}
+		return launch(s, args[0], args[1:], stdin, stdout, stderr)
+	}
+
+	if strings.HasPrefix(cmd, "-") && cmd != "--" && cmd != "-e" && cmd != "--exec" {
+		return 0, fmt.Errorf("unsupported option %s", cmd)
+	}
+
+	distro, err := defaultDistro(b)
+	if err != nil {
+		return 0, err
+	}
+	return launch(s, distro, append([]string{cmd}, args...), stdin, stdout, stderr)
+}
+
+func oneArg(cmd string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: %s <distro>", cmd)
+	}
+	return args[0], nil
+}
+
+func parseVersion(s string) (uint8, error) {
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || (v != 1 && v != 2) {
+		return 0, fmt.Errorf("invalid WSL version %q", s)
+	}
+	return uint8(v), nil
+}
+
+// importDistro implements `wsl.exe --import <distro> <install location> <tarball> [--version <version>]`.
+// The install location is not used.
+func importDistro(b *mock.Backend, args []string) error {
+	if len(args) != 3 && len(args) != 5 {
+		return errors.New("usage: --import <distro> <install location> <tarball> [--version <version>]")
+	}
+
+	version := uint8(2)
+	if len(args) == 5 {
+		if args[3] != "--version" {
+			return fmt.Errorf("unsupported option %s", args[3])
+		}
+		v, err := parseVersion(args[4])
+		if err != nil {
+			return err
+		}
+		version = v
+	}
+
+	return b.Import(args[0], args[2], version)
+}
+
+// distroInfo is a row in the output of `wsl.exe --list`.
+type distroInfo struct {
+	name      string
+	state     string
+	version   int
+	isDefault bool
+	running   bool
+}
+
+// list implements `wsl.exe --list`.
+func list(b *mock.Backend, args []string, out io.Writer) error {
+	var verbose, running, quiet bool
+	for _, arg := range args {
+		switch arg {
+		case "-v", "--verbose":
+			verbose = true
+		case "--running":
+			running = true
+		case "-q", "--quiet":
+			quiet = true
+		case "--all":
+			// Distros being installed and uninstalled are always listed
+		default:
+			return fmt.Errorf("unsupported option %s", arg)
+		}
+	}
+
+	distros, err := distroInfos(b)
+	if err != nil {
+		return err
+	}
+
+	if running {
+		var r []distroInfo
+		for _, d := range distros {
+			if d.running {
+				r = append(r, d)
+			}
+		}
+		distros = r
+	}
+
+	if len(distros) == 0 {
+		if running {
+			return errNoRunningDistros
+		}
+		return errNoDistros
+	}
+
+	switch {
+	case quiet:
+		for _, d := range distros {
+			fmt.Fprintf(out, "%s\r\n", d.name)
+		}
+	case verbose:
+		width := len("NAME")
+		for _, d := range distros {
+			if len(d.name) > width {
+				width = len(d.name)
+			}
+		}
+		fmt.Fprintf(out, "  %-*s    %-15s %s\r\n", width, "NAME", "STATE", "VERSION")
+		for _, d := range distros {
+			mark := " "
+			if d.isDefault {
+				mark = "*"
+			}
+			fmt.Fprintf(out, "%s %-*s    %-15s %d\r\n", mark, width, d.name, d.state, d.version)
+		}
+	default:
+		fmt.Fprintf(out, "Windows Subsystem for Linux Distributions:\r\n")
+		for _, d := range distros {
+			if d.isDefault {
+				fmt.Fprintf(out, "%s (Default)\r\n", d.name)
+				continue
+			}
+			fmt.Fprintf(out, "%s\r\n", d.name)
+		}
+	}
+
+	return nil
+}
+
+// distroInfos returns the registered distros, with the default one first and
+// the others sorted by name.
+func distroInfos(b *mock.Backend) ([]distroInfo, error) {
+	names, defaultName, err := registeredDistros(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var distros []distroInfo
+	for _, name := range names {
+		s, err := b.State(name)
+		if err != nil {
+			return nil, err
+		}
+
+		d := distroInfo{
+			name:      name,
+			state:     s.String(),
+			version:   2,
+			isDefault: name == defaultName,
+			running:   s.String() == "Running",
+		}
+
+		var version uint8
+		var uid uint32
+		var f flags.WslFlags
+		var env map[string]string
+		if err := b.WslGetDistributionConfiguration(name, &version, &uid, &f, &env); err == nil && f&0x8 == 0 {
+			d.version = 1
+		}
+
+		distros = append(distros, d)
+	}
+
+	sort.SliceStable(distros, func(i, j int) bool {
+		if distros[i].isDefault != distros[j].isDefault {
+			return distros[i].isDefault
+		}
+		return distros[i].name < distros[j].name
+	})
+
+	return distros, nil
+}
+
+// registeredDistros reads the names of the registered distros and the default
+// one from the registry.
+func registeredDistros(b *mock.Backend) (names []string, defaultName string, err error) {
+	root, err := b.OpenLxssRegistry(".")
+	if err != nil {
+		return nil, "", err
+	}
+	subkeys, err := root.SubkeyNames()
+	if err != nil {
+		root.Close()
+		return nil, "", err
+	}
+	defaultGUID, err := root.Field("DefaultDistribution")
+	root.Close()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, GUID := range subkeys {
+		if !strings.HasPrefix(GUID, "{") {
+			continue // Not a distro
+		}
+
+		key, err := b.OpenLxssRegistry(GUID)
+		if err != nil {
+			return nil, "", err
+		}
+		name, err := key.Field("DistributionName")
+		key.Close()
+		if err != nil {
+			return nil, "", err
+		}
+
+		names = append(names, name)
+		if GUID == defaultGUID {
+			defaultName = name
+		}
+	}
+
+	return names, defaultName, nil
+}
+
+func defaultDistro(b *mock.Backend) (string, error) {
+	_, name, err := registeredDistros(b)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", errNoDistros
+	}
+	return name, nil
+}
+
+// launch runs a command in a distro, and returns its exit code. The state
+// directory is unlocked while the command runs.
+func launch(s *state, distro string, args []string, stdin io.Reader, stdout, stderr io.Writer) (exitCode int, err error) {
+	useCWD := true
+	var user string
+	for len(args) > 0 && (args[0] == "--cd" || args[0] == "-u" || args[0] == "--user") {
+		if len(args) < 2 {
+			return 0, fmt.Errorf("usage: %s <value>", args[0])
+		}
+		if args[0] == "--cd" {
+			useCWD = false
+		} else {
+			user = args[1]
+		}
+		args = args[2:]
+	}
+	if len(args) > 0 && (args[0] == "--" || args[0] == "-e" || args[0] == "--exec") {
+		args = args[1:]
+	}
+	if len(args) == 3 && args[0] == "sh" && args[1] == "-c" {
+		args = args[2:]
+	}
+	command := strings.Join(args, " ")
+
+	b := s.backend
+
+	// The mocked back-end requires pipes
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+
+	b.HandleFallback(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+		info, _ := mock.CommandInfoFromContext(ctx)
+		fmt.Fprintf(stderr, "fakewsl: %s: command not found\n", info.Command)
+		return 127
+	})
+
+	// The files as they were before the command, to find out which ones it changes
+	before, err := s.files(distro)
+	if err != nil {
+		return 0, err
+	}
+
+	var p *os.Process
+	if user != "" {
+		p, err = b.WslLaunchAs(distro, user, command, useCWD, nil, inR, outW, errW)
+	} else {
+		p, err = b.WslLaunch(distro, command, useCWD, inR, outW, errW)
+	}
+	inR.Close()
+	outW.Close()
+	errW.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.release(); err != nil {
+		_ = p.Kill()
+		_, _ = p.Wait()
+		return 0, err
+	}
+
+	go func() {
+		_, _ = io.Copy(inW, stdin)
+		inW.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(stderr, errR)
+		close(done)
+	}()
+	_, _ = io.Copy(stdout, outR)
+	<-done
+
+	ps, waitErr := p.Wait()
+
+	if err := s.reacquire(distro, before); err != nil {
+		return 0, err
+	}
+	if waitErr != nil {
+		return 0, waitErr
+	}
+
+	return ps.ExitCode(), nil
+}
+
+// newOutput returns a writer that encodes text as wsl.exe does: in UTF-16
+// unless $WSL_UTF8 is set to 1.
+func newOutput(w io.Writer) io.Writer {
+	if os.Getenv("WSL_UTF8") == "1" {
+		return w
+	}
+	return utf16Writer{w}
+}
+
+type utf16Writer struct {
+	w io.Writer
+}
+
+func (u utf16Writer) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	for _, r := range utf16.Encode([]rune(string(p))) {
+		buf.WriteByte(byte(r))
+		buf.WriteByte(byte(r >> 8))
+	}
+
+	if _, err := u.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// stateDir returns the directory where the state is stored.
+func stateDir() (string, error) {
+	if dir := os.Getenv("FAKEWSL_STATE_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find the state directory: set $FAKEWSL_STATE_DIR: %v", err)
+	}
+	return filepath.Join(cache, "fakewsl"), nil
+}
+
+// state is the state of WSL, loaded from the state directory.
+type state struct {
+	dir     string
+	backend *mock.Backend
+	unlock  func() // Unlocks the state directory, or nil if it is not locked
+}
+
+// options are the options of the back-ends loaded from the state directory.
+// Distros are never stopped for idling: each invocation is short-lived.
+var options = []mock.Option{mock.WithIdleTimeout(0)}
+
+// openState locks the state directory and loads the state from it.
+func openState(dir string) (s *state, err error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create state directory: %v", err)
+	}
+
+	unlock, err := lock(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			unlock()
+		}
+	}()
+
+	b, err := mock.NewFromFixture(filepath.Join(dir, stateFile), options...)
+	if errors.Is(err, fs.ErrNotExist) {
+		b, err = mock.New(options...), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &state{dir: dir, backend: b, unlock: unlock}, nil
+}
+
+// save writes the state into the state directory.
+func (s *state) save() error {
+	if s.unlock == nil {
+		return errors.New("the state directory is not locked")
+	}
+
+	out, err := s.backend.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.dir, stateFile+".tmp")
+	if err := os.WriteFile(tmp, out, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, stateFile))
+}
+
+// close releases the lock on the state directory.
+func (s *state) close() {
+	if s.unlock != nil {
+		s.unlock()
+		s.unlock = nil
+	}
+}
+
+// release saves the state and unlocks the state directory, so that other
+// invocations can use it while a command runs. Use reacquire afterwards.
+func (s *state) release() error {
+	if err := s.save(); err != nil {
+		return err
+	}
+	s.close()
+	return nil
+}
+
+// reacquire locks the state directory again after release, and reloads the
+// state, which other invocations may have changed in the meantime. The changes
+// that the command made to the files of the distro since before are kept.
+func (s *state) reacquire(distro string, before map[string]mock.FileFixture) (err error) {
+	unlock, err := lock(s.dir)
+	if err != nil {
+		return err
+	}
+	s.unlock = unlock
+	defer func() {
+		// The state in memory is outdated: it must not be saved
+		if err != nil {
+			s.close()
+		}
+	}()
+
+	after, err := s.files(distro)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.ReadFile(filepath.Join(s.dir, stateFile))
+	if err != nil {
+		return fmt.Errorf("could not reload state: %v", err)
+	}
+	var f mock.Fixture
+	if err := yaml.Unmarshal(out, &f); err != nil {
+		return fmt.Errorf("could not reload state: %v", err)
+	}
+
+	for i := range f.Distros {
+		// The distro may have been unregistered in the meantime
+		if f.Distros[i].Name != distro {
+			continue
+		}
+
+		files := f.Distros[i].Files
+		if files == nil {
+			files = make(map[string]mock.FileFixture)
+		}
+		for name, file := range after {
+			if old, ok := before[name]; !ok || old != file {
+				files[name] = file
+			}
+		}
+		for name := range before {
+			if _, ok := after[name]; !ok {
+				delete(files, name)
+			}
+		}
+		f.Distros[i].Files = files
+	}
+
+	if out, err = yaml.Marshal(f); err != nil {
+		return err
+	}
+	b, err := mock.NewFromFixtureFS(fstest.MapFS{stateFile: {Data: out}}, stateFile, options...)
+	if err != nil {
+		return fmt.Errorf("could not reload state: %v", err)
+	}
+	s.backend = b
+
+	return nil
+}
+
+// files returns the files of a distro in the state in memory.
+func (s *state) files(distro string) (map[string]mock.FileFixture, error) {
+	out, err := s.backend.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	var f mock.Fixture
+	if err := yaml.Unmarshal(out, &f); err != nil {
+		return nil, err
+	}
+
+	for _, d := range f.Distros {
+		if d.Name == distro {
+			return d.Files, nil
+		}
+	}
+	return nil, nil
+}
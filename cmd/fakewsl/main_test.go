@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testState = `defaultDistro: Ubuntu
+distros:
+  - name: Ubuntu
+    version: 2
+    files:
+      /etc/hostname: ubuntu
+  - name: Legacy
+    flags: 7 # WSL 1
+`
+
+func TestRun(t *testing.T) {
+	testCases := map[string]struct {
+		args  []string
+		stdin string
+		utf16 bool
+
+		wantExitCode int
+		wantStdout   string
+		wantStderr   string
+	}{
+		"List distros":                          {args: []string{"--list"}, wantStdout: "Windows Subsystem for Linux Distributions:\r\nUbuntu (Default)\r\nLegacy\r\n"},
+		"List distros quietly":                  {args: []string{"-l", "-q"}, wantStdout: "Ubuntu\r\nLegacy\r\n"},
+		"List distros verbosely":                {args: []string{"-l", "-v"}, wantStdout: "  NAME      STATE           VERSION\r\n* Ubuntu    Stopped         2\r\n  Legacy    Stopped         1\r\n"},
+		"List distros in UTF-16":                {args: []string{"-l", "-q"}, utf16: true, wantStdout: "Ubuntu\r\nLegacy\r\n"},
+		"Run a command in a distro":             {args: []string{"-d", "Ubuntu", "--", "cat", "/etc/hostname"}, wantStdout: "ubuntu"},
+		"Run a command in the default distro":   {args: []string{"cat", "/etc/hostname"}, wantStdout: "ubuntu"},
+		"Run a command reading from stdin":      {args: []string{"-d", "Legacy", "-e", "cat"}, stdin: "hello", wantStdout: "hello"},
+		"Command output is not encoded":         {args: []string{"cat", "/etc/hostname"}, utf16: true, wantStdout: "ubuntu"},
+		"Command exits with its own exit code":  {args: []string{"cat", "/nonexistent"}, wantExitCode: 1, wantStderr: "cat: /nonexistent: No such file or directory\n"},
+		"Unknown command exits with code 127":   {args: []string{"frobnicate"}, wantExitCode: 127, wantStderr: "fakewsl: frobnicate: command not found\n"},
+		"Error on unsupported option":           {args: []string{"--install"}, wantExitCode: exitError, wantStdout: "unsupported option --install\r\n"},
+		"Error listing running distros on none": {args: []string{"-l", "--running"}, wantExitCode: exitError, wantStdout: "There are no running distributions.\r\n"},
+		"Error on interactive shell":            {args: []string{}, wantExitCode: exitError, wantStdout: "interactive shells are not supported\r\n"},
+		"Error on invalid WSL version":          {args: []string{"--set-version", "Ubuntu", "3"}, wantExitCode: exitError, wantStdout: "invalid WSL version \"3\"\r\n"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, stateFile), []byte(testState), 0600)
+			require.NoError(t, err, "Setup: could not write state")
+
+			t.Setenv("FAKEWSL_STATE_DIR", dir)
+			if tc.utf16 {
+				t.Setenv("WSL_UTF8", "")
+			} else {
+				t.Setenv("WSL_UTF8", "1")
+			}
+
+			var stdout, stderr bytes.Buffer
+			exitCode := run(tc.args, strings.NewReader(tc.stdin), &stdout, &stderr)
+
+			want := tc.wantStdout
+			if tc.utf16 && tc.args[0] == "-l" {
+				want = encodeUTF16(want)
+			}
+
+			require.Equal(t, tc.wantExitCode, exitCode, "Unexpected exit code. Stderr: %s", stderr.String())
+			require.Equal(t, want, stdout.String(), "Unexpected stdout")
+			require.Equal(t, tc.wantStderr, stderr.String(), "Unexpected stderr")
+		})
+	}
+}
+
+func TestRunPersistsState(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("FAKEWSL_STATE_DIR", dir)
+	t.Setenv("WSL_UTF8", "1")
+
+	wsl := func(args ...string) string {
+		t.Helper()
+
+		var stdout, stderr bytes.Buffer
+		exitCode := run(args, strings.NewReader(""), &stdout, &stderr)
+		require.Zero(t, exitCode, "wsl.exe %s should not have failed. Stdout: %s. Stderr: %s", strings.Join(args, " "), stdout.String(), stderr.String())
+		return stdout.String()
+	}
+
+	tarball := filepath.Join(t.TempDir(), "rootfs.tar")
+	err := os.WriteFile(filepath.Join(dir, stateFile), []byte(testState), 0600)
+	require.NoError(t, err, "Setup: could not write state")
+
+	wsl("--export", "Ubuntu", tarball)
+	wsl("--unregister", "Ubuntu")
+	require.Equal(t, "Legacy\r\n", wsl("-l", "-q"), "Unregistered distro should not be listed")
+
+	wsl("--import", "Imported", `C:\wsl\Imported`, tarball, "--version", "1")
+	wsl("--set-default", "Imported")
+	require.Equal(t, "ubuntu", wsl("cat", "/etc/hostname"), "Imported distro should have the exported files")
+	require.Equal(t, "Imported\r\n", wsl("-l", "--running", "-q"), "Distro should keep running across invocations")
+
+	wsl("--set-version", "Imported", "2")
+	require.Equal(t, "  NAME        STATE           VERSION\r\n* Imported    Stopped         2\r\n  Legacy      Stopped         1\r\n",
+		wsl("-l", "-v"), "Unexpected distros after converting")
+
+	wsl("-d", "Legacy", "ls", "/")
+	wsl("--terminate", "Legacy")
+	wsl("-d", "Imported", "ls", "/")
+	wsl("--shutdown")
+
+	var stdout bytes.Buffer
+	exitCode := run([]string{"-l", "--running"}, strings.NewReader(""), &stdout, &bytes.Buffer{})
+	require.Equal(t, exitError, exitCode, "No distro should be running after shutting down")
+}
+
+func TestRunWithStaleLockFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("FAKEWSL_STATE_DIR", dir)
+	t.Setenv("WSL_UTF8", "1")
+
+	err := os.WriteFile(filepath.Join(dir, stateFile), []byte(testState), 0600)
+	require.NoError(t, err, "Setup: could not write state")
+	// Left behind by an invocation that was killed
+	err = os.WriteFile(filepath.Join(dir, lockFile), nil, 0600)
+	require.NoError(t, err, "Setup: could not write lock file")
+
+	var stdout, stderr bytes.Buffer
+	exitCode := run([]string{"-l", "-q"}, strings.NewReader(""), &stdout, &stderr)
+	require.Zero(t, exitCode, "wsl.exe should not have failed. Stderr: %s", stderr.String())
+	require.Equal(t, "Ubuntu\r\nLegacy\r\n", stdout.String(), "Unexpected stdout")
+}
+
+func TestRunDoesNotLockWhileCommandsRun(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("FAKEWSL_STATE_DIR", dir)
+	t.Setenv("WSL_UTF8", "1")
+
+	err := os.WriteFile(filepath.Join(dir, stateFile), []byte(testState), 0600)
+	require.NoError(t, err, "Setup: could not write state")
+
+	wsl := func(args ...string) string {
+		t.Helper()
+
+		var stdout, stderr bytes.Buffer
+		exitCode := run(args, strings.NewReader(""), &stdout, &stderr)
+		require.Zero(t, exitCode, "wsl.exe %s should not have failed. Stdout: %s. Stderr: %s", strings.Join(args, " "), stdout.String(), stderr.String())
+		return stdout.String()
+	}
+
+	// The command blocks until its stdin is closed
+	stdinR, stdinW := io.Pipe()
+	done := make(chan int)
+	go func() {
+		done <- run([]string{"-d", "Ubuntu", "--", "tee", "/etc/motd"}, stdinR, io.Discard, io.Discard)
+	}()
+	require.Eventually(t, func() bool { return strings.Contains(wsl("-l", "-v"), "Running") },
+		5*time.Second, 10*time.Millisecond, "Setup: the command should have started")
+
+	// Other invocations can use the state while the command runs
+	wsl("--set-default", "Legacy")
+	wsl("-d", "Ubuntu", "--", "tee", "/etc/issue")
+
+	_, err = stdinW.Write([]byte("Welcome"))
+	require.NoError(t, err, "Setup: could not write into stdin")
+	stdinW.Close()
+	require.Zero(t, <-done, "The command should not have failed")
+
+	require.Equal(t, "Welcome", wsl("-d", "Ubuntu", "cat", "/etc/motd"), "The changes made by the command should have been saved")
+	require.Equal(t, "", wsl("-d", "Ubuntu", "cat", "/etc/issue"), "The changes made while the command ran should have been kept")
+	require.Equal(t, "Legacy\r\nUbuntu\r\n", wsl("-l", "-q"), "The changes made while the command ran should have been kept")
+}
+
+func encodeUTF16(s string) string {
+	var b strings.Builder
+	for _, r := range utf16.Encode([]rune(s)) {
+		b.WriteByte(byte(r))
+		b.WriteByte(byte(r >> 8))
+	}
+	return b.String()
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	wsl "github.com/ubuntu/gowsl"
+)
+
+// setter parses the value of a key of the configuration, and returns the function
+// that sets it.
+type setter func(value string) (set func(d *wsl.Distro) error, err error)
+
+// setters are the keys of the configuration that config set can change.
+var setters = map[string]setter{
+	"defaultUID": func(value string) (func(d *wsl.Distro) error, error) {
+		uid, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		//nolint:gosec // ParseUint checked that the UID fits in 32 bits.
+		return func(d *wsl.Distro) error { return d.DefaultUID(uint32(uid)) }, nil
+	},
+	"interopEnabled":       boolSetter((*wsl.Distro).InteropEnabled),
+	"pathAppended":         boolSetter((*wsl.Distro).PathAppended),
+	"driveMountingEnabled": boolSetter((*wsl.Distro).DriveMountingEnabled),
+}
+
+// boolSetter returns the setter of a boolean key of the configuration.
+func boolSetter(set func(d *wsl.Distro, value bool) error) setter {
+	return func(value string) (func(d *wsl.Distro) error, error) {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(d *wsl.Distro) error { return set(d, v) }, nil
+	}
+}
+
+// list shows the registered distros.
+func (c *cli) list(fs *flag.FlagSet, args []string) error {
+	if _, err := c.parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	ctx, err := c.context()
+	if err != nil {
+		return err
+	}
+
+	distros, err := wsl.RegisteredDistros(ctx)
+	if err != nil {
+		return err
+	}
+
+	// There is no default distro when there are no distros at all
+	var defaultName string
+	if len(distros) != 0 {
+		d, err := wsl.DefaultDistro(ctx)
+		if err != nil {
+			return err
+		}
+		defaultName = d.Name()
+	}
+
+	infos := make([]distroInfo, 0, len(distros))
+	for _, d := range distros {
+		info, err := newDistroInfo(d, defaultName)
+		if err != nil {
+			return err
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	return c.print(infos, func(w io.Writer) {
+		fmt.Fprintln(w, "  NAME\tSTATE\tGUID")
+		for _, info := range infos {
+			marker := " "
+			if info.Default {
+				marker = "*"
+			}
+			fmt.Fprintf(w, "%s %s\t%s\t%s\n", marker, info.Name, info.State, info.GUID)
+		}
+	})
+}
+
+// info shows a distro along with its configuration.
+func (c *cli) info(fs *flag.FlagSet, args []string) error {
+	args, err := c.parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	d, err := c.registeredDistro(args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx, err := c.context()
+	if err != nil {
+		return err
+	}
+
+	def, err := wsl.DefaultDistro(ctx)
+	if err != nil {
+		return err
+	}
+
+	info, err := newDistroInfo(d, def.Name())
+	if err != nil {
+		return err
+	}
+
+	conf, err := d.GetConfiguration()
+	if err != nil {
+		return err
+	}
+	info.Configuration = &conf
+
+	return c.print(info, func(w io.Writer) {
+		printRows(w, [][2]string{
+			{"Name", info.Name},
+			{"GUID", info.GUID.String()},
+			{"State", info.State.String()},
+			{"Default", strconv.FormatBool(info.Default)},
+		})
+		printRows(w, configurationRows(conf))
+	})
+}
+
+// state shows the state of a distro, which is NotRegistered if it does not exist.
+func (c *cli) state(fs *flag.FlagSet, args []string) error {
+	d, err := c.distro(fs, args)
+	if err != nil {
+		return err
+	}
+
+	s, err := d.State()
+	if err != nil {
+		return err
+	}
+
+	return c.print(s, func(w io.Writer) {
+		fmt.Fprintln(w, s)
+	})
+}
+
+// configGet shows the configuration of a distro, or one of its keys.
+func (c *cli) configGet(fs *flag.FlagSet, args []string) error {
+	args, err := c.parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+
+	d, err := c.registeredDistro(args[0])
+	if err != nil {
+		return err
+	}
+
+	conf, err := d.GetConfiguration()
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		return c.print(conf, func(w io.Writer) {
+			printRows(w, configurationRows(conf))
+		})
+	}
+
+	value, ok := configurationField(conf, args[1])
+	if !ok {
+		return badUsage(fs, "unknown key %q", args[1])
+	}
+
+	return c.print(value, func(w io.Writer) {
+		if env, ok := value.(map[string]string); ok {
+			for _, v := range environment(env) {
+				fmt.Fprintln(w, v)
+			}
+			return
+		}
+		fmt.Fprintln(w, value)
+	})
+}
+
+// configSet changes keys of the configuration of a distro. The values are all
+// validated before any of them is set.
+func (c *cli) configSet(fs *flag.FlagSet, args []string) error {
+	args, err := c.parseArgs(fs, args, 2, -1)
+	if err != nil {
+		return err
+	}
+
+	var sets []func(d *wsl.Distro) error
+	for _, arg := range args[1:] {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return badUsage(fs, "expected <key>=<value>, got %q", arg)
+		}
+
+		parse, ok := setters[key]
+		if !ok {
+			return badUsage(fs, "key %q cannot be set", key)
+		}
+
+		set, err := parse(value)
+		if err != nil {
+			return badUsage(fs, "invalid value for %s: %v", key, err)
+		}
+		sets = append(sets, set)
+	}
+
+	d, err := c.registeredDistro(args[0])
+	if err != nil {
+		return err
+	}
+
+	for _, set := range sets {
+		if err := set(&d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// register registers a distro from a rootfs tarball.
+func (c *cli) register(fs *flag.FlagSet, args []string) error {
+	args, err := c.parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := c.context()
+	if err != nil {
+		return err
+	}
+
+	d := wsl.NewDistro(ctx, args[0])
+	return d.Register(args[1])
+}
+
+// unregister unregisters a distro, destroying its filesystem.
+func (c *cli) unregister(fs *flag.FlagSet, args []string) error {
+	d, err := c.distro(fs, args)
+	if err != nil {
+		return err
+	}
+
+	return d.Unregister()
+}
+
+// terminate powers off a distro.
+func (c *cli) terminate(fs *flag.FlagSet, args []string) error {
+	args, err := c.parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	d, err := c.registeredDistro(args[0])
+	if err != nil {
+		return err
+	}
+
+	return d.Terminate()
+}
+
+// shutdown powers off WSL, including all distros.
+func (c *cli) shutdown(fs *flag.FlagSet, args []string) error {
+	if _, err := c.parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	ctx, err := c.context()
+	if err != nil {
+		return err
+	}
+
+	return wsl.Shutdown(ctx)
+}
+
+// setDefault makes a distro the default one.
+func (c *cli) setDefault(fs *flag.FlagSet, args []string) error {
+	args, err := c.parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	d, err := c.registeredDistro(args[0])
+	if err != nil {
+		return err
+	}
+
+	return d.SetAsDefault()
+}
+
+// exec runs a command in a distro with the standard streams of gowsl. The
+// arguments after the distro are the command, even if they look like options.
+func (c *cli) exec(fs *flag.FlagSet, args []string) error {
+	cwd := fs.Bool("cwd", false, "run the command in the current working directory instead of the home directory")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	args = fs.Args()
+	if len(args) < 2 {
+		return badUsage(fs, "wrong number of arguments")
+	}
+
+	ctx, err := c.context()
+	if err != nil {
+		return err
+	}
+
+	d := wsl.NewDistro(ctx, args[0])
+	cmd := d.Command(ctx, strings.Join(args[1:], " "))
+	cmd.UseCWD = *cwd
+	cmd.Stdin = c.stdin
+	cmd.Stdout = c.stdout
+	cmd.Stderr = c.stderr
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return exitCodeError(exitErr.ExitCode())
+	}
+
+	return err
+}
+
+// shell starts an interactive session in a distro.
+func (c *cli) shell(fs *flag.FlagSet, args []string) error {
+	cwd := fs.Bool("cwd", false, "start the shell in the current working directory instead of the home directory")
+	command := fs.String("command", "", "command to run instead of the default shell of the distro")
+
+	d, err := c.distro(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var opts []wsl.ShellOption
+	if *cwd {
+		opts = append(opts, wsl.UseCWD())
+	}
+	if *command != "" {
+		opts = append(opts, wsl.WithCommand(*command))
+	}
+
+	err = d.Shell(opts...)
+	var shellErr *wsl.ShellError
+	if errors.As(err, &shellErr) && shellErr.ExitCode() <= 0xff {
+		return exitCodeError(shellErr.ExitCode())
+	}
+
+	return err
+}
+
+// parseArgs parses the arguments of the command, and returns its positional
+// arguments, of which there must be between minArgs and maxArgs. A negative
+// maxArgs means that there is no limit. Options can be mixed with the positional
+// arguments, until "--".
+func (c *cli) parseArgs(fs *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	var positional []string
+	for {
+		if err := c.parse(fs, args); err != nil {
+			return nil, err
+		}
+
+		rest := fs.Args()
+		if parsed := len(args) - len(rest); parsed > 0 && args[parsed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+
+	if len(positional) < minArgs || (maxArgs >= 0 && len(positional) > maxArgs) {
+		return nil, badUsage(fs, "wrong number of arguments")
+	}
+
+	return positional, nil
+}
+
+// distro parses the arguments of a command that takes a distro as its only
+// positional argument, and returns that distro.
+func (c *cli) distro(fs *flag.FlagSet, args []string) (wsl.Distro, error) {
+	args, err := c.parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return wsl.Distro{}, err
+	}
+
+	ctx, err := c.context()
+	if err != nil {
+		return wsl.Distro{}, err
+	}
+
+	return wsl.NewDistro(ctx, args[0]), nil
+}
+
+// registeredDistro returns the distro with that name, or an error wrapping
+// wsl.ErrNotRegistered if there is none.
+func (c *cli) registeredDistro(name string) (wsl.Distro, error) {
+	ctx, err := c.context()
+	if err != nil {
+		return wsl.Distro{}, err
+	}
+
+	d := wsl.NewDistro(ctx, name)
+	registered, err := d.IsRegistered()
+	if err != nil {
+		return d, err
+	}
+	if !registered {
+		return d, fmt.Errorf("%s: %w", name, wsl.ErrNotRegistered)
+	}
+
+	return d, nil
+}
+
+// newDistroInfo returns what gowsl shows of a registered distro, without its
+// configuration.
+func newDistroInfo(d wsl.Distro, defaultName string) (distroInfo, error) {
+	guid, err := d.GUID()
+	if err != nil {
+		return distroInfo{}, err
+	}
+
+	s, err := d.State()
+	if err != nil {
+		return distroInfo{}, err
+	}
+
+	return distroInfo{
+		Name:    d.Name(),
+		GUID:    guid,
+		State:   s,
+		Default: d.Name() == defaultName,
+	}, nil
+}
@@ -0,0 +1,329 @@
+// Command gowsl manages WSL distros with GoWSL.
+//
+// Usage:
+//
+//	gowsl [options] <command> [arguments]
+//
+// The supported commands are:
+//
+//	list
+//	info <distro>
+//	state <distro>
+//	config get <distro> [<key>]
+//	config set <distro> <key>=<value>...
+//	register <distro> <rootfs>
+//	unregister <distro>
+//	terminate <distro>
+//	shutdown
+//	set-default <distro>
+//	exec [--cwd] <distro> <command>...
+//	shell [--cwd] [--command <command>] <distro>
+//	serve [--addr <address>] [--token-file <file>] [--tls-cert <file> --tls-key <file>]
+//
+// The keys of the configuration are version, defaultUID, interopEnabled, pathAppended,
+// driveMountingEnabled, wslVersion and environment. Only defaultUID, interopEnabled,
+// pathAppended and driveMountingEnabled can be set.
+//
+// exec runs the command with the standard streams of gowsl, whereas shell starts an
+// interactive session on the console, like wsl.exe does.
+//
+// serve exposes the back-end of this machine over HTTP, so that other machines can
+// manage its distros with the remote back-end of package backend/remote. Clients
+// authenticate with the token read from the token file or, without one, from
+// $GOWSL_TOKEN. It runs until it is interrupted.
+//
+// The options can be used before or after the command:
+//
+//	--output <format>      Format of the output: table (default), json, yaml or template.
+//	--template <template>  Go template for --output template. Lists are formatted one
+//	                       distro per line.
+//	--mock-fixture <file>  Manage the distros of a mocked WSL, with the state of the
+//	                       fixture (see package mock), instead of the ones of this
+//	                       machine. The changes are saved into the fixture, which is
+//	                       created if missing.
+//
+// The exit codes are:
+//
+//	0  Success.
+//	1  Failure.
+//	2  Invalid usage.
+//	3  The distro is not registered.
+//	4  The distro is already registered.
+//	5  WSL is busy or unavailable: the command may succeed if retried.
+//
+// Once their command runs, exec and shell exit with its exit code instead.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/mock"
+)
+
+// The exit codes of gowsl.
+const (
+	exitOK                = 0
+	exitError             = 1
+	exitUsage             = 2
+	exitNotRegistered     = 3
+	exitAlreadyRegistered = 4
+	exitBusy              = 5
+)
+
+// errUsage is returned when the command line is invalid. The error is reported
+// along with the usage before it is returned.
+var errUsage = errors.New("invalid usage")
+
+// exitCodeError is returned by exec and shell when their command fails, so that
+// gowsl exits with the same code.
+type exitCodeError int
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("command exited with code %d", int(e))
+}
+
+// command is a command of gowsl.
+type command struct {
+	name     string // Name of the command, possibly with a subcommand
+	synopsis string // Arguments of the command, as shown in its usage
+	run      func(c *cli, fs *flag.FlagSet, args []string) error
+}
+
+// commands are the commands of gowsl, in the order they are shown in the usage.
+var commands = []command{
+	{name: "list", run: (*cli).list},
+	{name: "info", synopsis: "<distro>", run: (*cli).info},
+	{name: "state", synopsis: "<distro>", run: (*cli).state},
+	{name: "config get", synopsis: "<distro> [<key>]", run: (*cli).configGet},
+	{name: "config set", synopsis: "<distro> <key>=<value>...", run: (*cli).configSet},
+	{name: "register", synopsis: "<distro> <rootfs>", run: (*cli).register},
+	{name: "unregister", synopsis: "<distro>", run: (*cli).unregister},
+	{name: "terminate", synopsis: "<distro>", run: (*cli).terminate},
+	{name: "shutdown", run: (*cli).shutdown},
+	{name: "set-default", synopsis: "<distro>", run: (*cli).setDefault},
+	{name: "exec", synopsis: "[--cwd] <distro> <command>...", run: (*cli).exec},
+	{name: "shell", synopsis: "[--cwd] [--command <command>] <distro>", run: (*cli).shell},
+	{name: "serve", synopsis: "[--addr <address>] [--token-file <file>] [--tls-cert <file> --tls-key <file>]", run: (*cli).serve},
+}
+
+// cli is an invocation of gowsl.
+type cli struct {
+	ctx     context.Context
+	backend backend.Backend
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+
+	// Options
+	output   string
+	template string
+	fixture  string
+
+	// mock is the back-end loaded from the fixture, if any.
+	mock *mock.Backend
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, wsl.DefaultBackend(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes gowsl with the provided arguments against the back-end, and returns
+// its exit code.
+func run(ctx context.Context, b backend.Backend, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{
+		ctx:     ctx,
+		backend: b,
+		stdin:   stdin,
+		stdout:  stdout,
+		stderr:  stderr,
+		output:  "table",
+	}
+
+	err := c.dispatch(args)
+	if saveErr := c.saveFixture(); saveErr != nil {
+		err = errors.Join(err, saveErr)
+	}
+
+	var exitCode exitCodeError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &exitCode):
+		return int(exitCode)
+	case errors.Is(err, errUsage):
+		return exitUsage
+	}
+
+	fmt.Fprintf(stderr, "gowsl: %v\n", err)
+
+	switch {
+	case errors.Is(err, wsl.ErrNotRegistered):
+		return exitNotRegistered
+	case errors.Is(err, wsl.ErrAlreadyRegistered):
+		return exitAlreadyRegistered
+	case backend.IsTransient(err):
+		return exitBusy
+	}
+	return exitError
+}
+
+// dispatch runs the command in args.
+func (c *cli) dispatch(args []string) error {
+	fs := c.flagSet("gowsl", "[options] <command> [arguments]")
+	fs.Usage = func() {
+		fmt.Fprintln(c.stderr, "usage: gowsl [options] <command> [arguments]")
+		fmt.Fprintln(c.stderr, "\nCommands:")
+		for _, cmd := range commands {
+			fmt.Fprintf(c.stderr, "  %s\n", strings.TrimSpace(cmd.name+" "+cmd.synopsis))
+		}
+		fmt.Fprintln(c.stderr, "\nOptions:")
+		fs.PrintDefaults()
+	}
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	args = fs.Args()
+	if len(args) == 0 {
+		return badUsage(fs, "no command")
+	}
+
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) || !slices.Equal(args[:len(words)], words) {
+			continue
+		}
+		return cmd.run(c, c.flagSet(cmd.name, cmd.synopsis), args[len(words):])
+	}
+
+	return badUsage(fs, "unknown command %q", args[0])
+}
+
+// flagSet returns a flag set for the command with the given name, with the
+// options shared by all commands.
+func (c *cli) flagSet(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: gowsl %s\n", strings.TrimSpace(name+" "+synopsis))
+		fs.PrintDefaults()
+	}
+
+	// Defining the flags resets them to their defaults, but the options can be
+	// used before the command too.
+	output, template, fixture := c.output, c.template, c.fixture
+	fs.StringVar(&c.output, "output", "table", "format of the output: table, json, yaml or template")
+	fs.StringVar(&c.template, "template", "", "Go template for --output template")
+	fs.StringVar(&c.fixture, "mock-fixture", "", "manage the distros of a mocked WSL with the state of this fixture")
+	c.output, c.template, c.fixture = output, template, fixture
+
+	return fs
+}
+
+// parse parses the arguments with the flag set, and validates the options.
+func (c *cli) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		// The flag set reported the error already
+		return errUsage
+	}
+
+	switch c.output {
+	case "table", "json", "yaml":
+	case "template":
+		if c.template == "" {
+			return badUsage(fs, "--output template requires --template")
+		}
+		if _, err := newTemplate(c.template); err != nil {
+			return badUsage(fs, "invalid template: %v", err)
+		}
+	default:
+		return badUsage(fs, "unknown output format %q", c.output)
+	}
+
+	return nil
+}
+
+// badUsage reports an error in the arguments of the command along with its
+// usage, and returns errUsage.
+func badUsage(fs *flag.FlagSet, format string, args ...any) error {
+	fmt.Fprintf(fs.Output(), "gowsl: %s\n", fmt.Sprintf(format, args...))
+	fs.Usage()
+	return errUsage
+}
+
+// open returns the back-end that the command manages: the one of the fixture
+// with --mock-fixture, or the back-end of gowsl otherwise.
+func (c *cli) open() (backend.Backend, error) {
+	if c.fixture == "" {
+		return c.backend, nil
+	}
+	if c.mock != nil {
+		return c.mock, nil
+	}
+
+	// Distros are never stopped for idling: each invocation is short-lived
+	opts := []mock.Option{mock.WithIdleTimeout(0)}
+
+	m, err := mock.NewFromFixture(c.fixture, opts...)
+	if errors.Is(err, fs.ErrNotExist) {
+		m, err = mock.New(opts...), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.mock = m
+	return m, nil
+}
+
+// context returns the context to call GoWSL with, so that it uses the back-end
+// that the command manages.
+func (c *cli) context() (context.Context, error) {
+	b, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+	return wsl.WithBackend(c.ctx, b), nil
+}
+
+// saveFixture writes the state of the mocked back-end into the fixture, if it
+// was loaded.
+func (c *cli) saveFixture() error {
+	if c.mock == nil {
+		return nil
+	}
+
+	out, err := c.mock.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(c.fixture), "."+filepath.Base(c.fixture)+".tmp")
+	if err := os.WriteFile(tmp, out, 0600); err != nil {
+		return fmt.Errorf("could not save fixture: %v", err)
+	}
+	if err := os.Rename(tmp, c.fixture); err != nil {
+		return fmt.Errorf("could not save fixture: %v", err)
+	}
+
+	return nil
+}
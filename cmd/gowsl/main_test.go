@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testFixture = `defaultDistro: Ubuntu
+distros:
+  - name: Ubuntu
+    guid: "{0b8e1a6c-2f4d-4e3a-9b7c-5d6e7f8a9b0c}"
+    version: 2
+    defaultUID: 1000
+    flags: 15
+    running: true
+    environment:
+      LANG: C.UTF-8
+  - name: Legacy
+    guid: "{9f3e2d1c-0b4a-4c5d-8e6f-7a8b9c0d1e2f}"
+    version: 2
+    flags: 7 # WSL 1
+    environment:
+      LANG: C
+`
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		args  []string
+		stdin string
+
+		wantExitCode int
+		wantStdout   string
+	}{
+		"List distros": {args: []string{"list"}, wantStdout: "  NAME    STATE    GUID\n" +
+			"  Legacy  Stopped  9f3e2d1c-0b4a-4c5d-8e6f-7a8b9c0d1e2f\n" +
+			"* Ubuntu  Running  0b8e1a6c-2f4d-4e3a-9b7c-5d6e7f8a9b0c\n"},
+		"List distros as JSON": {args: []string{"list", "--output", "json"}, wantStdout: `[
+  {
+    "name": "Legacy",
+    "guid": "9f3e2d1c-0b4a-4c5d-8e6f-7a8b9c0d1e2f",
+    "state": "Stopped",
+    "default": false
+  },
+  {
+    "name": "Ubuntu",
+    "guid": "0b8e1a6c-2f4d-4e3a-9b7c-5d6e7f8a9b0c",
+    "state": "Running",
+    "default": true
+  }
+]
+`},
+		"List distros with a template": {args: []string{"--output", "template", "--template", "{{.Name}} {{.Default}}", "list"}, wantStdout: "Legacy false\nUbuntu true\n"},
+		"Show a distro": {args: []string{"info", "Legacy"}, wantStdout: `Name:                  Legacy
+GUID:                  9f3e2d1c-0b4a-4c5d-8e6f-7a8b9c0d1e2f
+State:                 Stopped
+Default:               false
+Version:               2
+DefaultUID:            0
+InteropEnabled:        true
+PathAppended:          true
+DriveMountingEnabled:  true
+WSLVersion:            1
+Environment:           LANG=C
+`},
+		"Show a distro as YAML": {args: []string{"info", "Ubuntu", "--output", "yaml"}, wantStdout: `name: Ubuntu
+guid: 0b8e1a6c-2f4d-4e3a-9b7c-5d6e7f8a9b0c
+state: Running
+default: true
+configuration:
+  version: 2
+  defaultUID: 1000
+  interopEnabled: true
+  pathAppended: true
+  driveMountingEnabled: true
+  wslVersion: 2
+  environment:
+    LANG: C.UTF-8
+`},
+		"Show the state of a distro":                {args: []string{"state", "Ubuntu"}, wantStdout: "Running\n"},
+		"Show the state of a non-registered distro": {args: []string{"state", "Debian"}, wantStdout: "NotRegistered\n"},
+		"Show a key of the configuration":           {args: []string{"config", "get", "Ubuntu", "defaultUID"}, wantStdout: "1000\n"},
+		"Show a key of the configuration as JSON":   {args: []string{"config", "get", "Ubuntu", "environment", "--output", "json"}, wantStdout: "{\n  \"LANG\": \"C.UTF-8\"\n}\n"},
+		"Run a command":                             {args: []string{"exec", "Ubuntu", "echo", "'Hello!'"}, wantStdout: "Hello!\n"},
+		"Run a command with its exit code":          {args: []string{"exec", "Ubuntu", "exit", "42"}, wantExitCode: 42},
+		"Run a shell with its exit code":            {args: []string{"shell", "--command", "exit 42", "Ubuntu"}, wantExitCode: 42},
+
+		"Error with no command":                         {wantExitCode: exitUsage},
+		"Error with an unknown command":                 {args: []string{"frobnicate"}, wantExitCode: exitUsage},
+		"Error with an unknown output format":           {args: []string{"list", "--output", "xml"}, wantExitCode: exitUsage},
+		"Error with an output template but no template": {args: []string{"list", "--output", "template"}, wantExitCode: exitUsage},
+		"Error with an invalid template":                {args: []string{"list", "--output", "template", "--template", "{{"}, wantExitCode: exitUsage},
+		"Error with the wrong number of arguments":      {args: []string{"info"}, wantExitCode: exitUsage},
+		"Error with an unknown key":                     {args: []string{"config", "get", "Ubuntu", "colour"}, wantExitCode: exitUsage},
+		"Error setting a read-only key":                 {args: []string{"config", "set", "Ubuntu", "version=1"}, wantExitCode: exitUsage},
+		"Error setting an invalid value":                {args: []string{"config", "set", "Ubuntu", "defaultUID=-1"}, wantExitCode: exitUsage},
+		"Error showing a non-registered distro":         {args: []string{"info", "Debian"}, wantExitCode: exitNotRegistered},
+		"Error configuring a non-registered distro":     {args: []string{"config", "set", "Debian", "defaultUID=0"}, wantExitCode: exitNotRegistered},
+		"Error terminating a non-registered distro":     {args: []string{"terminate", "Debian"}, wantExitCode: exitNotRegistered},
+		"Error running in a non-registered distro":      {args: []string{"exec", "Debian", "exit", "0"}, wantExitCode: exitNotRegistered},
+		"Error registering a registered distro":         {args: []string{"register", "Ubuntu", emptyRootFs}, wantExitCode: exitAlreadyRegistered},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			fixture := filepath.Join(t.TempDir(), "fixture.yaml")
+			err := os.WriteFile(fixture, []byte(testFixture), 0600)
+			require.NoError(t, err, "Setup: could not write fixture")
+
+			args := append([]string{"--mock-fixture", fixture}, tc.args...)
+			var stdout, stderr strings.Builder
+			exitCode := run(context.Background(), nil, args, strings.NewReader(tc.stdin), &stdout, &stderr)
+
+			require.Equal(t, tc.wantExitCode, exitCode, "Unexpected exit code. Stderr: %s", stderr.String())
+			require.Equal(t, tc.wantStdout, stdout.String(), "Unexpected stdout")
+			// The exit codes of the commands run by exec and shell are not errors of gowsl
+			if tc.wantExitCode != exitOK && tc.wantExitCode <= exitBusy {
+				require.NotEmpty(t, stderr.String(), "The error should have been printed")
+			}
+		})
+	}
+}
+
+func TestRunPersistsState(t *testing.T) {
+	t.Parallel()
+
+	fixture := filepath.Join(t.TempDir(), "fixture.yaml")
+
+	gowsl := func(args ...string) string {
+		t.Helper()
+
+		var stdout, stderr strings.Builder
+		exitCode := run(context.Background(), nil, append([]string{"--mock-fixture", fixture}, args...), strings.NewReader(""), &stdout, &stderr)
+		require.Zero(t, exitCode, "gowsl %s should not have failed. Stderr: %s", strings.Join(args, " "), stderr.String())
+		return stdout.String()
+	}
+
+	// The fixture is created if missing
+	require.Equal(t, "[]\n", gowsl("list", "--output", "json"), "There should be no distros in a new fixture")
+
+	gowsl("register", "Ubuntu", emptyRootFs)
+	gowsl("register", "Debian", emptyRootFs)
+	gowsl("set-default", "Debian")
+	require.Equal(t, "Debian true\nUbuntu false\n", gowsl("list", "--output", "template", "--template", "{{.Name}} {{.Default}}"),
+		"The default distro should have changed")
+
+	gowsl("config", "set", "Ubuntu", "defaultUID=1000", "interopEnabled=false")
+	require.Equal(t, "1000 false true\n", gowsl("config", "get", "Ubuntu", "--output", "template", "--template", "{{.DefaultUID}} {{.InteropEnabled}} {{.PathAppended}}"),
+		"The configuration should have changed")
+
+	gowsl("exec", "Ubuntu", "exit", "0")
+	require.Equal(t, "Running\n", gowsl("state", "Ubuntu"), "The distro should keep running across invocations")
+	gowsl("terminate", "Ubuntu")
+	require.Equal(t, "Stopped\n", gowsl("state", "Ubuntu"), "The distro should have been terminated")
+
+	gowsl("exec", "Debian", "exit", "0")
+	gowsl("shutdown")
+	require.Equal(t, "Stopped\n", gowsl("state", "Debian"), "The distro should have been shut down")
+
+	gowsl("unregister", "Debian")
+	require.Equal(t, "Ubuntu\n", gowsl("list", "--output", "template", "--template", "{{.Name}}"), "The distro should have been unregistered")
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/google/uuid"
+	wsl "github.com/ubuntu/gowsl"
+	"gopkg.in/yaml.v3"
+)
+
+// distroInfo is what gowsl shows of a distro.
+type distroInfo struct {
+	Name          string             `json:"name" yaml:"name"`
+	GUID          uuid.UUID          `json:"guid" yaml:"guid"`
+	State         wsl.State          `json:"state" yaml:"state"`
+	Default       bool               `json:"default" yaml:"default"`
+	Configuration *wsl.Configuration `json:"configuration,omitempty" yaml:"configuration,omitempty"`
+}
+
+// configurationField returns the value of the key of the configuration, named
+// as in its serialization.
+func configurationField(conf wsl.Configuration, key string) (any, bool) {
+	switch key {
+	case "version":
+		return conf.Version, true
+	case "defaultUID":
+		return conf.DefaultUID, true
+	case "interopEnabled":
+		return conf.InteropEnabled, true
+	case "pathAppended":
+		return conf.PathAppended, true
+	case "driveMountingEnabled":
+		return conf.DriveMountingEnabled, true
+	case "wslVersion":
+		return conf.UndocumentedWSLVersion, true
+	case "environment":
+		return conf.DefaultEnvironmentVariables, true
+	}
+	return nil, false
+}
+
+// configurationRows returns the configuration as key-value pairs, as shown in tables.
+func configurationRows(conf wsl.Configuration) [][2]string {
+	return [][2]string{
+		{"Version", strconv.Itoa(int(conf.Version))},
+		{"DefaultUID", strconv.FormatUint(uint64(conf.DefaultUID), 10)},
+		{"InteropEnabled", strconv.FormatBool(conf.InteropEnabled)},
+		{"PathAppended", strconv.FormatBool(conf.PathAppended)},
+		{"DriveMountingEnabled", strconv.FormatBool(conf.DriveMountingEnabled)},
+		{"WSLVersion", strconv.Itoa(int(conf.UndocumentedWSLVersion))},
+		{"Environment", strings.Join(environment(conf.DefaultEnvironmentVariables), " ")},
+	}
+}
+
+// environment returns the variables as "key=value" pairs, sorted by key.
+func environment(vars map[string]string) []string {
+	env := make([]string, 0, len(vars))
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// print writes v into stdout in the output format. The table is written by the
+// provided function, since each command lays out its data its own way.
+func (c *cli) print(v any, table func(w io.Writer)) error {
+	switch c.output {
+	case "json":
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		enc := yaml.NewEncoder(c.stdout)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "template":
+		return c.printTemplate(v)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// printTemplate executes the template on v, or on each of its elements if it is a
+// slice, followed by a newline.
+func (c *cli) printTemplate(v any) error {
+	tmpl, err := newTemplate(c.template)
+	if err != nil {
+		return err
+	}
+
+	items := []any{v}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+		items = make([]any, rv.Len())
+		for i := range items {
+			items[i] = rv.Index(i).Interface()
+		}
+	}
+
+	for _, item := range items {
+		if err := tmpl.Execute(c.stdout, item); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(c.stdout); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newTemplate parses the template of --output template.
+func newTemplate(text string) (*template.Template, error) {
+	return template.New("output").Option("missingkey=error").Parse(text)
+}
+
+// printRows writes the key-value pairs as a table.
+func printRows(w io.Writer, rows [][2]string) {
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s:\t%s\n", row[0], row[1])
+	}
+}
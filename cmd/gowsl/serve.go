@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ubuntu/gowsl/backend/remote"
+)
+
+// shutdownTimeout is how long the server waits for the requests in progress
+// when it is interrupted. Commands still running after it are abandoned.
+const shutdownTimeout = 5 * time.Second
+
+// serve exposes the back-end over HTTP until the context of gowsl is cancelled.
+// The address it listens on is written into stderr once it is ready.
+func (c *cli) serve(fs *flag.FlagSet, args []string) error {
+	addr := fs.String("addr", "localhost:7070", "address to listen on")
+	tokenFile := fs.String("token-file", "", "file containing the token of the clients (default $GOWSL_TOKEN)")
+	cert := fs.String("tls-cert", "", "certificate to serve HTTPS with")
+	key := fs.String("tls-key", "", "private key of the certificate")
+	if _, err := c.parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if (*cert == "") != (*key == "") {
+		return badUsage(fs, "--tls-cert and --tls-key must be used together")
+	}
+
+	token, err := readToken(*tokenFile)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           remote.NewServer(b, token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	scheme := "http"
+	if *cert != "" {
+		scheme = "https"
+	}
+	fmt.Fprintf(c.stderr, "Listening on %s://%s\n", scheme, l.Addr())
+
+	errs := make(chan error, 1)
+	go func() {
+		if *cert != "" {
+			errs <- srv.ServeTLS(l, *cert, *key)
+			return
+		}
+		errs <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-c.ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return srv.Close()
+	}
+
+	return nil
+}
+
+// readToken returns the token of the clients, from the file if any or otherwise
+// from $GOWSL_TOKEN.
+func readToken(path string) (string, error) {
+	token := os.Getenv("GOWSL_TOKEN")
+	if path != "" {
+		out, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read token: %v", err)
+		}
+		token = string(out)
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", errors.New("no token: set $GOWSL_TOKEN or use --token-file")
+	}
+
+	return token, nil
+}
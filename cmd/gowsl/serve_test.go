@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/backend/remote"
+	"github.com/ubuntu/gowsl/mock"
+)
+
+const emptyRootFs = "../../images/empty.tar.gz"
+
+func TestServe(t *testing.T) {
+	t.Setenv("GOWSL_TOKEN", "token-from-env")
+
+	testCases := map[string]struct {
+		args        []string
+		tokenFile   string
+		clientToken string
+
+		wantErr bool
+	}{
+		"Serve with the token from the environment": {clientToken: "token-from-env"},
+		"Serve with the token from a file":          {tokenFile: "token-from-file\n", clientToken: "token-from-file"},
+
+		"Error on unexpected arguments":          {args: []string{"extra"}, wantErr: true},
+		"Error on a certificate without its key": {args: []string{"--tls-cert", "cert.pem"}, wantErr: true},
+		"Error on a missing token file":          {args: []string{"--token-file", "does-not-exist"}, wantErr: true},
+		"Error on an empty token":                {tokenFile: "\n", wantErr: true},
+		"Error on an address in use":             {args: []string{"--addr", "localhost:-1"}, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			args := append([]string{"--addr", "127.0.0.1:0"}, tc.args...)
+			if tc.tokenFile != "" {
+				path := filepath.Join(t.TempDir(), "token")
+				require.NoError(t, os.WriteFile(path, []byte(tc.tokenFile), 0600), "Setup: could not write token file")
+				args = append(args, "--token-file", path)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			stderrR, stderrW := io.Pipe()
+			exitCodes := make(chan int, 1)
+			go func() {
+				defer stderrW.Close()
+				exitCodes <- run(ctx, mock.New(), append([]string{"serve"}, args...), nil, io.Discard, stderrW)
+			}()
+
+			line, _ := bufio.NewReader(stderrR).ReadString('\n')
+			go func() { _, _ = io.Copy(io.Discard, stderrR) }()
+
+			if tc.wantErr {
+				require.NotEqual(t, exitOK, <-exitCodes, "serve should have failed")
+				return
+			}
+
+			url, ok := strings.CutPrefix(strings.TrimSpace(line), "Listening on ")
+			require.Truef(t, ok, "serve should have written the address it listens on, got %q", line)
+
+			// The distros of the mock are managed over loopback
+			d := wsl.NewDistro(wsl.WithBackend(ctx, remote.NewClient(url, tc.clientToken)), "Ubuntu")
+			require.NoError(t, d.Register(emptyRootFs), "Register should not have failed")
+			out, err := d.Command(ctx, "echo 'Hello!'").Output()
+			require.NoError(t, err, "Output should not have failed")
+			require.Equal(t, "Hello!\n", string(out), "Unexpected output")
+
+			_, err = remote.NewClient(url, "wrong-token").State("Ubuntu")
+			require.Error(t, err, "Clients with the wrong token should be rejected")
+
+			cancel()
+			select {
+			case exitCode := <-exitCodes:
+				require.Equal(t, exitOK, exitCode, "serve should have stopped without errors")
+			case <-time.After(10 * time.Second):
+				require.Fail(t, "serve should have stopped once interrupted")
+			}
+		})
+	}
+}
@@ -8,12 +8,11 @@ package gowsl
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
 	"github.com/ubuntu/decorate"
-	"github.com/ubuntu/gowsl/internal/backend"
+	"github.com/ubuntu/gowsl/backend"
 	"github.com/ubuntu/gowsl/internal/flags"
 	"github.com/ubuntu/gowsl/internal/state"
 )
@@ -21,6 +20,7 @@ import (
 // Distro is an abstraction around a WSL distro.
 type Distro struct {
 	backend backend.Backend
+	auditor *auditor
 	name    string
 }
 
@@ -33,6 +33,7 @@ const (
 	Stopped       = state.Stopped
 	Running       = state.Running
 	Installing    = state.Installing
+	Uninstalling  = state.Uninstalling
 	NonRegistered = state.NotRegistered
 )
 
@@ -41,6 +42,7 @@ const (
 func NewDistro(ctx context.Context, name string) Distro {
 	return Distro{
 		backend: selectBackend(ctx),
+		auditor: selectAuditor(ctx),
 		name:    name,
 	}
 }
@@ -60,7 +62,7 @@ func (d *Distro) GUID() (id uuid.UUID, err error) {
 	}
 	id, ok := distros[d.Name()]
 	if !ok {
-		return id, errors.New("distro is not registered")
+		return id, ErrNotRegistered
 	}
 	return id, nil
 }
@@ -85,7 +87,9 @@ func (d *Distro) State() (s State, err error) {
 //
 //	wsl --terminate <distro>
 func (d *Distro) Terminate() error {
-	return d.backend.Terminate(d.Name())
+	return d.audited("Terminate", nil, func() error {
+		return d.backend.Terminate(d.Name())
+	})
 }
 
 // Shutdown powers off all of WSL, including all other distros.
@@ -93,7 +97,8 @@ func (d *Distro) Terminate() error {
 //
 //	wsl --shutdown
 func Shutdown(ctx context.Context) error {
-	return selectBackend(ctx).Shutdown()
+	b := selectBackend(ctx)
+	return selectAuditor(ctx).audited(b, "Shutdown", b.Shutdown)
 }
 
 // SetAsDefault sets a particular distribution as the default one.
@@ -101,7 +106,9 @@ func Shutdown(ctx context.Context) error {
 //
 //	wsl --set-default <distro>
 func (d *Distro) SetAsDefault() error {
-	return d.backend.SetAsDefault(d.Name())
+	return d.audited("SetAsDefault", nil, func() error {
+		return d.backend.SetAsDefault(d.Name())
+	})
 }
 
 // DefaultDistro gets the current default distribution.
@@ -225,8 +232,8 @@ func (d Distro) GetConfiguration() (c Configuration, err error) {
 	return conf, nil
 }
 
-// String deserializes a distro its GUID and its configuration as a yaml string.
-// If there is an error, it is printed as part of the yaml.
+// String returns the name of the distro and its GUID, or whether it is not
+// registered. Use MarshalJSON or MarshalYAML for its state and configuration.
 func (d Distro) String() string {
 	guid, err := d.GUID()
 	if err != nil {
@@ -247,5 +254,7 @@ func (d *Distro) configure(config Configuration) error {
 		return err
 	}
 
-	return d.backend.WslConfigureDistribution(d.Name(), config.DefaultUID, flags)
+	return d.audited("Configure", &config, func() error {
+		return d.backend.WslConfigureDistribution(d.Name(), config.DefaultUID, flags)
+	})
 }
@@ -0,0 +1,175 @@
+package gowsl
+
+// This file contains the dry-run mode, in which the operations that change WSL
+// are recorded instead of performed.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/internal/flags"
+)
+
+type dryRunQueryType int
+
+const dryRunQuery dryRunQueryType = 0
+
+// PlannedOperation is an operation that was not performed because its context
+// was in dry-run mode. See WithDryRun.
+type PlannedOperation struct {
+	Operation string `json:"operation" yaml:"operation"`                 // Name of the operation, such as "Register" or "Command"
+	Distro    string `json:"distro,omitempty" yaml:"distro,omitempty"`   // Distro the operation acts upon, if any
+	Details   string `json:"details,omitempty" yaml:"details,omitempty"` // Arguments of the operation, such as the rootfs or the command
+}
+
+func (op PlannedOperation) String() string {
+	s := op.Operation
+	if op.Distro != "" {
+		s += " " + op.Distro
+	}
+	if op.Details != "" {
+		s += ": " + op.Details
+	}
+	return s
+}
+
+// dryRunPlan is the list of operations planned with a dry-run context.
+type dryRunPlan struct {
+	mu  sync.Mutex
+	ops []PlannedOperation
+}
+
+func (p *dryRunPlan) record(operation, distro, details string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ops = append(p.ops, PlannedOperation{Operation: operation, Distro: distro, Details: details})
+}
+
+// WithDryRun puts the context in dry-run mode. Operations made with it or its
+// children that would change WSL are recorded into a plan instead of performed.
+// These are Register, Unregister, Terminate, Shutdown, SetAsDefault, the
+// configuration setters, and the commands launched with Command or Shell, which
+// succeed without output. Retrieve the plan with DryRunPlan.
+//
+// Read-only operations, such as State or GetConfiguration, are still performed.
+// Because of this, the plan does not see its own effects: for instance, a distro
+// registered in dry-run mode is still not registered.
+//
+// A context that is already in dry-run mode is returned as is, so that all the
+// operations are recorded into the same plan.
+func WithDryRun(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(dryRunQuery).(*dryRunPlan); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, dryRunQuery, &dryRunPlan{})
+}
+
+// DryRunPlan returns the operations planned so far with a context in dry-run
+// mode, in order. It returns false if the context is not in dry-run mode.
+func DryRunPlan(ctx context.Context) ([]PlannedOperation, bool) {
+	p, ok := ctx.Value(dryRunQuery).(*dryRunPlan)
+	if !ok {
+		return nil, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]PlannedOperation{}, p.ops...), true
+}
+
+// dryRun wraps the back-end of a dry-run context, so that the distros created
+// with it keep planning their operations.
+func dryRun(ctx context.Context, b backend.Backend) backend.Backend {
+	p, ok := ctx.Value(dryRunQuery).(*dryRunPlan)
+	if !ok {
+		return b
+	}
+	if d, ok := b.(dryRunBackend); ok && d.plan == p {
+		return b
+	}
+	return dryRunBackend{Backend: b, plan: p}
+}
+
+// dryRunPlanOf returns the plan of the back-end if it is in dry-run mode.
+func dryRunPlanOf(b backend.Backend) (*dryRunPlan, bool) {
+	d, ok := b.(dryRunBackend)
+	if !ok {
+		return nil, false
+	}
+	return d.plan, true
+}
+
+// dryRunBackend is a back-end that records the calls that would change WSL
+// instead of performing them. The read-only ones are forwarded.
+type dryRunBackend struct {
+	backend.Backend
+	plan *dryRunPlan
+}
+
+func (b dryRunBackend) Shutdown() error {
+	b.plan.record("Shutdown", "", "")
+	return nil
+}
+
+func (b dryRunBackend) Terminate(distroName string) error {
+	b.plan.record("Terminate", distroName, "")
+	return nil
+}
+
+func (b dryRunBackend) SetAsDefault(distroName string) error {
+	b.plan.record("SetAsDefault", distroName, "")
+	return nil
+}
+
+func (b dryRunBackend) WslConfigureDistribution(distributionName string, defaultUID uint32, wslDistributionFlags backend.WslFlags) error {
+	f := flags.Unpack(wslDistributionFlags)
+	b.plan.record("Configure", distributionName, fmt.Sprintf("defaultUID=%d interopEnabled=%t pathAppended=%t driveMountingEnabled=%t",
+		defaultUID, f.InteropEnabled, f.PathAppended, f.DriveMountingEnabled))
+	return nil
+}
+
+func (b dryRunBackend) WslLaunch(distroName string, command string, useCWD bool, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	// Cmd.Start checks for dry runs before launching anything: this is a safety net.
+	return nil, fmt.Errorf("could not launch %q in distro %s: dry run", command, distroName)
+}
+
+func (b dryRunBackend) WslLaunchEnv(distroName string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	return b.WslLaunch(distroName, command, useCWD, stdin, stdout, stderr)
+}
+
+func (b dryRunBackend) WslLaunchAs(distroName string, user string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	return b.WslLaunch(distroName, command, useCWD, stdin, stdout, stderr)
+}
+
+func (b dryRunBackend) WslLaunchInteractive(distributionName string, command string, useCurrentWorkingDirectory bool) (uint32, error) {
+	b.plan.record("Shell", distributionName, command)
+	return 0, nil
+}
+
+func (b dryRunBackend) WslRegisterDistribution(distributionName string, tarGzFilename string) error {
+	b.plan.record("Register", distributionName, tarGzFilename)
+	return nil
+}
+
+func (b dryRunBackend) WslUnregisterDistribution(distributionName string) error {
+	b.plan.record("Unregister", distributionName, "")
+	return nil
+}
+
+// dryRunPlan returns the plan that the command is recorded into, if either its
+// distro or its context is in dry-run mode.
+func (c *Cmd) dryRunPlan() (*dryRunPlan, bool) {
+	if p, ok := dryRunPlanOf(c.distro.backend); ok {
+		return p, true
+	}
+	if c.ctx == nil {
+		return nil, false
+	}
+	p, ok := c.ctx.Value(dryRunQuery).(*dryRunPlan)
+	return p, ok
+}
@@ -0,0 +1,109 @@
+package gowsl_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/mock"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	if wsl.MockAvailable() {
+		t.Parallel()
+		ctx = wsl.WithMock(ctx, mock.New())
+	}
+
+	d := newTestDistro(t, ctx, emptyRootFs)
+	require.NoError(t, d.Terminate(), "Setup: could not terminate the test distro")
+
+	wantConf, err := d.GetConfiguration()
+	require.NoError(t, err, "Setup: could not get the configuration of the test distro")
+
+	_, ok := wsl.DryRunPlan(ctx)
+	require.False(t, ok, "The context should not be in dry-run mode before calling WithDryRun")
+
+	dryCtx := wsl.WithDryRun(ctx)
+	require.Equal(t, dryCtx, wsl.WithDryRun(dryCtx), "WithDryRun should return contexts already in dry-run mode as they are")
+
+	plan, ok := wsl.DryRunPlan(dryCtx)
+	require.True(t, ok, "The context should be in dry-run mode")
+	require.Empty(t, plan, "The plan should be empty before any operation")
+
+	dry := wsl.NewDistro(dryCtx, d.Name())
+	newDistro := wsl.NewDistro(dryCtx, uniqueDistroName(t))
+	rootFs, err := filepath.Abs(emptyRootFs)
+	require.NoError(t, err, "Setup: could not get the absolute path of the rootfs")
+
+	// Read-only operations are performed
+	gotConf, err := dry.GetConfiguration()
+	require.NoError(t, err, "GetConfiguration should not have failed in dry-run mode")
+	require.Equal(t, wantConf, gotConf, "GetConfiguration should have returned the actual configuration")
+
+	// Operations that change WSL are recorded
+	require.NoError(t, dry.DefaultUID(1000), "DefaultUID should not have failed in dry-run mode")
+	require.NoError(t, dry.InteropEnabled(false), "InteropEnabled should not have failed in dry-run mode")
+	require.NoError(t, dry.SetAsDefault(), "SetAsDefault should not have failed in dry-run mode")
+
+	out, err := dry.Command(ctx, "exit 42").Output()
+	require.NoError(t, err, "Command should have succeeded in dry-run mode")
+	require.Empty(t, out, "Command should have had no output in dry-run mode")
+
+	// Commands honour the dry-run mode of their own context too
+	require.NoError(t, d.Command(dryCtx, "exit 42").Run(), "Command should have succeeded with a dry-run context")
+
+	cmd := dry.Command(ctx, "exit 0")
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err, "StdoutPipe should not have failed in dry-run mode")
+	require.NoError(t, cmd.Start(), "Start should not have failed in dry-run mode")
+	require.Error(t, cmd.Start(), "Start should have failed when called twice in dry-run mode")
+	buff := make([]byte, 1)
+	_, err = stdout.Read(buff)
+	require.Error(t, err, "Stdout should be closed in dry-run mode")
+	require.NoError(t, cmd.Wait(), "Wait should not have failed in dry-run mode")
+	require.Error(t, cmd.Wait(), "Wait should have failed when called twice in dry-run mode")
+
+	require.NoError(t, dry.Terminate(), "Terminate should not have failed in dry-run mode")
+	require.NoError(t, newDistro.Register(emptyRootFs), "Register should not have failed in dry-run mode")
+	require.NoError(t, dry.Unregister(), "Unregister should not have failed in dry-run mode")
+	require.NoError(t, wsl.Shutdown(dryCtx), "Shutdown should not have failed in dry-run mode")
+
+	// Preconditions are still checked
+	require.ErrorIs(t, newDistro.Unregister(), wsl.ErrNotRegistered, "Unregister should have failed on a distro that is not registered")
+
+	plan, ok = wsl.DryRunPlan(dryCtx)
+	require.True(t, ok, "The context should be in dry-run mode")
+	require.Equal(t, []wsl.PlannedOperation{
+		{Operation: "Configure", Distro: d.Name(), Details: "defaultUID=1000 interopEnabled=true pathAppended=true driveMountingEnabled=true"},
+		{Operation: "Configure", Distro: d.Name(), Details: "defaultUID=0 interopEnabled=false pathAppended=true driveMountingEnabled=true"},
+		{Operation: "SetAsDefault", Distro: d.Name()},
+		{Operation: "Command", Distro: d.Name(), Details: "exit 42"},
+		{Operation: "Command", Distro: d.Name(), Details: "exit 42"},
+		{Operation: "Command", Distro: d.Name(), Details: "exit 0"},
+		{Operation: "Terminate", Distro: d.Name()},
+		{Operation: "Register", Distro: newDistro.Name(), Details: rootFs},
+		{Operation: "Unregister", Distro: d.Name()},
+		{Operation: "Shutdown"},
+	}, plan, "Unexpected plan")
+	require.Equal(t, "Register "+newDistro.Name()+": "+rootFs, plan[7].String(), "Unexpected description of the planned operation")
+
+	// Nothing changed
+	registered, err := d.IsRegistered()
+	require.NoError(t, err, "IsRegistered should not have failed")
+	require.True(t, registered, "The test distro should still be registered")
+
+	registered, err = newDistro.IsRegistered()
+	require.NoError(t, err, "IsRegistered should not have failed")
+	require.False(t, registered, "The new distro should not have been registered")
+
+	state, err := d.State()
+	require.NoError(t, err, "State should not have failed")
+	require.Equal(t, wsl.Stopped, state, "The test distro should not have been started")
+
+	gotConf, err = d.GetConfiguration()
+	require.NoError(t, err, "GetConfiguration should not have failed")
+	require.Equal(t, wantConf, gotConf, "The configuration should not have changed")
+}
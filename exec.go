@@ -14,6 +14,7 @@ import (
 	"sync"
 
 	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/backend"
 )
 
 // Cmd is a wrapper around the Windows process spawned by WslLaunch.
@@ -28,6 +29,19 @@ type Cmd struct {
 	Stderr io.Writer // Writer to write stdout into
 	UseCWD bool      // Whether WSL is launched in the current working directory (true) or the home directory (false)
 
+	// Env contains additional environment variables, in the form "key=value" and in their Windows format.
+	// They are forwarded into the distro via WSLENV. They are passed to the process that launches WSL,
+	// so the environment of the current process is left untouched: the back-end must be a
+	// backend.EnvLauncher.
+	Env []string
+	// WSLEnv contains the WSLENV flags for the variables in Env, and any other variable of the current
+	// process to forward into the distro. It is appended to the WSLENV of the process that launches WSL.
+	WSLEnv WSLEnv
+	// User is the name of the user of the distro to run the command as. If it is empty, the command
+	// runs as the default user (see DefaultUID). Running it as another user does not change the
+	// default user: the back-end must be a backend.UserLauncher.
+	User string
+
 	// Immutable parameters
 	distro  *Distro // The distro that the command will be launched into.
 	command string  // The command to be launched
@@ -47,6 +61,7 @@ type Cmd struct {
 	Process      *os.Process      // The windows handle to the WSL process
 	finished     bool             // Flag to fail nicely when Wait is invoked twice
 	ProcessState *os.ProcessState // Status of the process. Cached because it cannot be read after the process is closed.
+	dryRun       bool             // Flag to signal that the command was only recorded into a dry-run plan
 
 	// Context management
 	ctx context.Context // Context to kill the process before it finishes
@@ -73,6 +88,16 @@ func (d *Distro) Command(ctx context.Context, cmd string) *Cmd {
 	}
 }
 
+// Setenv adds a variable to the command's environment and forwards it into
+// the distro with the given WSLENV flags. For instance, a Windows path can be
+// forwarded as a Linux path with:
+//
+//	cmd.Setenv("PROJECT", `C:\Users\me\project`, gowsl.WSLEnvPath)
+func (c *Cmd) Setenv(name, value string, flags ...WSLEnvFlag) {
+	c.Env = append(c.Env, name+"="+value)
+	c.WSLEnv.Set(name, flags...)
+}
+
 // Start starts the specified command but does not wait for it to complete.
 //
 // The Wait method will return the exit code and release associated resources
@@ -86,10 +111,10 @@ func (c *Cmd) Start() (err error) {
 		return err
 	}
 	if !r {
-		return errors.New("distro is not registered")
+		return ErrNotRegistered
 	}
 
-	if c.Process != nil {
+	if c.Process != nil || c.dryRun {
 		return errors.New("already started")
 	}
 
@@ -103,6 +128,13 @@ func (c *Cmd) Start() (err error) {
 		}
 	}
 
+	if p, ok := c.dryRunPlan(); ok {
+		p.record("Command", c.distro.Name(), c.command)
+		c.dryRun = true
+		c.closeDescriptors(c.closeAfterStart)
+		return nil
+	}
+
 	type F func(*Cmd) error
 	for _, setupFd := range []F{(*Cmd).stdin, (*Cmd).stdout, (*Cmd).stderr} {
 		err := setupFd(c)
@@ -113,15 +145,7 @@ func (c *Cmd) Start() (err error) {
 		}
 	}
 
-	c.Process, err = c.distro.backend.WslLaunch(
-		c.distro.Name(),
-		c.command,
-		c.UseCWD,
-		c.stdinR,
-		c.stdoutW,
-		c.stderrW,
-	)
-
+	err = c.launch()
 	if err != nil {
 		c.closeDescriptors(c.closeAfterStart)
 		c.closeDescriptors(c.closeAfterWait)
@@ -155,6 +179,29 @@ func (c *Cmd) Start() (err error) {
 	return nil
 }
 
+// launch launches the command with the back-end. Commands with environment
+// variables are launched with WslLaunchEnv, so that the environment of the
+// current process is left untouched, and commands with a user with WslLaunchAs.
+func (c *Cmd) launch() (err error) {
+	env, err := launchEnv(c.Env, c.WSLEnv)
+	if err != nil {
+		return err
+	}
+
+	if c.User != "" {
+		c.Process, err = backend.WslLaunchAs(c.distro.backend, c.distro.Name(), c.User, c.command, c.UseCWD, env, c.stdinR, c.stdoutW, c.stderrW)
+		return err
+	}
+
+	if env == nil {
+		c.Process, err = c.distro.backend.WslLaunch(c.distro.Name(), c.command, c.UseCWD, c.stdinR, c.stdoutW, c.stderrW)
+		return err
+	}
+
+	c.Process, err = backend.WslLaunchEnv(c.distro.backend, c.distro.Name(), c.command, c.UseCWD, env, c.stdinR, c.stdoutW, c.stderrW)
+	return err
+}
+
 // Output runs the command and returns its standard output.
 // Any returned error will usually be of type *ExitError.
 // If c.Stderr was nil, Output populates ExitError.Stderr.
@@ -215,7 +262,7 @@ func (c *Cmd) StdinPipe() (w io.WriteCloser, err error) {
 	if c.Stdin != nil {
 		return nil, errors.New("Stdin already set")
 	}
-	if c.Process != nil {
+	if c.Process != nil || c.dryRun {
 		return nil, errors.New("StdinPipe after process started")
 	}
 	pr, pw, err := os.Pipe()
@@ -262,7 +309,7 @@ func (c *Cmd) StdoutPipe() (r io.ReadCloser, err error) {
 	if c.Stdout != nil {
 		return nil, errors.New("Stdout already set")
 	}
-	if c.Process != nil {
+	if c.Process != nil || c.dryRun {
 		return nil, errors.New("StdoutPipe after process started")
 	}
 	pr, pw, err := os.Pipe()
@@ -289,7 +336,7 @@ func (c *Cmd) StderrPipe() (r io.ReadCloser, err error) {
 	if c.Stderr != nil {
 		return nil, errors.New("Stderr already set")
 	}
-	if c.Process != nil {
+	if c.Process != nil || c.dryRun {
 		return nil, errors.New("StderrPipe after process started")
 	}
 	pr, pw, err := os.Pipe()
@@ -454,7 +501,7 @@ func (c *Cmd) Wait() (err error) {
 	defer decorate.OnError(&err, "in call to Cmd.Wait on distro %s with command %q", c.distro.name, c.command)
 
 	// Based on exec/exec.go.
-	if c.Process == nil {
+	if c.Process == nil && !c.dryRun {
 		return errors.New("not started")
 	}
 	if c.finished {
@@ -462,6 +509,12 @@ func (c *Cmd) Wait() (err error) {
 	}
 	c.finished = true
 
+	if c.dryRun {
+		// The command was not launched, so it succeeds without output.
+		c.closeDescriptors(c.closeAfterWait)
+		return nil
+	}
+
 	state, err := c.Process.Wait()
 	if c.waitDone != nil {
 		close(c.waitDone)
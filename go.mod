@@ -1,6 +1,6 @@
 module github.com/ubuntu/gowsl
 
-go 1.20
+go 1.21
 
 require golang.org/x/sys v0.6.0
 
@@ -16,5 +16,5 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.8.1
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,205 @@
+// Package interop contains the back-end used when running inside a WSL distro.
+// It manages the distros through WSL interop, by calling wsl.exe and reg.exe on
+// the Windows host, so that a GoWSL program can manage its sibling distros.
+//
+// Both executables are looked up in the PATH, so the back-end can be tested by
+// placing stand-ins for them there.
+package interop
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ubuntu/gowsl/internal/backend/windows"
+	"github.com/ubuntu/gowsl/paths"
+	"github.com/ubuntu/gowsl/wslconf"
+)
+
+// binfmtInterop are the entries registered in binfmt_misc when WSL interop is enabled.
+// The "-late" variant is used by distros that run systemd.
+var binfmtInterop = []string{
+	"/proc/sys/fs/binfmt_misc/WSLInterop",
+	"/proc/sys/fs/binfmt_misc/WSLInterop-late",
+}
+
+// Available returns true if the current process is running inside a WSL distro
+// with interop enabled.
+func Available() bool {
+	return available(binfmtInterop)
+}
+
+// available returns true if WSL registered any of the binfmt_misc entries, and
+// enabled it. WSL_DISTRO_NAME alone is not enough, as it is set even when
+// interop is disabled in wsl.conf.
+func available(entries []string) bool {
+	if os.Getenv("WSL_DISTRO_NAME") == "" {
+		return false
+	}
+
+	for _, p := range entries {
+		out, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		// The first line is the status of the entry: enabled or disabled
+		if status, _, _ := strings.Cut(string(out), "\n"); status == "enabled" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Backend implements the Backend interface.
+//
+// Its state is kept behind a pointer so that back-ends, and the distros that hold
+// them, remain comparable.
+type Backend struct {
+	*config
+}
+
+// config is the state of a Backend.
+type config struct {
+	wsl        windows.Backend  // Back-end for the methods that only call wsl.exe
+	wslExe     string           // Path to wsl.exe
+	regExe     string           // Path to reg.exe
+	executor   windows.Executor // Constructs the commands that call Windows executables
+	installDir string           // Windows directory where new distros are installed
+	translator paths.Translator // Translates the paths of this distro into Windows paths
+}
+
+// Option is an optional parameter for New. Use any of the provided functions
+// such as WithInstallDir().
+type Option func(*options)
+
+type options struct {
+	wslExe     string
+	regExe     string
+	executor   windows.Executor
+	installDir string
+	translator *paths.Translator
+}
+
+// WithWslExe is an optional parameter for New that sets the path to wsl.exe.
+// Otherwise, wsl.exe is looked up in the PATH.
+func WithWslExe(path string) Option {
+	return func(o *options) {
+		o.wslExe = path
+	}
+}
+
+// WithRegExe is an optional parameter for New that sets the path to reg.exe.
+// Otherwise, reg.exe is looked up in the PATH.
+func WithRegExe(path string) Option {
+	return func(o *options) {
+		o.regExe = path
+	}
+}
+
+// WithExecutor is an optional parameter for New that sets how the commands that
+// call Windows executables are constructed. Otherwise, exec.Command is used.
+func WithExecutor(e windows.Executor) Option {
+	return func(o *options) {
+		o.executor = e
+	}
+}
+
+// WithInstallDir is an optional parameter for New that sets the Windows directory
+// under which registered distros are installed, each in a subdirectory named after
+// it. Otherwise, %LOCALAPPDATA%\GoWSL is used.
+func WithInstallDir(windowsPath string) Option {
+	return func(o *options) {
+		o.installDir = windowsPath
+	}
+}
+
+// WithPathTranslator is an optional parameter for New that sets how the paths of
+// this distro are translated into Windows paths. Otherwise, the distro name is
+// taken from $WSL_DISTRO_NAME and the automount root from /etc/wsl.conf.
+func WithPathTranslator(t paths.Translator) Option {
+	return func(o *options) {
+		o.translator = &t
+	}
+}
+
+// New constructs a new interop back-end.
+func New(args ...Option) Backend {
+	opts := options{
+		wslExe:   "wsl.exe",
+		regExe:   "reg.exe",
+		executor: exec.Command,
+	}
+	for _, f := range args {
+		f(&opts)
+	}
+
+	if opts.translator == nil {
+		t := defaultTranslator()
+		opts.translator = &t
+	}
+
+	b := Backend{&config{
+		wslExe:     opts.wslExe,
+		regExe:     opts.regExe,
+		executor:   opts.executor,
+		installDir: opts.installDir,
+		translator: *opts.translator,
+	}}
+	b.wsl = windows.New(windows.WithWslExe(b.wslExe), windows.WithExecutor(b.command))
+
+	return b
+}
+
+// command returns the command that calls a Windows executable. The variables
+// listed in extraEnv are shared with it via $WSLENV, as otherwise interop
+// does not forward them.
+func (b Backend) command(name string, args ...string) *exec.Cmd {
+	cmd := b.executor(name, args...)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+
+	shared := extraEnv
+	if wslenv := os.Getenv("WSLENV"); wslenv != "" {
+		shared = wslenv + ":" + shared
+	}
+	cmd.Env = append(cmd.Env, "WSLENV="+shared)
+
+	return cmd
+}
+
+// extraEnv are the variables shared with Windows executables, in $WSLENV format.
+const extraEnv = "WSL_UTF8"
+
+// wslExeCommand returns the command that calls wsl.exe with the provided arguments.
+// Its output is encoded in UTF-8 rather than UTF-16.
+func (b Backend) wslExeCommand(args ...string) *exec.Cmd {
+	cmd := b.command(b.wslExe, args...)
+	cmd.Env = append(cmd.Env, "WSL_UTF8=1")
+	return cmd
+}
+
+// defaultTranslator returns the translator for the paths of the current distro.
+func defaultTranslator() paths.Translator {
+	t := paths.Translator{Distro: os.Getenv("WSL_DISTRO_NAME")}
+
+	f, err := os.Open(filepath.Join("/etc", "wsl.conf"))
+	if err != nil {
+		return t
+	}
+	defer f.Close()
+
+	conf, err := wslconf.Parse(f)
+	if err != nil {
+		return t
+	}
+	c, err := conf.Config()
+	if err != nil {
+		return t
+	}
+	t.AutomountRoot = strings.TrimSpace(c.AutomountRoot)
+
+	return t
+}
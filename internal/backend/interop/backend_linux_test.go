@@ -0,0 +1,41 @@
+package interop
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvailable(t *testing.T) {
+	testCases := map[string]struct {
+		distroName string
+		entries    map[string]string // Contents of the binfmt_misc entries that exist
+
+		want bool
+	}{
+		"Available with the interop entry":      {distroName: "Ubuntu", entries: map[string]string{"WSLInterop": "enabled\ninterpreter /init\n"}, want: true},
+		"Available with the late interop entry": {distroName: "Ubuntu", entries: map[string]string{"WSLInterop-late": "enabled\ninterpreter /init\n"}, want: true},
+
+		"Not available without the interop entry":      {distroName: "Ubuntu"},
+		"Not available with a disabled interop entry":  {distroName: "Ubuntu", entries: map[string]string{"WSLInterop": "disabled\ninterpreter /init\n"}},
+		"Not available outside of a distro":            {entries: map[string]string{"WSLInterop": "enabled\ninterpreter /init\n"}},
+		"Not available with other binfmt_misc entries": {distroName: "Ubuntu", entries: map[string]string{"python3.11": "enabled\n"}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("WSL_DISTRO_NAME", tc.distroName)
+
+			dir := t.TempDir()
+			for entry, content := range tc.entries {
+				err := os.WriteFile(filepath.Join(dir, entry), []byte(content), 0600)
+				require.NoError(t, err, "Setup: could not write binfmt_misc entry")
+			}
+
+			got := available([]string{filepath.Join(dir, "WSLInterop"), filepath.Join(dir, "WSLInterop-late")})
+			require.Equal(t, tc.want, got, "Unexpected availability")
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package interop_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/backend/interop"
+	"github.com/ubuntu/gowsl/internal/flags"
+	"github.com/ubuntu/gowsl/paths"
+)
+
+// fakeRegExe mimics reg.exe. Queries print the file named after the key in
+// $FAKE_REG_DIR, and all calls are logged into $FAKE_LOG.
+const fakeRegExe = `#!/bin/sh
+printf 'reg.exe' >> "$FAKE_LOG"
+printf '|%s' "$@" >> "$FAKE_LOG"
+echo >> "$FAKE_LOG"
+
+case "$1" in
+query)
+	f="$FAKE_REG_DIR/$(printf '%s' "$2" | tr '\\' '_')"
+	if [ ! -f "$f" ]; then
+		echo "ERROR: The system was unable to find the specified registry key or value." >&2
+		exit 1
+	fi
+	cat "$f"
+	;;
+add)
+	echo "The operation completed successfully."
+	;;
+esac
+`
+
+// fakeWslExe mimics wsl.exe. The commands launched with --exec run on the host,
+// unregistering the distro Ghost fails, and all calls are logged into $FAKE_LOG.
+const fakeWslExe = `#!/bin/sh
+printf 'wsl.exe' >> "$FAKE_LOG"
+printf '|%s' "$@" >> "$FAKE_LOG"
+echo >> "$FAKE_LOG"
+
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--exec)
+		shift
+		exec "$@"
+		;;
+	--unregister)
+		if [ "$2" = Ghost ]; then
+			echo "There is no distribution with the supplied name."
+			exit 255
+		fi
+		exit 0
+		;;
+	esac
+	shift
+done
+`
+
+const (
+	ubuntuGUID = "{11111111-1111-1111-1111-111111111111}"
+	debianGUID = "{22222222-2222-2222-2222-222222222222}"
+	lxssKey    = `HKEY_CURRENT_USER\Software\Microsoft\Windows\CurrentVersion\Lxss`
+)
+
+// registry is the content of the fake registry, as printed by `reg.exe query <key>`.
+var registry = map[string]string{
+	lxssKey: `
+HKEY_CURRENT_USER\Software\Microsoft\Windows\CurrentVersion\Lxss
+    DefaultDistribution    REG_SZ    ` + ubuntuGUID + `
+    DefaultVersion    REG_DWORD    0x2
+
+HKEY_CURRENT_USER\Software\Microsoft\Windows\CurrentVersion\Lxss\AppxInstallerCache
+HKEY_CURRENT_USER\Software\Microsoft\Windows\CurrentVersion\Lxss\` + ubuntuGUID + `
+HKEY_CURRENT_USER\Software\Microsoft\Windows\CurrentVersion\Lxss\` + debianGUID + `
+`,
+	lxssKey + `\` + ubuntuGUID: `
+HKEY_CURRENT_USER\Software\Microsoft\Windows\CurrentVersion\Lxss\` + ubuntuGUID + `
+    State    REG_DWORD    0x1
+    DistributionName    REG_SZ    Ubuntu
+    Version    REG_DWORD    0x2
+    BasePath    REG_SZ    C:\Users\me\AppData\Local\Ubuntu
+    Flags    REG_DWORD    0xf
+    DefaultUid    REG_DWORD    0x3e8
+    DefaultEnvironment    REG_MULTI_SZ    LANG=C.UTF-8\0PATH=/usr/bin:/bin\0EMPTY=
+    PackageFamilyName    REG_SZ
+`,
+	lxssKey + `\` + debianGUID: `
+HKEY_CURRENT_USER\Software\Microsoft\Windows\CurrentVersion\Lxss\` + debianGUID + `
+    DistributionName    REG_SZ    Debian
+    Version    REG_DWORD    0x2
+    Flags    REG_DWORD    0x7
+    DefaultUid    REG_DWORD    0x0
+`,
+	`HKEY_CURRENT_USER\Volatile Environment`: `
+HKEY_CURRENT_USER\Volatile Environment
+    LOCALAPPDATA    REG_SZ    C:\Users\me\AppData\Local
+    USERPROFILE    REG_SZ    C:\Users\me
+`,
+}
+
+func TestOpenLxssRegistry(t *testing.T) {
+	b := setupFakes(t)
+
+	root, err := b.OpenLxssRegistry(".")
+	require.NoError(t, err, "OpenLxssRegistry should not have failed")
+	defer root.Close()
+
+	subkeys, err := root.SubkeyNames()
+	require.NoError(t, err, "SubkeyNames should not have failed")
+	require.Equal(t, []string{"AppxInstallerCache", ubuntuGUID, debianGUID}, subkeys, "Unexpected subkeys")
+
+	got, err := root.Field("DefaultDistribution")
+	require.NoError(t, err, "Field should not have failed")
+	require.Equal(t, ubuntuGUID, got, "Unexpected default distro")
+
+	_, err = root.Field("DefaultVersion")
+	require.Error(t, err, "Field should have failed on a DWORD field")
+
+	_, err = root.Field("Nonexistent")
+	require.Error(t, err, "Field should have failed on a missing field")
+
+	key, err := b.OpenLxssRegistry(ubuntuGUID)
+	require.NoError(t, err, "OpenLxssRegistry should not have failed")
+	defer key.Close()
+
+	got, err = key.Field("BasePath")
+	require.NoError(t, err, "Field should not have failed")
+	require.Equal(t, `C:\Users\me\AppData\Local\Ubuntu`, got, "Unexpected field with backslashes")
+
+	got, err = key.Field("PackageFamilyName")
+	require.NoError(t, err, "Field should not have failed on an empty field")
+	require.Empty(t, got, "Unexpected empty field")
+
+	_, err = b.OpenLxssRegistry("{00000000-0000-0000-0000-000000000000}")
+	require.Error(t, err, "OpenLxssRegistry should have failed on a missing key")
+}
+
+func TestWslGetDistributionConfiguration(t *testing.T) {
+	testCases := map[string]struct {
+		distro string
+
+		wantUID   uint32
+		wantFlags flags.WslFlags
+		wantEnv   map[string]string
+		wantErr   bool
+	}{
+		"Distro with custom environment": {distro: "Ubuntu", wantUID: 1000, wantFlags: 0xf, wantEnv: map[string]string{"LANG": "C.UTF-8", "PATH": "/usr/bin:/bin", "EMPTY": ""}},
+		"Distro with default environment": {distro: "debian", wantUID: 0, wantFlags: 0x7, wantEnv: map[string]string{
+			"HOSTTYPE": "x86_64",
+			"LANG":     "en_US.UTF-8",
+			"PATH":     "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/games:/usr/local/games",
+			"TERM":     "xterm-256color",
+		}},
+
+		"Error on unregistered distro": {distro: "Ghost", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := setupFakes(t)
+
+			var version uint8
+			var uid uint32
+			var f flags.WslFlags
+			var env map[string]string
+
+			err := b.WslGetDistributionConfiguration(tc.distro, &version, &uid, &f, &env)
+			if tc.wantErr {
+				require.Error(t, err, "WslGetDistributionConfiguration should have failed")
+				return
+			}
+			require.NoError(t, err, "WslGetDistributionConfiguration should not have failed")
+
+			require.Equal(t, uint8(2), version, "Unexpected version")
+			require.Equal(t, tc.wantUID, uid, "Unexpected default UID")
+			require.Equal(t, tc.wantFlags, f, "Unexpected flags")
+			require.Equal(t, tc.wantEnv, env, "Unexpected environment")
+		})
+	}
+}
+
+func TestWslConfigureDistribution(t *testing.T) {
+	testCases := map[string]struct {
+		distro string
+		flags  flags.WslFlags
+
+		wantFlags string
+		wantErr   bool
+	}{
+		"Configure a WSL 2 distro":                  {distro: "Ubuntu", flags: 0x5, wantFlags: "13"},
+		"Configure a WSL 1 distro":                  {distro: "Debian", flags: 0x3, wantFlags: "3"},
+		"The WSL version of the distro is retained": {distro: "Debian", flags: 0xf, wantFlags: "7"},
+
+		"Error on unregistered distro": {distro: "Ghost", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := setupFakes(t)
+
+			err := b.WslConfigureDistribution(tc.distro, 1000, tc.flags)
+			if tc.wantErr {
+				require.Error(t, err, "WslConfigureDistribution should have failed")
+				return
+			}
+			require.NoError(t, err, "WslConfigureDistribution should not have failed")
+
+			calls := loggedCalls(t, "reg.exe|add")
+			require.Len(t, calls, 2, "reg.exe add should have been called for each field")
+			require.Contains(t, calls[0], "|/v|DefaultUid|/t|REG_DWORD|/d|1000|/f", "Unexpected call to set the default UID")
+			require.Contains(t, calls[1], "|/v|Flags|/t|REG_DWORD|/d|"+tc.wantFlags+"|/f", "Unexpected call to set the flags")
+		})
+	}
+}
+
+func TestWslLaunch(t *testing.T) {
+	testCases := map[string]struct {
+		useCWD bool
+
+		wantArgs string
+	}{
+		"Launch in the home directory":            {wantArgs: "wsl.exe|--distribution|Ubuntu|--cd|~|--exec|sh|-c|"},
+		"Launch in the current working directory": {useCWD: true, wantArgs: "wsl.exe|--distribution|Ubuntu|--exec|sh|-c|"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := setupFakes(t)
+
+			stdinR, stdinW, err := os.Pipe()
+			require.NoError(t, err, "Setup: could not create pipe")
+			stdoutR, stdoutW, err := os.Pipe()
+			require.NoError(t, err, "Setup: could not create pipe")
+
+			const command = "read line; echo \"Hello, $line\"; exit 3"
+
+			p, err := b.WslLaunch("Ubuntu", command, tc.useCWD, stdinR, stdoutW, nil)
+			require.NoError(t, err, "WslLaunch should not have failed")
+			stdinR.Close()
+			stdoutW.Close()
+
+			_, err = stdinW.WriteString("world\n")
+			require.NoError(t, err, "could not write into stdin")
+			stdinW.Close()
+
+			out, err := io.ReadAll(stdoutR)
+			stdoutR.Close()
+			require.NoError(t, err, "could not read stdout")
+
+			ps, err := p.Wait()
+			require.NoError(t, err, "Wait should not have failed")
+
+			require.Equal(t, 3, ps.ExitCode(), "Unexpected exit code")
+			require.Equal(t, "Hello, world\n", string(out), "Unexpected output")
+			require.Equal(t, []string{tc.wantArgs + command}, loggedCalls(t, "wsl.exe"), "Unexpected call to wsl.exe")
+		})
+	}
+}
+
+func TestWslLaunchEnv(t *testing.T) {
+	b := setupFakes(t)
+	t.Setenv("WSLENV", "USERPROFILE/p")
+
+	stdoutR, stdoutW, err := os.Pipe()
+	require.NoError(t, err, "Setup: could not create pipe")
+
+	env := []string{"GOWSL_TEST_VAR=hello", "WSLENV=GOWSL_TEST_VAR"}
+	p, err := b.WslLaunchEnv("Ubuntu", `echo "$GOWSL_TEST_VAR $WSLENV"`, false, env, nil, stdoutW, nil)
+	require.NoError(t, err, "WslLaunchEnv should not have failed")
+	stdoutW.Close()
+
+	out, err := io.ReadAll(stdoutR)
+	stdoutR.Close()
+	require.NoError(t, err, "could not read stdout")
+
+	_, err = p.Wait()
+	require.NoError(t, err, "Wait should not have failed")
+
+	require.Equal(t, "hello USERPROFILE/p:WSL_UTF8:GOWSL_TEST_VAR\n", string(out), "wsl.exe should have been called with the variables")
+	_, ok := os.LookupEnv("GOWSL_TEST_VAR")
+	require.False(t, ok, "The environment of the current process should be left untouched")
+	require.Equal(t, "USERPROFILE/p", os.Getenv("WSLENV"), "The environment of the current process should be left untouched")
+}
+
+func TestWslLaunchAs(t *testing.T) {
+	b := setupFakes(t)
+
+	p, err := b.WslLaunchAs("Ubuntu", "root", "exit 42", false, nil, nil, nil, nil)
+	require.NoError(t, err, "WslLaunchAs should not have failed")
+
+	ps, err := p.Wait()
+	require.NoError(t, err, "Wait should not have failed")
+
+	require.Equal(t, 42, ps.ExitCode(), "Unexpected exit code")
+	require.Equal(t, []string{"wsl.exe|--distribution|Ubuntu|--user|root|--cd|~|--exec|sh|-c|exit 42"}, loggedCalls(t, "wsl.exe"), "Unexpected call to wsl.exe")
+}
+
+func TestWslLaunchInteractive(t *testing.T) {
+	b := setupFakes(t)
+
+	exitCode, err := b.WslLaunchInteractive("Ubuntu", "exit 42", false)
+	require.NoError(t, err, "WslLaunchInteractive should not have failed")
+	require.Equal(t, uint32(42), exitCode, "Unexpected exit code")
+}
+
+func TestWslRegisterDistribution(t *testing.T) {
+	testCases := map[string]struct {
+		tarball    string
+		installDir string
+
+		wantArgs string
+		wantErr  bool
+	}{
+		"Register from a Windows drive":         {tarball: "/mnt/c/images/rootfs.tar.gz", wantArgs: `wsl.exe|--import|New|C:\Users\me\AppData\Local\GoWSL\New|C:\images\rootfs.tar.gz`},
+		"Register from the distro's filesystem": {tarball: "/tmp/rootfs.tar.gz", wantArgs: `wsl.exe|--import|New|C:\Users\me\AppData\Local\GoWSL\New|\\wsl.localhost\Ubuntu\tmp\rootfs.tar.gz`},
+		"Register into a custom directory":      {tarball: "/mnt/d/rootfs.tar.gz", installDir: `D:\WSL\`, wantArgs: `wsl.exe|--import|New|D:\WSL\New|D:\rootfs.tar.gz`},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := setupFakes(t, interop.WithInstallDir(tc.installDir))
+
+			err := b.WslRegisterDistribution("New", tc.tarball)
+			require.NoError(t, err, "WslRegisterDistribution should not have failed")
+			require.Equal(t, []string{tc.wantArgs}, loggedCalls(t, "wsl.exe"), "Unexpected call to wsl.exe")
+		})
+	}
+}
+
+func TestWslUnregisterDistribution(t *testing.T) {
+	b := setupFakes(t)
+
+	err := b.WslUnregisterDistribution("Ubuntu")
+	require.NoError(t, err, "WslUnregisterDistribution should not have failed")
+	require.Equal(t, []string{"wsl.exe|--unregister|Ubuntu"}, loggedCalls(t, "wsl.exe"), "Unexpected call to wsl.exe")
+
+	err = b.WslUnregisterDistribution("Ghost")
+	require.Error(t, err, "WslUnregisterDistribution should have failed on an unregistered distro")
+}
+
+// setupFakes places the fake wsl.exe and reg.exe in the PATH, and returns a
+// back-end that uses them. It must not be used in parallel tests.
+func setupFakes(t *testing.T, args ...interop.Option) interop.Backend {
+	t.Helper()
+
+	bin := t.TempDir()
+	for name, script := range map[string]string{"wsl.exe": fakeWslExe, "reg.exe": fakeRegExe} {
+		//nolint:gosec // The fakes must be executable.
+		err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0700)
+		require.NoError(t, err, "Setup: could not write fake %s", name)
+	}
+
+	regDir := t.TempDir()
+	for key, out := range registry {
+		name := strings.ReplaceAll(key, `\`, "_")
+		err := os.WriteFile(filepath.Join(regDir, name), []byte(strings.ReplaceAll(out, "\n", "\r\n")), 0600)
+		require.NoError(t, err, "Setup: could not write fake registry key")
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_REG_DIR", regDir)
+	t.Setenv("FAKE_LOG", filepath.Join(t.TempDir(), "calls.log"))
+
+	args = append([]interop.Option{interop.WithPathTranslator(paths.Translator{Distro: "Ubuntu"})}, args...)
+	return interop.New(args...)
+}
+
+// loggedCalls returns the calls made to the fakes that start with prefix. The
+// arguments of each call are separated by pipes.
+func loggedCalls(t *testing.T, prefix string) []string {
+	t.Helper()
+
+	out, err := os.ReadFile(os.Getenv("FAKE_LOG"))
+	require.NoError(t, err, "could not read the calls to the fakes")
+
+	var calls []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			calls = append(calls, line)
+		}
+	}
+	return calls
+}
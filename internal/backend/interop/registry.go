@@ -0,0 +1,229 @@
+package interop
+
+// This file contains the access to the registry of the Windows host via reg.exe.
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/backend"
+)
+
+// Paths to the registry keys, relative to HKEY_CURRENT_USER.
+const (
+	lxssPath                = `Software\Microsoft\Windows\CurrentVersion\Lxss` // All WSL info is under this path
+	volatileEnvironmentPath = `Volatile Environment`                           // Per-session environment variables
+)
+
+const hkeyCurrentUser = `HKEY_CURRENT_USER`
+
+// regNotFoundMessagePrefix starts the message of reg.exe when a key or value does not exist.
+const regNotFoundMessagePrefix = `ERROR: The system was unable to find`
+
+// RegistryKey is a snapshot of a Windows registry key, read via reg.exe.
+// Create it by calling OpenLxssRegistry.
+type RegistryKey struct {
+	path    string // For error message purposes
+	values  map[string]regValue
+	subkeys []string
+}
+
+// regValue is a registry value, as printed by reg.exe.
+type regValue struct {
+	kind string // REG_SZ, REG_DWORD, etc.
+	data string
+}
+
+// regValueLine matches the lines in the output of `reg.exe query` that contain a value:
+//
+//	<4 spaces><name><4 spaces><type>[<4 spaces><data>]
+var regValueLine = regexp.MustCompile(`^    (.+?)    (REG_[A-Z_]+)(?:    (.*))?$`)
+
+// OpenLxssRegistry opens a registry key at the chosen path.
+// The returned key is a snapshot: later changes to the registry are not reflected.
+func (b Backend) OpenLxssRegistry(path string) (r backend.RegistryKey, err error) {
+	p := lxssPath
+	if path != "" && path != "." {
+		p += `\` + strings.ReplaceAll(path, "/", `\`)
+	}
+
+	k, err := b.queryKey(p)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// queryKey reads the values and subkeys of a key under HKEY_CURRENT_USER.
+func (b Backend) queryKey(path string) (k *RegistryKey, err error) {
+	fullPath := hkeyCurrentUser + `\` + path
+	defer decorate.OnError(&err, "registry: could not open %s", fullPath)
+
+	var stderr bytes.Buffer
+	cmd := b.command(b.regExe, "query", fullPath)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if strings.HasPrefix(stderr.String(), regNotFoundMessagePrefix) {
+			return nil, errors.New("key not found")
+		}
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseRegQuery(fullPath, out)
+}
+
+// parseRegQuery parses the output of `reg.exe query <path>`. Sample output:
+//
+//	HKEY_CURRENT_USER\Software\Microsoft\Windows\CurrentVersion\Lxss
+//	    DefaultDistribution    REG_SZ    {a0b1c2d3-...}
+//	    DefaultVersion    REG_DWORD    0x2
+//
+//	HKEY_CURRENT_USER\Software\Microsoft\Windows\CurrentVersion\Lxss\{a0b1c2d3-...}
+//	HKEY_CURRENT_USER\Software\Microsoft\Windows\CurrentVersion\Lxss\AppxInstallerCache
+func parseRegQuery(path string, out []byte) (*RegistryKey, error) {
+	k := &RegistryKey{
+		path:   path,
+		values: make(map[string]regValue),
+	}
+
+	subkeyPrefix := strings.ToLower(path + `\`)
+
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+
+		if m := regValueLine.FindStringSubmatch(line); m != nil {
+			k.values[m[1]] = regValue{kind: m[2], data: m[3]}
+			continue
+		}
+
+		// Key names are case-insensitive
+		if strings.HasPrefix(strings.ToLower(line), subkeyPrefix) {
+			k.subkeys = append(k.subkeys, line[len(subkeyPrefix):])
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("could not parse output of reg.exe: %v", err)
+	}
+
+	return k, nil
+}
+
+// Close releases the key.
+func (r *RegistryKey) Close() error {
+	return nil
+}
+
+// Field obtains the value of a Field. The value must be a string.
+func (r *RegistryKey) Field(name string) (value string, err error) {
+	defer decorate.OnError(&err, "registry: could not access string field %s in %s", name, r.path)
+
+	v, ok := r.values[name]
+	if !ok {
+		return "", errors.New("field not found")
+	}
+	if v.kind != "REG_SZ" && v.kind != "REG_EXPAND_SZ" {
+		return "", fmt.Errorf("unexpected type %s", v.kind)
+	}
+
+	return v.data, nil
+}
+
+// SubkeyNames returns a slice containing the names of the current key's children.
+func (r *RegistryKey) SubkeyNames() ([]string, error) {
+	return append([]string(nil), r.subkeys...), nil
+}
+
+// dword obtains the value of a REG_DWORD field.
+func (r *RegistryKey) dword(name string) (value uint32, err error) {
+	defer decorate.OnError(&err, "registry: could not access DWORD field %s in %s", name, r.path)
+
+	v, ok := r.values[name]
+	if !ok {
+		return 0, errors.New("field not found")
+	}
+	if v.kind != "REG_DWORD" {
+		return 0, fmt.Errorf("unexpected type %s", v.kind)
+	}
+
+	n, err := strconv.ParseUint(strings.TrimPrefix(v.data, "0x"), 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %q: %v", v.data, err)
+	}
+
+	return uint32(n), nil
+}
+
+// multiString obtains the value of a REG_MULTI_SZ field. reg.exe prints the
+// strings separated by a literal `\0`.
+func (r *RegistryKey) multiString(name string) (values []string, err error) {
+	defer decorate.OnError(&err, "registry: could not access multi-string field %s in %s", name, r.path)
+
+	v, ok := r.values[name]
+	if !ok {
+		return nil, errors.New("field not found")
+	}
+	if v.kind != "REG_MULTI_SZ" {
+		return nil, fmt.Errorf("unexpected type %s", v.kind)
+	}
+
+	if v.data == "" {
+		return nil, nil
+	}
+	return strings.Split(v.data, `\0`), nil
+}
+
+// setDWORD writes a REG_DWORD value into a key under HKEY_CURRENT_USER.
+func (b Backend) setDWORD(path, name string, value uint32) (err error) {
+	fullPath := hkeyCurrentUser + `\` + path
+	defer decorate.OnError(&err, "registry: could not write field %s in %s", name, fullPath)
+
+	out, err := b.command(b.regExe, "add", fullPath, "/v", name, "/t", "REG_DWORD", "/d", strconv.FormatUint(uint64(value), 10), "/f").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// findDistroKey returns the registry path (relative to HKEY_CURRENT_USER) and the
+// key of a registered distro.
+func (b Backend) findDistroKey(distroName string) (path string, key *RegistryKey, err error) {
+	root, err := b.queryKey(lxssPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, GUID := range root.subkeys {
+		if !strings.HasPrefix(GUID, "{") {
+			continue // Not a distro
+		}
+
+		p := lxssPath + `\` + GUID
+		k, err := b.queryKey(p)
+		if err != nil {
+			return "", nil, err
+		}
+
+		name, err := k.Field("DistributionName")
+		if err != nil {
+			continue // Partially registered distro
+		}
+
+		// Distro names are case-insensitive
+		if strings.EqualFold(name, distroName) {
+			return p, k, nil
+		}
+	}
+
+	return "", nil, errors.New("not registered")
+}
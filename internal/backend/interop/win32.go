@@ -0,0 +1,294 @@
+package interop
+
+// This file contains the operations that the Windows back-end performs via the
+// Win32 API, performed here via wsl.exe and the registry instead.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/internal/flags"
+	"github.com/ubuntu/gowsl/internal/state"
+)
+
+// wslVersionFlag is the undocumented flag with the WSL version of a distro.
+const wslVersionFlag = flags.WslFlags(0x8)
+
+// State returns the state of a particular distro as seen in `wsl.exe -l -v`.
+func (b Backend) State(distributionName string) (state.State, error) {
+	return b.wsl.State(distributionName)
+}
+
+// Shutdown shuts down all distros.
+func (b Backend) Shutdown() error {
+	return b.wsl.Shutdown()
+}
+
+// Terminate shuts down a particular distro.
+func (b Backend) Terminate(distroName string) error {
+	return b.wsl.Terminate(distroName)
+}
+
+// SetAsDefault sets a particular distribution as the default one.
+func (b Backend) SetAsDefault(distroName string) error {
+	return b.wsl.SetAsDefault(distroName)
+}
+
+// WslConfigureDistribution mimics the WslConfigureDistribution function in the
+// wslApi.dll Win32 library by writing the configuration into the registry.
+// The WSL version of the distro is left unchanged.
+func (b Backend) WslConfigureDistribution(distributionName string, defaultUID uint32, wslDistributionFlags flags.WslFlags) (err error) {
+	defer decorate.OnError(&err, "WslConfigureDistribution")
+
+	path, key, err := b.findDistroKey(distributionName)
+	if err != nil {
+		return err
+	}
+
+	current, err := key.dword("Flags")
+	if err != nil {
+		return err
+	}
+	f := wslDistributionFlags&^wslVersionFlag | flags.WslFlags(current)&wslVersionFlag
+
+	if err := b.setDWORD(path, "DefaultUid", defaultUID); err != nil {
+		return err
+	}
+	//nolint:gosec // Flags are a bitmask, so the conversion is lossless.
+	return b.setDWORD(path, "Flags", uint32(f))
+}
+
+// WslGetDistributionConfiguration mimics the WslGetDistributionConfiguration
+// function in the wslApi.dll Win32 library by reading the registry.
+func (b Backend) WslGetDistributionConfiguration(distributionName string,
+	distributionVersion *uint8,
+	defaultUID *uint32,
+	wslDistributionFlags *flags.WslFlags,
+	defaultEnvironmentVariables *map[string]string) (err error) {
+	defer decorate.OnError(&err, "WslGetDistributionConfiguration")
+
+	_, key, err := b.findDistroKey(distributionName)
+	if err != nil {
+		return err
+	}
+
+	version, err := key.dword("Version")
+	if err != nil {
+		return err
+	}
+	uid, err := key.dword("DefaultUid")
+	if err != nil {
+		return err
+	}
+	f, err := key.dword("Flags")
+	if err != nil {
+		return err
+	}
+
+	env := make(map[string]string)
+	vars, err := key.multiString("DefaultEnvironment")
+	if err != nil {
+		// WSL does not store the environment unless it has been customised
+		vars = defaultEnvironment
+	}
+	for _, v := range vars {
+		k, v, _ := strings.Cut(v, "=")
+		env[k] = v
+	}
+
+	//nolint:gosec // The version is a small number.
+	*distributionVersion = uint8(version)
+	*defaultUID = uid
+	//nolint:gosec // Flags are a bitmask, so the conversion is lossless.
+	*wslDistributionFlags = flags.WslFlags(f)
+	*defaultEnvironmentVariables = env
+
+	return nil
+}
+
+// defaultEnvironment is the environment of distros that have not customised it.
+var defaultEnvironment = []string{
+	"HOSTTYPE=x86_64",
+	"LANG=en_US.UTF-8",
+	"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/games:/usr/local/games",
+	"TERM=xterm-256color",
+}
+
+// WslLaunch mimics the WslLaunch function in the wslApi.dll Win32 library by
+// launching `wsl.exe --exec sh -c <command>` in the distro.
+func (b Backend) WslLaunch(
+	distroName string,
+	command string,
+	useCWD bool,
+	stdin *os.File,
+	stdout *os.File,
+	stderr *os.File) (process *os.Process, err error) {
+	defer decorate.OnError(&err, "WslLaunch")
+
+	return start(b.launchCommand(distroName, "", command, useCWD), stdin, stdout, stderr)
+}
+
+// WslLaunchEnv is WslLaunch with additional environment variables, which are
+// added to the environment wsl.exe is called with.
+func (b Backend) WslLaunchEnv(
+	distroName string,
+	command string,
+	useCWD bool,
+	env []string,
+	stdin *os.File,
+	stdout *os.File,
+	stderr *os.File) (process *os.Process, err error) {
+	defer decorate.OnError(&err, "WslLaunchEnv")
+
+	cmd := b.launchCommand(distroName, "", command, useCWD)
+	cmd.Env = backend.AppendEnv(cmd.Env, env)
+
+	return start(cmd, stdin, stdout, stderr)
+}
+
+// WslLaunchAs is WslLaunchEnv, except that the command runs as the named user
+// of the distro, with `wsl.exe --user <user>`.
+func (b Backend) WslLaunchAs(
+	distroName string,
+	user string,
+	command string,
+	useCWD bool,
+	env []string,
+	stdin *os.File,
+	stdout *os.File,
+	stderr *os.File) (process *os.Process, err error) {
+	defer decorate.OnError(&err, "WslLaunchAs")
+
+	cmd := b.launchCommand(distroName, user, command, useCWD)
+	cmd.Env = backend.AppendEnv(cmd.Env, env)
+
+	return start(cmd, stdin, stdout, stderr)
+}
+
+// start starts the command attached to the provided streams.
+func start(cmd *exec.Cmd, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	// Leave unset streams as nil interfaces, so that they are attached to the null device
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+	if stderr != nil {
+		cmd.Stderr = stderr
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return cmd.Process, nil
+}
+
+// WslLaunchInteractive mimics the WslLaunchInteractive function in the wslApi.dll
+// Win32 library by running `wsl.exe --exec sh -c <command>` in the distro,
+// attached to the standard streams of the current process.
+func (b Backend) WslLaunchInteractive(distributionName string, command string, useCurrentWorkingDirectory bool) (exitCode uint32, err error) {
+	defer decorate.OnError(&err, "WslLaunchInteractive")
+
+	cmd := b.launchCommand(distributionName, "", command, useCurrentWorkingDirectory)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		//nolint:gosec // Exit codes are truncated just like in Windows.
+		return uint32(exitErr.ExitCode()), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+// launchCommand returns the wsl.exe command that runs command in the distro as
+// the user, or as the default user if it is empty. Without useCWD, the command
+// runs in the home directory of that user.
+func (b Backend) launchCommand(distroName, user, command string, useCWD bool) *exec.Cmd {
+	args := []string{"--distribution", distroName}
+	if user != "" {
+		args = append(args, "--user", user)
+	}
+	if !useCWD {
+		args = append(args, "--cd", "~")
+	}
+	if command == "" {
+		return b.command(b.wslExe, args...)
+	}
+
+	args = append(args, "--exec", "sh", "-c", command)
+	return b.command(b.wslExe, args...)
+}
+
+// WslRegisterDistribution mimics the WslRegisterDistribution function in the
+// wslApi.dll Win32 library by calling `wsl.exe --import`. The distro is installed
+// into a subdirectory of the install directory named after it.
+func (b Backend) WslRegisterDistribution(distributionName string, tarGzFilename string) (err error) {
+	defer decorate.OnError(&err, "WslRegisterDistribution")
+
+	tarball, err := filepath.Abs(tarGzFilename)
+	if err != nil {
+		return err
+	}
+	tarball, err = b.translator.ToWindows(tarball)
+	if err != nil {
+		return fmt.Errorf("could not translate the path to the tarball: %v", err)
+	}
+
+	installDir, err := b.distroInstallDir(distributionName)
+	if err != nil {
+		return err
+	}
+
+	out, err := b.wslExeCommand("--import", distributionName, installDir, tarball).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// distroInstallDir returns the Windows directory where a distro is installed.
+func (b Backend) distroInstallDir(distroName string) (string, error) {
+	if b.installDir != "" {
+		return strings.TrimRight(b.installDir, `\`) + `\` + distroName, nil
+	}
+
+	key, err := b.queryKey(volatileEnvironmentPath)
+	if err != nil {
+		return "", fmt.Errorf("could not find the install directory: %v", err)
+	}
+	localAppData, err := key.Field("LOCALAPPDATA")
+	if err != nil {
+		return "", fmt.Errorf("could not find the install directory: %v", err)
+	}
+
+	return localAppData + `\GoWSL\` + distroName, nil
+}
+
+// WslUnregisterDistribution mimics the WslUnregisterDistribution function in the
+// wslApi.dll Win32 library by calling `wsl.exe --unregister`.
+func (b Backend) WslUnregisterDistribution(distributionName string) (err error) {
+	defer decorate.OnError(&err, "WslUnregisterDistribution")
+
+	out, err := b.wslExeCommand("--unregister", distributionName).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -2,8 +2,57 @@
 // one used in production code, and makes real syscalls and
 // accesses to the registry.
 //
-// All functions will return an error when ran on Linux.
+// The functions that use wsl.exe run on any platform, so that they can be
+// tested against a stand-in for wsl.exe. All other functions will return an
+// error when ran on Linux.
 package windows
 
+import "os/exec"
+
 // Backend implements the Backend interface.
-type Backend struct{}
+// Its zero value uses wsl.exe from the PATH.
+//
+// The options are kept behind a pointer so that back-ends, and the distros that
+// hold them, remain comparable.
+type Backend struct {
+	opts *options // Options passed to New, or nil for the defaults
+}
+
+// Executor constructs the command that runs the named program with the given
+// arguments. It has the same signature as exec.Command, which is the default.
+type Executor func(name string, args ...string) *exec.Cmd
+
+// Option is an optional parameter for New. Use any of the provided functions
+// such as WithWslExe().
+type Option func(*options)
+
+type options struct {
+	wslExe   string   // Path to wsl.exe
+	executor Executor // Constructs the commands that call wsl.exe
+}
+
+// WithWslExe is an optional parameter for New that sets the path to the wsl.exe
+// executable. Otherwise, wsl.exe is looked up in the PATH.
+func WithWslExe(path string) Option {
+	return func(o *options) {
+		o.wslExe = path
+	}
+}
+
+// WithExecutor is an optional parameter for New that sets how the commands that
+// call wsl.exe are constructed. Otherwise, exec.Command is used.
+func WithExecutor(e Executor) Option {
+	return func(o *options) {
+		o.executor = e
+	}
+}
+
+// New constructs a new production back-end.
+func New(args ...Option) Backend {
+	var opts options
+	for _, f := range args {
+		f(&opts)
+	}
+
+	return Backend{opts: &opts}
+}
@@ -5,7 +5,7 @@ import (
 	"path/filepath"
 
 	"github.com/ubuntu/decorate"
-	"github.com/ubuntu/gowsl/internal/backend"
+	"github.com/ubuntu/gowsl/backend"
 )
 
 // RegistryKey wraps around a Windows registry key.
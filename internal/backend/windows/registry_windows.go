@@ -7,7 +7,7 @@ import (
 	"syscall"
 
 	"github.com/ubuntu/decorate"
-	"github.com/ubuntu/gowsl/internal/backend"
+	"github.com/ubuntu/gowsl/backend"
 	"golang.org/x/sys/windows/registry"
 )
 
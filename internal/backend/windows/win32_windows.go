@@ -13,6 +13,7 @@ import (
 	"unsafe"
 
 	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/backend"
 	"github.com/ubuntu/gowsl/internal/flags"
 	"golang.org/x/sys/windows"
 )
@@ -33,6 +34,12 @@ type wBOOL = int            // Windows' BOOL
 type char = byte            // Windows' CHAR (which is the same as C's char)
 const fileTypePipe = 0x0003 // Windows' FILE_TYPE_PIPE
 
+// syscallError returns the error of a Win32 call that failed with the HRESULT r1.
+func syscallError(r1 uintptr) error {
+	//nolint:gosec // HRESULTs are 32 bits wide.
+	return fmt.Errorf("failed syscall: %w", backend.HRESULTError(uint32(r1)))
+}
+
 // IsPipe checks if a file's descriptor is a pipe vs. any other type of object.
 func (Backend) IsPipe(f *os.File) (bool, error) {
 	n, err := windows.GetFileType(windows.Handle(f.Fd()))
@@ -85,7 +92,7 @@ func (Backend) WslLaunch(
 		uintptr(unsafe.Pointer(&handle)))
 
 	if r1 != 0 {
-		return nil, errors.New("failed syscall")
+		return nil, syscallError(r1)
 	}
 	if handle == windows.Handle(0) {
 		return nil, errors.New("syscall returned a null handle")
@@ -116,7 +123,7 @@ func (Backend) WslConfigureDistribution(distributionName string, defaultUID uint
 	)
 
 	if r1 != 0 {
-		return fmt.Errorf("failed syscall")
+		return syscallError(r1)
 	}
 
 	return nil
@@ -151,7 +158,7 @@ func (Backend) WslGetDistributionConfiguration(distributionName string,
 	)
 
 	if r1 != 0 {
-		return fmt.Errorf("failed syscall")
+		return syscallError(r1)
 	}
 
 	*defaultEnvironmentVariables = processEnvVariables(envVarsBegin, envVarsLen)
@@ -186,7 +193,7 @@ func (Backend) WslLaunchInteractive(distributionName string, command string, use
 		uintptr(unsafe.Pointer(&exitCode)))
 
 	if r1 != 0 {
-		return exitCode, fmt.Errorf("failed syscall")
+		return exitCode, syscallError(r1)
 	}
 
 	return exitCode, nil
@@ -212,7 +219,7 @@ func (Backend) WslRegisterDistribution(distributionName string, tarGzFilename st
 		uintptr(unsafe.Pointer(tarGzFilenameUTF16)))
 
 	if r1 != 0 {
-		return errors.New("failed syscall")
+		return syscallError(r1)
 	}
 
 	return nil
@@ -231,7 +238,7 @@ func (Backend) WslUnregisterDistribution(distributionName string) (err error) {
 	r1, _, _ := apiWslUnregisterDistribution.Call(uintptr(unsafe.Pointer(distroUTF16)))
 
 	if r1 != 0 {
-		return fmt.Errorf("failed syscall")
+		return syscallError(r1)
 	}
 	return nil
 }
@@ -0,0 +1,170 @@
+package windows
+
+// This file contains utilities to access functionality accessed via wsl.exe
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/internal/state"
+)
+
+// wslExeCommand returns the command that calls wsl.exe with the provided arguments.
+// Its output is encoded in UTF-8 rather than UTF-16.
+func (b Backend) wslExeCommand(args ...string) *exec.Cmd {
+	var opts options
+	if b.opts != nil {
+		opts = *b.opts
+	}
+
+	wslExe := opts.wslExe
+	if wslExe == "" {
+		wslExe = "wsl.exe"
+	}
+
+	command := opts.executor
+	if command == nil {
+		command = exec.Command
+	}
+
+	cmd := command(wslExe, args...)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, "WSL_UTF8=1")
+
+	return cmd
+}
+
+// WslLaunchEnv launches a command with additional environment variables by
+// calling `wsl.exe --exec sh -c <command>`, as the WslLaunch function in the
+// Win32 API launches commands with the environment of the current process.
+func (b Backend) WslLaunchEnv(distroName string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (process *os.Process, err error) {
+	defer decorate.OnError(&err, "WslLaunchEnv")
+
+	return b.launch(distroName, "", command, useCWD, env, stdin, stdout, stderr)
+}
+
+// WslLaunchAs is WslLaunchEnv, except that the command runs as the named user
+// of the distro, with `wsl.exe --user <user>`.
+func (b Backend) WslLaunchAs(distroName string, user string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (process *os.Process, err error) {
+	defer decorate.OnError(&err, "WslLaunchAs")
+
+	return b.launch(distroName, user, command, useCWD, env, stdin, stdout, stderr)
+}
+
+// launch launches a command with wsl.exe as the user, or as the default user if
+// it is empty.
+func (b Backend) launch(distroName string, user string, command string, useCWD bool, env []string, stdin *os.File, stdout *os.File, stderr *os.File) (*os.Process, error) {
+	args := []string{"--distribution", distroName}
+	if user != "" {
+		args = append(args, "--user", user)
+	}
+	if !useCWD {
+		args = append(args, "--cd", "~")
+	}
+	if command != "" {
+		args = append(args, "--exec", "sh", "-c", command)
+	}
+
+	cmd := b.wslExeCommand(args...)
+	cmd.Env = backend.AppendEnv(cmd.Env, env)
+
+	// Leave unset streams as nil interfaces, so that they are attached to the null device
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+	if stderr != nil {
+		cmd.Stderr = stderr
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return cmd.Process, nil
+}
+
+// Shutdown shuts down all distros
+//
+// It is analogous to
+//
+//	`wsl.exe --Shutdown
+func (b Backend) Shutdown() error {
+	out, err := b.wslExeCommand("--shutdown").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error shutting WSL down: %v: %s", err, out)
+	}
+	return nil
+}
+
+// Terminate shuts down a particular distro
+//
+// It is analogous to
+//
+//	`wsl.exe --Terminate <distroName>`
+func (b Backend) Terminate(distroName string) error {
+	out, err := b.wslExeCommand("--terminate", distroName).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error terminating distro %q: %v: %s", distroName, err, out)
+	}
+	return nil
+}
+
+// SetAsDefault sets a particular distribution as the default one.
+//
+// It is analogous to
+//
+//	`wsl.exe --set-default <distroName>`
+func (b Backend) SetAsDefault(distroName string) error {
+	out, err := b.wslExeCommand("--set-default", distroName).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error setting %q as default: %v, output: %s", distroName, err, out)
+	}
+	return nil
+}
+
+// State returns the state of a particular distro as seen in `wsl.exe -l -v`.
+func (b Backend) State(distributionName string) (s state.State, err error) {
+	out, err := b.wslExeCommand("--list", "--all", "--verbose").Output()
+	if err != nil {
+		return s, err
+	}
+
+	/*
+		Sample output:
+		   NAME           STATE           VERSION
+		 * Ubuntu         Stopped         2
+		   Ubuntu-Preview Running         2
+	*/
+
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	var headerSkipped bool
+	for sc.Scan() {
+		if !headerSkipped {
+			headerSkipped = true
+			continue
+		}
+
+		data := strings.Fields(sc.Text())
+		if len(data) == 4 {
+			// default distro, ignoring leading asterisk
+			data = data[1:]
+		}
+
+		if data[0] == distributionName {
+			return state.NewFromString(data[1])
+		}
+	}
+
+	return state.NotRegistered, nil
+}
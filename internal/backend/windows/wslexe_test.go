@@ -0,0 +1,220 @@
+package windows_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/backend/windows"
+	"github.com/ubuntu/gowsl/internal/state"
+	"github.com/ubuntu/gowsl/mock"
+	"gopkg.in/yaml.v3"
+)
+
+// fakeWslExe is the path to the fake wsl.exe built for the tests.
+var fakeWslExe string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "gowsl-fakewsl-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Setup: could not create temporary directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	fakeWslExe = filepath.Join(dir, "wsl")
+	if runtime.GOOS == "windows" {
+		fakeWslExe += ".exe"
+	}
+
+	//nolint:gosec // The arguments are controlled by the test.
+	out, err := exec.Command("go", "build", "-o", fakeWslExe, "github.com/ubuntu/gowsl/cmd/fakewsl").CombinedOutput()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Setup: could not build fake wsl.exe: %v: %s\n", err, out)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	exitCode := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(exitCode)
+}
+
+const testState = `defaultDistro: Ubuntu
+distros:
+  - name: Ubuntu
+  - name: Debian
+    running: true
+`
+
+func TestWslExe(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		action func(windows.Backend) error
+		wslExe string
+
+		wantDefault string
+		wantRunning []string
+		wantErr     bool
+	}{
+		"Terminate a running distro":     {action: terminate("Debian"), wantDefault: "Ubuntu"},
+		"Terminate a stopped distro":     {action: terminate("Ubuntu"), wantDefault: "Ubuntu", wantRunning: []string{"Debian"}},
+		"Shut down":                      {action: shutdown, wantDefault: "Ubuntu"},
+		"Set the default distro":         {action: setAsDefault("Debian"), wantDefault: "Debian", wantRunning: []string{"Debian"}},
+		"Error terminating a ghost":      {action: terminate("Ghost"), wantErr: true},
+		"Error setting ghost as default": {action: setAsDefault("Ghost"), wantErr: true},
+		"Error on missing wsl.exe":       {action: shutdown, wslExe: "/nonexistent/wsl.exe", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := setupState(t)
+			if tc.wslExe == "" {
+				tc.wslExe = fakeWslExe
+			}
+			b := windows.New(windows.WithWslExe(tc.wslExe), withStateDir(dir))
+
+			err := tc.action(b)
+			if tc.wantErr {
+				require.Error(t, err, "Action should have failed")
+				return
+			}
+			require.NoError(t, err, "Action should not have failed")
+
+			fixture := readState(t, dir)
+			require.Equal(t, tc.wantDefault, fixture.DefaultDistro, "Unexpected default distro")
+
+			var running []string
+			for _, d := range fixture.Distros {
+				if d.Running {
+					running = append(running, d.Name)
+				}
+			}
+			require.ElementsMatch(t, tc.wantRunning, running, "Unexpected running distros")
+		})
+	}
+}
+
+func TestState(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		distro string
+
+		want state.State
+	}{
+		"Stopped distro":        {distro: "Ubuntu", want: state.Stopped},
+		"Running distro":        {distro: "Debian", want: state.Running},
+		"Not registered distro": {distro: "Ghost", want: state.NotRegistered},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			b := windows.New(windows.WithWslExe(fakeWslExe), withStateDir(setupState(t)))
+
+			got, err := b.State(tc.distro)
+			require.NoError(t, err, "State should not have failed")
+			require.Equal(t, tc.want, got, "Unexpected state")
+		})
+	}
+}
+
+func TestWslLaunchEnv(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		useCWD bool
+	}{
+		"Launch in the home directory":            {},
+		"Launch in the current working directory": {useCWD: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			b := windows.New(windows.WithWslExe(fakeWslExe), withStateDir(setupState(t)))
+
+			p, err := b.WslLaunchEnv("Ubuntu", "exit 42", tc.useCWD, []string{"GOWSL_TEST_VAR=hello", "WSLENV=GOWSL_TEST_VAR"}, nil, nil, nil)
+			require.NoError(t, err, "WslLaunchEnv should not have failed")
+
+			ps, err := p.Wait()
+			require.NoError(t, err, "Wait should not have failed")
+			require.Equal(t, 42, ps.ExitCode(), "Unexpected exit code")
+
+			_, ok := os.LookupEnv("GOWSL_TEST_VAR")
+			require.False(t, ok, "The environment of the current process should be left untouched")
+		})
+	}
+}
+
+func TestWslLaunchAs(t *testing.T) {
+	t.Parallel()
+
+	b := windows.New(windows.WithWslExe(fakeWslExe), withStateDir(setupState(t)))
+
+	p, err := b.WslLaunchAs("Ubuntu", "root", "exit 42", false, nil, nil, nil, nil)
+	require.NoError(t, err, "WslLaunchAs should not have failed")
+
+	ps, err := p.Wait()
+	require.NoError(t, err, "Wait should not have failed")
+	require.Equal(t, 42, ps.ExitCode(), "Unexpected exit code")
+}
+
+func terminate(distro string) func(windows.Backend) error {
+	return func(b windows.Backend) error { return b.Terminate(distro) }
+}
+
+func setAsDefault(distro string) func(windows.Backend) error {
+	return func(b windows.Backend) error { return b.SetAsDefault(distro) }
+}
+
+func shutdown(b windows.Backend) error {
+	return b.Shutdown()
+}
+
+// withStateDir returns an executor that makes the fake wsl.exe store its state in dir.
+func withStateDir(dir string) windows.Option {
+	return windows.WithExecutor(func(name string, args ...string) *exec.Cmd {
+		cmd := exec.Command(name, args...)
+		cmd.Env = append(os.Environ(), "FAKEWSL_STATE_DIR="+dir)
+		return cmd
+	})
+}
+
+// setupState returns a state directory for the fake wsl.exe, containing testState.
+func setupState(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "state.yaml"), []byte(testState), 0600)
+	require.NoError(t, err, "Setup: could not write state of the fake wsl.exe")
+
+	return dir
+}
+
+// readState reads the state stored by the fake wsl.exe.
+func readState(t *testing.T, dir string) mock.Fixture {
+	t.Helper()
+
+	out, err := os.ReadFile(filepath.Join(dir, "state.yaml"))
+	require.NoError(t, err, "could not read state of the fake wsl.exe")
+
+	var f mock.Fixture
+	err = yaml.Unmarshal(out, &f)
+	require.NoError(t, err, "could not parse state of the fake wsl.exe")
+
+	return f
+}
@@ -0,0 +1,119 @@
+// Package bridge turns Go functions into processes, so that back-ends that do not
+// launch real commands can still return an *os.Process from WslLaunch.
+//
+// The process is a shell that waits for the exit code of the function on its
+// stdin, and exits with it. Killing the process cancels the context passed to the
+// function.
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// Handler implements a command. It returns its exit code.
+type Handler func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int
+
+// Start runs a Handler in a goroutine, and returns a process that lives for as
+// long as the handler runs, and exits with the same exit code. The context passed
+// to the handler carries the values of ctx, and is cancelled when the process exits.
+//
+// The handler receives duplicates of the standard streams, as the caller closes
+// its copies after the process starts, like it would with a real process.
+func Start(ctx context.Context, handler Handler, stdin, stdout, stderr *os.File) (p *os.Process, err error) {
+	var files []*os.File
+	defer func() {
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+		}
+	}()
+
+	for _, f := range []*os.File{stdin, stdout, stderr} {
+		dup, err := duplicate(f)
+		if err != nil {
+			return nil, fmt.Errorf("could not duplicate %s: %v", f.Name(), err)
+		}
+		files = append(files, dup)
+	}
+
+	// The bridge reads the exit code from its stdin, and keeps its stdout open
+	// until it exits, which lets us know when it has been killed.
+	codeR, codeW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, codeW)
+	defer codeR.Close()
+
+	aliveR, aliveW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, aliveR)
+	defer aliveW.Close()
+
+	p, err = startBridge(codeR, aliveW)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer cancel()
+		defer aliveR.Close()
+		_, _ = io.Copy(io.Discard, aliveR)
+	}()
+
+	go func() {
+		defer codeW.Close()
+
+		code := handler(ctx, files[0], files[1], files[2])
+
+		// Closing the streams before exiting, so that readers see EOF
+		// by the time the process has exited.
+		for _, f := range files[:3] {
+			f.Close()
+		}
+
+		fmt.Fprintln(codeW, code)
+	}()
+
+	return p, nil
+}
+
+// startBridge starts a process that exits with the exit code written into stdin.
+func startBridge(stdin, stdout *os.File) (*os.Process, error) {
+	executable := "bash"
+	argv := []string{executable, "-c", `read -r code; exit "${code:-1}"`}
+	if runtime.GOOS == "windows" {
+		executable = "cmd.exe"
+		argv = []string{executable, "/v:on", "/c", "set /p code= & exit !code!"}
+	}
+
+	exec, err := exec.LookPath(executable)
+	if err != nil {
+		panic(fmt.Sprintf("could not find executable %q", executable))
+	}
+
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		return nil, err
+	}
+	defer null.Close()
+
+	p, err := os.StartProcess(exec, argv, &os.ProcAttr{
+		Files: []*os.File{stdin, stdout, null},
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("could not start bridge process: %v", err)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,23 @@
+package bridge
+
+import (
+	"os"
+	"syscall"
+)
+
+// duplicate returns a new file with a duplicate of f's descriptor.
+func duplicate(f *os.File) (*os.File, error) {
+	// Holding the fork lock so that no process started in the meantime inherits
+	// the descriptor before it is marked close-on-exec. Otherwise, that process
+	// would keep the pipe open, and its reader would not see EOF until it exits.
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	syscall.CloseOnExec(fd)
+
+	return os.NewFile(uintptr(fd), f.Name()), nil
+}
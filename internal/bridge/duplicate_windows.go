@@ -0,0 +1,19 @@
+package bridge
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// duplicate returns a new file with a duplicate of f's handle.
+func duplicate(f *os.File) (*os.File, error) {
+	p := windows.CurrentProcess()
+
+	var h windows.Handle
+	if err := windows.DuplicateHandle(p, windows.Handle(f.Fd()), p, &h, 0, false, windows.DUPLICATE_SAME_ACCESS); err != nil {
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(h), f.Name()), nil
+}
@@ -1,12 +1,14 @@
 package flags_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/ubuntu/gowsl/internal/flags"
+	"gopkg.in/yaml.v3"
 )
 
 func TestUnpackFlags(t *testing.T) {
@@ -72,3 +74,26 @@ func TestPackFlags(t *testing.T) {
 		})
 	}
 }
+
+func TestSerialization(t *testing.T) {
+	t.Parallel()
+
+	conf := flags.Unpacked{InteropEnabled: true, PathAppended: false, DriveMountingEnabled: true, UndocumentedWSLVersion: 2}
+
+	gotJSON, err := json.Marshal(conf)
+	require.NoError(t, err, "MarshalJSON should not have failed")
+	require.JSONEq(t, `{"interopEnabled":true,"pathAppended":false,"driveMountingEnabled":true,"wslVersion":2}`, string(gotJSON), "Unexpected JSON")
+
+	gotYAML, err := yaml.Marshal(conf)
+	require.NoError(t, err, "MarshalYAML should not have failed")
+	require.Equal(t, "interopEnabled: true\npathAppended: false\ndriveMountingEnabled: true\nwslVersion: 2\n", string(gotYAML), "Unexpected YAML")
+
+	var fromJSON, fromYAML flags.Unpacked
+	require.NoError(t, json.Unmarshal(gotJSON, &fromJSON), "UnmarshalJSON should not have failed")
+	require.NoError(t, yaml.Unmarshal(gotYAML, &fromYAML), "UnmarshalYAML should not have failed")
+	require.Equal(t, conf, fromJSON, "The flags should have round-tripped through JSON")
+	require.Equal(t, conf, fromYAML, "The flags should have round-tripped through YAML")
+
+	require.Error(t, json.Unmarshal([]byte(`{"interopEnabled":"yes"}`), &fromJSON), "UnmarshalJSON should have failed with the wrong type")
+	require.Error(t, yaml.Unmarshal([]byte("interopEnabled: [yes]"), &fromYAML), "UnmarshalYAML should have failed with the wrong type")
+}
@@ -1,6 +1,11 @@
 package flags
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
 
 // Unpacked contains the same information as WslFlags but in a struct instead of an integer.
 type Unpacked struct {
@@ -63,3 +68,32 @@ func (conf Unpacked) Pack() (WslFlags, error) {
 
 	return f, nil
 }
+
+// serialized is the serialized form of Unpacked. It has the same fields, so that
+// they can be converted into each other.
+type serialized struct {
+	InteropEnabled         bool  `json:"interopEnabled" yaml:"interopEnabled"`
+	PathAppended           bool  `json:"pathAppended" yaml:"pathAppended"`
+	DriveMountingEnabled   bool  `json:"driveMountingEnabled" yaml:"driveMountingEnabled"`
+	UndocumentedWSLVersion uint8 `json:"wslVersion" yaml:"wslVersion"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (conf Unpacked) MarshalJSON() ([]byte, error) {
+	return json.Marshal(serialized(conf))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (conf *Unpacked) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*serialized)(conf))
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (conf Unpacked) MarshalYAML() (any, error) {
+	return serialized(conf), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (conf *Unpacked) UnmarshalYAML(value *yaml.Node) error {
+	return value.Decode((*serialized)(conf))
+}
@@ -0,0 +1,374 @@
+// Package ini implements a parser for the INI dialect used by WSL's
+// configuration files (.wslconfig and /etc/wsl.conf).
+//
+// Unlike a plain parser, it keeps every line of the original file, so that
+// comments, blank lines and key order survive a read-modify-write cycle.
+package ini
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// File is a parsed INI document. The zero value is an empty document ready to use.
+//
+// Section and key names are case-insensitive, as they are in WSL.
+type File struct {
+	lines []*line
+	eol   string
+}
+
+// Entry is a key-value pair found in a File.
+type Entry struct {
+	Section string // Name of the section the entry belongs to. Empty for entries before any section.
+	Key     string // Name of the key, as written in the file
+	Value   string // Decoded value, with quotes and escape sequences resolved
+	Line    int    // Line number (starting at 1) where the entry is found
+}
+
+type lineKind int
+
+const (
+	lineOther lineKind = iota // Blank lines and comments
+	lineSection
+	lineKey
+)
+
+type line struct {
+	kind lineKind
+	raw  string // Verbatim text of the line, without the line terminator
+
+	section string // Section the line belongs to (or the section name for section headers)
+	key     string // Only for key lines
+	value   string // Only for key lines. Decoded value.
+
+	// Only for key lines: offsets of the encoded value within raw
+	valueStart, valueEnd int
+}
+
+// Parse reads an INI document. Any syntax error is reported along with its line number.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Contains(data, []byte("\r\n")) {
+		f.eol = "\r\n"
+	}
+
+	// UTF-8 byte order mark, as left by some Windows editors
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var section string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		l, err := parseLine(strings.TrimSuffix(sc.Text(), "\r"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+
+		switch l.kind {
+		case lineSection:
+			section = l.section
+		case lineKey, lineOther:
+			l.section = section
+		}
+
+		f.lines = append(f.lines, l)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func parseLine(raw string) (*line, error) {
+	l := &line{raw: raw}
+	text := strings.TrimSpace(raw)
+
+	switch {
+	case text == "" || text[0] == '#' || text[0] == ';':
+		l.kind = lineOther
+		return l, nil
+	case text[0] == '[':
+		end := strings.IndexByte(text, ']')
+		if end == -1 {
+			return nil, errors.New("unterminated section header")
+		}
+		if rest := strings.TrimSpace(text[end+1:]); rest != "" && rest[0] != '#' && rest[0] != ';' {
+			return nil, fmt.Errorf("unexpected text after section header: %q", rest)
+		}
+		name := strings.TrimSpace(text[1:end])
+		if name == "" {
+			return nil, errors.New("empty section name")
+		}
+		l.kind = lineSection
+		l.section = name
+		return l, nil
+	}
+
+	eq := strings.IndexByte(raw, '=')
+	if eq == -1 {
+		return nil, fmt.Errorf("expected key=value, found %q", text)
+	}
+
+	key := strings.TrimSpace(raw[:eq])
+	if key == "" {
+		return nil, errors.New("empty key name")
+	}
+	if strings.ContainsAny(key, " \t") {
+		return nil, fmt.Errorf("invalid key name %q", key)
+	}
+
+	value, start, end, err := decodeValue(raw, eq+1)
+	if err != nil {
+		return nil, err
+	}
+
+	l.kind = lineKey
+	l.key = key
+	l.value = value
+	l.valueStart = start
+	l.valueEnd = end
+
+	return l, nil
+}
+
+// decodeValue parses the value of a key-value line starting at offset from.
+// It returns the decoded value as well as the span it occupies in the raw line.
+//
+// Values follow the same rules as WSL's parser: leading and trailing whitespace
+// is ignored, an unquoted '#' or ';' starts a comment, and double quotes and
+// backslash escape sequences can be used to avoid that.
+func decodeValue(raw string, from int) (value string, start, end int, err error) {
+	start = from
+	for start < len(raw) && (raw[start] == ' ' || raw[start] == '\t') {
+		start++
+	}
+
+	var sb strings.Builder
+	var quoted bool
+	var pendingSpace strings.Builder
+
+	end = start
+	i := start
+loop:
+	for ; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && i+1 < len(raw) && strings.IndexByte(`nt\"`, raw[i+1]) != -1:
+			// Unknown escape sequences are not matched here, so that unescaped
+			// Windows paths such as C:\Users are read verbatim.
+			i++
+			switch c = raw[i]; c {
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			}
+			sb.WriteString(pendingSpace.String())
+			pendingSpace.Reset()
+			sb.WriteByte(c)
+		case !quoted && (c == '#' || c == ';'):
+			break loop
+		case !quoted && (c == ' ' || c == '\t'):
+			pendingSpace.WriteByte(c)
+			continue
+		default:
+			sb.WriteString(pendingSpace.String())
+			pendingSpace.Reset()
+			sb.WriteByte(c)
+		}
+		end = i + 1
+	}
+
+	if quoted {
+		return "", 0, 0, errors.New("unterminated quoted value")
+	}
+
+	return sb.String(), start, end, nil
+}
+
+// encodeValue is the inverse of decodeValue.
+func encodeValue(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	s := r.Replace(value)
+
+	if strings.ContainsAny(value, "#;") || strings.TrimSpace(value) != value {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// Sections returns the names of the sections in the order they first appear.
+// Entries that precede any section header belong to the section with empty name,
+// which is only listed if it contains any key.
+func (f *File) Sections() []string {
+	var sections []string
+	seen := make(map[string]bool)
+	for _, l := range f.lines {
+		if l.kind == lineOther || (l.kind == lineKey && l.section != "") {
+			continue
+		}
+		id := strings.ToLower(l.section)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		sections = append(sections, l.section)
+	}
+	return sections
+}
+
+// Entries returns all key-value pairs in the order they appear in the file.
+func (f *File) Entries() []Entry {
+	var entries []Entry
+	for i, l := range f.lines {
+		if l.kind != lineKey {
+			continue
+		}
+		entries = append(entries, Entry{
+			Section: l.section,
+			Key:     l.key,
+			Value:   l.value,
+			Line:    i + 1,
+		})
+	}
+	return entries
+}
+
+// Get returns the value of a key. If the key is repeated, the last occurrence wins.
+func (f *File) Get(section, key string) (value string, ok bool) {
+	if i := f.find(section, key); i != -1 {
+		return f.lines[i].value, true
+	}
+	return "", false
+}
+
+// Set assigns a value to a key, creating the key (and its section) if necessary.
+// An existing line is updated in place, preserving its formatting and trailing comment.
+func (f *File) Set(section, key, value string) {
+	encoded := encodeValue(value)
+
+	if i := f.find(section, key); i != -1 {
+		l := f.lines[i]
+		l.raw = l.raw[:l.valueStart] + encoded + l.raw[l.valueEnd:]
+		l.valueEnd = l.valueStart + len(encoded)
+		l.value = value
+		return
+	}
+
+	sep := f.separator()
+	newLine := &line{
+		kind:       lineKey,
+		raw:        key + sep + encoded,
+		section:    section,
+		key:        key,
+		value:      value,
+		valueStart: len(key) + len(sep),
+		valueEnd:   len(key) + len(sep) + len(encoded),
+	}
+
+	if at := f.insertionPoint(section); at != -1 {
+		f.lines = append(f.lines[:at], append([]*line{newLine}, f.lines[at:]...)...)
+		return
+	}
+
+	// The section does not exist: append it.
+	if n := len(f.lines); n != 0 && strings.TrimSpace(f.lines[n-1].raw) != "" {
+		f.lines = append(f.lines, &line{kind: lineOther, section: f.lines[n-1].section})
+	}
+	f.lines = append(f.lines, &line{kind: lineSection, raw: "[" + section + "]", section: section}, newLine)
+}
+
+// Unset removes every occurrence of a key. Removing a missing key is a no-op.
+func (f *File) Unset(section, key string) {
+	lines := f.lines[:0]
+	for _, l := range f.lines {
+		if l.kind == lineKey && strings.EqualFold(l.section, section) && strings.EqualFold(l.key, key) {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	f.lines = lines
+}
+
+// WriteTo writes the document into w. Lines that have not been modified are written verbatim.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	eol := f.eol
+	if eol == "" {
+		eol = "\n"
+	}
+
+	var buff bytes.Buffer
+	for _, l := range f.lines {
+		buff.WriteString(l.raw)
+		buff.WriteString(eol)
+	}
+
+	return buff.WriteTo(w)
+}
+
+// String returns the document as text.
+func (f *File) String() string {
+	var sb strings.Builder
+	_, _ = f.WriteTo(&sb)
+	return sb.String()
+}
+
+// find returns the index of the last line with the given key, or -1 if there is none.
+func (f *File) find(section, key string) int {
+	for i := len(f.lines) - 1; i >= 0; i-- {
+		l := f.lines[i]
+		if l.kind == lineKey && strings.EqualFold(l.section, section) && strings.EqualFold(l.key, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertionPoint returns the index where a new key of the given section should
+// be inserted, that is, right after the last key (or header) of the last occurrence
+// of the section. It returns -1 if the section does not exist.
+func (f *File) insertionPoint(section string) int {
+	at := -1
+	if section == "" {
+		// Before the first section header
+		at = 0
+	}
+
+	for i, l := range f.lines {
+		if section == "" && l.kind == lineSection {
+			break
+		}
+		if !strings.EqualFold(l.section, section) || l.kind == lineOther {
+			continue
+		}
+		at = i + 1
+	}
+
+	return at
+}
+
+// separator returns the text between key and value used in the file,
+// so that new keys are formatted like the existing ones.
+func (f *File) separator() string {
+	for _, l := range f.lines {
+		if l.kind == lineKey {
+			keyEnd := strings.Index(l.raw, l.key) + len(l.key)
+			return l.raw[keyEnd:l.valueStart]
+		}
+	}
+	return "="
+}
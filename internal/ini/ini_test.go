@@ -0,0 +1,167 @@
+package ini_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/ini"
+)
+
+const sampleFile = `# Settings apply across all Linux distros running on WSL 2
+[wsl2]
+
+# Limits VM memory to use no more than 4 GB
+memory = 4GB # Inline comment
+processors=2
+
+[experimental]
+autoMemoryReclaim = gradual
+kernelCommandLine = "quiet; splash"   ; Quoted value with a semicolon
+kernel = C:\\temp\\my kernel
+`
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+
+		wantEntries []ini.Entry
+		wantErr     bool
+	}{
+		"Empty file": {},
+		"Sample file": {input: sampleFile, wantEntries: []ini.Entry{
+			{Section: "wsl2", Key: "memory", Value: "4GB", Line: 5},
+			{Section: "wsl2", Key: "processors", Value: "2", Line: 6},
+			{Section: "experimental", Key: "autoMemoryReclaim", Value: "gradual", Line: 9},
+			{Section: "experimental", Key: "kernelCommandLine", Value: "quiet; splash", Line: 10},
+			{Section: "experimental", Key: "kernel", Value: `C:\temp\my kernel`, Line: 11},
+		}},
+		"Keys before any section": {input: "a=b\n[s]\nc=d", wantEntries: []ini.Entry{
+			{Section: "", Key: "a", Value: "b", Line: 1},
+			{Section: "s", Key: "c", Value: "d", Line: 3},
+		}},
+		"CRLF line endings": {input: "[s]\r\nk = v\r\n", wantEntries: []ini.Entry{
+			{Section: "s", Key: "k", Value: "v", Line: 2},
+		}},
+		"Unescaped Windows path": {input: `k=C:\Users\me`, wantEntries: []ini.Entry{
+			{Section: "", Key: "k", Value: `C:\Users\me`, Line: 1},
+		}},
+		"Empty value": {input: "k=", wantEntries: []ini.Entry{
+			{Section: "", Key: "k", Value: "", Line: 1},
+		}},
+
+		// Error cases
+		"Error on line without equals sign":  {input: "[s]\nnot a key", wantErr: true},
+		"Error on unterminated header":       {input: "[s", wantErr: true},
+		"Error on empty section name":        {input: "[ ]", wantErr: true},
+		"Error on text after section header": {input: "[s] text", wantErr: true},
+		"Error on empty key":                 {input: "=value", wantErr: true},
+		"Error on key with spaces":           {input: "my key=value", wantErr: true},
+		"Error on unterminated quote":        {input: `k="value`, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := ini.Parse(strings.NewReader(tc.input))
+			if tc.wantErr {
+				require.Error(t, err, "Parse should have failed")
+				return
+			}
+			require.NoError(t, err, "Parse should not have failed")
+
+			require.Equal(t, tc.wantEntries, f.Entries(), "Unexpected entries in parsed file")
+			want := tc.input
+			if want != "" && !strings.HasSuffix(want, "\n") {
+				want += "\n"
+			}
+			require.Equal(t, want, f.String(), "Unmodified file should round-trip verbatim")
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+
+	f, err := ini.Parse(strings.NewReader(sampleFile + "[WSL2]\nMemory=8GB\n"))
+	require.NoError(t, err, "Setup: Parse should not have failed")
+
+	v, ok := f.Get("wsl2", "memory")
+	require.True(t, ok, "Get should find an existing key")
+	require.Equal(t, "8GB", v, "Get should be case-insensitive and return the last occurrence")
+
+	_, ok = f.Get("wsl2", "swap")
+	require.False(t, ok, "Get should not find a missing key")
+
+	require.Equal(t, []string{"wsl2", "experimental"}, f.Sections(), "Unexpected sections")
+}
+
+func TestSet(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input   string
+		section string
+		key     string
+		value   string
+
+		want string
+	}{
+		"Modify existing key preserving comment": {input: sampleFile, section: "wsl2", key: "memory", value: "8GB",
+			want: strings.Replace(sampleFile, "memory = 4GB #", "memory = 8GB #", 1)},
+		"Modify existing quoted key": {input: sampleFile, section: "experimental", key: "kernelCommandLine", value: "quiet",
+			want: strings.Replace(sampleFile, `"quiet; splash"   ;`, `quiet   ;`, 1)},
+		"Add key to existing section": {input: sampleFile, section: "WSL2", key: "swap", value: "0",
+			want: strings.Replace(sampleFile, "processors=2\n", "processors=2\nswap = 0\n", 1)},
+		"Add key to new section": {input: sampleFile, section: "boot", key: "systemd", value: "true",
+			want: sampleFile + "\n[boot]\nsystemd = true\n"},
+		"Add key to empty file": {section: "boot", key: "command", value: "echo #1",
+			want: "[boot]\ncommand=\"echo #1\"\n"},
+		"Add key that needs escaping": {input: "[wsl2]\n", section: "wsl2", key: "kernel", value: `C:\kernel`,
+			want: "[wsl2]\nkernel=C:\\\\kernel\n"},
+		"Add key without section": {input: "# comment\n[s]\na=b\n", section: "", key: "k", value: "v",
+			want: "k=v\n# comment\n[s]\na=b\n"},
+		"Preserve CRLF line endings": {input: "[s]\r\na=b\r\n", section: "s", key: "c", value: "d",
+			want: "[s]\r\na=b\r\nc=d\r\n"},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := ini.Parse(strings.NewReader(tc.input))
+			require.NoError(t, err, "Setup: Parse should not have failed")
+
+			f.Set(tc.section, tc.key, tc.value)
+			require.Equal(t, tc.want, f.String(), "Unexpected file contents after Set")
+
+			got, ok := f.Get(tc.section, tc.key)
+			require.True(t, ok, "Key should be found after Set")
+			require.Equal(t, tc.value, got, "Get should return the value written by Set")
+
+			// Round trip
+			f, err = ini.Parse(strings.NewReader(f.String()))
+			require.NoError(t, err, "Parse should not fail on a file written by Set")
+			got, ok = f.Get(tc.section, tc.key)
+			require.True(t, ok, "Key should be found after re-parsing")
+			require.Equal(t, tc.value, got, "Value should survive a round trip")
+		})
+	}
+}
+
+func TestUnset(t *testing.T) {
+	t.Parallel()
+
+	f, err := ini.Parse(strings.NewReader("[s]\na=1\nb=2\n[S]\na=3\n"))
+	require.NoError(t, err, "Setup: Parse should not have failed")
+
+	f.Unset("s", "a")
+	f.Unset("s", "missing")
+
+	require.Equal(t, "[s]\nb=2\n[S]\n", f.String(), "Unset should remove every occurrence of the key")
+}
@@ -0,0 +1,317 @@
+package ini
+
+// This file contains the mapping between INI files and typed configuration structs.
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Schema is the list of known settings of a configuration file, and how
+// they map to the fields of a configuration struct C.
+type Schema[C any] []Setting[C]
+
+// Setting describes a key in an INI file and its mapping to a field of C.
+type Setting[C any] struct {
+	Section string
+	Key     string
+
+	// LegacySection is a section where the key used to be. It is still read from
+	// (and updated in) there if the key is not found in Section.
+	LegacySection string
+
+	decode   func(c *C, value string) error
+	encode   func(c C) (value string, ok bool)
+	validate func(c C) error
+}
+
+// Warning is a non-fatal problem found in a configuration file.
+type Warning struct {
+	Line    int    // Line number (starting at 1) where the problem is found
+	Message string // Description of the problem
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("line %d: %s", w.Line, w.Message)
+}
+
+// Decode reads all known settings in the file. Unknown settings are ignored.
+func (s Schema[C]) Decode(f *File) (c C, err error) {
+	for _, setting := range s {
+		value, ok := setting.get(f)
+		if !ok {
+			continue
+		}
+		if e := setting.decode(&c, value); e != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %v", setting.Key, e))
+		}
+	}
+
+	return c, err
+}
+
+// Encode validates c and writes it into the file. Settings that are not set in c are
+// removed from the file. Unknown settings and comments are left untouched.
+func (s Schema[C]) Encode(f *File, c C) error {
+	if err := s.Validate(c); err != nil {
+		return err
+	}
+
+	for _, setting := range s {
+		value, ok := setting.encode(c)
+		if !ok {
+			setting.unset(f)
+			continue
+		}
+		setting.set(f, value)
+	}
+
+	return nil
+}
+
+// Validate checks that all settings have valid values.
+func (s Schema[C]) Validate(c C) (err error) {
+	for _, setting := range s {
+		if setting.validate == nil {
+			continue
+		}
+		if e := setting.validate(c); e != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %v", setting.Key, e))
+		}
+	}
+
+	return err
+}
+
+// Unknown reports every key in the file that is not part of the schema.
+func (s Schema[C]) Unknown(f *File) (warnings []Warning) {
+	for _, e := range f.Entries() {
+		if _, ok := s.Lookup(e.Section, e.Key); ok {
+			continue
+		}
+
+		var msg string
+		switch {
+		case e.Section == "":
+			msg = fmt.Sprintf("key %q is outside of any section", e.Key)
+		case !s.knownSection(e.Section):
+			msg = fmt.Sprintf("unknown section [%s]", e.Section)
+		default:
+			msg = fmt.Sprintf("unknown key %q in section [%s]", e.Key, e.Section)
+		}
+
+		warnings = append(warnings, Warning{Line: e.Line, Message: msg})
+	}
+
+	return warnings
+}
+
+// Diff returns the settings whose value differs between a and b.
+func (s Schema[C]) Diff(a, b C) (changed []Setting[C]) {
+	for _, setting := range s {
+		va, okA := setting.encode(a)
+		vb, okB := setting.encode(b)
+		if okA != okB || va != vb {
+			changed = append(changed, setting)
+		}
+	}
+	return changed
+}
+
+// Lookup finds a setting by section and key (case-insensitive).
+func (s Schema[C]) Lookup(section, key string) (Setting[C], bool) {
+	for _, setting := range s {
+		if !strings.EqualFold(setting.Key, key) {
+			continue
+		}
+		if strings.EqualFold(setting.Section, section) || (setting.LegacySection != "" && strings.EqualFold(setting.LegacySection, section)) {
+			return setting, true
+		}
+	}
+	return Setting[C]{}, false
+}
+
+func (s Schema[C]) knownSection(section string) bool {
+	for _, setting := range s {
+		if strings.EqualFold(setting.Section, section) || (setting.LegacySection != "" && strings.EqualFold(setting.LegacySection, section)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns the textual value of the setting in c, and whether it is set at all.
+func (s Setting[C]) Value(c C) (string, bool) {
+	return s.encode(c)
+}
+
+// get looks for the setting in the file, falling back to its legacy section.
+func (s Setting[C]) get(f *File) (string, bool) {
+	if v, ok := f.Get(s.Section, s.Key); ok {
+		return v, true
+	}
+	if s.LegacySection != "" {
+		return f.Get(s.LegacySection, s.Key)
+	}
+	return "", false
+}
+
+// set writes the setting into the file. Settings that are in their legacy section
+// are updated there. Values that are only written differently (such as 4gb
+// and 4GB) are left untouched.
+func (s Setting[C]) set(f *File, value string) {
+	if current, ok := s.get(f); ok {
+		var c C
+		if err := s.decode(&c, current); err == nil {
+			if v, _ := s.encode(c); v == value {
+				return
+			}
+		}
+	}
+
+	if _, ok := f.Get(s.Section, s.Key); !ok && s.LegacySection != "" {
+		if _, ok := f.Get(s.LegacySection, s.Key); ok {
+			f.Set(s.LegacySection, s.Key, value)
+			return
+		}
+	}
+	f.Set(s.Section, s.Key, value)
+}
+
+// unset removes the setting from the file.
+func (s Setting[C]) unset(f *File) {
+	f.Unset(s.Section, s.Key)
+	if s.LegacySection != "" {
+		f.Unset(s.LegacySection, s.Key)
+	}
+}
+
+// Optional describes a setting stored in a pointer field, where nil means it is not set.
+// Validate may be nil.
+func Optional[C, T any](section, key string, field func(*C) **T,
+	parse func(string) (T, error), format func(T) string, validate func(T) error) Setting[C] {
+	s := Setting[C]{
+		Section: section,
+		Key:     key,
+		decode: func(c *C, value string) error {
+			v, err := parse(value)
+			if err != nil {
+				return err
+			}
+			*field(c) = &v
+			return nil
+		},
+		encode: func(c C) (string, bool) {
+			v := *field(&c)
+			if v == nil {
+				return "", false
+			}
+			return format(*v), true
+		},
+	}
+
+	if validate != nil {
+		s.validate = func(c C) error {
+			v := *field(&c)
+			if v == nil {
+				return nil
+			}
+			return validate(*v)
+		}
+	}
+
+	return s
+}
+
+// Bool describes a boolean setting.
+func Bool[C any](section, key string, field func(*C) **bool) Setting[C] {
+	parse := func(s string) (bool, error) {
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return false, fmt.Errorf("expected true or false, found %q", s)
+	}
+
+	return Optional(section, key, field, parse, strconv.FormatBool, nil)
+}
+
+// Int describes an integer setting. Validate may be nil.
+func Int[C any](section, key string, field func(*C) **int, validate func(int) error) Setting[C] {
+	parse := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("expected an integer, found %q", s)
+		}
+		return n, nil
+	}
+
+	return Optional(section, key, field, parse, strconv.Itoa, validate)
+}
+
+// String describes a string setting, where the empty string means it is not set.
+// Validate may be nil.
+func String[C any](section, key string, field func(*C) *string, validate func(string) error) Setting[C] {
+	s := Setting[C]{
+		Section: section,
+		Key:     key,
+		decode: func(c *C, value string) error {
+			*field(c) = value
+			return nil
+		},
+		encode: func(c C) (string, bool) {
+			v := *field(&c)
+			return v, v != ""
+		},
+	}
+
+	if validate != nil {
+		s.validate = func(c C) error {
+			v := *field(&c)
+			if v == "" {
+				return nil
+			}
+			return validate(v)
+		}
+	}
+
+	return s
+}
+
+// Enum describes a string setting that only accepts some values. They are
+// matched case-insensitively when reading.
+func Enum[C any, T ~string](section, key string, field func(*C) *T, values ...T) Setting[C] {
+	return Setting[C]{
+		Section: section,
+		Key:     key,
+		decode: func(c *C, value string) error {
+			*field(c) = T(value)
+			for _, v := range values {
+				if strings.EqualFold(string(v), value) {
+					*field(c) = v
+				}
+			}
+			return nil
+		},
+		encode: func(c C) (string, bool) {
+			v := *field(&c)
+			return string(v), v != ""
+		},
+		validate: func(c C) error {
+			v := *field(&c)
+			if v == "" {
+				return nil
+			}
+			for _, allowed := range values {
+				if v == allowed {
+					return nil
+				}
+			}
+			return fmt.Errorf("unknown value %q, expected one of %v", v, values)
+		},
+	}
+}
@@ -1,7 +1,12 @@
 // Package state defines the state enum so that both backends can use it
 package state
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
 
 // State is the state of a particular distro as seen in `wsl.exe -l -v`.
 type State int
@@ -49,3 +54,59 @@ func (s State) String() string {
 
 	return fmt.Sprintf("Unknown state %d", s)
 }
+
+// MarshalJSON implements json.Marshaler. States are serialized by name.
+func (s State) MarshalJSON() ([]byte, error) {
+	name, err := s.name()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(name)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *State) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	return s.parse(name)
+}
+
+// MarshalYAML implements yaml.Marshaler. States are serialized by name.
+func (s State) MarshalYAML() (any, error) {
+	return s.name()
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *State) UnmarshalYAML(value *yaml.Node) error {
+	var name string
+	if err := value.Decode(&name); err != nil {
+		return err
+	}
+	return s.parse(name)
+}
+
+// name returns the name of the state, or an error if it is unknown.
+func (s State) name() (string, error) {
+	if s < Stopped || s > NotRegistered {
+		return "", fmt.Errorf("unknown state %d", s)
+	}
+	return s.String(), nil
+}
+
+// parse sets the state with the given name. Unlike NewFromString, it accepts
+// NotRegistered.
+func (s *State) parse(name string) error {
+	if name == NotRegistered.String() {
+		*s = NotRegistered
+		return nil
+	}
+
+	parsed, err := NewFromString(name)
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
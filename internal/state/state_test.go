@@ -1,10 +1,12 @@
 package state_test
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 	"github.com/ubuntu/gowsl/internal/state"
+	"gopkg.in/yaml.v3"
 )
 
 func TestStateFromString(t *testing.T) {
@@ -70,3 +72,59 @@ func TestString(t *testing.T) {
 		})
 	}
 }
+
+func TestSerialization(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input state.State
+
+		wantJSON string
+		wantYAML string
+		wantErr  bool
+	}{
+		"Stopped":       {input: state.Stopped, wantJSON: `"Stopped"`, wantYAML: "Stopped\n"},
+		"Running":       {input: state.Running, wantJSON: `"Running"`, wantYAML: "Running\n"},
+		"Installing":    {input: state.Installing, wantJSON: `"Installing"`, wantYAML: "Installing\n"},
+		"Uninstalling":  {input: state.Uninstalling, wantJSON: `"Uninstalling"`, wantYAML: "Uninstalling\n"},
+		"NotRegistered": {input: state.NotRegistered, wantJSON: `"NotRegistered"`, wantYAML: "NotRegistered\n"},
+
+		// Error case
+		"Error with made-up state": {input: 35, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			gotJSON, jsonErr := json.Marshal(tc.input)
+			gotYAML, yamlErr := yaml.Marshal(tc.input)
+			if tc.wantErr {
+				require.Error(t, jsonErr, "MarshalJSON should have failed with an unknown state")
+				require.Error(t, yamlErr, "MarshalYAML should have failed with an unknown state")
+				return
+			}
+			require.NoError(t, jsonErr, "MarshalJSON should not have failed")
+			require.NoError(t, yamlErr, "MarshalYAML should not have failed")
+			require.Equal(t, tc.wantJSON, string(gotJSON), "Unexpected JSON")
+			require.Equal(t, tc.wantYAML, string(gotYAML), "Unexpected YAML")
+
+			var fromJSON, fromYAML state.State
+			require.NoError(t, json.Unmarshal(gotJSON, &fromJSON), "UnmarshalJSON should not have failed")
+			require.NoError(t, yaml.Unmarshal(gotYAML, &fromYAML), "UnmarshalYAML should not have failed")
+			require.Equal(t, tc.input, fromJSON, "The state should have round-tripped through JSON")
+			require.Equal(t, tc.input, fromYAML, "The state should have round-tripped through YAML")
+		})
+	}
+}
+
+func TestDeserializationErrors(t *testing.T) {
+	t.Parallel()
+
+	var s state.State
+	require.Error(t, json.Unmarshal([]byte(`"Discombobulating"`), &s), "UnmarshalJSON should have failed with a made-up state")
+	require.Error(t, json.Unmarshal([]byte(`1`), &s), "UnmarshalJSON should have failed with a number")
+	require.Error(t, yaml.Unmarshal([]byte("Discombobulating"), &s), "UnmarshalYAML should have failed with a made-up state")
+	require.Error(t, yaml.Unmarshal([]byte("[Running]"), &s), "UnmarshalYAML should have failed with a list")
+}
@@ -3,31 +3,92 @@
 package mock
 
 import (
-	"fmt"
 	"path/filepath"
+	"time"
 )
 
 // Backend implements the Backend interface.
 type Backend struct {
-	lxssRootKey *RegistryKey // Map from GUID to key
+	lxssRootKey *RegistryKey     // Map from GUID to key
+	handlers    *commandHandlers // Handlers for the commands launched into the distros
+	journal     *journal         // Record of the calls to the back-end
+	faults      *faultInjector   // Faults injected into the calls to the back-end
+
+	clock       Clock              // Clock used to stop idle distros, time operations and delay faults
+	idleTimeout time.Duration      // Time after which idle distros are stopped
+	durations   OperationDurations // Time the long-running operations take
+}
+
+// Option is an optional parameter for New. Use any of the provided functions
+// such as WithClock().
+type Option func(*options)
+
+type options struct {
+	clock       Clock
+	idleTimeout time.Duration
+	durations   OperationDurations
+}
+
+// WithClock is an optional parameter for New that sets the clock used to stop
+// idle distros, and to measure the duration of operations and the delay of faults.
+// Otherwise, the real time is used.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithIdleTimeout is an optional parameter for New that sets how long distros
+// can be idle before they are stopped. A non-positive timeout keeps them running
+// until they are terminated. Otherwise, they are stopped after 8 seconds, like in WSL.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = d
+	}
+}
+
+// WithOperationDurations is an optional parameter for New that sets how long the
+// long-running operations take, as measured by the clock. While they are in progress,
+// the distro reports the Installing or Uninstalling states where applicable, and
+// conflicting operations fail with ErrDistroBusy. Otherwise, they are instantaneous.
+func WithOperationDurations(d OperationDurations) Option {
+	return func(o *options) {
+		o.durations = d
+	}
 }
 
 // New constructs a new mocked back-end for WSL.
-func New() *Backend {
-	str := fmt.Sprintf("afaf %s", 12345678)
-	fmt.Println(str)
+func New(args ...Option) *Backend {
+	opts := options{
+		clock:       realClock{},
+		idleTimeout: 8 * time.Second,
+	}
+	for _, f := range args {
+		f(&opts)
+	}
+
+	faults := newFaultInjector(opts.clock)
 
 	return &Backend{
 		lxssRootKey: &RegistryKey{
-			path: lxssPath,
+			path:   lxssPath,
+			faults: faults,
 			children: map[string]*RegistryKey{
 				"AppxInstallerCache": {
-					path: filepath.Join(lxssPath, "AppxInstallerCache"),
+					path:   filepath.Join(lxssPath, "AppxInstallerCache"),
+					faults: faults,
 				},
 			},
 			data: map[string]any{
 				"DefaultDistribution": "",
 			},
 		},
+		handlers: newCommandHandlers(),
+		journal:  &journal{},
+		faults:   faults,
+
+		clock:       opts.clock,
+		idleTimeout: opts.idleTimeout,
+		durations:   opts.durations,
 	}
 }
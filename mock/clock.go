@@ -0,0 +1,132 @@
+package mock
+
+// This file contains the clocks used to stop idle distros.
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ubuntu/gowsl/mock/internal/distrostate"
+)
+
+// Clock creates the timers the back-end uses to stop idle distros. Use
+// NewFakeClock to control the passing of time in tests.
+type Clock = distrostate.Clock
+
+// Timer is a timer created by a Clock. Stop returns false if the timer had
+// already fired or been stopped.
+type Timer = distrostate.Timer
+
+// realClock is the Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// sleep blocks until the clock has advanced by d.
+func sleep(c Clock, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	c.AfterFunc(d, func() { close(done) })
+	<-done
+}
+
+// FakeClock is a Clock where time only passes when Advance is called.
+// It is safe for concurrent use.
+type FakeClock struct {
+	now    time.Time
+	timers []*fakeTimer
+	mu     sync.Mutex
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	f        func()
+}
+
+// NewFakeClock returns a FakeClock set at the provided time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// AfterFunc calls f once the clock has advanced by d. Timers never fire
+// during this call, even if d is not positive: they fire during the next
+// call to Advance.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{clock: c, deadline: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+
+	return t
+}
+
+// Advance moves the clock forward by d. The timers that expire in the meantime
+// fire in order, synchronously, with the clock set at their deadline.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].deadline.Before(c.timers[j].deadline) })
+		if len(c.timers) == 0 || c.timers[0].deadline.After(target) {
+			break
+		}
+
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.deadline.After(c.now) {
+			c.now = t.deadline
+		}
+
+		// Released so that the function can use the clock
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+
+	if target.After(c.now) {
+		c.now = target
+	}
+	c.mu.Unlock()
+}
+
+// PendingTimers returns the number of timers that have not fired nor been stopped.
+func (c *FakeClock) PendingTimers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	for i := range t.clock.timers {
+		if t.clock.timers[i] == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
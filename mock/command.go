@@ -1,10 +1,13 @@
 package mock
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
+
+	"github.com/ubuntu/gowsl/internal/bridge"
 )
 
 // mockedCommand is in charge of creating processes that behave the same way
@@ -97,3 +100,9 @@ func (c mockedCommand) start(stdin, stdout, stderr *os.File) (*os.Process, error
 
 	return p, nil
 }
+
+// startHandler runs a CommandHandler as a process. See bridge.Start.
+func startHandler(handler CommandHandler, info CommandInfo, stdin, stdout, stderr *os.File) (*os.Process, error) {
+	ctx := context.WithValue(context.Background(), commandInfoKey{}, info)
+	return bridge.Start(ctx, bridge.Handler(handler), stdin, stdout, stderr)
+}
@@ -0,0 +1,224 @@
+package mock
+
+// This file contains the fault injection, used to make the back-end fail on demand.
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ubuntu/gowsl/backend"
+)
+
+// Fault describes a failure injected into a method of the back-end.
+//
+// The fields OnCall, Times and Probability decide which calls are affected. All
+// calls are affected if they are left empty. The fields Err, HRESULT and ExitCode
+// decide how they fail. A fault with none of them only delays the call.
+type Fault struct {
+	OnCall      int     // Only affect the Nth call (starting at 1) made after injecting the fault
+	Times       int     // Affect at most this many calls
+	Probability float64 // Affect each call with this probability, between 0 and 1
+
+	Delay time.Duration // Time to wait before the call proceeds or fails, as measured by the back-end's clock
+
+	Err      error  // Error returned by the call
+	HRESULT  uint32 // If Err is nil, the call fails with this HRESULT, wrapped as an HRESULTError
+	ExitCode int    // If Err and HRESULT are empty, commands exit with this code, and wsl.exe calls fail with it
+
+	// Partial makes WslRegisterDistribution fail after creating the registry key of
+	// the distro, leaving it partially configured.
+	Partial bool
+}
+
+// HRESULTError is the error wrapped by a failed syscall.
+type HRESULTError = backend.HRESULTError
+
+// ExitCodeError is the error returned by calls to wsl.exe that exit with a non-zero code.
+type ExitCodeError int
+
+func (e ExitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// err returns the error the fault causes in methods that do not launch commands.
+func (f Fault) err() error {
+	switch {
+	case f.Err != nil:
+		return f.Err
+	case f.HRESULT != 0:
+		return fmt.Errorf("failed syscall: %w", HRESULTError(f.HRESULT))
+	case f.ExitCode != 0:
+		return ExitCodeError(f.ExitCode)
+	}
+	return nil
+}
+
+// launchErr returns the error the fault causes in methods that launch commands.
+// These fail only with Err or HRESULT; an exit code is returned by the command.
+func (f Fault) launchErr() error {
+	if f.Err == nil && f.HRESULT == 0 {
+		return nil
+	}
+	return f.err()
+}
+
+// faultableMethods is the set of methods that accept faults.
+var faultableMethods = map[string]bool{
+	"OpenLxssRegistry":                true,
+	"Field":                           true,
+	"SubkeyNames":                     true,
+	"State":                           true,
+	"Shutdown":                        true,
+	"Terminate":                       true,
+	"SetAsDefault":                    true,
+	"WslConfigureDistribution":        true,
+	"WslGetDistributionConfiguration": true,
+	"WslLaunch":                       true,
+	"WslLaunchEnv":                    true,
+	"WslLaunchAs":                     true,
+	"WslLaunchInteractive":            true,
+	"WslRegisterDistribution":         true,
+	"WslUnregisterDistribution":       true,
+	"Export":                          true,
+	"Import":                          true,
+	"SetVersion":                      true,
+}
+
+// InjectFault makes calls to a method of the back-end fail. The method is the name
+// of any method of the Backend interface, one of WslLaunchEnv, WslLaunchAs, Export,
+// Import and SetVersion, or one of the RegistryKey methods Field and SubkeyNames.
+// It panics if the method does not exist.
+//
+// When more than one fault affects a call, the one injected first takes precedence.
+// Use the returned function to remove the fault.
+func (b *Backend) InjectFault(method string, f Fault) (remove func()) {
+	if !faultableMethods[method] {
+		panic(fmt.Sprintf("InjectFault: unknown method %q", method))
+	}
+
+	return b.faults.add(method, f)
+}
+
+// ClearFaults removes all faults.
+func (b *Backend) ClearFaults() {
+	b.faults.mu.Lock()
+	defer b.faults.mu.Unlock()
+
+	b.faults.rules = nil
+}
+
+// SeedFaults seeds the random source used for faults with a Probability,
+// so that tests using them are reproducible.
+func (b *Backend) SeedFaults(seed int64) {
+	b.faults.mu.Lock()
+	defer b.faults.mu.Unlock()
+
+	//nolint:gosec // This is not a cryptographic use.
+	b.faults.rand = rand.New(rand.NewSource(seed))
+}
+
+// faultInjector stores the faults of a back-end. It is safe for concurrent use.
+type faultInjector struct {
+	rules []*faultRule
+	rand  *rand.Rand
+	clock Clock // Clock the delays are measured with
+	mu    sync.Mutex
+}
+
+type faultRule struct {
+	method    string
+	fault     Fault
+	calls     int
+	triggered int
+}
+
+func newFaultInjector(clock Clock) *faultInjector {
+	//nolint:gosec // This is not a cryptographic use.
+	return &faultInjector{rand: rand.New(rand.NewSource(time.Now().UnixNano())), clock: clock}
+}
+
+func (fi *faultInjector) add(method string, f Fault) (remove func()) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	rule := &faultRule{method: method, fault: f}
+	fi.rules = append(fi.rules, rule)
+
+	return func() {
+		fi.mu.Lock()
+		defer fi.mu.Unlock()
+
+		for i := range fi.rules {
+			if fi.rules[i] == rule {
+				fi.rules = append(fi.rules[:i], fi.rules[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// trigger returns the fault affecting this call to method, after waiting for its
+// delay. It returns false if no fault affects it.
+func (fi *faultInjector) trigger(method string) (Fault, bool) {
+	if fi == nil {
+		return Fault{}, false
+	}
+
+	fi.mu.Lock()
+
+	var hit *faultRule
+	for _, r := range fi.rules {
+		if r.method != method {
+			continue
+		}
+		r.calls++
+
+		if hit != nil || !fi.affects(r) {
+			continue
+		}
+		r.triggered++
+		hit = r
+	}
+
+	fi.mu.Unlock()
+
+	if hit == nil {
+		return Fault{}, false
+	}
+
+	sleep(fi.clock, hit.fault.Delay)
+	return hit.fault, true
+}
+
+// affects returns true if the last call counted by the rule is affected by its fault.
+// The caller must hold the lock.
+func (fi *faultInjector) affects(r *faultRule) bool {
+	f := r.fault
+	if f.OnCall != 0 && r.calls != f.OnCall {
+		return false
+	}
+	if f.Times != 0 && r.triggered >= f.Times {
+		return false
+	}
+	if f.Probability != 0 && fi.rand.Float64() >= f.Probability {
+		return false
+	}
+	return true
+}
+
+// injectedError returns the error caused by the faults of a method that does not
+// launch commands, if any.
+func (fi *faultInjector) injectedError(method string) error {
+	f, ok := fi.trigger(method)
+	if !ok {
+		return nil
+	}
+	return f.err()
+}
+
+// errPartialRegistration is returned by WslRegisterDistribution when a partial
+// registration is injected with no other error.
+var errPartialRegistration = errors.New("failed syscall: the registration was interrupted")
@@ -0,0 +1,509 @@
+package mock
+
+// This file contains the mocked filesystem of the distros: the commands that
+// operate on it, and the accessors for tests to inspect it.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"testing/fstest"
+
+	"github.com/ubuntu/gowsl/mock/internal/distrofs"
+)
+
+// homeDir is the directory where relative paths are resolved from.
+const homeDir = "/root"
+
+// ReadFile returns the contents of a file inside a distro.
+func (b *Backend) ReadFile(distroName, name string) ([]byte, error) {
+	f, err := b.distroFS(distroName)
+	if err != nil {
+		return nil, err
+	}
+	return f.ReadFile(name)
+}
+
+// WriteFile writes a file inside a distro, creating its parent directories
+// if necessary.
+func (b *Backend) WriteFile(distroName, name string, data []byte, perm fs.FileMode) error {
+	f, err := b.distroFS(distroName)
+	if err != nil {
+		return err
+	}
+	if err := f.Mkdir(path.Dir(path.Clean("/"+name)), 0755, true); err != nil {
+		return err
+	}
+	return f.WriteFile(name, data, perm, false)
+}
+
+// DistroFS returns a copy of the filesystem of a distro, with paths relative to
+// the root directory, as required by io/fs.
+func (b *Backend) DistroFS(distroName string) (fstest.MapFS, error) {
+	f, err := b.distroFS(distroName)
+	if err != nil {
+		return nil, err
+	}
+	return f.Snapshot("/")
+}
+
+func (b *Backend) distroFS(distroName string) (*distrofs.FS, error) {
+	b.lxssRootKey.mu.RLock()
+	defer b.lxssRootKey.mu.RUnlock()
+
+	_, key := b.findDistroKey(distroName)
+	if key == nil {
+		return nil, fmt.Errorf("distro %q not registered", distroName)
+	}
+	return key.fs, nil
+}
+
+// fileCommands are the commands that operate on the distro's filesystem.
+var fileCommands = map[string]func(f *distrofs.FS, args []string, stdin io.Reader, stdout, stderr io.Writer) int{
+	"cat":   cat,
+	"ls":    ls,
+	"tee":   tee,
+	"mkdir": mkdir,
+	"rm":    rm,
+	"tar":   tarCommand,
+}
+
+// fileCommand returns a handler for the command if it is one of fileCommands,
+// or nil otherwise. Only simple commands are supported: pipes, redirections,
+// variables, etc. are not.
+func fileCommand(f *distrofs.FS, command string) CommandHandler {
+	args, ok := splitCommand(command)
+	if !ok || len(args) == 0 {
+		return nil
+	}
+
+	cmd, ok := fileCommands[args[0]]
+	if !ok {
+		return nil
+	}
+
+	return func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+		return cmd(f, args[1:], stdin, stdout, stderr)
+	}
+}
+
+// splitCommand splits a command into words, following the quoting rules of the
+// shell. It returns false if the command uses any other shell feature.
+func splitCommand(command string) (args []string, ok bool) {
+	var word strings.Builder
+	inWord := false
+	var quote byte
+
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+				continue
+			}
+			word.WriteByte(c)
+		case quote == '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && i+1 < len(command) && strings.IndexByte("\\\"$`", command[i+1]) != -1:
+				i++
+				word.WriteByte(command[i])
+			case c == '$' || c == '`':
+				return nil, false
+			default:
+				word.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '\\':
+			if i+1 == len(command) {
+				return nil, false
+			}
+			i++
+			word.WriteByte(command[i])
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case strings.IndexByte("|&;<>()$`*?[]{}~#!\n", c) != -1:
+			return nil, false
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, false
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+
+	return args, true
+}
+
+// parseFlags parses short options. Options in valueFlags take an argument.
+// Parsing stops at the first operand, or after "--".
+func parseFlags(args []string, boolFlags, valueFlags string) (flags map[byte]string, operands []string, err error) {
+	flags = make(map[byte]string)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return flags, args[i+1:], nil
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			return flags, args[i:], nil
+		}
+
+		for j := 1; j < len(arg); j++ {
+			c := arg[j]
+			switch {
+			case strings.IndexByte(boolFlags, c) != -1:
+				flags[c] = ""
+			case strings.IndexByte(valueFlags, c) != -1:
+				value := arg[j+1:]
+				if value == "" {
+					if i+1 == len(args) {
+						return nil, nil, fmt.Errorf("option requires an argument -- '%c'", c)
+					}
+					i++
+					value = args[i]
+				}
+				flags[c] = value
+				j = len(arg)
+			default:
+				return nil, nil, fmt.Errorf("invalid option -- '%c'", c)
+			}
+		}
+	}
+
+	return flags, nil, nil
+}
+
+// resolve makes a path absolute, relative to the home directory.
+func resolve(p string) string {
+	if path.IsAbs(p) {
+		return p
+	}
+	return path.Join(homeDir, p)
+}
+
+// strerror returns the error message that coreutils would print for err.
+func strerror(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "No such file or directory"
+	case errors.Is(err, fs.ErrExist):
+		return "File exists"
+	case errors.Is(err, fs.ErrPermission):
+		return "Permission denied"
+	case errors.Is(err, distrofs.ErrNotDir):
+		return "Not a directory"
+	case errors.Is(err, distrofs.ErrIsDir):
+		return "Is a directory"
+	case errors.Is(err, distrofs.ErrNotEmpty):
+		return "Directory not empty"
+	case errors.Is(err, distrofs.ErrLoop):
+		return "Too many levels of symbolic links"
+	}
+	return err.Error()
+}
+
+func cat(f *distrofs.FS, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	_, files, err := parseFlags(args, "", "")
+	if err != nil {
+		fmt.Fprintf(stderr, "cat: %v\n", err)
+		return 1
+	}
+
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	exit := 0
+	for _, file := range files {
+		if file == "-" {
+			if _, err := io.Copy(stdout, stdin); err != nil {
+				fmt.Fprintf(stderr, "cat: -: %v\n", err)
+				exit = 1
+			}
+			continue
+		}
+
+		data, err := f.ReadFile(resolve(file))
+		if err != nil {
+			fmt.Fprintf(stderr, "cat: %s: %s\n", file, strerror(err))
+			exit = 1
+			continue
+		}
+		_, _ = stdout.Write(data)
+	}
+
+	return exit
+}
+
+func ls(f *distrofs.FS, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags, paths, err := parseFlags(args, "1aAd", "")
+	if err != nil {
+		fmt.Fprintf(stderr, "ls: %v\n", err)
+		return 2
+	}
+
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	_, all := flags['a']
+	_, almostAll := flags['A']
+	_, directory := flags['d']
+
+	exit := 0
+	var files, dirs []string
+	for _, p := range paths {
+		info, err := f.Stat(resolve(p))
+		if err != nil {
+			fmt.Fprintf(stderr, "ls: cannot access '%s': %s\n", p, strerror(err))
+			exit = 2
+			continue
+		}
+		if info.IsDir() && !directory {
+			dirs = append(dirs, p)
+			continue
+		}
+		files = append(files, p)
+	}
+
+	for _, p := range files {
+		fmt.Fprintln(stdout, p)
+	}
+
+	for i, p := range dirs {
+		if len(paths) > 1 {
+			if i > 0 || len(files) > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "%s:\n", p)
+		}
+
+		entries, err := f.ReadDir(resolve(p))
+		if err != nil {
+			fmt.Fprintf(stderr, "ls: cannot open directory '%s': %s\n", p, strerror(err))
+			exit = 2
+			continue
+		}
+
+		if all {
+			fmt.Fprintln(stdout, ".")
+			fmt.Fprintln(stdout, "..")
+		}
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), ".") && !all && !almostAll {
+				continue
+			}
+			fmt.Fprintln(stdout, e.Name())
+		}
+	}
+
+	return exit
+}
+
+func tee(f *distrofs.FS, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags, files, err := parseFlags(args, "a", "")
+	if err != nil {
+		fmt.Fprintf(stderr, "tee: %v\n", err)
+		return 1
+	}
+	_, appendData := flags['a']
+
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "tee: standard input: %v\n", err)
+		return 1
+	}
+	_, _ = stdout.Write(data)
+
+	exit := 0
+	for _, file := range files {
+		if err := f.WriteFile(resolve(file), data, 0644, appendData); err != nil {
+			fmt.Fprintf(stderr, "tee: %s: %s\n", file, strerror(err))
+			exit = 1
+		}
+	}
+
+	return exit
+}
+
+func mkdir(f *distrofs.FS, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags, dirs, err := parseFlags(args, "p", "")
+	if err != nil {
+		fmt.Fprintf(stderr, "mkdir: %v\n", err)
+		return 1
+	}
+	if len(dirs) == 0 {
+		fmt.Fprintln(stderr, "mkdir: missing operand")
+		return 1
+	}
+	_, parents := flags['p']
+
+	exit := 0
+	for _, dir := range dirs {
+		if err := f.Mkdir(resolve(dir), 0755, parents); err != nil {
+			fmt.Fprintf(stderr, "mkdir: cannot create directory '%s': %s\n", dir, strerror(err))
+			exit = 1
+		}
+	}
+
+	return exit
+}
+
+func rm(f *distrofs.FS, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags, files, err := parseFlags(args, "rRfd", "")
+	if err != nil {
+		fmt.Fprintf(stderr, "rm: %v\n", err)
+		return 1
+	}
+	_, r := flags['r']
+	_, R := flags['R']
+	_, force := flags['f']
+	_, emptyDirs := flags['d']
+	recursive := r || R
+
+	if len(files) == 0 && !force {
+		fmt.Fprintln(stderr, "rm: missing operand")
+		return 1
+	}
+
+	exit := 0
+	for _, file := range files {
+		p := resolve(file)
+		if info, err := f.Stat(p); err == nil && info.IsDir() && !recursive && !emptyDirs {
+			fmt.Fprintf(stderr, "rm: cannot remove '%s': Is a directory\n", file)
+			exit = 1
+			continue
+		}
+
+		err := f.Remove(p, recursive)
+		if errors.Is(err, fs.ErrNotExist) && force {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "rm: cannot remove '%s': %s\n", file, strerror(err))
+			exit = 1
+		}
+	}
+
+	return exit
+}
+
+// tarCommand supports creating (c), extracting (x) and listing (t) tarballs,
+// with gzip (z), from and into files in the distro or stdin/stdout (f -), and
+// changing directory (C).
+func tarCommand(f *distrofs.FS, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	// Old-style options: the first argument contains options without a dash.
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		args = append([]string{"-" + args[0]}, args[1:]...)
+	}
+
+	var operands []string
+	flags := make(map[byte]string)
+	for len(args) > 0 {
+		fl, rest, err := parseFlags(args, "cxtzv", "fC")
+		if err != nil {
+			fmt.Fprintf(stderr, "tar: %v\n", err)
+			return 2
+		}
+		for k, v := range fl {
+			flags[k] = v
+		}
+		if len(rest) == 0 {
+			break
+		}
+		// Options and operands can be mixed.
+		operands = append(operands, rest[0])
+		args = rest[1:]
+	}
+
+	dir := homeDir
+	if d, ok := flags['C']; ok {
+		dir = resolve(d)
+	}
+
+	archive, ok := flags['f']
+	if !ok {
+		archive = "-"
+	}
+	_, gzipped := flags['z']
+
+	_, create := flags['c']
+	_, extract := flags['x']
+	_, list := flags['t']
+
+	switch {
+	case create && !extract && !list:
+		if len(operands) == 0 {
+			fmt.Fprintln(stderr, "tar: Cowardly refusing to create an empty archive")
+			return 2
+		}
+		w := stdout
+		var buf bytes.Buffer
+		if archive != "-" {
+			w = &buf
+		}
+		if err := f.WriteTar(w, dir, operands, gzipped); err != nil {
+			fmt.Fprintf(stderr, "tar: %s\n", strerror(err))
+			return 2
+		}
+		if archive != "-" {
+			if err := f.WriteFile(resolve(archive), buf.Bytes(), 0644, false); err != nil {
+				fmt.Fprintf(stderr, "tar: %s: Cannot open: %s\n", archive, strerror(err))
+				return 2
+			}
+		}
+		return 0
+	case (extract || list) && !create && !(extract && list):
+		r := stdin
+		if archive != "-" {
+			data, err := f.ReadFile(resolve(archive))
+			if err != nil {
+				fmt.Fprintf(stderr, "tar: %s: Cannot open: %s\n", archive, strerror(err))
+				return 2
+			}
+			r = bytes.NewReader(data)
+		}
+
+		var names []string
+		var err error
+		if extract {
+			names, err = f.ExtractTar(r, dir)
+		} else {
+			names, err = distrofs.ListTar(r)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "tar: %s\n", strerror(err))
+			return 2
+		}
+
+		if _, verbose := flags['v']; verbose || list {
+			for _, n := range names {
+				fmt.Fprintln(stdout, n)
+			}
+		}
+		return 0
+	default:
+		fmt.Fprintln(stderr, "tar: You must specify one of the '-ctx' options")
+		return 2
+	}
+}
@@ -0,0 +1,369 @@
+package mock
+
+// This file contains the fixtures: declarative descriptions of the state of the
+// back-end, used to set it up and to take snapshots of it.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing/fstest"
+
+	"github.com/google/uuid"
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/internal/flags"
+	"github.com/ubuntu/gowsl/mock/internal/distrofs"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture describes the state of the back-end. It is written in YAML or JSON:
+//
+//	defaultDistro: Ubuntu
+//	distros:
+//	  - name: Ubuntu
+//	    guid: "{0b8e1a6c-2f4d-4e3a-9b7c-5d6e7f8a9b0c}"
+//	    defaultUID: 1000
+//	    flags: 7
+//	    running: true
+//	    environment:
+//	      LANG: C.UTF-8
+//	    files:
+//	      /etc/hostname: ubuntu
+//	      /etc/wsl.conf:
+//	        content: "[boot]\nsystemd=true\n"
+//	        mode: "0644"
+//	      /etc/os-release:
+//	        symlink: ../usr/lib/os-release
+//	      /home/ubuntu:
+//	        dir: true
+//
+// Omitted fields take the values a freshly registered distro would have. Running
+// distros stay running until they are terminated.
+type Fixture struct {
+	DefaultDistro string          `yaml:"defaultDistro,omitempty"`
+	Distros       []DistroFixture `yaml:"distros,omitempty"`
+}
+
+// DistroFixture describes a distro in a Fixture.
+type DistroFixture struct {
+	Name        string                 `yaml:"name"`
+	GUID        string                 `yaml:"guid,omitempty"`
+	Version     uint8                  `yaml:"version,omitempty"`
+	DefaultUID  uint32                 `yaml:"defaultUID,omitempty"`
+	Flags       *int32                 `yaml:"flags,omitempty"`
+	Environment map[string]string      `yaml:"environment,omitempty"`
+	Running     bool                   `yaml:"running,omitempty"`
+	Files       map[string]FileFixture `yaml:"files,omitempty"`
+}
+
+// FileFixture describes a file in the filesystem of a distro. A plain string is
+// a shorthand for a regular file with that content.
+type FileFixture struct {
+	Content string `yaml:"content,omitempty"`
+	Mode    string `yaml:"mode,omitempty"` // Octal permissions
+	Symlink string `yaml:"symlink,omitempty"`
+	Dir     bool   `yaml:"dir,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler so that files can be written as plain strings.
+func (f *FileFixture) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*f = FileFixture{}
+		return value.Decode(&f.Content)
+	}
+
+	type plain FileFixture
+	return value.Decode((*plain)(f))
+}
+
+// MarshalYAML implements yaml.Marshaler so that regular files with default
+// permissions are written as plain strings.
+func (f FileFixture) MarshalYAML() (any, error) {
+	if f.Mode == "" && f.Symlink == "" && !f.Dir {
+		return f.Content, nil
+	}
+
+	type plain FileFixture
+	return plain(f), nil
+}
+
+// NewFromFixture constructs a new mocked back-end with the state described in
+// the fixture at path. See Fixture for the format, and New for the options.
+func NewFromFixture(path string, args ...Option) (*Backend, error) {
+	return NewFromFixtureFS(os.DirFS(filepath.Dir(path)), filepath.Base(path), args...)
+}
+
+// NewFromFixtureFS constructs a new mocked back-end with the state described in
+// the fixture with the given name in fsys. See Fixture for the format, and New
+// for the options.
+func NewFromFixtureFS(fsys fs.FS, name string, args ...Option) (b *Backend, err error) {
+	defer decorate.OnError(&err, "could not load fixture %s", name)
+
+	out, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, so a single decoder deals with both
+	var f Fixture
+	if err := yaml.Unmarshal(out, &f); err != nil {
+		return nil, err
+	}
+
+	b = New(args...)
+	if err := b.load(f); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Snapshot returns the current state of the back-end as a YAML fixture, which
+// NewFromFixture can load. The output is deterministic, so it can be compared
+// against golden files.
+func (b *Backend) Snapshot() (out []byte, err error) {
+	defer decorate.OnError(&err, "could not take snapshot")
+
+	f, err := b.fixture()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(f); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// load adds the distros described in the fixture to the back-end.
+func (b *Backend) load(f Fixture) error {
+	b.lxssRootKey.mu.Lock()
+	defer b.lxssRootKey.mu.Unlock()
+
+	for _, d := range f.Distros {
+		if err := b.loadDistro(d); err != nil {
+			return fmt.Errorf("distro %q: %v", d.Name, err)
+		}
+	}
+
+	if len(f.Distros) == 0 {
+		if f.DefaultDistro != "" {
+			return fmt.Errorf("default distro %q is not in the fixture", f.DefaultDistro)
+		}
+		return nil
+	}
+
+	defaultDistro := f.DefaultDistro
+	if defaultDistro == "" {
+		defaultDistro = f.Distros[0].Name
+	}
+
+	GUID, key := b.findDistroKey(defaultDistro)
+	if key == nil {
+		return fmt.Errorf("default distro %q is not in the fixture", defaultDistro)
+	}
+	b.lxssRootKey.data["DefaultDistribution"] = GUID
+
+	return nil
+}
+
+// loadDistro adds a distro to the back-end. Use under the write lock of the root key.
+func (b *Backend) loadDistro(d DistroFixture) error {
+	if err := validDistroName(d.Name); err != nil {
+		return err
+	}
+	if _, key := b.findDistroKey(d.Name); key != nil {
+		return errors.New("duplicate distro")
+	}
+
+	GUID, err := uuid.NewRandom()
+	if d.GUID != "" {
+		GUID, err = uuid.Parse(d.GUID)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid GUID: %v", err)
+	}
+
+	guidStr := fmt.Sprintf("{%s}", GUID.String())
+	if _, ok := b.lxssRootKey.children[guidStr]; ok {
+		return fmt.Errorf("duplicate GUID %s", guidStr)
+	}
+
+	rootfs := distrofs.New()
+	if err := loadFiles(rootfs, d.Files); err != nil {
+		return err
+	}
+
+	key := b.newDistroKey(guidStr, d.Name, rootfs)
+	if d.Version != 0 {
+		key.data["Version"] = d.Version
+	}
+	key.data["DefaultUid"] = d.DefaultUID
+	if d.Flags != nil {
+		key.data["Flags"] = flags.WslFlags(*d.Flags)
+	}
+	if d.Environment != nil {
+		key.data["DefaultEnvironment"] = d.Environment
+	}
+
+	if d.Running {
+		if err := key.state.Touch(); err != nil {
+			return err
+		}
+		// The shell keeps the distro running until it is terminated
+		if _, err := key.state.NewShell(); err != nil {
+			return err
+		}
+	}
+
+	b.lxssRootKey.children[guidStr] = key
+
+	return nil
+}
+
+// loadFiles writes the files into the filesystem, creating their parent directories.
+func loadFiles(rootfs *distrofs.FS, files map[string]FileFixture) error {
+	// Sorting so that directories are created before their contents
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file := files[name]
+		p := path.Clean("/" + name)
+
+		perm := fs.FileMode(0644)
+		if file.Dir {
+			perm = 0755
+		}
+		if file.Mode != "" {
+			m, err := strconv.ParseUint(file.Mode, 8, 32)
+			if err != nil {
+				return fmt.Errorf("file %s: invalid mode %q", name, file.Mode)
+			}
+			perm = fs.FileMode(m).Perm()
+		}
+
+		if err := rootfs.Mkdir(path.Dir(p), 0755, true); err != nil {
+			return fmt.Errorf("file %s: %v", name, err)
+		}
+
+		var err error
+		switch {
+		case file.Dir:
+			err = rootfs.Mkdir(p, perm, true)
+		case file.Symlink != "":
+			err = rootfs.Symlink(file.Symlink, p)
+		default:
+			err = rootfs.WriteFile(p, []byte(file.Content), perm, false)
+		}
+		if err != nil {
+			return fmt.Errorf("file %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// fixture returns the fixture describing the back-end.
+func (b *Backend) fixture() (f Fixture, err error) {
+	b.lxssRootKey.mu.RLock()
+	defer b.lxssRootKey.mu.RUnlock()
+
+	defaultGUID, _ := b.lxssRootKey.data["DefaultDistribution"].(string)
+
+	for GUID, key := range b.lxssRootKey.children {
+		if _, err := uuid.Parse(GUID); err != nil {
+			continue // Not a distro
+		}
+
+		d, err := distroFixture(GUID, key)
+		if err != nil {
+			return f, err
+		}
+
+		if GUID == defaultGUID {
+			f.DefaultDistro = d.Name
+		}
+		f.Distros = append(f.Distros, d)
+	}
+
+	sort.Slice(f.Distros, func(i, j int) bool { return f.Distros[i].Name < f.Distros[j].Name })
+
+	return f, nil
+}
+
+// distroFixture returns the fixture describing a distro.
+func distroFixture(GUID string, key *RegistryKey) (d DistroFixture, err error) {
+	key.mu.RLock()
+	defer key.mu.RUnlock()
+
+	d.Name, _ = key.data["DistributionName"].(string)
+	d.GUID = GUID
+	d.Version, _ = key.data["Version"].(uint8)
+	d.DefaultUID, _ = key.data["DefaultUid"].(uint32)
+	if f, ok := key.data["Flags"].(flags.WslFlags); ok {
+		d.Flags = (*int32)(&f)
+	}
+	d.Environment, _ = key.data["DefaultEnvironment"].(map[string]string)
+	d.Running = key.state.IsRunning()
+
+	files, err := key.fs.Snapshot("/")
+	if err != nil {
+		return d, fmt.Errorf("distro %q: %v", d.Name, err)
+	}
+
+	for name, file := range files {
+		var ff FileFixture
+		switch {
+		case file.Mode&fs.ModeSymlink != 0:
+			ff.Symlink = string(file.Data)
+		case file.Mode.IsDir():
+			if !isEmptyDir(files, name) {
+				continue // Created along with its contents
+			}
+			ff.Dir = true
+			if file.Mode.Perm() != 0755 {
+				ff.Mode = fmt.Sprintf("%04o", file.Mode.Perm())
+			}
+		default:
+			ff.Content = string(file.Data)
+			if file.Mode.Perm() != 0644 {
+				ff.Mode = fmt.Sprintf("%04o", file.Mode.Perm())
+			}
+		}
+
+		if d.Files == nil {
+			d.Files = make(map[string]FileFixture)
+		}
+		d.Files["/"+name] = ff
+	}
+
+	return d, nil
+}
+
+func isEmptyDir(files fstest.MapFS, dir string) bool {
+	prefix := dir + "/"
+	for name := range files {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package mock
+
+// This file contains the scriptable command handlers, used to mock
+// commands launched into the distros.
+
+import (
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// CommandHandler mocks a command launched into a distro. It must read its input
+// from stdin, write its output into stdout and stderr, and return the exit code.
+//
+// When the command is launched via WslLaunch, ctx is cancelled if the process is
+// killed or the distro is terminated. Use CommandInfoFromContext to find out the
+// command being mocked.
+type CommandHandler func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int
+
+// CommandInfo contains information about a command being handled by a CommandHandler.
+type CommandInfo struct {
+	Distro      string // Name of the distro the command is launched into
+	User        string // User the command is launched as, if it was launched with WslLaunchAs
+	Command     string // Command, as passed to WslLaunch, WslLaunchEnv, WslLaunchAs or WslLaunchInteractive
+	UseCWD      bool   // Whether the command was launched in the current working directory
+	Interactive bool   // Whether the command was launched with WslLaunchInteractive
+
+	// Env contains the variables forwarded into the distro via WSLENV, in the form
+	// "key=value". Paths are not translated.
+	Env []string
+}
+
+type commandInfoKey struct{}
+
+// CommandInfoFromContext returns the information about the command being handled.
+// It returns false if the context does not belong to a CommandHandler.
+func CommandInfoFromContext(ctx context.Context) (info CommandInfo, ok bool) {
+	info, ok = ctx.Value(commandInfoKey{}).(CommandInfo)
+	return info, ok
+}
+
+// forwardedEnv returns the variables in env that WSLENV forwards from Windows
+// into the distros.
+func forwardedEnv(env []string) (forwarded []string) {
+	values := make(map[string]string)
+	var wslEnv string
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		// Later entries take precedence, and names are case-insensitive as in Windows
+		values[strings.ToUpper(name)] = value
+		if strings.EqualFold(name, "WSLENV") {
+			wslEnv = value
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(wslEnv, ":") {
+		name, flags, _ := strings.Cut(entry, "/")
+		if name == "" || seen[strings.ToUpper(name)] {
+			continue
+		}
+		// Variables with only the w flag are forwarded the other way around
+		if strings.Contains(flags, "w") && !strings.Contains(flags, "u") {
+			continue
+		}
+
+		value, ok := values[strings.ToUpper(name)]
+		if !ok {
+			continue
+		}
+		seen[strings.ToUpper(name)] = true
+		forwarded = append(forwarded, name+"="+value)
+	}
+
+	return forwarded
+}
+
+// CannedOutput returns a handler that writes the provided stdout and stderr and
+// exits with the provided exit code, regardless of its input.
+func CannedOutput(stdout, stderr string, exitCode int) CommandHandler {
+	return func(ctx context.Context, stdin io.Reader, o, e io.Writer) int {
+		_, _ = io.WriteString(o, stdout)
+		_, _ = io.WriteString(e, stderr)
+		return exitCode
+	}
+}
+
+// HandleCommand registers a handler for the commands that are exactly equal to
+// command, replacing any previous one. A nil handler removes it.
+//
+// Handlers for exact matches take precedence over the ones for regular expressions
+// and over the commands supported out of the box.
+func (b *Backend) HandleCommand(command string, handler CommandHandler) {
+	b.handlers.mu.Lock()
+	defer b.handlers.mu.Unlock()
+
+	if handler == nil {
+		delete(b.handlers.exact, command)
+		return
+	}
+	b.handlers.exact[command] = handler
+}
+
+// HandleCommandRegexp registers a handler for the commands that match re.
+// Regular expressions are tried in the order they were registered, and
+// they take precedence over the commands supported out of the box.
+//
+// Use regexp anchors (^ and $) to match whole commands.
+func (b *Backend) HandleCommandRegexp(re *regexp.Regexp, handler CommandHandler) {
+	b.handlers.mu.Lock()
+	defer b.handlers.mu.Unlock()
+
+	b.handlers.regexps = append(b.handlers.regexps, regexpHandler{re: re, handler: handler})
+}
+
+// HandleFallback registers a handler for the commands that do not match any other
+// handler and are not supported out of the box. Without it, such commands cause
+// a panic. A nil handler removes it.
+func (b *Backend) HandleFallback(handler CommandHandler) {
+	b.handlers.mu.Lock()
+	defer b.handlers.mu.Unlock()
+
+	b.handlers.fallback = handler
+}
+
+// commandHandlers is the set of handlers registered in a Backend.
+type commandHandlers struct {
+	exact    map[string]CommandHandler
+	regexps  []regexpHandler
+	fallback CommandHandler
+
+	mu sync.RWMutex
+}
+
+type regexpHandler struct {
+	re      *regexp.Regexp
+	handler CommandHandler
+}
+
+func newCommandHandlers() *commandHandlers {
+	return &commandHandlers{
+		exact: make(map[string]CommandHandler),
+	}
+}
+
+// lookup returns the handler that matches the command exactly or via a regular
+// expression, or nil if there is none.
+func (h *commandHandlers) lookup(command string) CommandHandler {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if handler, ok := h.exact[command]; ok {
+		return handler
+	}
+
+	for _, r := range h.regexps {
+		if r.re.MatchString(command) {
+			return r.handler
+		}
+	}
+
+	return nil
+}
+
+// fallbackHandler returns the fallback handler, or nil if there is none.
+func (h *commandHandlers) fallbackHandler() CommandHandler {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.fallback
+}
+
+// StartCommand runs the handler as if it were a command launched with WslLaunch,
+// and returns a process that lives for as long as the handler runs and exits with
+// its exit code. Killing the process cancels the context passed to the handler.
+//
+// It is useful to implement other back-ends on top of command handlers.
+func StartCommand(handler CommandHandler, stdin, stdout, stderr *os.File) (*os.Process, error) {
+	return startHandler(handler, CommandInfo{}, stdin, stdout, stderr)
+}
@@ -0,0 +1,653 @@
+// Package distrofs implements the in-memory filesystem of a mocked distro,
+// seeded from the rootfs tarball it was registered with.
+package distrofs
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// Errors returned by the filesystem, on top of the ones in io/fs.
+var (
+	ErrNotDir   = errors.New("not a directory")
+	ErrIsDir    = errors.New("is a directory")
+	ErrNotEmpty = errors.New("directory not empty")
+	ErrLoop     = errors.New("too many levels of symbolic links")
+)
+
+// maxSymlinks is the maximum number of symlinks followed when resolving a path,
+// as in Linux.
+const maxSymlinks = 40
+
+// FS is the filesystem of a distro. All paths are absolute Linux paths.
+// Relative paths are resolved from the root.
+type FS struct {
+	root *node
+
+	// Seeding is delayed until first use, as rootfs tarballs can be large and
+	// most tests never look inside the distro.
+	tarball string
+	once    sync.Once
+	seedErr error
+
+	mu sync.RWMutex
+}
+
+type node struct {
+	mode     fs.FileMode // Permissions and type bits
+	modTime  time.Time
+	data     []byte           // Contents of regular files
+	target   string           // Target of symlinks
+	children map[string]*node // Contents of directories
+}
+
+func newDir(perm fs.FileMode) *node {
+	return &node{mode: fs.ModeDir | perm.Perm(), modTime: time.Now(), children: make(map[string]*node)}
+}
+
+func (n *node) isDir() bool {
+	return n.mode.IsDir()
+}
+
+func (n *node) isSymlink() bool {
+	return n.mode&fs.ModeSymlink != 0
+}
+
+// New returns an empty filesystem, containing only the root directory.
+func New() *FS {
+	f := &FS{root: newDir(0755)}
+	f.once.Do(func() {})
+	return f
+}
+
+// FromTarball returns a filesystem with the contents of a (possibly gzipped) tarball.
+// The tarball is checked to be valid, but only extracted the first time the
+// filesystem is used. An empty file results in an empty filesystem.
+func FromTarball(tarball string) (*FS, error) {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() == 0 {
+		return New(), nil
+	}
+
+	tr, err := newTarReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", tarball, err)
+	}
+	if _, err := tr.Next(); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("could not read %s: %v", tarball, err)
+	}
+
+	return &FS{root: newDir(0755), tarball: tarball}, nil
+}
+
+// load extracts the tarball, the first time it is called.
+func (f *FS) load() error {
+	f.once.Do(func() {
+		file, err := os.Open(f.tarball)
+		if err != nil {
+			f.seedErr = err
+			return
+		}
+		defer file.Close()
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if err := f.extract(file, "/"); err != nil {
+			f.seedErr = fmt.Errorf("could not extract %s: %v", f.tarball, err)
+		}
+	})
+	return f.seedErr
+}
+
+// ReadFile returns the contents of a file.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	n, err := f.lookup(name, true)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	if n.isDir() {
+		return nil, pathError("read", name, ErrIsDir)
+	}
+
+	return append([]byte{}, n.data...), nil
+}
+
+// WriteFile writes data into a file, creating it with permissions perm if it does
+// not exist. If appendData is true, data is appended to the existing contents.
+func (f *FS) WriteFile(name string, data []byte, perm fs.FileMode, appendData bool) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.writeFile(name, data, perm, appendData)
+}
+
+func (f *FS) writeFile(name string, data []byte, perm fs.FileMode, appendData bool) error {
+	parent, base, n, err := f.walk(name, true)
+	if err != nil {
+		return pathError("open", name, err)
+	}
+
+	if n == nil {
+		n = &node{mode: perm.Perm()}
+		parent.children[base] = n
+	} else if n.isDir() {
+		return pathError("open", name, ErrIsDir)
+	}
+
+	if !appendData {
+		n.data = nil
+	}
+	n.data = append(n.data, data...)
+	n.modTime = time.Now()
+
+	return nil
+}
+
+// Mkdir creates a directory. If all is true, parent directories are created
+// as needed, and it is not an error if the directory already exists.
+func (f *FS) Mkdir(name string, perm fs.FileMode, all bool) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.mkdir(name, perm, all)
+}
+
+func (f *FS) mkdir(name string, perm fs.FileMode, all bool) error {
+	parent, base, n, err := f.walk(name, true)
+	if all && errors.Is(err, fs.ErrNotExist) {
+		if err := f.mkdir(path.Dir(absolute(name)), perm, true); err != nil {
+			return err
+		}
+		parent, base, n, err = f.walk(name, true)
+	}
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+
+	if n != nil {
+		if all && n.isDir() {
+			return nil
+		}
+		return pathError("mkdir", name, fs.ErrExist)
+	}
+
+	parent.children[base] = newDir(perm)
+	return nil
+}
+
+// Remove removes a file or directory. If all is true, directories are removed
+// with all their contents. Otherwise, removing a non-empty directory is an error.
+// Symlinks are removed, not followed.
+func (f *FS) Remove(name string, all bool) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parent, base, n, err := f.walk(name, false)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	if n == nil {
+		return pathError("remove", name, fs.ErrNotExist)
+	}
+	if parent == nil {
+		return pathError("remove", name, fs.ErrPermission)
+	}
+	if n.isDir() && len(n.children) != 0 && !all {
+		return pathError("remove", name, ErrNotEmpty)
+	}
+
+	delete(parent.children, base)
+	return nil
+}
+
+// Symlink creates a symbolic link at name pointing to target.
+func (f *FS) Symlink(target, name string) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parent, base, n, err := f.walk(name, false)
+	if err != nil {
+		return pathError("symlink", name, err)
+	}
+	if n != nil {
+		return pathError("symlink", name, fs.ErrExist)
+	}
+
+	parent.children[base] = &node{mode: fs.ModeSymlink | 0777, modTime: time.Now(), target: target}
+	return nil
+}
+
+// Stat returns information about a file, following symlinks.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	n, err := f.lookup(name, true)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+
+	return fileInfo{name: path.Base(absolute(name)), node: n}, nil
+}
+
+// ReadDir returns the entries of a directory, sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	n, err := f.lookup(name, true)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	if !n.isDir() {
+		return nil, pathError("readdir", name, ErrNotDir)
+	}
+
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for name, child := range n.children {
+		entries = append(entries, fs.FileInfoToDirEntry(fileInfo{name: name, node: child}))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
+
+// Snapshot returns a copy of the filesystem, or of the subtree under root.
+// Its keys are paths relative to root, as required by io/fs.
+func (f *FS) Snapshot(root string) (fstest.MapFS, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	n, err := f.lookup(root, true)
+	if err != nil {
+		return nil, pathError("open", root, err)
+	}
+
+	m := make(fstest.MapFS)
+	var walk func(p string, n *node)
+	walk = func(p string, n *node) {
+		file := &fstest.MapFile{Mode: n.mode, ModTime: n.modTime, Data: append([]byte{}, n.data...)}
+		if n.isSymlink() {
+			file.Data = []byte(n.target)
+		}
+		if p != "." {
+			m[p] = file
+		}
+		for name, child := range n.children {
+			walk(path.Join(p, name), child)
+		}
+	}
+	walk(".", n)
+
+	return m, nil
+}
+
+// WriteTar writes the files under dir into w as a tarball, with paths relative
+// to dir. If members is not empty, only those paths (relative to dir) are included.
+func (f *FS) WriteTar(w io.Writer, dir string, members []string, gzipped bool) (err error) {
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if gzipped {
+		gz := gzip.NewWriter(w)
+		defer func() {
+			if e := gz.Close(); err == nil {
+				err = e
+			}
+		}()
+		w = gz
+	}
+
+	tw := tar.NewWriter(w)
+	defer func() {
+		if e := tw.Close(); err == nil {
+			err = e
+		}
+	}()
+
+	if len(members) == 0 {
+		members = []string{"."}
+	}
+
+	for _, m := range members {
+		p := path.Join(absolute(dir), m)
+		n, err := f.lookup(p, false)
+		if err != nil {
+			return pathError("open", p, err)
+		}
+		if err := writeTarNode(tw, path.Clean(m), n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeTarNode(tw *tar.Writer, name string, n *node) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    int64(n.mode.Perm()),
+		ModTime: n.modTime,
+	}
+
+	switch {
+	case n.isDir():
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case n.isSymlink():
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = n.target
+	default:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(len(n.data))
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag == tar.TypeReg {
+		if _, err := tw.Write(n.data); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, child := range names {
+		if err := writeTarNode(tw, path.Join(name, child), n.children[child]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExtractTar extracts a (possibly gzipped) tarball into dir, which must exist.
+// It returns the names of the extracted entries.
+func (f *FS) ExtractTar(r io.Reader, dir string) (names []string, err error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var extracted []string
+	err = walkTar(r, func(hdr *tar.Header, content io.Reader) error {
+		extracted = append(extracted, hdr.Name)
+		return f.extractEntry(dir, hdr, content)
+	})
+
+	return extracted, err
+}
+
+// ListTar returns the names of the entries in a (possibly gzipped) tarball.
+func ListTar(r io.Reader) (names []string, err error) {
+	err = walkTar(r, func(hdr *tar.Header, _ io.Reader) error {
+		names = append(names, hdr.Name)
+		return nil
+	})
+	return names, err
+}
+
+func (f *FS) extract(r io.Reader, dir string) error {
+	return walkTar(r, func(hdr *tar.Header, content io.Reader) error {
+		return f.extractEntry(dir, hdr, content)
+	})
+}
+
+// walkTar calls fn for every entry in a (possibly gzipped) tarball.
+func walkTar(r io.Reader, fn func(*tar.Header, io.Reader) error) error {
+	tr, err := newTarReader(r)
+	if err != nil {
+		return err
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (f *FS) extractEntry(dir string, hdr *tar.Header, content io.Reader) error {
+	p := path.Join(absolute(dir), hdr.Name)
+	perm := fs.FileMode(hdr.Mode).Perm()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := f.mkdir(p, perm, true); err != nil {
+			return err
+		}
+		n, err := f.lookup(p, true)
+		if err != nil {
+			return err
+		}
+		n.mode = fs.ModeDir | perm
+		n.modTime = hdr.ModTime
+		return nil
+	case tar.TypeReg:
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		if err := f.mkdir(path.Dir(p), 0755, true); err != nil {
+			return err
+		}
+		if err := f.writeFile(p, data, perm, false); err != nil {
+			return err
+		}
+		n, err := f.lookup(p, true)
+		if err != nil {
+			return err
+		}
+		n.mode = perm
+		n.modTime = hdr.ModTime
+		return nil
+	case tar.TypeSymlink:
+		if err := f.mkdir(path.Dir(p), 0755, true); err != nil {
+			return err
+		}
+		parent, base, _, err := f.walk(p, false)
+		if err != nil {
+			return err
+		}
+		parent.children[base] = &node{mode: fs.ModeSymlink | 0777, modTime: hdr.ModTime, target: hdr.Linkname}
+		return nil
+	case tar.TypeLink:
+		target, err := f.lookup(path.Join(absolute(dir), hdr.Linkname), false)
+		if err != nil {
+			return fmt.Errorf("hard link %s: %v", hdr.Name, err)
+		}
+		parent, base, _, err := f.walk(p, false)
+		if err != nil {
+			return err
+		}
+		parent.children[base] = target
+		return nil
+	default:
+		// Devices, FIFOs, etc. have no use in the mock.
+		return nil
+	}
+}
+
+// newTarReader returns a tar reader, decompressing r if it is gzipped.
+func newTarReader(r io.Reader) (*tar.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return tar.NewReader(gz), nil
+	}
+
+	return tar.NewReader(br), nil
+}
+
+// lookup returns the node at p, or an error if it does not exist.
+func (f *FS) lookup(p string, follow bool) (*node, error) {
+	_, _, n, err := f.walk(p, follow)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, fs.ErrNotExist
+	}
+	return n, nil
+}
+
+// walk resolves p, following symlinks in all components except the last one
+// if follow is false. It returns the parent directory, the name of the last
+// component and its node. If the last component does not exist, its node is nil.
+// The parent is nil for the root directory.
+func (f *FS) walk(p string, follow bool) (parent *node, base string, n *node, err error) {
+	return f.walkFrom(absolute(p), follow, 0)
+}
+
+func (f *FS) walkFrom(p string, follow bool, hops int) (parent *node, base string, n *node, err error) {
+	if p == "/" {
+		return nil, "", f.root, nil
+	}
+
+	components := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	cur, curPath := f.root, "/"
+
+	for i, c := range components {
+		if !cur.isDir() {
+			return nil, "", nil, ErrNotDir
+		}
+
+		last := i == len(components)-1
+		child, ok := cur.children[c]
+		if !ok {
+			if last {
+				return cur, c, nil, nil
+			}
+			return nil, "", nil, fs.ErrNotExist
+		}
+
+		if child.isSymlink() && (!last || follow) {
+			if hops++; hops > maxSymlinks {
+				return nil, "", nil, ErrLoop
+			}
+			target := child.target
+			if !path.IsAbs(target) {
+				target = path.Join(curPath, target)
+			}
+			rest := path.Join(append([]string{target}, components[i+1:]...)...)
+			return f.walkFrom(path.Clean(rest), follow, hops)
+		}
+
+		if last {
+			return cur, c, child, nil
+		}
+
+		cur, curPath = child, path.Join(curPath, c)
+	}
+
+	return nil, "", nil, fs.ErrNotExist
+}
+
+// absolute cleans p, making it absolute if it is not.
+func absolute(p string) string {
+	return path.Clean("/" + p)
+}
+
+func pathError(op, p string, err error) error {
+	var pErr *fs.PathError
+	if errors.As(err, &pErr) {
+		return err
+	}
+	return &fs.PathError{Op: op, Path: p, Err: err}
+}
+
+type fileInfo struct {
+	name string
+	node *node
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return int64(len(i.node.data)) }
+func (i fileInfo) Mode() fs.FileMode  { return i.node.mode }
+func (i fileInfo) ModTime() time.Time { return i.node.modTime }
+func (i fileInfo) IsDir() bool        { return i.node.isDir() }
+func (i fileInfo) Sys() any           { return nil }
@@ -0,0 +1,196 @@
+package distrofs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/mock/internal/distrofs"
+)
+
+func TestFromTarball(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		tarball func(t *testing.T, dir string) string
+
+		wantFiles map[string]string
+		wantErr   bool
+	}{
+		"Empty file results in an empty filesystem": {tarball: writeFile(nil), wantFiles: map[string]string{}},
+		"Plain tarball":   {tarball: writeFile(rootfs(t, false)), wantFiles: rootfsFiles},
+		"Gzipped tarball": {tarball: writeFile(rootfs(t, true)), wantFiles: rootfsFiles},
+
+		"Error on missing tarball": {tarball: func(t *testing.T, dir string) string { return filepath.Join(dir, "missing.tar.gz") }, wantErr: true},
+		"Error on invalid tarball": {tarball: writeFile([]byte("This is not a tarball, but it is long enough to have a header... or is it? " +
+			"A tar header is 512 bytes long, so we need a few more of them to make the reader fail on a bad checksum rather than on EOF. " +
+			"Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. " +
+			"Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure.")),
+			wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := distrofs.FromTarball(tc.tarball(t, t.TempDir()))
+			if tc.wantErr {
+				require.Error(t, err, "FromTarball should have failed")
+				return
+			}
+			require.NoError(t, err, "FromTarball should not have failed")
+
+			for p, want := range tc.wantFiles {
+				got, err := f.ReadFile(p)
+				require.NoError(t, err, "ReadFile should not have failed for %s", p)
+				require.Equal(t, want, string(got), "Unexpected contents for %s", p)
+			}
+
+			m, err := f.Snapshot("/")
+			require.NoError(t, err, "Snapshot should not have failed")
+			if len(tc.wantFiles) == 0 {
+				require.Empty(t, m, "Filesystem should be empty")
+			}
+		})
+	}
+}
+
+func TestOperations(t *testing.T) {
+	t.Parallel()
+
+	f := distrofs.New()
+
+	require.NoError(t, f.Mkdir("/etc", 0755, false), "Mkdir should not fail")
+	require.ErrorIs(t, f.Mkdir("/etc", 0755, false), fs.ErrExist, "Mkdir should fail on existing directory")
+	require.NoError(t, f.Mkdir("/etc", 0755, true), "Mkdir with all should not fail on existing directory")
+	require.ErrorIs(t, f.Mkdir("/usr/lib", 0755, false), fs.ErrNotExist, "Mkdir should fail if the parent does not exist")
+	require.NoError(t, f.Mkdir("/usr/lib", 0755, true), "Mkdir with all should create parents")
+
+	require.NoError(t, f.WriteFile("/usr/lib/os-release", []byte("NAME=Ubuntu\n"), 0644, false), "WriteFile should not fail")
+	require.NoError(t, f.WriteFile("/usr/lib/os-release", []byte("VERSION=22.04\n"), 0644, true), "WriteFile in append mode should not fail")
+	require.ErrorIs(t, f.WriteFile("/var/log/syslog", nil, 0644, false), fs.ErrNotExist, "WriteFile should fail if the parent does not exist")
+	require.ErrorIs(t, f.WriteFile("/etc", nil, 0644, false), distrofs.ErrIsDir, "WriteFile should fail on directories")
+
+	require.NoError(t, f.Symlink("../usr/lib/os-release", "/etc/os-release"), "Symlink should not fail")
+	got, err := f.ReadFile("/etc/os-release")
+	require.NoError(t, err, "ReadFile should follow symlinks")
+	require.Equal(t, "NAME=Ubuntu\nVERSION=22.04\n", string(got), "Unexpected contents")
+
+	require.NoError(t, f.Symlink("/loop", "/loop"), "Setup: Symlink should not fail")
+	_, err = f.ReadFile("/loop")
+	require.ErrorIs(t, err, distrofs.ErrLoop, "ReadFile should fail on symlink loops")
+
+	_, err = f.ReadFile("/usr/lib/os-release/file")
+	require.ErrorIs(t, err, distrofs.ErrNotDir, "ReadFile should fail when a component is not a directory")
+
+	entries, err := f.ReadDir("/etc")
+	require.NoError(t, err, "ReadDir should not fail")
+	require.Len(t, entries, 1, "Unexpected number of entries")
+	require.Equal(t, "os-release", entries[0].Name(), "Unexpected entry")
+
+	info, err := f.Stat("/etc/os-release")
+	require.NoError(t, err, "Stat should not fail")
+	require.Equal(t, int64(len("NAME=Ubuntu\nVERSION=22.04\n")), info.Size(), "Stat should follow symlinks")
+
+	require.ErrorIs(t, f.Remove("/usr", false), distrofs.ErrNotEmpty, "Remove should fail on non-empty directories")
+	require.NoError(t, f.Remove("/etc/os-release", false), "Remove should not fail on symlinks")
+	_, err = f.Stat("/usr/lib/os-release")
+	require.NoError(t, err, "Remove should not follow symlinks")
+	require.NoError(t, f.Remove("/usr", true), "Remove with all should not fail on non-empty directories")
+	require.ErrorIs(t, f.Remove("/usr", true), fs.ErrNotExist, "Remove should fail on missing files")
+	require.Error(t, f.Remove("/", true), "Remove should fail on the root directory")
+}
+
+func TestTar(t *testing.T) {
+	t.Parallel()
+
+	src, err := distrofs.FromTarball(writeFile(rootfs(t, true))(t, t.TempDir()))
+	require.NoError(t, err, "Setup: FromTarball should not have failed")
+
+	var buf bytes.Buffer
+	err = src.WriteTar(&buf, "/etc", nil, true)
+	require.NoError(t, err, "WriteTar should not have failed")
+
+	names, err := distrofs.ListTar(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err, "ListTar should not have failed")
+	require.Equal(t, []string{"./", "hostname", "os-release"}, names, "Unexpected entries in tarball")
+
+	dst := distrofs.New()
+	require.NoError(t, dst.Mkdir("/backup", 0755, false), "Setup: Mkdir should not have failed")
+
+	_, err = dst.ExtractTar(bytes.NewReader(buf.Bytes()), "/backup")
+	require.NoError(t, err, "ExtractTar should not have failed")
+
+	got, err := dst.ReadFile("/backup/hostname")
+	require.NoError(t, err, "ReadFile should not have failed")
+	require.Equal(t, rootfsFiles["/etc/hostname"], string(got), "Unexpected contents after extracting")
+
+	buf.Reset()
+	err = src.WriteTar(&buf, "/", []string{"etc/hostname"}, false)
+	require.NoError(t, err, "WriteTar should not have failed with members")
+	names, err = distrofs.ListTar(&buf)
+	require.NoError(t, err, "ListTar should not have failed")
+	require.Equal(t, []string{"etc/hostname"}, names, "Unexpected entries in tarball with members")
+}
+
+var rootfsFiles = map[string]string{
+	"/etc/hostname":       "ubuntu\n",
+	"/etc/os-release":     "NAME=Ubuntu\n",
+	"/usr/lib/os-release": "NAME=Ubuntu\n",
+	"/root/.bashrc":       "# ~/.bashrc\n",
+}
+
+// rootfs returns a small rootfs tarball with the files in rootfsFiles.
+func rootfs(t *testing.T, gzipped bool) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if gzipped {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	}
+
+	entries := []tar.Header{
+		{Name: "./", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./etc/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./etc/hostname", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(rootfsFiles["/etc/hostname"]))},
+		{Name: "./etc/os-release", Typeflag: tar.TypeSymlink, Linkname: "../usr/lib/os-release"},
+		{Name: "./usr/lib/os-release", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(rootfsFiles["/usr/lib/os-release"]))},
+		{Name: "./root/.bashrc", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(rootfsFiles["/root/.bashrc"]))},
+		{Name: "./dev/null", Typeflag: tar.TypeChar, Mode: 0666},
+	}
+
+	for _, hdr := range entries {
+		hdr := hdr
+		require.NoError(t, tw.WriteHeader(&hdr), "Setup: could not write tar header")
+		if hdr.Typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte(rootfsFiles[filepath.ToSlash(hdr.Name[1:])]))
+			require.NoError(t, err, "Setup: could not write tar contents")
+		}
+	}
+
+	require.NoError(t, tw.Close(), "Setup: could not close tar writer")
+	if gzipped {
+		require.NoError(t, gz.Close(), "Setup: could not close gzip writer")
+	}
+
+	return buf.Bytes()
+}
+
+func writeFile(contents []byte) func(t *testing.T, dir string) string {
+	return func(t *testing.T, dir string) string {
+		t.Helper()
+
+		p := filepath.Join(dir, "rootfs.tar.gz")
+		require.NoError(t, os.WriteFile(p, contents, 0600), "Setup: could not write tarball")
+		return p
+	}
+}
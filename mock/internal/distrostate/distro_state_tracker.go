@@ -15,8 +15,10 @@ type DistroState struct {
 	// running indicates whether the distro is running or not.
 	running bool
 
-	// terminateTimer stops the distro 8 seconds after no processes are left.
-	terminateTimer *time.Timer
+	// terminateTimer stops the distro once it has been idle for idleTimeout.
+	terminateTimer Timer
+	idleTimeout    time.Duration
+	clock          Clock
 
 	// processes is a set of attached processes.
 	processes map[*os.Process]struct{}
@@ -54,11 +56,28 @@ func (s *Shell) Wait() uint32 {
 	return 0
 }
 
-// New creates a new disro state with state Stopped.
-func New() *DistroState {
+// Clock creates the timers used to stop idle distros.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer created by a Clock.
+type Timer interface {
+	// Stop prevents the timer from firing. It returns false if the timer
+	// had already fired or been stopped.
+	Stop() bool
+}
+
+// New creates a new disro state with state Stopped. The distro is stopped after
+// being idle for idleTimeout, as measured by clock. A non-positive timeout
+// disables it.
+func New(clock Clock, idleTimeout time.Duration) *DistroState {
 	return &DistroState{
-		processes: make(map[*os.Process]struct{}),
-		shells:    make(map[*Shell]struct{}),
+		processes:   make(map[*os.Process]struct{}),
+		shells:      make(map[*Shell]struct{}),
+		clock:       clock,
+		idleTimeout: idleTimeout,
 	}
 }
 
@@ -198,13 +217,28 @@ func (t *DistroState) refresh() {
 	t.startTimer()
 }
 
-// Starts the 8 second timeout terminate timer.
+// Starts the idle timeout terminate timer.
 // If it was already ticking, it is restarted.
 //
 // Use under a write mutex.
 func (t *DistroState) startTimer() {
 	t.cancelTimer()
-	t.terminateTimer = time.AfterFunc(8*time.Second, func() { _ = t.Terminate() })
+	if t.idleTimeout <= 0 {
+		return
+	}
+
+	var timer Timer
+	timer = t.clock.AfterFunc(t.idleTimeout, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		// The timer may have been cancelled while this function waited for the lock
+		if t.terminateTimer != timer {
+			return
+		}
+		_ = t.terminate()
+	})
+	t.terminateTimer = timer
 }
 
 // Cancels the terminate timer.
@@ -214,8 +248,6 @@ func (t *DistroState) cancelTimer() {
 	if t.terminateTimer == nil {
 		return
 	}
-	if !t.terminateTimer.Stop() {
-		<-t.terminateTimer.C
-	}
+	t.terminateTimer.Stop()
 	t.terminateTimer = nil
 }
@@ -0,0 +1,305 @@
+package mock
+
+// This file contains the journal of calls to the back-end, and the helpers
+// to make assertions about it.
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Call is a recorded call to one of the methods of the Backend.
+type Call struct {
+	Method   string        // Name of the method
+	Args     []any         // Arguments. Output parameters and files are not recorded.
+	Returns  []any         // Returned values, including output parameters
+	Time     time.Time     // Moment the call started, according to the clock of the Backend
+	Duration time.Duration // Time it took for the call to return, according to the clock of the Backend
+}
+
+// Err returns the error returned by the call, if any.
+func (c Call) Err() error {
+	if len(c.Returns) == 0 {
+		return nil
+	}
+	err, _ := c.Returns[len(c.Returns)-1].(error)
+	return err
+}
+
+func (c Call) String() string {
+	args := make([]string, 0, len(c.Args))
+	for _, a := range c.Args {
+		args = append(args, fmt.Sprintf("%#v", a))
+	}
+
+	returns := make([]string, 0, len(c.Returns))
+	for _, r := range c.Returns {
+		returns = append(returns, fmt.Sprintf("%v", r))
+	}
+
+	return fmt.Sprintf("%s(%s) = (%s)", c.Method, strings.Join(args, ", "), strings.Join(returns, ", "))
+}
+
+// journal records the calls to the back-end. It is safe for concurrent use.
+type journal struct {
+	calls []*Call
+	mu    sync.RWMutex
+}
+
+// record starts recording a call. The returned function must be called with
+// the return values when the call finishes. Calls are stored in the order they
+// started. Their time and duration are measured with the clock of the back-end.
+//
+// Use it at the very beginning of every method, so that the returned values are
+// recorded after any other deferred function has modified them:
+//
+//	done := b.record("Method", args...)
+//	defer func() { done(err) }()
+func (b *Backend) record(method string, args ...any) func(returns ...any) {
+	b.journal.mu.Lock()
+	defer b.journal.mu.Unlock()
+
+	// Keeping a pointer rather than an index, as the journal may be reset in the meantime
+	c := &Call{Method: method, Args: args, Time: b.clock.Now()}
+	b.journal.calls = append(b.journal.calls, c)
+
+	return func(returns ...any) {
+		b.journal.mu.Lock()
+		defer b.journal.mu.Unlock()
+
+		c.Duration = b.clock.Now().Sub(c.Time)
+		c.Returns = returns
+	}
+}
+
+// Calls returns all calls to the back-end, in the order they were made.
+// Calls that have not returned yet have no return values.
+func (b *Backend) Calls() []Call {
+	b.journal.mu.RLock()
+	defer b.journal.mu.RUnlock()
+
+	calls := make([]Call, 0, len(b.journal.calls))
+	for _, c := range b.journal.calls {
+		calls = append(calls, *c)
+	}
+	return calls
+}
+
+// CallsTo returns the calls to a method of the back-end, in the order they
+// were made. If any args are passed, only the calls with matching arguments are
+// returned (see Expect for the matching rules).
+func (b *Backend) CallsTo(method string, args ...any) []Call {
+	e := Expect(method, args...)
+
+	var calls []Call
+	for _, c := range b.Calls() {
+		if e.matches(c) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// ResetCalls empties the journal of calls.
+func (b *Backend) ResetCalls() {
+	b.journal.mu.Lock()
+	defer b.journal.mu.Unlock()
+
+	b.journal.calls = nil
+}
+
+// TestingT is the subset of *testing.T used by the assertion helpers.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Expectation describes a call to the back-end. Create it with Expect.
+type Expectation struct {
+	Method string
+	Args   []any
+}
+
+// Expect returns the expectation of a call to method.
+//
+// If no args are passed, any call to the method matches. Otherwise, the call must
+// have the same number of arguments, and each of them must match: either by being
+// equal (integers of different types are compared by value), or by satisfying
+// the Matcher passed in its place (see Anything and MatchedBy).
+func Expect(method string, args ...any) Expectation {
+	return Expectation{Method: method, Args: args}
+}
+
+func (e Expectation) String() string {
+	if len(e.Args) == 0 {
+		return e.Method + "(...)"
+	}
+
+	args := make([]string, 0, len(e.Args))
+	for _, a := range e.Args {
+		args = append(args, fmt.Sprintf("%#v", a))
+	}
+	return fmt.Sprintf("%s(%s)", e.Method, strings.Join(args, ", "))
+}
+
+func (e Expectation) matches(c Call) bool {
+	if c.Method != e.Method {
+		return false
+	}
+	if len(e.Args) == 0 {
+		return true
+	}
+	if len(e.Args) != len(c.Args) {
+		return false
+	}
+	for i := range e.Args {
+		if !argMatches(e.Args[i], c.Args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matcher is an argument of an Expectation that matches a set of values.
+type Matcher interface {
+	Match(v any) bool
+}
+
+// Anything matches any argument.
+var Anything Matcher = MatchedBy(func(any) bool { return true })
+
+// MatchedBy returns a Matcher that matches the arguments for which f returns true.
+func MatchedBy(f func(v any) bool) Matcher {
+	return matcherFunc(f)
+}
+
+type matcherFunc func(v any) bool
+
+func (f matcherFunc) Match(v any) bool {
+	return f(v)
+}
+
+func argMatches(want, got any) bool {
+	if m, ok := want.(Matcher); ok {
+		return m.Match(got)
+	}
+
+	if reflect.DeepEqual(want, got) {
+		return true
+	}
+
+	// Comparing integers by value, so that callers can use untyped
+	// constants, or compare against unexported types.
+	w, g := reflect.ValueOf(want), reflect.ValueOf(got)
+	if !w.IsValid() || !g.IsValid() {
+		return false
+	}
+
+	switch {
+	case w.CanInt() && g.CanInt():
+		return w.Int() == g.Int()
+	case w.CanUint() && g.CanUint():
+		return w.Uint() == g.Uint()
+	case w.CanInt() && g.CanUint():
+		return w.Int() >= 0 && uint64(w.Int()) == g.Uint()
+	case w.CanUint() && g.CanInt():
+		return g.Int() >= 0 && w.Uint() == uint64(g.Int())
+	}
+
+	return false
+}
+
+// AssertCalled checks that method was called at least once with matching
+// arguments (see Expect).
+func (b *Backend) AssertCalled(t TestingT, method string, args ...any) bool {
+	t.Helper()
+
+	if len(b.CallsTo(method, args...)) == 0 {
+		t.Errorf("Expected a call to %s, but there was none.\n%s", Expect(method, args...), b.formatCalls())
+		return false
+	}
+	return true
+}
+
+// AssertNotCalled checks that method was never called with matching
+// arguments (see Expect).
+func (b *Backend) AssertNotCalled(t TestingT, method string, args ...any) bool {
+	t.Helper()
+
+	if calls := b.CallsTo(method, args...); len(calls) != 0 {
+		t.Errorf("Expected no calls to %s, but there were %d.\n%s", Expect(method, args...), len(calls), b.formatCalls())
+		return false
+	}
+	return true
+}
+
+// AssertNumberOfCalls checks that method was called exactly n times with
+// matching arguments (see Expect).
+func (b *Backend) AssertNumberOfCalls(t TestingT, n int, method string, args ...any) bool {
+	t.Helper()
+
+	if calls := b.CallsTo(method, args...); len(calls) != n {
+		t.Errorf("Expected %d calls to %s, but there were %d.\n%s", n, Expect(method, args...), len(calls), b.formatCalls())
+		return false
+	}
+	return true
+}
+
+// AssertCallOrder checks that calls matching the expectations were made in the
+// given order. Other calls may happen before, after, or in between them.
+func (b *Backend) AssertCallOrder(t TestingT, expectations ...Expectation) bool {
+	t.Helper()
+
+	if err := checkOrder(b.Calls(), expectations); err != nil {
+		t.Errorf("%v\n%s", err, b.formatCalls())
+		return false
+	}
+	return true
+}
+
+func checkOrder(calls []Call, expectations []Expectation) error {
+	next := 0
+	for _, c := range calls {
+		if next == len(expectations) {
+			break
+		}
+		if expectations[next].matches(c) {
+			next++
+		}
+	}
+
+	if next == len(expectations) {
+		return nil
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "Expected calls in order:\n")
+	for i, e := range expectations {
+		mark := "  "
+		if i < next {
+			mark = "✓ "
+		}
+		fmt.Fprintf(&msg, "\t%s%s\n", mark, e)
+	}
+	fmt.Fprintf(&msg, "but no call matched %s after the previous ones.", expectations[next])
+
+	return errors.New(msg.String())
+}
+
+func (b *Backend) formatCalls() string {
+	calls := b.Calls()
+	if len(calls) == 0 {
+		return "The back-end was never called."
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "Calls to the back-end:\n")
+	for _, c := range calls {
+		fmt.Fprintf(&msg, "\t%s\n", c)
+	}
+	return strings.TrimSuffix(msg.String(), "\n")
+}
@@ -0,0 +1,215 @@
+package mock
+
+// This file contains the long-running operations on distros: while they are in
+// progress, the distro reports an intermediate state and conflicting operations
+// fail.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/internal/flags"
+)
+
+// ErrDistroBusy is returned by the operations on a distro that is being
+// installed, uninstalled, exported or converted.
+var ErrDistroBusy = errors.New("the distribution is busy with another operation")
+
+// OperationDurations sets how long the long-running operations take. Zero
+// durations make them instantaneous.
+type OperationDurations struct {
+	Register   time.Duration // WslRegisterDistribution
+	Unregister time.Duration // WslUnregisterDistribution
+	Export     time.Duration // Export
+	Import     time.Duration // Import
+	Convert    time.Duration // SetVersion
+}
+
+// operation is a long-running operation in progress on a distro.
+type operation int32
+
+const (
+	opNone operation = iota
+	opInstalling
+	opUninstalling
+	opExporting
+	opConverting
+)
+
+func (op operation) String() string {
+	switch op {
+	case opInstalling:
+		return "being installed"
+	case opUninstalling:
+		return "being uninstalled"
+	case opExporting:
+		return "being exported"
+	case opConverting:
+		return "being converted"
+	}
+	return "idle"
+}
+
+// currentOperation returns the operation in progress on the distro.
+func (r *RegistryKey) currentOperation() operation {
+	return operation(r.operation.Load())
+}
+
+// busy returns an error if there is an operation in progress on the distro.
+func (r *RegistryKey) busy() error {
+	if op := r.currentOperation(); op != opNone {
+		return fmt.Errorf("failed syscall: %w: distro is %s", ErrDistroBusy, op)
+	}
+	return nil
+}
+
+// startOperation marks the operation as in progress. It fails if there is
+// another one already.
+func (r *RegistryKey) startOperation(op operation) error {
+	if !r.operation.CompareAndSwap(int32(opNone), int32(op)) {
+		return r.busy()
+	}
+	return nil
+}
+
+// endOperation marks the operation as finished.
+func (r *RegistryKey) endOperation() {
+	r.operation.Store(int32(opNone))
+}
+
+// wait blocks for the duration of an operation, as measured by the back-end's clock.
+func (b *Backend) wait(d time.Duration) {
+	sleep(b.clock, d)
+}
+
+// lookupDistroKey returns the key of a registered distro, or the error wsl.exe
+// fails with if there is none.
+func (b *Backend) lookupDistroKey(distroName string) (*RegistryKey, error) {
+	b.lxssRootKey.mu.RLock()
+	defer b.lxssRootKey.mu.RUnlock()
+
+	_, key := b.findDistroKey(distroName)
+	if key == nil {
+		return nil, errors.New("Bla bla bla this is localized text, don't assert on it.\nError code: Wsl/Service/WSL_E_DISTRO_NOT_FOUND")
+	}
+
+	return key, nil
+}
+
+// Export mocks the behaviour of exporting a distro into a tarball, as in
+// `wsl.exe --export <distroName> <tarball>`. The tarball is gzipped if its name
+// ends in ".gz".
+func (b *Backend) Export(distroName, tarball string) (err error) {
+	done := b.record("Export", distroName, tarball)
+	defer func() { done(err) }()
+
+	defer decorate.OnError(&err, "Export")
+
+	if err := b.faults.injectedError("Export"); err != nil {
+		return err
+	}
+
+	key, err := b.lookupDistroKey(distroName)
+	if err != nil {
+		return err
+	}
+	if err := key.startOperation(opExporting); err != nil {
+		return err
+	}
+	defer key.endOperation()
+
+	b.wait(b.durations.Export)
+
+	f, err := os.Create(tarball)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := key.fs.WriteTar(f, "/", nil, strings.HasSuffix(tarball, ".gz")); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// Import mocks the behaviour of registering a distro from a tarball with a
+// chosen WSL version, as in `wsl.exe --import <distroName> <dir> <tarball> --version <version>`.
+// The tarball may be gzipped.
+func (b *Backend) Import(distroName, tarball string, version uint8) (err error) {
+	done := b.record("Import", distroName, tarball, version)
+	defer func() { done(err) }()
+
+	defer decorate.OnError(&err, "Import")
+
+	if err := b.faults.injectedError("Import"); err != nil {
+		return err
+	}
+
+	if version != 1 && version != 2 {
+		return fmt.Errorf("invalid WSL version %d", version)
+	}
+
+	if err := validDistroName(distroName); err != nil {
+		return err
+	}
+
+	return b.register(distroName, tarball, version, Fault{}, b.durations.Import)
+}
+
+// SetVersion mocks the behaviour of converting a distro to another WSL version,
+// as in `wsl.exe --set-version <distroName> <version>`. The distro is terminated.
+func (b *Backend) SetVersion(distroName string, version uint8) (err error) {
+	done := b.record("SetVersion", distroName, version)
+	defer func() { done(err) }()
+
+	defer decorate.OnError(&err, "SetVersion")
+
+	if err := b.faults.injectedError("SetVersion"); err != nil {
+		return err
+	}
+
+	if version != 1 && version != 2 {
+		return fmt.Errorf("invalid WSL version %d", version)
+	}
+
+	key, err := b.lookupDistroKey(distroName)
+	if err != nil {
+		return err
+	}
+	if err := key.startOperation(opConverting); err != nil {
+		return err
+	}
+	defer key.endOperation()
+
+	if err := key.state.Terminate(); err != nil {
+		return err
+	}
+
+	b.wait(b.durations.Convert)
+
+	key.mu.Lock()
+	defer key.mu.Unlock()
+
+	f, ok := key.data["Flags"].(flags.WslFlags)
+	if !ok {
+		return errors.New("failed syscall: distro is not fully registered")
+	}
+	key.data["Flags"] = withWSLVersion(f, version)
+
+	return nil
+}
+
+// withWSLVersion returns the flags with the undocumented WSL version bit set
+// according to the version.
+func withWSLVersion(f flags.WslFlags, version uint8) flags.WslFlags {
+	const wsl2 = flags.WslFlags(0x8)
+	if version == 2 {
+		return f | wsl2
+	}
+	return f &^ wsl2
+}
@@ -5,9 +5,11 @@ import (
 	"io/fs"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ubuntu/decorate"
-	"github.com/ubuntu/gowsl/internal/backend"
+	"github.com/ubuntu/gowsl/backend"
+	"github.com/ubuntu/gowsl/mock/internal/distrofs"
 	"github.com/ubuntu/gowsl/mock/internal/distrostate"
 )
 
@@ -20,7 +22,12 @@ type RegistryKey struct {
 	children map[string]*RegistryKey
 	data     map[string]any
 
-	state *distrostate.DistroState
+	state  *distrostate.DistroState
+	fs     *distrofs.FS
+	faults *faultInjector
+
+	// Long-running operation in progress
+	operation atomic.Int32
 
 	mu sync.RWMutex
 }
@@ -33,8 +40,15 @@ const (
 //
 // This implementation is a mock used for testing.
 func (b Backend) OpenLxssRegistry(path string) (r backend.RegistryKey, err error) {
+	done := b.record("OpenLxssRegistry", path)
+	defer func() { done(r, err) }()
+
 	defer decorate.OnError(&err, "registry: could not open %s", filepath.Join("HKEY_CURRENT_USER", lxssPath, path))
 
+	if err := b.faults.injectedError("OpenLxssRegistry"); err != nil {
+		return nil, err
+	}
+
 	b.lxssRootKey.mu.RLock()
 	if path == "." {
 		// We "leak" the locked mutex. The user is in charge of releasing it with .Close()
@@ -65,6 +79,10 @@ func (r *RegistryKey) Close() (err error) {
 func (r *RegistryKey) Field(name string) (value string, err error) {
 	defer decorate.OnError(&err, "registry: could not access field %q in %s", name, r.path)
 
+	if err := r.faults.injectedError("Field"); err != nil {
+		return "", err
+	}
+
 	v, ok := r.data[name]
 	if !ok {
 		return "", fs.ErrNotExist
@@ -83,6 +101,10 @@ func (r *RegistryKey) Field(name string) (value string, err error) {
 func (r *RegistryKey) SubkeyNames() (subkeys []string, err error) {
 	defer decorate.OnError(&err, "registry: could not access subkeys under %s", r.path)
 
+	if err := r.faults.injectedError("SubkeyNames"); err != nil {
+		return nil, err
+	}
+
 	for key := range r.children {
 		subkeys = append(subkeys, key)
 	}
@@ -3,6 +3,7 @@ package mock
 // This file contains mocks for Win32 API definitions and imports.
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -10,10 +11,13 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/backend"
 	"github.com/ubuntu/gowsl/internal/flags"
+	"github.com/ubuntu/gowsl/mock/internal/distrofs"
 	"github.com/ubuntu/gowsl/mock/internal/distrostate"
 )
 
@@ -22,8 +26,15 @@ const windowsError = math.MaxUint32
 
 // WslConfigureDistribution mocks the WslConfigureDistribution call to the Win32 API.
 func (b *Backend) WslConfigureDistribution(distributionName string, defaultUID uint32, wslDistributionFlags flags.WslFlags) (err error) {
+	done := b.record("WslConfigureDistribution", distributionName, defaultUID, wslDistributionFlags)
+	defer func() { done(err) }()
+
 	defer decorate.OnError(&err, "WslConfigureDistribution")
 
+	if err := b.faults.injectedError("WslConfigureDistribution"); err != nil {
+		return err
+	}
+
 	if err := validDistroName(distributionName); err != nil {
 		return err
 	}
@@ -33,10 +44,20 @@ func (b *Backend) WslConfigureDistribution(distributionName string, defaultUID u
 		return errors.New("failed syscall: distro not registered")
 	}
 
+	if err := key.busy(); err != nil {
+		return err
+	}
+
 	key.mu.Lock()
 	defer key.mu.Unlock()
 
-	key.data["Flags"] = wslDistributionFlags
+	// Like in WSL, the version can only be changed with SetVersion
+	version := uint8(1)
+	if f, ok := key.data["Flags"].(flags.WslFlags); ok && f&0x8 != 0 {
+		version = 2
+	}
+
+	key.data["Flags"] = withWSLVersion(wslDistributionFlags, version)
 	key.data["DefaultUid"] = defaultUID
 
 	return nil
@@ -48,8 +69,17 @@ func (b *Backend) WslGetDistributionConfiguration(distributionName string,
 	defaultUID *uint32,
 	wslDistributionFlags *flags.WslFlags,
 	defaultEnvironmentVariables *map[string]string) (err error) {
+	done := b.record("WslGetDistributionConfiguration", distributionName)
+	defer func() {
+		done(*distributionVersion, *defaultUID, *wslDistributionFlags, *defaultEnvironmentVariables, err)
+	}()
+
 	defer decorate.OnError(&err, "WslGetDistributionConfiguration")
 
+	if err := b.faults.injectedError("WslGetDistributionConfiguration"); err != nil {
+		return err
+	}
+
 	if err := validDistroName(distributionName); err != nil {
 		return err
 	}
@@ -62,19 +92,29 @@ func (b *Backend) WslGetDistributionConfiguration(distributionName string,
 		return errors.New("failed syscall: not registered")
 	}
 
+	if err := key.busy(); err != nil {
+		return err
+	}
+
 	key.mu.RLock()
 	defer key.mu.RUnlock()
 
-	// Ignoring tipe assert linter because we're the only ones with access to these fields
-	*distributionVersion = key.data["Version"].(uint8)         //nolint: forcetypeassert
-	*defaultUID = key.data["DefaultUid"].(uint32)              //nolint: forcetypeassert
-	*wslDistributionFlags = key.data["Flags"].(flags.WslFlags) //nolint: forcetypeassert
+	version, okVersion := key.data["Version"].(uint8)
+	uid, okUID := key.data["DefaultUid"].(uint32)
+	f, okFlags := key.data["Flags"].(flags.WslFlags)
+	if !okVersion || !okUID || !okFlags {
+		// This happens when a registration was interrupted
+		return errors.New("failed syscall: distro is not fully registered")
+	}
+
+	*distributionVersion = version
+	*defaultUID = uid
+	*wslDistributionFlags = f
 
-	*defaultEnvironmentVariables = map[string]string{
-		"HOSTTYPE": "x86_64",
-		"LANG":     "en_US.UTF-8",
-		"PATH":     "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/games:/usr/local/games",
-		"TERM":     "xterm-256color",
+	env, _ := key.data["DefaultEnvironment"].(map[string]string)
+	*defaultEnvironmentVariables = make(map[string]string, len(env))
+	for k, v := range env {
+		(*defaultEnvironmentVariables)[k] = v
 	}
 
 	return nil
@@ -87,7 +127,52 @@ func (b *Backend) WslLaunch(distributionName string,
 	stdin *os.File,
 	stdout *os.File,
 	stderr *os.File) (process *os.Process, err error) {
-	defer decorate.OnError(&err, "WslLaunch")
+	return b.launch("WslLaunch", distributionName, "", command, useCWD, nil, stdin, stdout, stderr)
+}
+
+// WslLaunchEnv mocks launching a command with wsl.exe, with additional
+// environment variables. The variables forwarded via WSLENV are in the Env of
+// the CommandInfo of the handler.
+func (b *Backend) WslLaunchEnv(distributionName string,
+	command string,
+	useCWD bool,
+	env []string,
+	stdin *os.File,
+	stdout *os.File,
+	stderr *os.File) (process *os.Process, err error) {
+	return b.launch("WslLaunchEnv", distributionName, "", command, useCWD, env, stdin, stdout, stderr)
+}
+
+// WslLaunchAs mocks launching a command with wsl.exe as the named user. The
+// user is in the User of the CommandInfo of the handler: the mock does not
+// check that it exists in the distro.
+func (b *Backend) WslLaunchAs(distributionName string,
+	user string,
+	command string,
+	useCWD bool,
+	env []string,
+	stdin *os.File,
+	stdout *os.File,
+	stderr *os.File) (process *os.Process, err error) {
+	return b.launch("WslLaunchAs", distributionName, user, command, useCWD, env, stdin, stdout, stderr)
+}
+
+// launch launches a command on behalf of the method as the user, with env added
+// to the environment of the current process.
+func (b *Backend) launch(method string, distributionName string, user string, command string, useCWD bool, env []string, stdin, stdout, stderr *os.File) (process *os.Process, err error) {
+	args := []any{distributionName, command, useCWD}
+	if method == "WslLaunchAs" {
+		args = []any{distributionName, user, command, useCWD}
+	}
+	done := b.record(method, args...)
+	defer func() { done(process, err) }()
+
+	defer decorate.OnError(&err, method)
+
+	fault, _ := b.faults.trigger(method)
+	if err := fault.launchErr(); err != nil {
+		return nil, err
+	}
 
 	if err := validWin32String(distributionName); err != nil {
 		return nil, err
@@ -107,6 +192,10 @@ func (b *Backend) WslLaunch(distributionName string,
 
 	b.lxssRootKey.mu.RUnlock()
 
+	if err := distroKey.busy(); err != nil {
+		return nil, err
+	}
+
 	if !isPipeOrNull(stdin) {
 		panic("Stdin must be a pipe")
 	}
@@ -117,7 +206,21 @@ func (b *Backend) WslLaunch(distributionName string,
 		panic("Stderr must be a pipe")
 	}
 
-	p, err := newMockedCommand(command).start(stdin, stdout, stderr)
+	handler := b.handlers.lookup(command)
+	if _, builtin := translateCommand[command]; handler == nil && !builtin {
+		handler = b.unhandled(distroKey, command)
+	}
+	if fault.ExitCode != 0 {
+		handler = CannedOutput("", "", fault.ExitCode)
+	}
+
+	var p *os.Process
+	if handler != nil {
+		info := CommandInfo{Distro: distributionName, User: user, Command: command, UseCWD: useCWD, Env: forwardedEnv(backend.AppendEnv(os.Environ(), env))}
+		p, err = startHandler(handler, info, stdin, stdout, stderr)
+	} else {
+		p, err = newMockedCommand(command).start(stdin, stdout, stderr)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -132,8 +235,16 @@ func (b *Backend) WslLaunch(distributionName string,
 
 // WslLaunchInteractive mocks the WslLaunchInteractive call to the Win32 API.
 func (b *Backend) WslLaunchInteractive(distributionName string, command string, useCurrentWorkingDirectory bool) (exitCode uint32, err error) {
+	done := b.record("WslLaunchInteractive", distributionName, command, useCurrentWorkingDirectory)
+	defer func() { done(exitCode, err) }()
+
 	defer decorate.OnError(&err, "WslLaunchInteractive")
 
+	fault, _ := b.faults.trigger("WslLaunchInteractive")
+	if err := fault.launchErr(); err != nil {
+		return windowsError, err
+	}
+
 	if err := validWin32String(distributionName); err != nil {
 		return windowsError, err
 	}
@@ -152,10 +263,24 @@ func (b *Backend) WslLaunchInteractive(distributionName string, command string,
 
 	b.lxssRootKey.mu.RUnlock()
 
+	if err := distroKey.busy(); err != nil {
+		return windowsError, err
+	}
+
 	if err := distroKey.state.Touch(); err != nil {
 		return windowsError, fmt.Errorf("failed syscall: %v", err)
 	}
 
+	if fault.ExitCode != 0 {
+		//nolint:gosec // Exit codes are truncated just like in Windows.
+		return uint32(fault.ExitCode), nil
+	}
+
+	info := CommandInfo{Distro: distributionName, Command: command, UseCWD: useCurrentWorkingDirectory, Interactive: true}
+	if handler := b.handlers.lookup(command); handler != nil {
+		return runInteractive(handler, info), nil
+	}
+
 	switch command {
 	case "":
 		s, err := distroKey.state.NewShell()
@@ -184,14 +309,42 @@ func (b *Backend) WslLaunchInteractive(distributionName string, command string,
 		// We are home (hence /root)
 		return 1, nil
 	default:
+		if handler := b.unhandled(distroKey, command); handler != nil {
+			return runInteractive(handler, info), nil
+		}
 		panic(fmt.Sprintf("WslLaunchInteractive command not supported: %q", command))
 	}
 }
 
+// unhandled returns the handler for a command that has no registered handler
+// and is not one of the mocked processes: either one of the commands that
+// operate on the distro's filesystem, or the fallback handler. It returns nil
+// if there is none.
+func (b *Backend) unhandled(distroKey *RegistryKey, command string) CommandHandler {
+	if handler := fileCommand(distroKey.fs, command); handler != nil {
+		return handler
+	}
+	return b.handlers.fallbackHandler()
+}
+
+// runInteractive runs the handler attached to the standard streams of the current process.
+func runInteractive(handler CommandHandler, info CommandInfo) (exitCode uint32) {
+	ctx := context.WithValue(context.Background(), commandInfoKey{}, info)
+	return uint32(handler(ctx, os.Stdin, os.Stdout, os.Stderr))
+}
+
 // WslRegisterDistribution mocks the WslRegisterDistribution call to the Win32 API.
 func (b *Backend) WslRegisterDistribution(distributionName string, tarGzFilename string) (err error) {
+	done := b.record("WslRegisterDistribution", distributionName, tarGzFilename)
+	defer func() { done(err) }()
+
 	defer decorate.OnError(&err, "WslRegisterDistribution")
 
+	fault, _ := b.faults.trigger("WslRegisterDistribution")
+	if err := fault.err(); err != nil && !fault.Partial {
+		return err
+	}
+
 	if err := validDistroName(distributionName); err != nil {
 		return err
 	}
@@ -200,31 +353,67 @@ func (b *Backend) WslRegisterDistribution(distributionName string, tarGzFilename
 		return err
 	}
 
+	return b.register(distributionName, tarGzFilename, 2, fault, b.durations.Register)
+}
+
+// register registers a distro with the chosen WSL version. The distro is in
+// the Installing state for the chosen duration.
+func (b *Backend) register(distributionName, tarGzFilename string, version uint8, fault Fault, d time.Duration) error {
+	key, err := b.addDistroKey(distributionName, tarGzFilename, version, fault)
+	if err != nil {
+		return err
+	}
+
+	b.wait(d)
+	key.endOperation()
+
+	return nil
+}
+
+// addDistroKey adds the registry key of a distro that is being installed.
+func (b *Backend) addDistroKey(distributionName, tarGzFilename string, version uint8, fault Fault) (*RegistryKey, error) {
 	b.lxssRootKey.mu.Lock()
 	defer b.lxssRootKey.mu.Unlock()
 
 	if _, key := b.findDistroKey(distributionName); key != nil {
-		return errors.New("failed syscall: distro already exists")
+		return nil, errors.New("failed syscall: distro already exists")
+	}
+
+	rootfs, err := distrofs.FromTarball(tarGzFilename)
+	if err != nil {
+		return nil, fmt.Errorf("failed syscall: could not import rootfs: %v", err)
 	}
 
 	GUID, err := uuid.NewRandom()
 	if err != nil {
-		return fmt.Errorf("could not generate UUID: %v", err)
+		return nil, fmt.Errorf("could not generate UUID: %v", err)
 	}
 
 	guidStr := fmt.Sprintf("{%s}", GUID.String())
 
-	b.lxssRootKey.children[guidStr] = &RegistryKey{
-		path: filepath.Join("HKEY_CURRENT_USER", lxssPath, guidStr),
-		data: map[string]any{
-			"DistributionName": distributionName,
-			"Flags":            flags.WslFlags(0xf),
-			"Version":          uint8(2),
-			"DefaultUid":       uint32(0),
-		},
-		state: distrostate.New(),
+	if fault.Partial {
+		// The registration was interrupted before configuring the distro
+		b.lxssRootKey.children[guidStr] = &RegistryKey{
+			path: filepath.Join("HKEY_CURRENT_USER", lxssPath, guidStr),
+			data: map[string]any{
+				"DistributionName": distributionName,
+			},
+			state:  distrostate.New(b.clock, b.idleTimeout),
+			fs:     distrofs.New(),
+			faults: b.faults,
+		}
+
+		if err := fault.err(); err != nil {
+			return nil, err
+		}
+		return nil, errPartialRegistration
 	}
 
+	key := b.newDistroKey(guidStr, distributionName, rootfs)
+	key.data["Flags"] = withWSLVersion(key.data["Flags"].(flags.WslFlags), version) //nolint:forcetypeassert // We just set it.
+	key.operation.Store(int32(opInstalling))
+	b.lxssRootKey.children[guidStr] = key
+
 	// When registering the first distro, DefaultDistribution
 	// is updated with its GUID
 
@@ -232,26 +421,41 @@ func (b *Backend) WslRegisterDistribution(distributionName string, tarGzFilename
 		b.lxssRootKey.data["DefaultDistribution"] = guidStr
 	}
 
-	return nil
+	return key, nil
 }
 
 // WslUnregisterDistribution mocks the WslUnregisterDistribution call to the Win32 API.
 func (b *Backend) WslUnregisterDistribution(distributionName string) (err error) {
+	done := b.record("WslUnregisterDistribution", distributionName)
+	defer func() { done(err) }()
+
 	defer decorate.OnError(&err, "WslUnregisterDistribution")
 
-	if err := validDistroName(distributionName); err != nil {
+	if err := b.faults.injectedError("WslUnregisterDistribution"); err != nil {
 		return err
 	}
 
-	b.lxssRootKey.mu.Lock()
-	defer b.lxssRootKey.mu.Unlock()
+	if err := validDistroName(distributionName); err != nil {
+		return err
+	}
 
+	b.lxssRootKey.mu.RLock()
 	GUID, key := b.findDistroKey(distributionName)
+	b.lxssRootKey.mu.RUnlock()
 	if key == nil {
 		return errors.New("failed syscall: distro not registered")
 	}
 
+	if err := key.startOperation(opUninstalling); err != nil {
+		return err
+	}
+
 	err = key.state.MarkUninstalled()
+	b.wait(b.durations.Unregister)
+
+	b.lxssRootKey.mu.Lock()
+	defer b.lxssRootKey.mu.Unlock()
+
 	delete(b.lxssRootKey.children, GUID)
 
 	//  When you unregister the default distro, the one with the lowest GUID
@@ -268,7 +472,7 @@ func (b *Backend) WslUnregisterDistribution(distributionName string) (err error)
 			continue // Not a distro
 		}
 
-		if strings.Compare(GUID, firstGUID) == -1 {
+		if firstGUID == "" || strings.Compare(GUID, firstGUID) == -1 {
 			firstGUID = GUID
 		}
 	}
@@ -278,6 +482,28 @@ func (b *Backend) WslUnregisterDistribution(distributionName string) (err error)
 	return err
 }
 
+// newDistroKey returns the registry key of a newly registered distro, with the default configuration.
+func (b *Backend) newDistroKey(GUID, distroName string, rootfs *distrofs.FS) *RegistryKey {
+	return &RegistryKey{
+		path: filepath.Join("HKEY_CURRENT_USER", lxssPath, GUID),
+		data: map[string]any{
+			"DistributionName": distroName,
+			"Flags":            flags.WslFlags(0xf),
+			"Version":          uint8(2),
+			"DefaultUid":       uint32(0),
+			"DefaultEnvironment": map[string]string{
+				"HOSTTYPE": "x86_64",
+				"LANG":     "en_US.UTF-8",
+				"PATH":     "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/games:/usr/local/games",
+				"TERM":     "xterm-256color",
+			},
+		},
+		state:  distrostate.New(b.clock, b.idleTimeout),
+		fs:     rootfs,
+		faults: b.faults,
+	}
+}
+
 func validWin32String(str string) error {
 	if strings.ContainsRune(str, rune(0)) {
 		return fmt.Errorf("could not convert %q to UTF-16", str)
@@ -9,6 +9,13 @@ import (
 
 // Shutdown mocks the behaviour of shutting down WSL.
 func (backend *Backend) Shutdown() (err error) {
+	done := backend.record("Shutdown")
+	defer func() { done(err) }()
+
+	if err := backend.faults.injectedError("Shutdown"); err != nil {
+		return err
+	}
+
 	backend.lxssRootKey.mu.RLock()
 	defer backend.lxssRootKey.mu.RUnlock()
 
@@ -27,20 +34,35 @@ func (backend *Backend) Shutdown() (err error) {
 }
 
 // Terminate mocks the behaviour of shutting down one WSL distro.
-func (backend *Backend) Terminate(distroName string) error {
-	backend.lxssRootKey.mu.RLock()
-	defer backend.lxssRootKey.mu.RUnlock()
+func (backend *Backend) Terminate(distroName string) (err error) {
+	done := backend.record("Terminate", distroName)
+	defer func() { done(err) }()
 
-	guid, key := backend.findDistroKey(distroName)
-	if guid == "" {
-		return errors.New("Bla bla bla this is localized text, don't assert on it.\nError code: Wsl/Service/WSL_E_DISTRO_NOT_FOUND")
+	if err := backend.faults.injectedError("Terminate"); err != nil {
+		return err
+	}
+
+	key, err := backend.lookupDistroKey(distroName)
+	if err != nil {
+		return err
+	}
+
+	if err := key.busy(); err != nil {
+		return err
 	}
 
 	return key.state.Terminate()
 }
 
 // SetAsDefault mocks the behaviour of setting one distro as default.
-func (backend *Backend) SetAsDefault(distroName string) error {
+func (backend *Backend) SetAsDefault(distroName string) (err error) {
+	done := backend.record("SetAsDefault", distroName)
+	defer func() { done(err) }()
+
+	if err := backend.faults.injectedError("SetAsDefault"); err != nil {
+		return err
+	}
+
 	if err := validDistroName(distroName); err != nil {
 		return err
 	}
@@ -53,6 +75,10 @@ func (backend *Backend) SetAsDefault(distroName string) error {
 		return errors.New("distro not registered")
 	}
 
+	if err := key.busy(); err != nil {
+		return err
+	}
+
 	backend.lxssRootKey.data["DefaultDistribution"] = GUID
 
 	return nil
@@ -60,11 +86,25 @@ func (backend *Backend) SetAsDefault(distroName string) error {
 
 // State returns the state of a particular distro as seen in `wsl.exe -l -v`.
 func (backend Backend) State(distributionName string) (s state.State, err error) {
+	done := backend.record("State", distributionName)
+	defer func() { done(s, err) }()
+
+	if err := backend.faults.injectedError("State"); err != nil {
+		return s, err
+	}
+
 	_, key := backend.findDistroKey(distributionName)
 	if key == nil {
 		return state.NotRegistered, nil
 	}
 
+	switch key.currentOperation() {
+	case opInstalling:
+		return state.Installing, nil
+	case opUninstalling:
+		return state.Uninstalling, nil
+	}
+
 	if key.state.IsRunning() {
 		return state.Running, nil
 	}
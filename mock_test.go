@@ -0,0 +1,821 @@
+//go:build gowslmock
+
+// This file contains tests for the features of the mock back-end that are
+// not part of the real one.
+
+package gowsl_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/mock"
+)
+
+func TestMockCommandHandlers(t *testing.T) {
+	t.Parallel()
+
+	echoHandler := func(prefix string) mock.CommandHandler {
+		return func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+			info, ok := mock.CommandInfoFromContext(ctx)
+			if !ok {
+				return 255
+			}
+			fmt.Fprintf(stdout, "%s: %s", prefix, info.Command)
+			return 0
+		}
+	}
+
+	testCases := map[string]struct {
+		command  string
+		exact    bool
+		regexp   bool
+		fallback bool
+
+		wantStdout   string
+		wantExitCode int
+		wantPanic    bool
+	}{
+		"Exact match":                     {command: "cat /etc/os-release", exact: true, wantStdout: "exact: cat /etc/os-release"},
+		"Exact match takes precedence":    {command: "cat /etc/os-release", exact: true, regexp: true, fallback: true, wantStdout: "exact: cat /etc/os-release"},
+		"Regexp match":                    {command: "apt-get install -y git", regexp: true, wantStdout: "regexp: apt-get install -y git"},
+		"Regexp takes precedence":         {command: "apt-get update", regexp: true, fallback: true, wantStdout: "regexp: apt-get update"},
+		"Fallback":                        {command: "uname -a", fallback: true, wantStdout: "fallback: uname -a"},
+		"Builtin commands still work":     {command: "exit 42", fallback: true, wantExitCode: 42},
+		"Builtin commands can be handled": {command: "exit 42", exact: true, wantStdout: "exact: exit 42"},
+
+		"Panic without a handler": {command: "uname -a", wantPanic: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m := mock.New()
+			ctx := wsl.WithMock(context.Background(), m)
+			d := newTestDistro(t, ctx, emptyRootFs)
+
+			if tc.exact {
+				m.HandleCommand(tc.command, echoHandler("exact"))
+			}
+			if tc.regexp {
+				m.HandleCommandRegexp(regexp.MustCompile(`^apt(-get)? `), echoHandler("regexp"))
+				m.HandleCommandRegexp(regexp.MustCompile(`^cat `), echoHandler("regexp"))
+			}
+			if tc.fallback {
+				m.HandleFallback(echoHandler("fallback"))
+			}
+
+			if tc.wantPanic {
+				require.Panics(t, func() { _ = d.Command(ctx, tc.command).Run() }, "Command should panic")
+				require.Panics(t, func() { _ = d.Shell(wsl.WithCommand(tc.command)) }, "Shell should panic")
+				return
+			}
+
+			out, err := d.Command(ctx, tc.command).Output()
+			if tc.wantExitCode != 0 {
+				var target *exec.ExitError
+				require.ErrorAs(t, err, &target, "Command should have returned an ExitError")
+				require.Equal(t, tc.wantExitCode, target.ExitCode(), "Unexpected exit code")
+			} else {
+				require.NoError(t, err, "Command should not have failed")
+			}
+			require.Equal(t, tc.wantStdout, string(out), "Unexpected output")
+
+			err = d.Shell(wsl.WithCommand(tc.command))
+			if tc.wantExitCode != 0 {
+				var target *wsl.ShellError
+				require.ErrorAs(t, err, &target, "Shell should have returned a ShellError")
+				require.Equal(t, uint32(tc.wantExitCode), target.ExitCode(), "Unexpected exit code")
+			} else {
+				require.NoError(t, err, "Shell should not have failed")
+			}
+		})
+	}
+}
+
+func TestMockCommandHandlerStreams(t *testing.T) {
+	t.Parallel()
+
+	m := mock.New()
+	ctx := wsl.WithMock(context.Background(), m)
+	d := newTestDistro(t, ctx, emptyRootFs)
+
+	m.HandleCommand("tr a-z A-Z", func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+		in, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "could not read stdin: %v", err)
+			return 1
+		}
+		fmt.Fprint(stdout, strings.ToUpper(string(in)))
+		return 0
+	})
+	m.HandleCommand("false", mock.CannedOutput("", "Something went wrong", 3))
+
+	cmd := d.Command(ctx, "tr a-z A-Z")
+	cmd.Stdin = strings.NewReader("hello, world!")
+	out, err := cmd.Output()
+	require.NoError(t, err, "Command should not have failed")
+	require.Equal(t, "HELLO, WORLD!", string(out), "Handler should have read stdin and written stdout")
+
+	var stderr bytes.Buffer
+	cmd = d.Command(ctx, "false")
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	var target *exec.ExitError
+	require.ErrorAs(t, err, &target, "Command should have returned an ExitError")
+	require.Equal(t, 3, target.ExitCode(), "Unexpected exit code")
+	require.Equal(t, "Something went wrong", stderr.String(), "Handler should have written stderr")
+
+	m.HandleCommand("false", nil)
+	require.Panics(t, func() { _ = d.Command(ctx, "false").Run() }, "Removed handlers should not be used")
+}
+
+func TestMockCommandHandlerCancel(t *testing.T) {
+	t.Parallel()
+
+	m := mock.New()
+	ctx := wsl.WithMock(context.Background(), m)
+	d := newTestDistro(t, ctx, emptyRootFs)
+
+	cancelled := make(chan struct{})
+	m.HandleCommand("sleep 1000", func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+		<-ctx.Done()
+		close(cancelled)
+		return 1
+	})
+
+	cmdCtx, cancel := context.WithCancel(ctx)
+	cmd := d.Command(cmdCtx, "sleep 1000")
+	require.NoError(t, cmd.Start(), "Start should not have failed")
+
+	cancel()
+	err := cmd.Wait()
+	require.Error(t, err, "Wait should have failed after cancelling the context")
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "Handler context should have been cancelled after the process was killed")
+	}
+}
+
+func TestMockFilesystem(t *testing.T) {
+	t.Parallel()
+
+	m := mock.New()
+	ctx := wsl.WithMock(context.Background(), m)
+	d := newTestDistro(t, ctx, emptyRootFs)
+
+	err := m.WriteFile(d.Name(), "/etc/os-release", []byte("NAME=Ubuntu\n"), 0644)
+	require.NoError(t, err, "Setup: WriteFile should not fail")
+
+	run := func(command, stdin string) (stdout, stderr string, exitCode int) {
+		t.Helper()
+
+		var o, e bytes.Buffer
+		cmd := d.Command(ctx, command)
+		cmd.Stdin = strings.NewReader(stdin)
+		cmd.Stdout = &o
+		cmd.Stderr = &e
+
+		err := cmd.Run()
+		var target *exec.ExitError
+		if errors.As(err, &target) {
+			return o.String(), e.String(), target.ExitCode()
+		}
+		require.NoError(t, err, "Command %q should not fail to run", command)
+		return o.String(), e.String(), 0
+	}
+
+	out, _, code := run("cat /etc/os-release", "")
+	require.Zero(t, code, "cat should succeed")
+	require.Equal(t, "NAME=Ubuntu\n", out, "cat should print the file written with WriteFile")
+
+	_, stderr, code := run("cat /etc/missing", "")
+	require.Equal(t, 1, code, "cat should fail on missing files")
+	require.Equal(t, "cat: /etc/missing: No such file or directory\n", stderr, "Unexpected error message")
+
+	_, _, code = run("mkdir /opt/app/config", "")
+	require.Equal(t, 1, code, "mkdir should fail without -p if the parent does not exist")
+	_, _, code = run("mkdir -p /opt/app/config", "")
+	require.Zero(t, code, "mkdir -p should succeed")
+
+	out, _, code = run("tee '/opt/app/config/my settings.ini'", "key=value\n")
+	require.Zero(t, code, "tee should succeed")
+	require.Equal(t, "key=value\n", out, "tee should copy stdin into stdout")
+	_, _, code = run("tee -a '/opt/app/config/my settings.ini'", "other=value\n")
+	require.Zero(t, code, "tee -a should succeed")
+
+	got, err := m.ReadFile(d.Name(), "/opt/app/config/my settings.ini")
+	require.NoError(t, err, "ReadFile should not fail")
+	require.Equal(t, "key=value\nother=value\n", string(got), "tee should have written the file")
+
+	out, _, code = run("ls /opt/app/config", "")
+	require.Zero(t, code, "ls should succeed")
+	require.Equal(t, "my settings.ini\n", out, "Unexpected ls output")
+
+	_, _, code = run("ls /opt/missing", "")
+	require.Equal(t, 2, code, "ls should fail on missing files")
+
+	out, _, code = run("tar -czf - -C /opt app", "")
+	require.Zero(t, code, "tar -c should succeed")
+	_, _, code = run("mkdir /backup", "")
+	require.Zero(t, code, "Setup: mkdir should succeed")
+	_, _, code = run("tar xzf - -C /backup", out)
+	require.Zero(t, code, "tar -x should succeed")
+
+	got, err = m.ReadFile(d.Name(), "/backup/app/config/my settings.ini")
+	require.NoError(t, err, "ReadFile should not fail on extracted file")
+	require.Equal(t, "key=value\nother=value\n", string(got), "tar should round-trip the file")
+
+	_, _, code = run("rm /opt/app", "")
+	require.Equal(t, 1, code, "rm should fail on directories without -r")
+	_, _, code = run("rm -rf /opt/app", "")
+	require.Zero(t, code, "rm -rf should succeed")
+	_, _, code = run("rm -f /opt/app", "")
+	require.Zero(t, code, "rm -f should succeed on missing files")
+
+	files, err := m.DistroFS(d.Name())
+	require.NoError(t, err, "DistroFS should not fail")
+	require.Contains(t, files, "backup/app/config/my settings.ini", "DistroFS should list extracted files")
+	require.NotContains(t, files, "opt/app", "DistroFS should not list removed files")
+
+	require.Panics(t, func() { _, _, _ = run("cat /etc/os-release | grep NAME", "") }, "Pipes should not be supported")
+}
+
+func TestMockCallJournal(t *testing.T) {
+	t.Parallel()
+
+	m := mock.New()
+	ctx := wsl.WithMock(context.Background(), m)
+	d := newTestDistro(t, ctx, emptyRootFs)
+
+	m.AssertCalled(t, "WslRegisterDistribution", d.Name(), mock.Anything)
+	m.ResetCalls()
+	require.Empty(t, m.Calls(), "ResetCalls should empty the journal")
+
+	err := d.DefaultUID(1000)
+	require.NoError(t, err, "Setup: DefaultUID should not fail")
+	err = d.Terminate()
+	require.NoError(t, err, "Setup: Terminate should not fail")
+	err = d.Command(ctx, "exit 0").Run()
+	require.NoError(t, err, "Setup: Command should not fail")
+	other := wsl.NewDistro(ctx, d.Name()+"-not-registered")
+	err = other.Terminate()
+	require.Error(t, err, "Setup: Terminate should fail on an unregistered distro")
+
+	m.AssertCalled(t, "WslConfigureDistribution", d.Name(), 1000, mock.Anything)
+	m.AssertNumberOfCalls(t, 2, "Terminate")
+	m.AssertNotCalled(t, "Shutdown")
+	m.AssertCallOrder(t,
+		mock.Expect("WslConfigureDistribution"),
+		mock.Expect("Terminate", d.Name()),
+		mock.Expect("WslLaunch", d.Name(), "exit 0", mock.Anything),
+	)
+
+	calls := m.CallsTo("Terminate", mock.MatchedBy(func(v any) bool {
+		return strings.HasSuffix(v.(string), "-not-registered") //nolint:forcetypeassert // The argument is always a string.
+	}))
+	require.Len(t, calls, 1, "CallsTo should filter calls by their arguments")
+	require.Error(t, calls[0].Err(), "The journal should record the returned error")
+	require.False(t, calls[0].Time.IsZero(), "The journal should record the time of the call")
+
+	calls = m.CallsTo("WslLaunch")
+	require.Len(t, calls, 1, "Unexpected number of calls to WslLaunch")
+	require.Len(t, calls[0].Returns, 2, "WslLaunch should record its process and error")
+	require.NoError(t, calls[0].Err(), "WslLaunch should have succeeded")
+
+	// Failing assertions
+	tt := &fakeTestingT{}
+	require.False(t, m.AssertCalled(tt, "Shutdown"), "AssertCalled should fail for methods never called")
+	require.False(t, m.AssertNotCalled(tt, "Terminate"), "AssertNotCalled should fail for methods that were called")
+	require.False(t, m.AssertNumberOfCalls(tt, 1, "Terminate"), "AssertNumberOfCalls should fail with the wrong count")
+	require.False(t, m.AssertCallOrder(tt, mock.Expect("Terminate"), mock.Expect("WslConfigureDistribution")),
+		"AssertCallOrder should fail when calls are out of order")
+	require.Len(t, tt.errors, 4, "Every failing assertion should report an error")
+	require.Contains(t, tt.errors[3], "WslConfigureDistribution(...)", "The error should mention the unmatched expectation")
+
+	// Calls that return after the journal is reset do not affect the new journal
+	m.InjectFault("Terminate", mock.Fault{Delay: 100 * time.Millisecond, Times: 1})
+	done := make(chan error)
+	go func() { done <- d.Terminate() }()
+	require.Eventually(t, func() bool { return len(m.CallsTo("Terminate")) == 3 }, 5*time.Second, time.Millisecond,
+		"Setup: Terminate should have been called")
+	m.ResetCalls()
+
+	_, err = d.State()
+	require.NoError(t, err, "Setup: State should not fail")
+	require.NoError(t, <-done, "Setup: Terminate should not fail")
+	m.AssertNotCalled(t, "Terminate")
+	calls = m.CallsTo("State")
+	require.Len(t, calls, 1, "Unexpected number of calls to State")
+	require.NoError(t, calls[0].Err(), "The call in the journal should keep its own return values")
+	require.Equal(t, wsl.Running, calls[0].Returns[0], "The call in the journal should keep its own return values")
+}
+
+// fakeTestingT is a mock.TestingT that records its errors.
+type fakeTestingT struct {
+	errors []string
+}
+
+func (t *fakeTestingT) Helper() {}
+
+func (t *fakeTestingT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestMockFaultInjection(t *testing.T) {
+	t.Parallel()
+
+	errInjected := errors.New("injected error")
+
+	testCases := map[string]struct {
+		method string
+		fault  mock.Fault
+
+		// call calls the method and returns its error (and exit code, for commands)
+		call     func(ctx context.Context, d wsl.Distro) (exitCode int, err error)
+		attempts int
+
+		wantFailures []bool
+		wantErrIs    error
+		wantHRESULT  uint32
+		wantExitCode int
+		wantDelay    time.Duration
+	}{
+		"Error on every call":        {method: "Terminate", fault: mock.Fault{Err: errInjected}, call: terminate, attempts: 2, wantFailures: []bool{true, true}, wantErrIs: errInjected},
+		"Error on the Nth call":      {method: "Terminate", fault: mock.Fault{OnCall: 2, Err: errInjected}, call: terminate, attempts: 3, wantFailures: []bool{false, true, false}, wantErrIs: errInjected},
+		"Error a number of times":    {method: "Terminate", fault: mock.Fault{Times: 1, Err: errInjected}, call: terminate, attempts: 2, wantFailures: []bool{true, false}, wantErrIs: errInjected},
+		"Error with probability 1":   {method: "SetAsDefault", fault: mock.Fault{Probability: 1, Err: errInjected}, call: setAsDefault, attempts: 2, wantFailures: []bool{true, true}, wantErrIs: errInjected},
+		"Error after a delay":        {method: "Terminate", fault: mock.Fault{Delay: 200 * time.Millisecond, Err: errInjected}, call: terminate, attempts: 1, wantFailures: []bool{true}, wantErrIs: errInjected, wantDelay: 200 * time.Millisecond},
+		"HRESULT":                    {method: "WslConfigureDistribution", fault: mock.Fault{HRESULT: 0x8007019e}, call: configure, attempts: 1, wantFailures: []bool{true}, wantHRESULT: 0x8007019e},
+		"Exit code of wsl.exe":       {method: "Shutdown", fault: mock.Fault{ExitCode: 1}, call: shutdown, attempts: 1, wantFailures: []bool{true}, wantErrIs: mock.ExitCodeError(1)},
+		"Exit code of a command":     {method: "WslLaunch", fault: mock.Fault{ExitCode: 3}, call: launch, attempts: 1, wantFailures: []bool{false}, wantExitCode: 3},
+		"Error reading the registry": {method: "Field", fault: mock.Fault{Err: errInjected}, call: listDistros, attempts: 1, wantFailures: []bool{true}, wantErrIs: errInjected},
+
+		"Only a delay": {method: "Terminate", fault: mock.Fault{Delay: 200 * time.Millisecond}, call: terminate, attempts: 1, wantFailures: []bool{false}, wantDelay: 200 * time.Millisecond},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m := mock.New()
+			ctx := wsl.WithMock(context.Background(), m)
+			d := newTestDistro(t, ctx, emptyRootFs)
+
+			remove := m.InjectFault(tc.method, tc.fault)
+
+			for i := 0; i < tc.attempts; i++ {
+				start := time.Now()
+				exitCode, err := tc.call(ctx, d)
+				require.GreaterOrEqual(t, time.Since(start), tc.wantDelay, "Call %d should have been delayed", i+1)
+
+				if !tc.wantFailures[i] {
+					require.NoError(t, err, "Call %d should not have failed", i+1)
+					require.Equal(t, tc.wantExitCode, exitCode, "Unexpected exit code in call %d", i+1)
+					continue
+				}
+
+				require.Error(t, err, "Call %d should have failed", i+1)
+				if tc.wantErrIs != nil {
+					require.ErrorIs(t, err, tc.wantErrIs, "Call %d should have failed with the injected error", i+1)
+				}
+				if tc.wantHRESULT != 0 {
+					var target mock.HRESULTError
+					require.ErrorAs(t, err, &target, "Call %d should have failed with an HRESULT", i+1)
+					require.Equal(t, tc.wantHRESULT, uint32(target), "Unexpected HRESULT in call %d", i+1)
+				}
+			}
+
+			remove()
+			_, err := tc.call(ctx, d)
+			require.NoError(t, err, "Calls should not fail after removing the fault")
+		})
+	}
+}
+
+func TestMockFaultDelayUsesClock(t *testing.T) {
+	t.Parallel()
+
+	clock := mock.NewFakeClock(time.Now())
+	m := mock.New(mock.WithClock(clock))
+	ctx := wsl.WithMock(context.Background(), m)
+	d := newTestDistro(t, ctx, emptyRootFs)
+
+	m.InjectFault("Terminate", mock.Fault{Delay: time.Hour, Times: 1})
+	start := clock.Now()
+
+	done := make(chan error, 1)
+	go func() { done <- d.Terminate() }()
+	require.Eventually(t, func() bool { return clock.PendingTimers() == 1 },
+		5*time.Second, time.Millisecond, "Setup: Terminate should have been delayed")
+
+	clock.Advance(59 * time.Minute)
+	select {
+	case <-done:
+		require.Fail(t, "Terminate should still be delayed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case err := <-done:
+		require.NoError(t, err, "Terminate should not fail after its delay")
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "Terminate should have proceeded once the clock advanced past its delay")
+	}
+
+	var calls []mock.Call
+	for _, c := range m.Calls() {
+		if c.Method == "Terminate" {
+			calls = append(calls, c)
+		}
+	}
+	require.Len(t, calls, 1, "Terminate should have been recorded once")
+	require.True(t, start.Equal(calls[0].Time), "The call should have been recorded with the time of the clock")
+	require.Equal(t, time.Hour, calls[0].Duration, "The duration of the call should have been measured with the clock")
+}
+
+func TestMockPartialRegistration(t *testing.T) {
+	t.Parallel()
+
+	m := mock.New()
+	ctx := wsl.WithMock(context.Background(), m)
+	d := wsl.NewDistro(ctx, uniqueDistroName(t))
+
+	m.InjectFault("WslRegisterDistribution", mock.Fault{Partial: true})
+
+	err := d.Register(emptyRootFs)
+	require.Error(t, err, "Register should fail when the registration is interrupted")
+
+	registered, err := d.IsRegistered()
+	require.NoError(t, err, "IsRegistered should not fail")
+	require.True(t, registered, "Distro should be left partially registered")
+
+	_, err = d.GetConfiguration()
+	require.Error(t, err, "GetConfiguration should fail on a partially registered distro")
+
+	err = d.Unregister()
+	require.NoError(t, err, "Unregister should clean up a partially registered distro")
+
+	registered, err = d.IsRegistered()
+	require.NoError(t, err, "IsRegistered should not fail")
+	require.False(t, registered, "Distro should not be registered after cleaning up")
+
+	require.Panics(t, func() { m.InjectFault("NotAMethod", mock.Fault{}) }, "InjectFault should panic on unknown methods")
+}
+
+func terminate(_ context.Context, d wsl.Distro) (int, error) {
+	return 0, d.Terminate()
+}
+
+func shutdown(ctx context.Context, _ wsl.Distro) (int, error) {
+	return 0, wsl.Shutdown(ctx)
+}
+
+func setAsDefault(_ context.Context, d wsl.Distro) (int, error) {
+	return 0, d.SetAsDefault()
+}
+
+func configure(_ context.Context, d wsl.Distro) (int, error) {
+	return 0, d.DefaultUID(0)
+}
+
+func listDistros(ctx context.Context, _ wsl.Distro) (int, error) {
+	_, err := wsl.RegisteredDistros(ctx)
+	return 0, err
+}
+
+func launch(ctx context.Context, d wsl.Distro) (int, error) {
+	err := d.Command(ctx, "exit 0").Run()
+	var target *exec.ExitError
+	if errors.As(err, &target) {
+		return target.ExitCode(), nil
+	}
+	return 0, err
+}
+
+func TestMockFixture(t *testing.T) {
+	t.Parallel()
+
+	const fixture = `
+defaultDistro: Debian
+distros:
+  - name: Ubuntu
+    guid: "{0b8e1a6c-2f4d-4e3a-9b7c-5d6e7f8a9b0c}"
+    defaultUID: 1000
+    flags: 5
+    running: true
+    environment:
+      LANG: C.UTF-8
+    files:
+      /etc/hostname: ubuntu
+      /etc/wsl.conf:
+        content: "[boot]\nsystemd=true\n"
+        mode: "0600"
+      /etc/os-release:
+        symlink: ../usr/lib/os-release
+      /usr/lib/os-release: "NAME=Ubuntu\n"
+      /home/ubuntu:
+        dir: true
+  - name: Debian
+`
+
+	fsys := fstest.MapFS{
+		"fixture.yaml": {Data: []byte(fixture)},
+		"fixture.json": {Data: []byte(`{"distros": [{"name": "Ubuntu", "defaultUID": 1000}]}`)},
+
+		"bad-syntax.yaml":         {Data: []byte("distros: [")},
+		"bad-name.yaml":           {Data: []byte("distros: [{name: 'Not valid!'}]")},
+		"bad-guid.yaml":           {Data: []byte("distros: [{name: Ubuntu, guid: not-a-guid}]")},
+		"bad-mode.yaml":           {Data: []byte("distros: [{name: Ubuntu, files: {/etc/hostname: {mode: rw-r--r--}}}]")},
+		"duplicate-distro.yaml":   {Data: []byte("distros: [{name: Ubuntu}, {name: Ubuntu}]")},
+		"missing-default.yaml":    {Data: []byte("defaultDistro: Debian\ndistros: [{name: Ubuntu}]")},
+		"duplicate-guid.yaml":     {Data: []byte("distros: [{name: Ubuntu, guid: 0b8e1a6c-2f4d-4e3a-9b7c-5d6e7f8a9b0c}, {name: Debian, guid: 0b8e1a6c-2f4d-4e3a-9b7c-5d6e7f8a9b0c}]")},
+		"file-inside-a-file.yaml": {Data: []byte("distros: [{name: Ubuntu, files: {/etc: file, /etc/hostname: ubuntu}}]")},
+	}
+
+	t.Run("Load YAML", func(t *testing.T) {
+		t.Parallel()
+
+		m, err := mock.NewFromFixtureFS(fsys, "fixture.yaml")
+		require.NoError(t, err, "NewFromFixtureFS should not fail")
+		ctx := wsl.WithMock(context.Background(), m)
+
+		def, err := wsl.DefaultDistro(ctx)
+		require.NoError(t, err, "DefaultDistro should not fail")
+		require.Equal(t, "Debian", def.Name(), "Unexpected default distro")
+
+		d := wsl.NewDistro(ctx, "Ubuntu")
+		guid, err := d.GUID()
+		require.NoError(t, err, "GUID should not fail")
+		require.Equal(t, "0b8e1a6c-2f4d-4e3a-9b7c-5d6e7f8a9b0c", guid.String(), "Unexpected GUID")
+
+		conf, err := d.GetConfiguration()
+		require.NoError(t, err, "GetConfiguration should not fail")
+		require.Equal(t, uint32(1000), conf.DefaultUID, "Unexpected default UID")
+		require.True(t, conf.InteropEnabled, "Unexpected interop flag")
+		require.False(t, conf.PathAppended, "Unexpected path appended flag")
+		require.True(t, conf.DriveMountingEnabled, "Unexpected drive mounting flag")
+		require.Equal(t, map[string]string{"LANG": "C.UTF-8"}, conf.DefaultEnvironmentVariables, "Unexpected environment")
+
+		s, err := d.State()
+		require.NoError(t, err, "State should not fail")
+		require.Equal(t, wsl.Running, s, "Distro should be running")
+
+		got, err := m.ReadFile("Ubuntu", "/etc/os-release")
+		require.NoError(t, err, "ReadFile should not fail")
+		require.Equal(t, "NAME=Ubuntu\n", string(got), "Unexpected file contents")
+
+		files, err := m.DistroFS("Ubuntu")
+		require.NoError(t, err, "DistroFS should not fail")
+		require.Equal(t, fs.FileMode(0600), files["etc/wsl.conf"].Mode, "Unexpected file mode")
+		require.True(t, files["home/ubuntu"].Mode.IsDir(), "Directory should have been created")
+
+		other := wsl.NewDistro(ctx, "Debian")
+		conf, err = other.GetConfiguration()
+		require.NoError(t, err, "GetConfiguration should not fail")
+		require.Zero(t, conf.DefaultUID, "Omitted fields should take the default values")
+		require.True(t, conf.PathAppended, "Omitted fields should take the default values")
+
+		err = d.Terminate()
+		require.NoError(t, err, "Terminate should not fail")
+		s, err = d.State()
+		require.NoError(t, err, "State should not fail")
+		require.Equal(t, wsl.Stopped, s, "Running distros should stop when terminated")
+	})
+
+	t.Run("Load JSON", func(t *testing.T) {
+		t.Parallel()
+
+		m, err := mock.NewFromFixtureFS(fsys, "fixture.json")
+		require.NoError(t, err, "NewFromFixtureFS should not fail")
+		ctx := wsl.WithMock(context.Background(), m)
+
+		def, err := wsl.DefaultDistro(ctx)
+		require.NoError(t, err, "DefaultDistro should not fail")
+		require.Equal(t, "Ubuntu", def.Name(), "The first distro should be the default one")
+
+		conf, err := def.GetConfiguration()
+		require.NoError(t, err, "GetConfiguration should not fail")
+		require.Equal(t, uint32(1000), conf.DefaultUID, "Unexpected default UID")
+	})
+
+	t.Run("Load from path", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "fixture.yaml")
+		err := os.WriteFile(path, []byte(fixture), 0600)
+		require.NoError(t, err, "Setup: could not write fixture")
+
+		_, err = mock.NewFromFixture(path)
+		require.NoError(t, err, "NewFromFixture should not fail")
+
+		_, err = mock.NewFromFixture(filepath.Join(t.TempDir(), "missing.yaml"))
+		require.Error(t, err, "NewFromFixture should fail with missing files")
+	})
+
+	t.Run("Snapshot round-trip", func(t *testing.T) {
+		t.Parallel()
+
+		m, err := mock.NewFromFixtureFS(fsys, "fixture.yaml")
+		require.NoError(t, err, "Setup: NewFromFixtureFS should not fail")
+		ctx := wsl.WithMock(context.Background(), m)
+
+		d := newTestDistro(t, ctx, emptyRootFs)
+		err = m.WriteFile(d.Name(), "/etc/hostname", []byte("test"), 0644)
+		require.NoError(t, err, "Setup: WriteFile should not fail")
+
+		snapshot, err := m.Snapshot()
+		require.NoError(t, err, "Snapshot should not fail")
+		require.Contains(t, string(snapshot), "/etc/hostname: ubuntu", "Regular files should be written as plain strings")
+		require.Contains(t, string(snapshot), "symlink: ../usr/lib/os-release", "Symlinks should be in the snapshot")
+		require.NotContains(t, string(snapshot), "/etc:\n", "Directories with contents should not be in the snapshot")
+
+		reloaded, err := mock.NewFromFixtureFS(fstest.MapFS{"snapshot.yaml": {Data: snapshot}}, "snapshot.yaml")
+		require.NoError(t, err, "The snapshot should be a valid fixture")
+
+		again, err := reloaded.Snapshot()
+		require.NoError(t, err, "Snapshot should not fail")
+		require.Equal(t, string(snapshot), string(again), "Snapshots should be equal after a round-trip")
+	})
+
+	for _, name := range []string{"bad-syntax", "bad-name", "bad-guid", "bad-mode", "duplicate-distro", "missing-default", "duplicate-guid", "file-inside-a-file"} {
+		name := name
+		t.Run("Error with "+name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := mock.NewFromFixtureFS(fsys, name+".yaml")
+			require.Error(t, err, "NewFromFixtureFS should fail")
+		})
+	}
+}
+
+func TestMockIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		idleTimeout time.Duration
+
+		advance     []time.Duration
+		wantRunning []bool
+	}{
+		"Distro stops after being idle":          {idleTimeout: time.Minute, advance: []time.Duration{59 * time.Second, time.Second}, wantRunning: []bool{true, false}},
+		"Distro is never stopped with timeout 0": {idleTimeout: 0, advance: []time.Duration{time.Hour}, wantRunning: []bool{true}},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			clock := mock.NewFakeClock(time.Now())
+			m := mock.New(mock.WithClock(clock), mock.WithIdleTimeout(tc.idleTimeout))
+			ctx := wsl.WithMock(context.Background(), m)
+			d := newTestDistro(t, ctx, emptyRootFs)
+
+			err := d.Shell(wsl.WithCommand("exit 0"))
+			require.NoError(t, err, "Setup: Shell should not fail")
+
+			for i := range tc.advance {
+				clock.Advance(tc.advance[i])
+
+				s, err := d.State()
+				require.NoError(t, err, "State should not fail")
+				if tc.wantRunning[i] {
+					require.Equal(t, wsl.Running, s, "Distro should be running after step %d", i)
+				} else {
+					require.Equal(t, wsl.Stopped, s, "Distro should have stopped after step %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestMockIdleTimeoutRestarts(t *testing.T) {
+	t.Parallel()
+
+	clock := mock.NewFakeClock(time.Now())
+	m := mock.New(mock.WithClock(clock), mock.WithIdleTimeout(10*time.Second))
+	ctx := wsl.WithMock(context.Background(), m)
+	d := newTestDistro(t, ctx, emptyRootFs)
+
+	err := d.Shell(wsl.WithCommand("exit 0"))
+	require.NoError(t, err, "Setup: Shell should not fail")
+	require.Equal(t, 1, clock.PendingTimers(), "The idle timer should have started")
+
+	clock.Advance(8 * time.Second)
+	err = d.Shell(wsl.WithCommand("exit 0"))
+	require.NoError(t, err, "Setup: Shell should not fail")
+	require.Equal(t, 1, clock.PendingTimers(), "Activity should restart the idle timer")
+
+	clock.Advance(8 * time.Second)
+	s, err := d.State()
+	require.NoError(t, err, "State should not fail")
+	require.Equal(t, wsl.Running, s, "Distro should still be running after activity")
+
+	err = d.Terminate()
+	require.NoError(t, err, "Terminate should not fail")
+	require.Zero(t, clock.PendingTimers(), "Terminate should stop the idle timer")
+}
+
+func TestMockOperationStates(t *testing.T) {
+	t.Parallel()
+
+	clock := mock.NewFakeClock(time.Now())
+	m := mock.New(mock.WithClock(clock), mock.WithOperationDurations(mock.OperationDurations{
+		Register:   time.Minute,
+		Unregister: time.Minute,
+		Export:     time.Minute,
+		Convert:    time.Minute,
+	}))
+	ctx := wsl.WithMock(context.Background(), m)
+	d := wsl.NewDistro(ctx, uniqueDistroName(t))
+
+	// inProgress runs the operation in the background, and returns once its
+	// timer has started. The returned channel yields its error.
+	inProgress := func(op func() error) <-chan error {
+		t.Helper()
+
+		ch := make(chan error, 1)
+		go func() { ch <- op() }()
+		require.Eventually(t, func() bool { return clock.PendingTimers() == 1 },
+			5*time.Second, time.Millisecond, "Setup: operation should have started")
+		return ch
+	}
+
+	requireState := func(want wsl.State, msg string) {
+		t.Helper()
+
+		s, err := d.State()
+		require.NoError(t, err, "State should not fail")
+		require.Equal(t, want, s, msg)
+	}
+
+	// Registration
+	ch := inProgress(func() error { return d.Register(emptyRootFs) })
+	requireState(wsl.Installing, "Distro should be installing during registration")
+	require.Error(t, d.Terminate(), "Terminate should fail during registration")
+	require.Error(t, d.Register(emptyRootFs), "Register should fail during registration")
+
+	clock.Advance(time.Minute)
+	require.NoError(t, <-ch, "Register should not fail")
+	requireState(wsl.Stopped, "Distro should be stopped after registration")
+
+	err := m.WriteFile(d.Name(), "/etc/hostname", []byte("mocked"), 0644)
+	require.NoError(t, err, "Setup: WriteFile should not fail")
+
+	// Export
+	tarball := filepath.Join(t.TempDir(), "export.tar.gz")
+	ch = inProgress(func() error { return m.Export(d.Name(), tarball) })
+	requireState(wsl.Stopped, "Exporting should not change the state")
+	require.ErrorIs(t, m.SetVersion(d.Name(), 1), mock.ErrDistroBusy, "SetVersion should fail during export")
+	require.Error(t, d.DefaultUID(1000), "Configuring the distro should fail during export")
+
+	clock.Advance(time.Minute)
+	require.NoError(t, <-ch, "Export should not fail")
+
+	// Conversion
+	ch = inProgress(func() error { return m.SetVersion(d.Name(), 1) })
+	require.ErrorIs(t, m.Export(d.Name(), tarball), mock.ErrDistroBusy, "Export should fail during conversion")
+
+	clock.Advance(time.Minute)
+	require.NoError(t, <-ch, "SetVersion should not fail")
+
+	// Unregistration
+	ch = inProgress(func() error { return d.Unregister() })
+	requireState(wsl.Uninstalling, "Distro should be uninstalling during unregistration")
+	require.Error(t, d.Command(ctx, "exit 0").Run(), "Commands should fail during unregistration")
+
+	clock.Advance(time.Minute)
+	require.NoError(t, <-ch, "Unregister should not fail")
+	requireState(wsl.NonRegistered, "Distro should not be registered after unregistration")
+
+	// Import
+	err = m.Import(d.Name(), tarball, 2)
+	require.NoError(t, err, "Import should not fail")
+
+	got, err := m.ReadFile(d.Name(), "/etc/hostname")
+	require.NoError(t, err, "ReadFile should not fail after importing")
+	require.Equal(t, "mocked", string(got), "Import should restore the exported filesystem")
+
+	require.Error(t, m.Import(d.Name()+"-other", tarball, 3), "Import should fail with invalid versions")
+}
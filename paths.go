@@ -0,0 +1,66 @@
+package gowsl
+
+// This file contains utilities to translate paths between Windows and the distro.
+
+import (
+	"context"
+
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/paths"
+)
+
+// WindowsPath translates a path inside the distro into a Windows path, taking
+// into account the automount root in the distro's wsl.conf. Equivalent to:
+//
+//	wslpath -w <linuxPath>
+//
+// See paths.Translator for the details.
+func (d *Distro) WindowsPath(ctx context.Context, linuxPath string) (winPath string, err error) {
+	defer decorate.OnError(&err, "could not translate %q into a Windows path for distro %s", linuxPath, d.name)
+
+	t, err := d.PathTranslator(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return t.ToWindows(linuxPath)
+}
+
+// LinuxPath translates a Windows path into a path inside the distro, taking
+// into account the automount root in the distro's wsl.conf. Equivalent to:
+//
+//	wslpath -u <winPath>
+//
+// See paths.Translator for the details.
+func (d *Distro) LinuxPath(ctx context.Context, winPath string) (linuxPath string, err error) {
+	defer decorate.OnError(&err, "could not translate %q into a Linux path for distro %s", winPath, d.name)
+
+	t, err := d.PathTranslator(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return t.ToLinux(winPath)
+}
+
+// PathTranslator returns a translator configured for this distro. The
+// distro's wsl.conf is read once, so it is cheaper to use the translator
+// than WindowsPath and LinuxPath when translating many paths.
+func (d *Distro) PathTranslator(ctx context.Context) (t paths.Translator, err error) {
+	defer decorate.OnError(&err, "could not create path translator for distro %s", d.name)
+
+	f, err := d.WSLConf(ctx)
+	if err != nil {
+		return t, err
+	}
+
+	conf, err := f.Config()
+	if err != nil {
+		return t, err
+	}
+
+	return paths.Translator{
+		Distro:        d.name,
+		AutomountRoot: conf.AutomountRoot,
+	}, nil
+}
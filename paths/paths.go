@@ -0,0 +1,159 @@
+// Package paths translates paths between Windows and a WSL distro without
+// spawning wslpath, so it can be used (and tested) on any platform.
+//
+// It follows the semantics of `wslpath -u`, `wslpath -w` and `wslpath -m`,
+// except that paths are translated lexically: they are not required to exist,
+// and relative paths are kept relative.
+package paths
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Prefixes for the UNC paths under which Windows exposes the filesystem of
+// WSL distros.
+const (
+	UNCPrefix       = `\\wsl.localhost` // Used by Windows 11 and recent WSL releases
+	LegacyUNCPrefix = `\\wsl$`          // Used by older releases, and still accepted by all of them
+)
+
+// DefaultAutomountRoot is the directory where Windows drives are mounted when
+// wsl.conf does not specify one.
+const DefaultAutomountRoot = "/mnt/"
+
+// Translator translates paths for a particular distro.
+type Translator struct {
+	// Distro is the name of the distro, used to build and recognise UNC paths.
+	Distro string
+
+	// AutomountRoot is the directory where Windows drives are mounted, as
+	// found in the distro's wsl.conf. Defaults to DefaultAutomountRoot.
+	AutomountRoot string
+
+	// UNCPrefix is the prefix used when translating Linux paths outside of the
+	// automount root into Windows paths. Defaults to UNCPrefix. Both UNCPrefix
+	// and LegacyUNCPrefix are always recognised when translating to Linux.
+	UNCPrefix string
+}
+
+// ToLinux translates a Windows path into a Linux path inside the distro.
+// Equivalent to:
+//
+//	wslpath -u <winPath>
+//
+// Drive paths are translated into paths under the automount root, and UNC
+// paths of this distro into absolute Linux paths. Both back and forward slashes
+// are accepted as separators. UNC paths to other distros or network shares are
+// an error.
+func (t Translator) ToLinux(winPath string) (string, error) {
+	if winPath == "" {
+		return "", errors.New("empty path")
+	}
+
+	p := strings.ReplaceAll(winPath, `\`, "/")
+
+	// Drive path: C:, C:\ or C:\Users
+	if len(p) >= 2 && isDriveLetter(p[0]) && p[1] == ':' {
+		rest := p[2:]
+		if rest != "" && rest[0] != '/' {
+			return "", fmt.Errorf("%q: drive-relative paths are not supported", winPath)
+		}
+		return path.Join(t.automountRoot(), strings.ToLower(p[:1]), rest), nil
+	}
+
+	// UNC path: \\wsl.localhost\Distro\home
+	if strings.HasPrefix(p, "//") {
+		host, rest, _ := strings.Cut(p[2:], "/")
+		distro, rest, _ := strings.Cut(rest, "/")
+
+		switch {
+		case !strings.EqualFold(`\\`+host, UNCPrefix) && !strings.EqualFold(`\\`+host, LegacyUNCPrefix):
+			return "", fmt.Errorf("%q: network paths are not supported", winPath)
+		case distro == "":
+			return "", fmt.Errorf("%q: missing distro name", winPath)
+		case !strings.EqualFold(distro, t.Distro):
+			return "", fmt.Errorf("%q: path belongs to distro %q, not %q", winPath, distro, t.Distro)
+		}
+
+		return path.Join("/", rest), nil
+	}
+
+	if p[0] == '/' {
+		return "", fmt.Errorf("%q: paths relative to the current drive are not supported", winPath)
+	}
+
+	// Relative path
+	return p, nil
+}
+
+// ToWindows translates a Linux path inside the distro into a Windows path.
+// Equivalent to:
+//
+//	wslpath -w <linuxPath>
+//
+// Paths under the automount root are translated into drive paths, and other
+// absolute paths into UNC paths. Relative paths only have their separators
+// replaced.
+func (t Translator) ToWindows(linuxPath string) (string, error) {
+	p, err := t.ToMixed(linuxPath)
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(p, "/", `\`), nil
+}
+
+// ToMixed translates a Linux path inside the distro into a Windows path with
+// forward slashes. Equivalent to:
+//
+//	wslpath -m <linuxPath>
+func (t Translator) ToMixed(linuxPath string) (string, error) {
+	if linuxPath == "" {
+		return "", errors.New("empty path")
+	}
+
+	// Relative path
+	if linuxPath[0] != '/' {
+		return linuxPath, nil
+	}
+
+	p := path.Clean(linuxPath)
+
+	// Drive path: /mnt/c or /mnt/c/Users
+	if rest, ok := strings.CutPrefix(p, t.automountRoot()); ok {
+		drive, rest, _ := strings.Cut(rest, "/")
+		if len(drive) == 1 && isDriveLetter(drive[0]) {
+			return strings.ToUpper(drive) + ":/" + rest, nil
+		}
+	}
+
+	if t.Distro == "" {
+		return "", fmt.Errorf("%q: cannot build a UNC path without a distro name", linuxPath)
+	}
+
+	prefix := t.UNCPrefix
+	if prefix == "" {
+		prefix = UNCPrefix
+	}
+
+	return strings.ReplaceAll(prefix, `\`, "/") + "/" + t.Distro + p, nil
+}
+
+// automountRoot returns the cleaned automount root, with a trailing slash.
+func (t Translator) automountRoot() string {
+	if t.AutomountRoot == "" {
+		return DefaultAutomountRoot
+	}
+
+	root := path.Clean("/" + t.AutomountRoot)
+	if root == "/" {
+		return root
+	}
+	return root + "/"
+}
+
+func isDriveLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
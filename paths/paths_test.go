@@ -0,0 +1,134 @@
+package paths_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/paths"
+)
+
+func TestToLinux(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		path          string
+		automountRoot string
+
+		want    string
+		wantErr bool
+	}{
+		"Drive path":                            {path: `C:\Users\x\repo`, want: "/mnt/c/Users/x/repo"},
+		"Drive path with forward slashes":       {path: `D:/data/file.txt`, want: "/mnt/d/data/file.txt"},
+		"Drive path with lowercase letter":      {path: `c:\Windows`, want: "/mnt/c/Windows"},
+		"Drive path with trailing separator":    {path: `C:\Users\`, want: "/mnt/c/Users"},
+		"Drive root":                            {path: `C:\`, want: "/mnt/c"},
+		"Drive without separator":               {path: `C:`, want: "/mnt/c"},
+		"Drive path with custom automountRoot":  {path: `C:\Users`, automountRoot: "/windir/", want: "/windir/c/Users"},
+		"Drive path with automountRoot /":       {path: `C:\Users`, automountRoot: "/", want: "/c/Users"},
+		"Drive path with unclean automountRoot": {path: `C:\Users`, automountRoot: "/win//dir", want: "/win/dir/c/Users"},
+		"UNC path":                              {path: `\\wsl.localhost\Ubuntu\home\x`, want: "/home/x"},
+		"Legacy UNC path":                       {path: `\\wsl$\Ubuntu\home\x`, want: "/home/x"},
+		"UNC path with different casing":        {path: `\\WSL.LOCALHOST\ubuntu\etc`, want: "/etc"},
+		"UNC path to distro root":               {path: `\\wsl.localhost\Ubuntu`, want: "/"},
+		"Relative path":                         {path: `repo\src\main.go`, want: "repo/src/main.go"},
+
+		// Error cases
+		"Error on empty path":               {path: "", wantErr: true},
+		"Error on drive-relative path":      {path: `C:Users`, wantErr: true},
+		"Error on current-drive path":       {path: `\Users\x`, wantErr: true},
+		"Error on network share":            {path: `\\server\share\file`, wantErr: true},
+		"Error on UNC path without distro":  {path: `\\wsl.localhost\`, wantErr: true},
+		"Error on UNC path to other distro": {path: `\\wsl.localhost\Debian\home`, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tr := paths.Translator{Distro: "Ubuntu", AutomountRoot: tc.automountRoot}
+
+			got, err := tr.ToLinux(tc.path)
+			if tc.wantErr {
+				require.Error(t, err, "ToLinux should have failed")
+				return
+			}
+			require.NoError(t, err, "ToLinux should not have failed")
+			require.Equal(t, tc.want, got, "Unexpected Linux path")
+		})
+	}
+}
+
+func TestToWindows(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		path          string
+		automountRoot string
+		uncPrefix     string
+		noDistro      bool
+
+		wantWindows string
+		wantMixed   string
+		wantErr     bool
+	}{
+		"Drive path":                         {path: "/mnt/c/Users/x/repo", wantWindows: `C:\Users\x\repo`, wantMixed: "C:/Users/x/repo"},
+		"Drive root":                         {path: "/mnt/c", wantWindows: `C:\`, wantMixed: "C:/"},
+		"Drive root with trailing slash":     {path: "/mnt/d/", wantWindows: `D:\`, wantMixed: "D:/"},
+		"Unclean drive path":                 {path: "/mnt//c/./Users/../Windows", wantWindows: `C:\Windows`, wantMixed: "C:/Windows"},
+		"Drive path with custom automount":   {path: "/windir/c/Users", automountRoot: "/windir", wantWindows: `C:\Users`, wantMixed: "C:/Users"},
+		"Drive path with automountRoot /":    {path: "/c/Users", automountRoot: "/", wantWindows: `C:\Users`, wantMixed: "C:/Users"},
+		"Linux path":                         {path: "/home/x", wantWindows: `\\wsl.localhost\Ubuntu\home\x`, wantMixed: "//wsl.localhost/Ubuntu/home/x"},
+		"Linux root":                         {path: "/", wantWindows: `\\wsl.localhost\Ubuntu\`, wantMixed: "//wsl.localhost/Ubuntu/"},
+		"Linux path with legacy UNC prefix":  {path: "/etc", uncPrefix: paths.LegacyUNCPrefix, wantWindows: `\\wsl$\Ubuntu\etc`, wantMixed: "//wsl$/Ubuntu/etc"},
+		"Old automount root is a Linux path": {path: "/mnt/c/Users", automountRoot: "/windir/", wantWindows: `\\wsl.localhost\Ubuntu\mnt\c\Users`, wantMixed: "//wsl.localhost/Ubuntu/mnt/c/Users"},
+		"Mount point that is not a drive":    {path: "/mnt/wsl", wantWindows: `\\wsl.localhost\Ubuntu\mnt\wsl`, wantMixed: "//wsl.localhost/Ubuntu/mnt/wsl"},
+		"Relative path":                      {path: "repo/src", wantWindows: `repo\src`, wantMixed: "repo/src"},
+		"Drive path without distro":          {path: "/mnt/c/Users", noDistro: true, wantWindows: `C:\Users`, wantMixed: "C:/Users"},
+
+		// Error cases
+		"Error on empty path":                  {path: "", wantErr: true},
+		"Error on Linux path without a distro": {path: "/home/x", noDistro: true, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tr := paths.Translator{Distro: "Ubuntu", AutomountRoot: tc.automountRoot, UNCPrefix: tc.uncPrefix}
+			if tc.noDistro {
+				tr.Distro = ""
+			}
+
+			got, err := tr.ToWindows(tc.path)
+			if tc.wantErr {
+				require.Error(t, err, "ToWindows should have failed")
+				_, err = tr.ToMixed(tc.path)
+				require.Error(t, err, "ToMixed should have failed")
+				return
+			}
+			require.NoError(t, err, "ToWindows should not have failed")
+			require.Equal(t, tc.wantWindows, got, "Unexpected Windows path")
+
+			got, err = tr.ToMixed(tc.path)
+			require.NoError(t, err, "ToMixed should not have failed")
+			require.Equal(t, tc.wantMixed, got, "Unexpected mixed path")
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tr := paths.Translator{Distro: "Ubuntu"}
+
+	for _, p := range []string{`C:\Users\x\repo`, `\\wsl.localhost\Ubuntu\home\x`} {
+		linux, err := tr.ToLinux(p)
+		require.NoError(t, err, "ToLinux should not have failed")
+
+		got, err := tr.ToWindows(linux)
+		require.NoError(t, err, "ToWindows should not have failed")
+		require.Equal(t, p, got, "Translating back and forth should return the original path")
+	}
+}
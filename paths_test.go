@@ -0,0 +1,49 @@
+package gowsl_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/mock"
+	"github.com/ubuntu/gowsl/wslconf"
+)
+
+func TestPathTranslation(t *testing.T) {
+	ctx := context.Background()
+	if wsl.MockAvailable() {
+		t.Parallel()
+		ctx = wsl.WithMock(ctx, mock.New())
+	}
+
+	d := newTestDistro(t, ctx, rootFs)
+
+	err := d.Command(ctx, "mkdir -p /etc").Run()
+	require.NoError(t, err, "Setup: could not create /etc")
+
+	got, err := d.LinuxPath(ctx, `C:\Users`)
+	require.NoError(t, err, "LinuxPath should not fail")
+	require.Equal(t, "/mnt/c/Users", got, "Unexpected Linux path")
+
+	got, err = d.WindowsPath(ctx, "/home")
+	require.NoError(t, err, "WindowsPath should not fail")
+	require.Equal(t, `\\wsl.localhost\`+d.Name()+`\home`, got, "Unexpected Windows path")
+
+	conf, err := wslconf.Parse(strings.NewReader("[automount]\nroot=/windir/"))
+	require.NoError(t, err, "Setup: Parse should not fail")
+	err = d.SetWSLConf(ctx, conf)
+	require.NoError(t, err, "Setup: SetWSLConf should not fail")
+
+	got, err = d.LinuxPath(ctx, `C:\Users`)
+	require.NoError(t, err, "LinuxPath should not fail")
+	require.Equal(t, "/windir/c/Users", got, "LinuxPath should use the automount root from wsl.conf")
+
+	got, err = d.WindowsPath(ctx, "/windir/c/Users")
+	require.NoError(t, err, "WindowsPath should not fail")
+	require.Equal(t, `C:\Users`, got, "WindowsPath should use the automount root from wsl.conf")
+
+	_, err = d.LinuxPath(ctx, `\\wsl.localhost\`+d.Name()+`-other\home`)
+	require.Error(t, err, "LinuxPath should fail with a path to another distro")
+}
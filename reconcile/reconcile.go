@@ -0,0 +1,465 @@
+// Package reconcile converges the distros of a machine to a declarative spec.
+//
+// A Spec describes the distros that must be registered and how they must be
+// configured. Plan compares it with the current state of the machine and returns
+// the steps that would converge them, without changing anything. Apply executes
+// those steps and reports what it did:
+//
+//	plan, err := reconcile.Plan(ctx, spec)
+//	...
+//	report, err := reconcile.Apply(ctx, spec)
+//
+// Both use the back-end of the context (see gowsl.WithBackend), so they can be
+// tried against the mock back-end. Applying is idempotent: once a spec has been
+// applied, its plan is empty.
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ubuntu/decorate"
+	wsl "github.com/ubuntu/gowsl"
+)
+
+// provisionedDir is the directory inside the distros where the provisioning
+// commands that succeeded are recorded.
+const provisionedDir = "/var/lib/gowsl/provisioned"
+
+// ErrConflict is returned by Apply when the machine disagrees with the spec in a
+// way that GoWSL cannot change. See Conflict.
+var ErrConflict = errors.New("the machine conflicts with the spec")
+
+// Action is the kind of a Step.
+type Action string
+
+// The actions that converge a machine to a spec, in the order they are taken for
+// each distro. The default distro is set once all distros have converged.
+const (
+	ActionRegister     Action = "register"
+	ActionWriteWSLConf Action = "write-wsl.conf"
+	ActionProvision    Action = "provision"
+	ActionConfigure    Action = "configure"
+	ActionSetDefault   Action = "set-default"
+)
+
+// Step is a change to the machine.
+type Step struct {
+	Action      Action `json:"action" yaml:"action"`
+	Distro      string `json:"distro" yaml:"distro"`
+	Description string `json:"description" yaml:"description"`
+}
+
+func (s Step) String() string {
+	return fmt.Sprintf("%s %s: %s", s.Action, s.Distro, s.Description)
+}
+
+// Conflict is a setting of a distro that disagrees with the spec, and that GoWSL
+// cannot change: the WSL version and the default environment variables.
+type Conflict struct {
+	Distro  string `json:"distro" yaml:"distro"`
+	Setting string `json:"setting" yaml:"setting"`
+	Want    string `json:"want" yaml:"want"`
+	Got     string `json:"got" yaml:"got"`
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s: %s is %s, but the spec wants %s", c.Distro, c.Setting, c.Got, c.Want)
+}
+
+// Changes are what Apply would do to converge the machine to a spec.
+type Changes struct {
+	Steps     []Step     `json:"steps" yaml:"steps"`
+	Conflicts []Conflict `json:"conflicts,omitempty" yaml:"conflicts,omitempty"`
+}
+
+// Report is what Apply did to converge the machine to a spec.
+type Report struct {
+	Steps     []Step     `json:"steps" yaml:"steps"`                             // Steps that were applied, in order
+	Failed    *Step      `json:"failed,omitempty" yaml:"failed,omitempty"`       // Step that failed, if any
+	Conflicts []Conflict `json:"conflicts,omitempty" yaml:"conflicts,omitempty"` // Conflicts that prevented applying the spec
+}
+
+// Plan returns the steps that converge the machine to the spec, without changing
+// it. The steps of distros that are not registered yet cannot be compared with
+// their configuration, so all their settings are planned.
+func Plan(ctx context.Context, spec Spec) (plan Changes, err error) {
+	defer decorate.OnError(&err, "could not plan spec")
+
+	if err := spec.Validate(); err != nil {
+		return plan, err
+	}
+
+	r := reconciler{ctx: ctx, dryRun: true}
+	if err := r.reconcile(spec); err != nil {
+		return plan, err
+	}
+
+	return Changes{Steps: r.steps, Conflicts: r.conflicts}, nil
+}
+
+// Apply converges the machine to the spec. Nothing is changed if there are
+// conflicts, in which case ErrConflict is returned. Otherwise, Apply stops at the
+// first step that fails. Applying the spec again resumes from that step.
+//
+// The distros that Apply registers can only be compared with the spec once they
+// are registered. If one of them conflicts with it, Apply stops there and returns
+// ErrConflict, leaving the distro registered.
+func Apply(ctx context.Context, spec Spec) (report Report, err error) {
+	defer decorate.OnError(&err, "could not apply spec")
+
+	plan, err := Plan(ctx, spec)
+	if err != nil {
+		return report, err
+	}
+	if len(plan.Conflicts) != 0 {
+		return Report{Conflicts: plan.Conflicts}, ErrConflict
+	}
+
+	r := reconciler{ctx: ctx}
+	err = r.reconcile(spec)
+	return Report{Steps: r.steps, Failed: r.failed, Conflicts: r.conflicts}, err
+}
+
+// reconciler converges the machine to a spec, or plans to in dry runs.
+type reconciler struct {
+	ctx    context.Context
+	dryRun bool
+
+	steps     []Step
+	failed    *Step
+	conflicts []Conflict
+}
+
+// do records the step and, unless this is a dry run, applies it.
+func (r *reconciler) do(step Step, apply func() error) error {
+	if !r.dryRun {
+		if err := apply(); err != nil {
+			r.failed = &step
+			return fmt.Errorf("%s: %v", step, err)
+		}
+	}
+
+	r.steps = append(r.steps, step)
+	return nil
+}
+
+func (r *reconciler) reconcile(spec Spec) error {
+	for _, ds := range spec.Distros {
+		if err := r.distro(ds); err != nil {
+			return err
+		}
+	}
+
+	if spec.DefaultDistro == "" {
+		return nil
+	}
+
+	d := wsl.NewDistro(r.ctx, spec.DefaultDistro)
+	registered, err := d.IsRegistered()
+	if err != nil {
+		return err
+	}
+
+	// Distros that are not registered yet are only registered in dry runs
+	if registered {
+		current, err := wsl.DefaultDistro(r.ctx)
+		if err != nil {
+			return err
+		}
+		if current.Name() == d.Name() {
+			return nil
+		}
+	}
+
+	step := Step{Action: ActionSetDefault, Distro: d.Name(), Description: "set as the default distro"}
+	return r.do(step, d.SetAsDefault)
+}
+
+// distro converges a single distro to its spec.
+func (r *reconciler) distro(spec DistroSpec) error {
+	d := wsl.NewDistro(r.ctx, spec.Name)
+
+	registered, err := d.IsRegistered()
+	if err != nil {
+		return err
+	}
+
+	if !registered {
+		if spec.RootFs == "" {
+			return fmt.Errorf("distro %s is not registered, and the spec has no rootfs to register it from", spec.Name)
+		}
+
+		step := Step{Action: ActionRegister, Distro: spec.Name, Description: "register from " + spec.RootFs}
+		if err := r.do(step, func() error { return d.Register(spec.RootFs) }); err != nil {
+			return err
+		}
+	}
+
+	// In dry runs, the distro only exists once it is registered
+	exists := registered || !r.dryRun
+
+	var conf wsl.Configuration
+	if exists {
+		if conf, err = d.GetConfiguration(); err != nil {
+			return err
+		}
+
+		if conflicts := distroConflicts(spec, conf); len(conflicts) != 0 {
+			r.conflicts = append(r.conflicts, conflicts...)
+			// Plans report all the conflicts, but nothing else is applied once
+			// a distro that was just registered conflicts with the spec
+			if !r.dryRun {
+				return ErrConflict
+			}
+			return nil
+		}
+	}
+
+	if err := r.wslConf(&d, spec, exists); err != nil {
+		return err
+	}
+
+	if err := r.provision(&d, spec, exists); err != nil {
+		return err
+	}
+
+	return r.configure(&d, spec, conf, exists)
+}
+
+// distroConflicts returns the settings of the distro that disagree with the spec
+// and cannot be changed.
+func distroConflicts(spec DistroSpec, conf wsl.Configuration) (conflicts []Conflict) {
+	if spec.WSLVersion != 0 && spec.WSLVersion != conf.UndocumentedWSLVersion {
+		conflicts = append(conflicts, Conflict{
+			Distro:  spec.Name,
+			Setting: "wslVersion",
+			Want:    strconv.Itoa(int(spec.WSLVersion)),
+			Got:     strconv.Itoa(int(conf.UndocumentedWSLVersion)),
+		})
+	}
+
+	for _, name := range sortedKeys(spec.Environment) {
+		want := spec.Environment[name]
+		got, ok := conf.DefaultEnvironmentVariables[name]
+		if ok && got == want {
+			continue
+		}
+		if !ok {
+			got = "unset"
+		}
+		conflicts = append(conflicts, Conflict{
+			Distro:  spec.Name,
+			Setting: "environment variable " + name,
+			Want:    strconv.Quote(want),
+			Got:     got,
+		})
+	}
+
+	return conflicts
+}
+
+// wslConf converges the contents of /etc/wsl.conf.
+func (r *reconciler) wslConf(d *wsl.Distro, spec DistroSpec, exists bool) error {
+	if spec.WSLConf == nil {
+		return nil
+	}
+
+	want, err := spec.wslConf()
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		got, err := d.WSLConf(r.ctx)
+		if err != nil {
+			return err
+		}
+		if got.String() == want.String() {
+			return nil
+		}
+	}
+
+	step := Step{Action: ActionWriteWSLConf, Distro: spec.Name, Description: "write /etc/wsl.conf"}
+	return r.do(step, func() error { return d.SetWSLConf(r.ctx, want) })
+}
+
+// provision runs the provisioning commands that have not succeeded yet, as root.
+func (r *reconciler) provision(d *wsl.Distro, spec DistroSpec, exists bool) error {
+	for _, command := range spec.Provision {
+		marker := path.Join(provisionedDir, provisionID(command))
+
+		if exists {
+			done, err := r.provisioned(d, marker)
+			if err != nil {
+				return err
+			}
+			if done {
+				continue
+			}
+		}
+
+		step := Step{Action: ActionProvision, Distro: spec.Name, Description: "run " + strconv.Quote(command)}
+		err := r.do(step, func() error {
+			if err := r.runAsRoot(d, command, ""); err != nil {
+				return err
+			}
+			if err := r.runAsRoot(d, "mkdir -p "+provisionedDir, ""); err != nil {
+				return fmt.Errorf("could not record provisioning: %v", err)
+			}
+			if err := r.runAsRoot(d, "tee "+marker, command+"\n"); err != nil {
+				return fmt.Errorf("could not record provisioning: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// provisionID identifies a provisioning command inside a distro.
+func provisionID(command string) string {
+	sum := sha256.Sum256([]byte(command))
+	return hex.EncodeToString(sum[:])
+}
+
+// provisioned returns true if the marker of a provisioning command exists.
+func (r *reconciler) provisioned(d *wsl.Distro, marker string) (bool, error) {
+	err := d.Command(r.ctx, "ls "+marker).Run()
+	if target := (&exec.ExitError{}); errors.As(err, &target) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// runAsRoot runs a command in the distro as root with the given stdin, and
+// returns an error with its stderr if it fails. The default user may not be able
+// to write the markers, nor to run the commands that are usually found in
+// provisioning.
+func (r *reconciler) runAsRoot(d *wsl.Distro, command, stdin string) error {
+	cmd := d.Command(r.ctx, command)
+	cmd.User = "root"
+	cmd.Stdin = strings.NewReader(stdin)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) != 0 {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// configure converges the default user and the flags of the distro.
+func (r *reconciler) configure(d *wsl.Distro, spec DistroSpec, conf wsl.Configuration, exists bool) error {
+	settings := []struct {
+		name  string
+		want  *bool
+		got   bool
+		apply func(bool) error
+	}{
+		{"interopEnabled", spec.InteropEnabled, conf.InteropEnabled, d.InteropEnabled},
+		{"pathAppended", spec.PathAppended, conf.PathAppended, d.PathAppended},
+		{"driveMountingEnabled", spec.DriveMountingEnabled, conf.DriveMountingEnabled, d.DriveMountingEnabled},
+	}
+
+	for _, s := range settings {
+		if s.want == nil || (exists && *s.want == s.got) {
+			continue
+		}
+
+		want := *s.want
+		step := Step{Action: ActionConfigure, Distro: spec.Name, Description: change(s.name, strconv.FormatBool(s.got), strconv.FormatBool(want), exists)}
+		if err := r.do(step, func() error { return s.apply(want) }); err != nil {
+			return err
+		}
+	}
+
+	uid, user, err := r.defaultUID(d, spec, exists)
+	if err != nil {
+		return err
+	}
+	if uid == nil || (exists && *uid == conf.DefaultUID) {
+		return nil
+	}
+
+	want := strconv.FormatUint(uint64(*uid), 10)
+	if user != "" {
+		want = fmt.Sprintf("%s (UID %d)", user, *uid)
+	}
+
+	step := Step{Action: ActionConfigure, Distro: spec.Name, Description: change("defaultUID", strconv.FormatUint(uint64(conf.DefaultUID), 10), want, exists)}
+	return r.do(step, func() error { return d.DefaultUID(*uid) })
+}
+
+// defaultUID returns the default UID in the spec, resolving the default user if
+// there is one. In dry runs, the user may not exist until the distro is
+// provisioned: then, the UID is unknown, and the user name is returned alone.
+func (r *reconciler) defaultUID(d *wsl.Distro, spec DistroSpec, exists bool) (uid *uint32, user string, err error) {
+	if spec.DefaultUser == "" {
+		return spec.DefaultUID, "", nil
+	}
+
+	if exists {
+		// User names have been validated, so they are safe to pass to the shell.
+		out, err := d.Command(r.ctx, "id -u "+spec.DefaultUser).Output()
+		if err == nil {
+			id, err := strconv.ParseUint(string(bytes.TrimSpace(out)), 10, 32)
+			if err != nil {
+				return nil, "", fmt.Errorf("could not parse UID of user %s: %v", spec.DefaultUser, err)
+			}
+			//nolint:gosec // ParseUint checked that the UID fits in 32 bits.
+			uid := uint32(id)
+			return &uid, spec.DefaultUser, nil
+		}
+		if target := (&exec.ExitError{}); !errors.As(err, &target) {
+			return nil, "", err
+		}
+		if !r.dryRun {
+			return nil, "", fmt.Errorf("distro %s has no user %s", spec.Name, spec.DefaultUser)
+		}
+	}
+
+	// The user is created by the provisioning that was just planned
+	return nil, spec.DefaultUser, r.do(Step{
+		Action:      ActionConfigure,
+		Distro:      spec.Name,
+		Description: fmt.Sprintf("set defaultUID to the UID of user %s", spec.DefaultUser),
+	}, nil)
+}
+
+// change describes the change of a setting. Settings of distros that do not exist
+// yet have no previous value.
+func change(setting, from, to string, exists bool) string {
+	if !exists {
+		return fmt.Sprintf("set %s to %s", setting, to)
+	}
+	return fmt.Sprintf("change %s from %s to %s", setting, from, to)
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,381 @@
+package reconcile_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/mock"
+	"github.com/ubuntu/gowsl/reconcile"
+)
+
+const testFixture = `defaultDistro: Legacy
+distros:
+  - name: Legacy
+    version: 2
+    defaultUID: 0
+    flags: 7 # WSL 1
+    environment:
+      LANG: C
+  - name: Ubuntu
+    version: 2
+    defaultUID: 0
+    flags: 15
+    environment:
+      LANG: C.UTF-8
+    files:
+      /etc:
+        dir: true
+`
+
+func TestPlanAndApply(t *testing.T) {
+	t.Parallel()
+
+	rootFs := filepath.Join(t.TempDir(), "rootfs.tar.gz")
+	require.NoError(t, os.WriteFile(rootFs, nil, 0600), "Setup: could not write rootfs")
+
+	spec := reconcile.Spec{
+		DefaultDistro: "Ubuntu",
+		Distros: []reconcile.DistroSpec{
+			{
+				Name:           "Ubuntu",
+				WSLVersion:     2,
+				DefaultUser:    "ubuntu",
+				InteropEnabled: ptr(false),
+				Environment:    map[string]string{"LANG": "C.UTF-8"},
+				WSLConf:        ptr("[boot]\nsystemd = true\n"),
+				Provision:      []string{"useradd --create-home ubuntu"},
+			},
+			{
+				Name:       "New",
+				RootFs:     rootFs,
+				DefaultUID: ptr(uint32(1000)),
+				Provision:  []string{"exit 0"},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		spec              *reconcile.Spec
+		provisioningFails bool
+
+		wantPlan       []string
+		wantConflicts  []string
+		wantApplyErr   bool
+		wantApplyErrIs error
+		wantApplied    []string
+		wantFailed     string
+	}{
+		"Success converging the machine": {
+			wantPlan: []string{
+				"write-wsl.conf Ubuntu: write /etc/wsl.conf",
+				`provision Ubuntu: run "useradd --create-home ubuntu"`,
+				"configure Ubuntu: change interopEnabled from true to false",
+				"configure Ubuntu: set defaultUID to the UID of user ubuntu",
+				"register New: register from " + rootFs,
+				`provision New: run "exit 0"`,
+				"configure New: set defaultUID to 1000",
+				"set-default Ubuntu: set as the default distro",
+			},
+			wantApplied: []string{
+				"write-wsl.conf Ubuntu: write /etc/wsl.conf",
+				`provision Ubuntu: run "useradd --create-home ubuntu"`,
+				"configure Ubuntu: change interopEnabled from true to false",
+				"configure Ubuntu: change defaultUID from 0 to ubuntu (UID 1000)",
+				"register New: register from " + rootFs,
+				`provision New: run "exit 0"`,
+				"configure New: change defaultUID from 0 to 1000",
+				"set-default Ubuntu: set as the default distro",
+			},
+		},
+		"Success with an empty spec": {spec: &reconcile.Spec{}},
+
+		"Error when the machine conflicts with the spec": {
+			spec: &reconcile.Spec{Distros: []reconcile.DistroSpec{
+				{Name: "Legacy", WSLVersion: 2, Environment: map[string]string{"LANG": "C", "TERM": "xterm"}},
+			}},
+			wantConflicts: []string{
+				"Legacy: wslVersion is 1, but the spec wants 2",
+				`Legacy: environment variable TERM is unset, but the spec wants "xterm"`,
+			},
+			wantApplyErrIs: reconcile.ErrConflict,
+		},
+		"Error when provisioning fails": {
+			provisioningFails: true,
+			wantPlan: []string{
+				"write-wsl.conf Ubuntu: write /etc/wsl.conf",
+				`provision Ubuntu: run "useradd --create-home ubuntu"`,
+				"configure Ubuntu: change interopEnabled from true to false",
+				"configure Ubuntu: set defaultUID to the UID of user ubuntu",
+				"register New: register from " + rootFs,
+				`provision New: run "exit 0"`,
+				"configure New: set defaultUID to 1000",
+				"set-default Ubuntu: set as the default distro",
+			},
+			wantApplyErr: true,
+			wantApplied:  []string{"write-wsl.conf Ubuntu: write /etc/wsl.conf"},
+			wantFailed:   `provision Ubuntu: run "useradd --create-home ubuntu"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m, err := mock.NewFromFixture(writeFixture(t), mock.WithIdleTimeout(0))
+			require.NoError(t, err, "Setup: could not load fixture")
+			ctx := wsl.WithBackend(context.Background(), m)
+
+			// The mock has no users: the provisioning creates one.
+			var userCreated bool
+			m.HandleCommand("useradd --create-home ubuntu", func(context.Context, io.Reader, io.Writer, io.Writer) int {
+				if tc.provisioningFails {
+					return 1
+				}
+				userCreated = true
+				return 0
+			})
+			m.HandleCommand("id -u ubuntu", func(_ context.Context, _ io.Reader, stdout, _ io.Writer) int {
+				if !userCreated {
+					return 1
+				}
+				_, _ = io.WriteString(stdout, "1000\n")
+				return 0
+			})
+
+			s := spec
+			if tc.spec != nil {
+				s = *tc.spec
+			}
+
+			plan, err := reconcile.Plan(ctx, s)
+			require.NoError(t, err, "Plan should not have failed")
+			require.Equal(t, tc.wantPlan, steps(plan.Steps), "Unexpected steps in the plan")
+			require.Equal(t, tc.wantConflicts, conflicts(plan.Conflicts), "Unexpected conflicts in the plan")
+
+			before, err := wsl.Snapshot(ctx)
+			require.NoError(t, err, "Setup: could not take a snapshot")
+
+			report, err := reconcile.Apply(ctx, s)
+			if tc.wantApplyErrIs != nil {
+				require.ErrorIs(t, err, tc.wantApplyErrIs, "Apply should have failed with the expected error")
+			} else if tc.wantApplyErr {
+				require.Error(t, err, "Apply should have failed")
+			} else {
+				require.NoError(t, err, "Apply should not have failed")
+			}
+			require.Equal(t, tc.wantApplied, steps(report.Steps), "Unexpected steps in the report")
+			require.Equal(t, tc.wantConflicts, conflicts(report.Conflicts), "Unexpected conflicts in the report")
+			if tc.wantFailed == "" {
+				require.Nil(t, report.Failed, "No step should have failed")
+			} else {
+				require.NotNil(t, report.Failed, "A step should have failed")
+				require.Equal(t, tc.wantFailed, report.Failed.String(), "Unexpected failed step")
+			}
+
+			if tc.wantApplyErrIs != nil {
+				after, err := wsl.Snapshot(ctx)
+				require.NoError(t, err, "Setup: could not take a snapshot")
+				require.Equal(t, before, after, "Apply should not have changed anything")
+				return
+			}
+			if tc.wantApplyErr {
+				return
+			}
+
+			plan, err = reconcile.Plan(ctx, s)
+			require.NoError(t, err, "Plan should not have failed after applying the spec")
+			require.Empty(t, plan.Steps, "The plan should be empty after applying the spec")
+
+			report, err = reconcile.Apply(ctx, s)
+			require.NoError(t, err, "Apply should not have failed a second time")
+			require.Empty(t, report.Steps, "Applying the spec a second time should have done nothing")
+		})
+	}
+}
+
+func TestApplyResumesAfterFailure(t *testing.T) {
+	t.Parallel()
+
+	m, err := mock.NewFromFixture(writeFixture(t), mock.WithIdleTimeout(0))
+	require.NoError(t, err, "Setup: could not load fixture")
+	ctx := wsl.WithBackend(context.Background(), m)
+
+	var runs int
+	m.HandleCommand("flaky", func(context.Context, io.Reader, io.Writer, io.Writer) int {
+		runs++
+		if runs == 1 {
+			return 1
+		}
+		return 0
+	})
+
+	spec := reconcile.Spec{Distros: []reconcile.DistroSpec{
+		{Name: "Ubuntu", Provision: []string{"exit 0", "flaky"}},
+	}}
+
+	report, err := reconcile.Apply(ctx, spec)
+	require.Error(t, err, "Apply should have failed the first time")
+	require.Equal(t, []string{`provision Ubuntu: run "exit 0"`}, steps(report.Steps), "Unexpected steps in the first report")
+
+	report, err = reconcile.Apply(ctx, spec)
+	require.NoError(t, err, "Apply should not have failed the second time")
+	require.Equal(t, []string{`provision Ubuntu: run "flaky"`}, steps(report.Steps), "Provisioning should have resumed from the command that failed")
+	require.Equal(t, 2, runs, "The command that failed should have been run again")
+}
+
+func TestApplyStopsWhenANewDistroConflicts(t *testing.T) {
+	t.Parallel()
+
+	rootFs := filepath.Join(t.TempDir(), "rootfs.tar.gz")
+	require.NoError(t, os.WriteFile(rootFs, nil, 0600), "Setup: could not write rootfs")
+
+	m, err := mock.NewFromFixture(writeFixture(t), mock.WithIdleTimeout(0))
+	require.NoError(t, err, "Setup: could not load fixture")
+	ctx := wsl.WithBackend(context.Background(), m)
+
+	spec := reconcile.Spec{Distros: []reconcile.DistroSpec{
+		{Name: "New", RootFs: rootFs, Environment: map[string]string{"LANG": "C"}, Provision: []string{"exit 0"}},
+		{Name: "Ubuntu", InteropEnabled: ptr(false)},
+	}}
+
+	plan, err := reconcile.Plan(ctx, spec)
+	require.NoError(t, err, "Setup: Plan should not have failed")
+	require.Empty(t, plan.Conflicts, "Setup: distros that are not registered yet cannot conflict with the spec")
+
+	report, err := reconcile.Apply(ctx, spec)
+	require.ErrorIs(t, err, reconcile.ErrConflict, "Apply should have failed with the conflict of the new distro")
+	require.Equal(t, []string{"register New: register from " + rootFs}, steps(report.Steps), "Apply should have stopped after registering the distro")
+	require.Equal(t, []string{`New: environment variable LANG is en_US.UTF-8, but the spec wants "C"`}, conflicts(report.Conflicts),
+		"Unexpected conflicts in the report")
+	require.Nil(t, report.Failed, "No step should have failed")
+
+	m.AssertNotCalled(t, "WslLaunch")
+	conf, err := wsl.NewDistro(ctx, "Ubuntu").GetConfiguration()
+	require.NoError(t, err, "GetConfiguration should not have failed")
+	require.True(t, conf.InteropEnabled, "The distros after the conflicting one should not have been changed")
+}
+
+func TestApplyProvisionsAsRoot(t *testing.T) {
+	t.Parallel()
+
+	m, err := mock.NewFromFixture(writeFixture(t), mock.WithIdleTimeout(0))
+	require.NoError(t, err, "Setup: could not load fixture")
+	ctx := wsl.WithBackend(context.Background(), m)
+	d := wsl.NewDistro(ctx, "Ubuntu")
+
+	m.HandleCommand("useradd --create-home ubuntu", mock.CannedOutput("", "", 0))
+	m.HandleCommand("id -u ubuntu", mock.CannedOutput("1000\n", "", 0))
+	m.HandleCommand("apt-get install -y cowsay", func(ctx context.Context, _ io.Reader, _, stderr io.Writer) int {
+		if info, _ := mock.CommandInfoFromContext(ctx); info.User != "root" {
+			_, _ = io.WriteString(stderr, "E: are you root?\n")
+			return 100
+		}
+		return 0
+	})
+
+	spec := reconcile.Spec{Distros: []reconcile.DistroSpec{
+		{Name: "Ubuntu", DefaultUser: "ubuntu", Provision: []string{"useradd --create-home ubuntu"}},
+	}}
+
+	_, err = reconcile.Apply(ctx, spec)
+	require.NoError(t, err, "Setup: Apply should not have failed")
+
+	// The distro now has a default user other than root
+	spec.Distros[0].Provision = append(spec.Distros[0].Provision, "apt-get install -y cowsay")
+	m.ResetCalls()
+
+	report, err := reconcile.Apply(ctx, spec)
+	require.NoError(t, err, "Apply should have provisioned the distro as root")
+	require.Equal(t, []string{`provision Ubuntu: run "apt-get install -y cowsay"`}, steps(report.Steps), "Unexpected steps in the report")
+
+	m.AssertNumberOfCalls(t, 0, "WslConfigureDistribution")
+	m.AssertCallOrder(t,
+		mock.Expect("WslLaunchAs", "Ubuntu", "root", "apt-get install -y cowsay", mock.Anything),
+		mock.Expect("WslLaunchAs", "Ubuntu", "root", mock.MatchedBy(func(v any) bool {
+			return strings.HasPrefix(v.(string), "tee /var/lib/gowsl/provisioned/") //nolint:forcetypeassert // The argument is always a string.
+		}), mock.Anything),
+	)
+
+	conf, err := d.GetConfiguration()
+	require.NoError(t, err, "GetConfiguration should not have failed")
+	require.Equal(t, uint32(1000), conf.DefaultUID, "The default user should not have changed")
+}
+
+func TestPlanErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]reconcile.Spec{
+		"Error when the spec is invalid":               {Distros: []reconcile.DistroSpec{{Name: "Ubuntu", WSLVersion: 3}}},
+		"Error when a new distro has no rootfs":        {Distros: []reconcile.DistroSpec{{Name: "New"}}},
+		"Error when the default user cannot be parsed": {Distros: []reconcile.DistroSpec{{Name: "Ubuntu", DefaultUser: "nobody"}}},
+	}
+
+	for name, spec := range testCases {
+		spec := spec
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m, err := mock.NewFromFixture(writeFixture(t), mock.WithIdleTimeout(0))
+			require.NoError(t, err, "Setup: could not load fixture")
+			m.HandleCommand("id -u nobody", mock.CannedOutput("nobody\n", "", 0))
+			ctx := wsl.WithBackend(context.Background(), m)
+
+			_, err = reconcile.Plan(ctx, spec)
+			require.Error(t, err, "Plan should have failed")
+
+			_, err = reconcile.Apply(ctx, spec)
+			require.Error(t, err, "Apply should have failed")
+		})
+	}
+}
+
+func TestApplyErrorWhenDefaultUserDoesNotExist(t *testing.T) {
+	t.Parallel()
+
+	m, err := mock.NewFromFixture(writeFixture(t), mock.WithIdleTimeout(0))
+	require.NoError(t, err, "Setup: could not load fixture")
+	m.HandleCommand("id -u ubuntu", mock.CannedOutput("", "id: 'ubuntu': no such user\n", 1))
+	ctx := wsl.WithBackend(context.Background(), m)
+
+	spec := reconcile.Spec{Distros: []reconcile.DistroSpec{{Name: "Ubuntu", DefaultUser: "ubuntu"}}}
+
+	plan, err := reconcile.Plan(ctx, spec)
+	require.NoError(t, err, "Plan should not have failed")
+	require.Equal(t, []string{"configure Ubuntu: set defaultUID to the UID of user ubuntu"}, steps(plan.Steps), "Unexpected steps in the plan")
+
+	_, err = reconcile.Apply(ctx, spec)
+	require.Error(t, err, "Apply should have failed")
+}
+
+func writeFixture(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "fixture.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testFixture), 0600), "Setup: could not write fixture")
+	return path
+}
+
+func steps(s []reconcile.Step) (out []string) {
+	for _, step := range s {
+		out = append(out, step.String())
+	}
+	return out
+}
+
+func conflicts(c []reconcile.Conflict) (out []string) {
+	for _, conflict := range c {
+		out = append(out, conflict.String())
+	}
+	return out
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
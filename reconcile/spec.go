@@ -0,0 +1,154 @@
+package reconcile
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/wslconf"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the desired state of the distros of a machine. It is written in YAML
+// or JSON:
+//
+//	defaultDistro: Ubuntu
+//	distros:
+//	  - name: Ubuntu
+//	    rootfs: C:\images\ubuntu.tar.gz
+//	    wslVersion: 2
+//	    defaultUser: ubuntu
+//	    interopEnabled: true
+//	    environment:
+//	      LANG: C.UTF-8
+//	    wslConf: |
+//	      [boot]
+//	      systemd=true
+//	    provision:
+//	      - useradd --create-home ubuntu
+//
+// Omitted settings are left as they are. Distros that are not in the spec are
+// left untouched.
+type Spec struct {
+	DefaultDistro string       `json:"defaultDistro,omitempty" yaml:"defaultDistro,omitempty"`
+	Distros       []DistroSpec `json:"distros" yaml:"distros"`
+}
+
+// DistroSpec is the desired state of a distro.
+type DistroSpec struct {
+	// Name of the distro.
+	Name string `json:"name" yaml:"name"`
+
+	// RootFs is the tarball the distro is registered from if it is not registered.
+	RootFs string `json:"rootfs,omitempty" yaml:"rootfs,omitempty"`
+
+	// WSLVersion is the version of WSL the distro must run on: 1 or 2. WSL registers
+	// distros with its default version and GoWSL cannot convert them, so it is only
+	// checked.
+	WSLVersion uint8 `json:"wslVersion,omitempty" yaml:"wslVersion,omitempty"`
+
+	// DefaultUID is the user that WSL logs in as. Use either this or DefaultUser.
+	DefaultUID *uint32 `json:"defaultUID,omitempty" yaml:"defaultUID,omitempty"`
+	// DefaultUser is the name of the user that WSL logs in as. It is resolved inside
+	// the distro after provisioning, so the provisioning commands can create it.
+	DefaultUser string `json:"defaultUser,omitempty" yaml:"defaultUser,omitempty"`
+
+	InteropEnabled       *bool `json:"interopEnabled,omitempty" yaml:"interopEnabled,omitempty"`
+	PathAppended         *bool `json:"pathAppended,omitempty" yaml:"pathAppended,omitempty"`
+	DriveMountingEnabled *bool `json:"driveMountingEnabled,omitempty" yaml:"driveMountingEnabled,omitempty"`
+
+	// Environment contains variables that must be among the default environment
+	// variables of the distro. WSL sets them when registering the distro and they
+	// cannot be changed, so they are only checked.
+	Environment map[string]string `json:"environment,omitempty" yaml:"environment,omitempty"`
+
+	// WSLConf is the contents of /etc/wsl.conf. Changes take effect the next time
+	// the distro starts.
+	WSLConf *string `json:"wslConf,omitempty" yaml:"wslConf,omitempty"`
+
+	// Provision are commands that are run once in the distro, in order, as root
+	// (see gowsl.Cmd.User). Each command is run until it succeeds once, which
+	// is recorded inside the distro.
+	Provision []string `json:"provision,omitempty" yaml:"provision,omitempty"`
+}
+
+// ParseSpec reads a spec written in YAML or JSON, and validates it.
+func ParseSpec(data []byte) (spec Spec, err error) {
+	defer decorate.OnError(&err, "could not parse spec")
+
+	// JSON is valid YAML, so a single decoder deals with both
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return spec, err
+	}
+
+	return spec, spec.Validate()
+}
+
+// Validate checks that the spec is consistent. It does not check it against the
+// state of the machine: use Plan for that.
+func (s Spec) Validate() (err error) {
+	defer decorate.OnError(&err, "invalid spec")
+
+	names := make(map[string]bool)
+	for _, d := range s.Distros {
+		if err := d.validate(); err != nil {
+			return err
+		}
+		if names[strings.ToLower(d.Name)] {
+			return fmt.Errorf("distro %s is in the spec more than once", d.Name)
+		}
+		names[strings.ToLower(d.Name)] = true
+	}
+
+	return nil
+}
+
+func (d DistroSpec) validate() (err error) {
+	if d.Name == "" {
+		return errors.New("distro has no name")
+	}
+
+	defer decorate.OnError(&err, "distro %s", d.Name)
+
+	if d.WSLVersion > 2 {
+		return fmt.Errorf("unknown WSL version %d", d.WSLVersion)
+	}
+
+	if d.DefaultUID != nil && d.DefaultUser != "" {
+		return errors.New("defaultUID and defaultUser cannot be used together")
+	}
+
+	if d.DefaultUser != "" {
+		// The user name is passed to the shell: it must be a valid one
+		if err := (wslconf.Config{DefaultUser: d.DefaultUser}).Validate(); err != nil {
+			return err
+		}
+	}
+
+	if d.WSLConf != nil {
+		if _, err := d.wslConf(); err != nil {
+			return err
+		}
+	}
+
+	for _, cmd := range d.Provision {
+		if strings.TrimSpace(cmd) == "" {
+			return errors.New("provisioning command is empty")
+		}
+	}
+
+	return nil
+}
+
+// wslConf parses and validates the contents of wsl.conf in the spec.
+func (d DistroSpec) wslConf() (*wslconf.File, error) {
+	f, err := wslconf.Parse(strings.NewReader(*d.WSLConf))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
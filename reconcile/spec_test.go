@@ -0,0 +1,81 @@
+package reconcile_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/reconcile"
+)
+
+func TestParseSpec(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+
+		want    reconcile.Spec
+		wantErr bool
+	}{
+		"Success with YAML": {
+			input: `defaultDistro: Ubuntu
+distros:
+  - name: Ubuntu
+    rootfs: ubuntu.tar.gz
+    wslVersion: 2
+    defaultUID: 1000
+    interopEnabled: false
+    environment:
+      LANG: C.UTF-8
+    wslConf: |
+      [boot]
+      systemd=true
+    provision:
+      - apt-get update
+`,
+			want: reconcile.Spec{
+				DefaultDistro: "Ubuntu",
+				Distros: []reconcile.DistroSpec{{
+					Name:           "Ubuntu",
+					RootFs:         "ubuntu.tar.gz",
+					WSLVersion:     2,
+					DefaultUID:     ptr(uint32(1000)),
+					InteropEnabled: ptr(false),
+					Environment:    map[string]string{"LANG": "C.UTF-8"},
+					WSLConf:        ptr("[boot]\nsystemd=true\n"),
+					Provision:      []string{"apt-get update"},
+				}},
+			},
+		},
+		"Success with JSON": {
+			input: `{"distros": [{"name": "Ubuntu", "defaultUser": "ubuntu", "pathAppended": true}]}`,
+			want: reconcile.Spec{Distros: []reconcile.DistroSpec{
+				{Name: "Ubuntu", DefaultUser: "ubuntu", PathAppended: ptr(true)},
+			}},
+		},
+		"Success with no distros": {input: `defaultDistro: Ubuntu`, want: reconcile.Spec{DefaultDistro: "Ubuntu"}},
+
+		"Error with invalid YAML":                  {input: `distros: {`, wantErr: true},
+		"Error with a distro with no name":         {input: `distros: [{rootfs: ubuntu.tar.gz}]`, wantErr: true},
+		"Error with a repeated distro":             {input: `distros: [{name: Ubuntu}, {name: ubuntu}]`, wantErr: true},
+		"Error with an unknown WSL version":        {input: `distros: [{name: Ubuntu, wslVersion: 3}]`, wantErr: true},
+		"Error with both a default UID and user":   {input: `distros: [{name: Ubuntu, defaultUID: 1000, defaultUser: ubuntu}]`, wantErr: true},
+		"Error with an invalid default user":       {input: `distros: [{name: Ubuntu, defaultUser: "ubuntu; rm -rf /"}]`, wantErr: true},
+		"Error with an invalid wsl.conf":           {input: `distros: [{name: Ubuntu, wslConf: "[boot]\nsystemd=maybe\n"}]`, wantErr: true},
+		"Error with an empty provisioning command": {input: `distros: [{name: Ubuntu, provision: ["  "]}]`, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := reconcile.ParseSpec([]byte(tc.input))
+			if tc.wantErr {
+				require.Error(t, err, "ParseSpec should have failed")
+				return
+			}
+			require.NoError(t, err, "ParseSpec should not have failed")
+			require.Equal(t, tc.want, got, "Unexpected spec")
+		})
+	}
+}
@@ -12,7 +12,17 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/ubuntu/decorate"
-	"github.com/ubuntu/gowsl/internal/backend"
+	"github.com/ubuntu/gowsl/backend"
+)
+
+var (
+	// ErrNotRegistered is returned when an operation requires a registered distro
+	// but the distro is not registered.
+	ErrNotRegistered = errors.New("distro is not registered")
+
+	// ErrAlreadyRegistered is returned when registering a distro that is
+	// registered already.
+	ErrAlreadyRegistered = errors.New("already registered")
 )
 
 // Register is a wrapper around Win32's WslRegisterDistribution.
@@ -31,10 +41,12 @@ func (d *Distro) Register(rootFsPath string) (err error) {
 		return err
 	}
 	if r {
-		return errors.New("already registered")
+		return ErrAlreadyRegistered
 	}
 
-	return d.backend.WslRegisterDistribution(d.Name(), rootFsPath)
+	return d.audited("Register", nil, func() error {
+		return d.backend.WslRegisterDistribution(d.Name(), rootFsPath)
+	})
 }
 
 // RegisteredDistros returns a slice of the registered distros.
@@ -89,7 +101,7 @@ func registeredDistros(backend backend.Backend) (distros map[string]uuid.UUID, e
 func (d Distro) IsRegistered() (registered bool, err error) {
 	r, err := d.isRegistered()
 	if err != nil {
-		return false, fmt.Errorf("%s: %v", d.name, err)
+		return false, fmt.Errorf("%s: %w", d.name, err)
 	}
 	return r, nil
 }
@@ -117,10 +129,12 @@ func (d *Distro) Unregister() (err error) {
 		return err
 	}
 	if !r {
-		return errors.New("distro is not registered")
+		return ErrNotRegistered
 	}
 
-	return d.backend.WslUnregisterDistribution(d.Name())
+	return d.audited("Unregister", nil, func() error {
+		return d.backend.WslUnregisterDistribution(d.Name())
+	})
 }
 
 // fixPath deals with the fact that WslRegisterDistribuion is
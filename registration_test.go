@@ -67,7 +67,7 @@ func TestRegister(t *testing.T) {
 			cancel()
 			t.Log("Registration completed")
 
-			require.Error(t, err, "Unexpected success in registering distro that was already registered.")
+			require.ErrorIs(t, err, wsl.ErrAlreadyRegistered, "Unexpected success in registering distro that was already registered.")
 		})
 	}
 }
@@ -155,9 +155,10 @@ func TestUnregister(t *testing.T) {
 	testCases := map[string]struct {
 		distro    *wsl.Distro
 		wantError bool
+		wantErrIs error
 	}{
 		"happy path":        {distro: &realDistro},
-		"not registered":    {distro: &fakeDistro, wantError: true},
+		"not registered":    {distro: &fakeDistro, wantError: true, wantErrIs: wsl.ErrNotRegistered},
 		"null char in name": {distro: &wrongDistro, wantError: true},
 	}
 
@@ -174,6 +175,9 @@ func TestUnregister(t *testing.T) {
 
 			if tc.wantError {
 				require.Errorf(t, err, "Unexpected success in unregistering distro %q.", d.Name())
+				if tc.wantErrIs != nil {
+					require.ErrorIs(t, err, tc.wantErrIs, "Unexpected error in unregistering distro %q.", d.Name())
+				}
 			} else {
 				require.NoError(t, err, "Unexpected failure in unregistering distro %q.", d.Name())
 			}
@@ -85,7 +85,7 @@ func (d *Distro) Shell(args ...ShellOption) (err error) {
 		return err
 	}
 	if !r {
-		return fmt.Errorf("distro %q is not registered", d.Name())
+		return ErrNotRegistered
 	}
 
 	options := shellOptions{
@@ -0,0 +1,225 @@
+package gowsl
+
+// This file contains the serialization of distros and their configuration, and
+// the inventory of all the distros.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/internal/flags"
+	"gopkg.in/yaml.v3"
+)
+
+// Inventory is the state of all the distros at a point in time, as returned by
+// Snapshot. It can be serialized into JSON and YAML, and deserialized back.
+type Inventory struct {
+	DefaultDistro string           `json:"defaultDistro,omitempty" yaml:"defaultDistro,omitempty"`
+	Distros       []DistroSnapshot `json:"distros" yaml:"distros"`
+}
+
+// DistroSnapshot is the state of a registered distro at a point in time. It is
+// what a Distro is serialized into.
+type DistroSnapshot struct {
+	Name          string        `json:"name" yaml:"name"`
+	GUID          uuid.UUID     `json:"guid" yaml:"guid"`
+	State         State         `json:"state" yaml:"state"`
+	Configuration Configuration `json:"configuration" yaml:"configuration"`
+}
+
+// Snapshot returns the inventory of the registered distros, sorted by name.
+func Snapshot(ctx context.Context) (inv Inventory, err error) {
+	defer decorate.OnError(&err, "could not take a snapshot of the distros")
+
+	distros, err := RegisteredDistros(ctx)
+	if err != nil {
+		return inv, err
+	}
+
+	// There is no default distro when there are no distros at all
+	if len(distros) != 0 {
+		d, err := DefaultDistro(ctx)
+		if err != nil {
+			return inv, err
+		}
+		inv.DefaultDistro = d.Name()
+	}
+
+	inv.Distros = make([]DistroSnapshot, 0, len(distros))
+	for _, d := range distros {
+		s, err := d.snapshot()
+		if err != nil {
+			return inv, err
+		}
+		inv.Distros = append(inv.Distros, s)
+	}
+	sort.Slice(inv.Distros, func(i, j int) bool { return inv.Distros[i].Name < inv.Distros[j].Name })
+
+	return inv, nil
+}
+
+// snapshot returns the current state of a registered distro.
+func (d Distro) snapshot() (s DistroSnapshot, err error) {
+	s.Name = d.Name()
+
+	if s.GUID, err = d.GUID(); err != nil {
+		return s, err
+	}
+	if s.State, err = d.State(); err != nil {
+		return s, err
+	}
+	if s.Configuration, err = d.GetConfiguration(); err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// notRegisteredDistro is what a distro that is not registered is serialized into.
+type notRegisteredDistro struct {
+	Name  string `json:"name" yaml:"name"`
+	State State  `json:"state" yaml:"state"`
+}
+
+// serialized returns what the distro is serialized into: its snapshot if it is
+// registered, or just its name and state otherwise.
+func (d Distro) serialized() (v any, err error) {
+	defer decorate.OnError(&err, "could not serialize distro %q", d.name)
+
+	registered, err := d.isRegistered()
+	if err != nil {
+		return nil, err
+	}
+	if !registered {
+		return notRegisteredDistro{Name: d.Name(), State: NonRegistered}, nil
+	}
+
+	return d.snapshot()
+}
+
+// MarshalJSON implements json.Marshaler. A registered distro is serialized into
+// its DistroSnapshot, and one that is not registered into its name and state.
+func (d Distro) MarshalJSON() ([]byte, error) {
+	v, err := d.serialized()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// MarshalYAML implements yaml.Marshaler. See MarshalJSON for the format.
+func (d Distro) MarshalYAML() (any, error) {
+	return d.serialized()
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Only the name of the distro is read:
+// its GUID, state and configuration are queried when they are needed, like with
+// NewDistro. The distro keeps its back-end and audit hook if it has them, so
+// that the ones of a context can be used by deserializing into
+// NewDistro(ctx, ""). Otherwise, it uses the default back-end.
+func (d *Distro) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return d.setName(v.Name)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler. See UnmarshalJSON for the details.
+func (d *Distro) UnmarshalYAML(value *yaml.Node) error {
+	var v struct {
+		Name string `yaml:"name"`
+	}
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	return d.setName(v.Name)
+}
+
+// setName sets the name of a deserialized distro.
+func (d *Distro) setName(name string) error {
+	if name == "" {
+		return errors.New("distro has no name")
+	}
+
+	d.name = name
+	if d.backend == nil {
+		d.backend = DefaultBackend()
+	}
+
+	return nil
+}
+
+// serializedConfiguration is what a Configuration is serialized into.
+type serializedConfiguration struct {
+	Version              uint8             `json:"version" yaml:"version"`
+	DefaultUID           uint32            `json:"defaultUID" yaml:"defaultUID"`
+	InteropEnabled       bool              `json:"interopEnabled" yaml:"interopEnabled"`
+	PathAppended         bool              `json:"pathAppended" yaml:"pathAppended"`
+	DriveMountingEnabled bool              `json:"driveMountingEnabled" yaml:"driveMountingEnabled"`
+	WSLVersion           uint8             `json:"wslVersion" yaml:"wslVersion"`
+	Environment          map[string]string `json:"environment" yaml:"environment"`
+}
+
+func (conf Configuration) serialized() serializedConfiguration {
+	return serializedConfiguration{
+		Version:              conf.Version,
+		DefaultUID:           conf.DefaultUID,
+		InteropEnabled:       conf.InteropEnabled,
+		PathAppended:         conf.PathAppended,
+		DriveMountingEnabled: conf.DriveMountingEnabled,
+		WSLVersion:           conf.UndocumentedWSLVersion,
+		Environment:          conf.DefaultEnvironmentVariables,
+	}
+}
+
+func (s serializedConfiguration) configuration() Configuration {
+	return Configuration{
+		Version:    s.Version,
+		DefaultUID: s.DefaultUID,
+		Unpacked: flags.Unpacked{
+			InteropEnabled:         s.InteropEnabled,
+			PathAppended:           s.PathAppended,
+			DriveMountingEnabled:   s.DriveMountingEnabled,
+			UndocumentedWSLVersion: s.WSLVersion,
+		},
+		DefaultEnvironmentVariables: s.Environment,
+	}
+}
+
+// MarshalJSON implements json.Marshaler. The flags are serialized along with the
+// rest of the configuration, and the environment variables as "environment".
+func (conf Configuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(conf.serialized())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (conf *Configuration) UnmarshalJSON(data []byte) error {
+	var s serializedConfiguration
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*conf = s.configuration()
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler. See MarshalJSON for the format.
+func (conf Configuration) MarshalYAML() (any, error) {
+	return conf.serialized(), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (conf *Configuration) UnmarshalYAML(value *yaml.Node) error {
+	var s serializedConfiguration
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	*conf = s.configuration()
+	return nil
+}
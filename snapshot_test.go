@@ -0,0 +1,201 @@
+package gowsl_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/mock"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDistroSerialization(t *testing.T) {
+	ctx := context.Background()
+	if wsl.MockAvailable() {
+		t.Parallel()
+		ctx = wsl.WithMock(ctx, mock.New())
+	}
+
+	realDistro := newTestDistro(t, ctx, emptyRootFs)
+	fakeDistro := wsl.NewDistro(ctx, uniqueDistroName(t))
+	require.NoError(t, realDistro.Terminate(), "Setup: could not terminate the test distro")
+
+	guid, err := realDistro.GUID()
+	require.NoError(t, err, "Setup: could not get the GUID of the test distro")
+	conf, err := realDistro.GetConfiguration()
+	require.NoError(t, err, "Setup: could not get the configuration of the test distro")
+
+	testCases := map[string]struct {
+		distro *wsl.Distro
+
+		want wsl.DistroSnapshot
+	}{
+		"Registered distro":     {distro: &realDistro, want: wsl.DistroSnapshot{Name: realDistro.Name(), GUID: guid, State: wsl.Stopped, Configuration: conf}},
+		"Non-registered distro": {distro: &fakeDistro, want: wsl.DistroSnapshot{Name: fakeDistro.Name(), State: wsl.NonRegistered}},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			d := *tc.distro
+
+			outJSON, err := json.Marshal(d)
+			require.NoError(t, err, "MarshalJSON should not have failed")
+
+			var got wsl.DistroSnapshot
+			require.NoError(t, json.Unmarshal(outJSON, &got), "The JSON should be a snapshot of the distro")
+			require.Equal(t, tc.want, got, "Unexpected distro in the JSON")
+
+			outYAML, err := yaml.Marshal(d)
+			require.NoError(t, err, "MarshalYAML should not have failed")
+
+			got = wsl.DistroSnapshot{}
+			require.NoError(t, yaml.Unmarshal(outYAML, &got), "The YAML should be a snapshot of the distro")
+			require.Equal(t, tc.want, got, "Unexpected distro in the YAML")
+
+			// Deserialized distros keep the back-end they were created with
+			fromJSON := wsl.NewDistro(ctx, "")
+			require.NoError(t, json.Unmarshal(outJSON, &fromJSON), "UnmarshalJSON should not have failed")
+			require.Equal(t, d.Name(), fromJSON.Name(), "Unexpected name of the distro deserialized from JSON")
+			require.Equal(t, d.String(), fromJSON.String(), "The distro deserialized from JSON should be the same distro")
+
+			fromYAML := wsl.NewDistro(ctx, "")
+			require.NoError(t, yaml.Unmarshal(outYAML, &fromYAML), "UnmarshalYAML should not have failed")
+			require.Equal(t, d.String(), fromYAML.String(), "The distro deserialized from YAML should be the same distro")
+		})
+	}
+}
+
+func TestDistroDeserializationErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]string{
+		"Error with no name":   `{"state": "Running"}`,
+		"Error with no object": `"Ubuntu"`,
+	}
+
+	for name, input := range testCases {
+		input := input
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var d wsl.Distro
+			require.Error(t, json.Unmarshal([]byte(input), &d), "UnmarshalJSON should have failed")
+			require.Error(t, yaml.Unmarshal([]byte(input), &d), "UnmarshalYAML should have failed")
+		})
+	}
+}
+
+func TestConfigurationSerialization(t *testing.T) {
+	t.Parallel()
+
+	conf := wsl.Configuration{
+		Version:                     2,
+		DefaultUID:                  1000,
+		DefaultEnvironmentVariables: map[string]string{"LANG": "C.UTF-8"},
+	}
+	conf.InteropEnabled = true
+	conf.DriveMountingEnabled = true
+	conf.UndocumentedWSLVersion = 2
+
+	out, err := json.Marshal(conf)
+	require.NoError(t, err, "MarshalJSON should not have failed")
+	require.JSONEq(t, `{
+		"version": 2,
+		"defaultUID": 1000,
+		"interopEnabled": true,
+		"pathAppended": false,
+		"driveMountingEnabled": true,
+		"wslVersion": 2,
+		"environment": {"LANG": "C.UTF-8"}
+	}`, string(out), "Unexpected JSON")
+
+	var fromJSON wsl.Configuration
+	require.NoError(t, json.Unmarshal(out, &fromJSON), "UnmarshalJSON should not have failed")
+	require.Equal(t, conf, fromJSON, "The configuration should have round-tripped through JSON")
+
+	out, err = yaml.Marshal(conf)
+	require.NoError(t, err, "MarshalYAML should not have failed")
+	require.Equal(t, `version: 2
+defaultUID: 1000
+interopEnabled: true
+pathAppended: false
+driveMountingEnabled: true
+wslVersion: 2
+environment:
+    LANG: C.UTF-8
+`, string(out), "Unexpected YAML")
+
+	var fromYAML wsl.Configuration
+	require.NoError(t, yaml.Unmarshal(out, &fromYAML), "UnmarshalYAML should not have failed")
+	require.Equal(t, conf, fromYAML, "The configuration should have round-tripped through YAML")
+
+	require.Error(t, json.Unmarshal([]byte(`{"defaultUID": "root"}`), &fromJSON), "UnmarshalJSON should have failed with the wrong type")
+	require.Error(t, yaml.Unmarshal([]byte(`defaultUID: root`), &fromYAML), "UnmarshalYAML should have failed with the wrong type")
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	if wsl.MockAvailable() {
+		t.Parallel()
+		ctx = wsl.WithMock(ctx, mock.New())
+	}
+
+	d := newTestDistro(t, ctx, emptyRootFs)
+	require.NoError(t, d.DefaultUID(0), "Setup: could not set the default UID of the test distro")
+	require.NoError(t, d.Terminate(), "Setup: could not terminate the test distro")
+
+	inv, err := wsl.Snapshot(ctx)
+	require.NoError(t, err, "Snapshot should not have failed")
+	require.NotEmpty(t, inv.DefaultDistro, "There should be a default distro")
+
+	var found bool
+	for i, s := range inv.Distros {
+		if i > 0 {
+			require.Less(t, inv.Distros[i-1].Name, s.Name, "Distros should be sorted by name")
+		}
+		if s.Name != d.Name() {
+			continue
+		}
+		found = true
+
+		guid, err := d.GUID()
+		require.NoError(t, err, "GUID should not have failed")
+		require.Equal(t, guid, s.GUID, "Unexpected GUID in the snapshot")
+		require.Equal(t, wsl.Stopped, s.State, "Unexpected state in the snapshot")
+		require.Equal(t, uint32(0), s.Configuration.DefaultUID, "Unexpected configuration in the snapshot")
+	}
+	require.True(t, found, "The test distro should be in the snapshot")
+
+	for name, format := range map[string]struct {
+		marshal   func(any) ([]byte, error)
+		unmarshal func([]byte, any) error
+	}{
+		"JSON": {marshal: json.Marshal, unmarshal: json.Unmarshal},
+		"YAML": {marshal: yaml.Marshal, unmarshal: yaml.Unmarshal},
+	} {
+		out, err := format.marshal(inv)
+		require.NoError(t, err, "Marshalling the inventory into %s should not have failed", name)
+
+		var got wsl.Inventory
+		require.NoError(t, format.unmarshal(out, &got), "Unmarshalling the inventory from %s should not have failed", name)
+		require.Equal(t, inv, got, "The inventory should have round-tripped through %s", name)
+	}
+}
+
+func TestSnapshotWithNoDistros(t *testing.T) {
+	if !wsl.MockAvailable() {
+		t.Skip("Skipping test because only the mock back-end can have no distros")
+	}
+	t.Parallel()
+
+	inv, err := wsl.Snapshot(wsl.WithMock(context.Background(), mock.New()))
+	require.NoError(t, err, "Snapshot should not have failed")
+	require.Equal(t, wsl.Inventory{Distros: []wsl.DistroSnapshot{}}, inv, "The inventory should be empty")
+
+	out, err := json.Marshal(inv)
+	require.NoError(t, err, "MarshalJSON should not have failed")
+	require.JSONEq(t, `{"distros": []}`, string(out), "Unexpected JSON")
+}
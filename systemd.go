@@ -0,0 +1,254 @@
+package gowsl
+
+// This file contains utilities to enable systemd inside a distro and manage its services.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/ubuntu/decorate"
+)
+
+// ErrSystemdNotPID1 is returned when an operation requires systemd but the
+// distro was not booted with it. Use EnableSystemd to fix this.
+var ErrSystemdNotPID1 = errors.New("systemd is not PID 1 (see EnableSystemd)")
+
+// SystemdState is the overall state of systemd as reported by
+// `systemctl is-system-running`.
+type SystemdState string
+
+// These are the states reported by `systemctl is-system-running`.
+const (
+	SystemdInitializing SystemdState = "initializing" // Early boot, before basic.target is reached
+	SystemdStarting     SystemdState = "starting"     // Late boot, before the job queue first becomes idle
+	SystemdRunning      SystemdState = "running"      // Fully operational
+	SystemdDegraded     SystemdState = "degraded"     // Operational, but one or more units failed
+	SystemdMaintenance  SystemdState = "maintenance"  // The rescue or emergency target is active
+	SystemdStopping     SystemdState = "stopping"     // The system is shutting down
+)
+
+// EnableSystemd sets `systemd=true` in the distro's wsl.conf and, if systemd
+// is not PID 1 yet, terminates the distro so that it boots with systemd the next
+// time it starts. It then starts the distro and waits until systemd has finished
+// booting.
+//
+// A distro where some units failed to start (SystemdDegraded) is not considered
+// an error. Any other state after booting is.
+func (d *Distro) EnableSystemd(ctx context.Context) (err error) {
+	defer decorate.OnError(&err, "could not enable systemd in distro %s", d.name)
+
+	f, err := d.WSLConf(ctx)
+	if err != nil {
+		return err
+	}
+
+	conf, err := f.Config()
+	if err != nil {
+		return err
+	}
+
+	if conf.Systemd == nil || !*conf.Systemd {
+		enabled := true
+		conf.Systemd = &enabled
+		if err := f.SetConfig(conf); err != nil {
+			return err
+		}
+		if err := d.SetWSLConf(ctx, f); err != nil {
+			return err
+		}
+	}
+
+	if err := d.checkSystemd(ctx); errors.Is(err, ErrSystemdNotPID1) {
+		if err := d.Terminate(); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	// Starts the distro again (if it was terminated) and blocks until boot is finished.
+	out, err := d.Command(ctx, "systemctl is-system-running --wait").Output()
+	if target := (&exec.ExitError{}); err != nil && !errors.As(err, &target) {
+		return err
+	}
+
+	switch s := SystemdState(bytes.TrimSpace(out)); s {
+	case SystemdRunning, SystemdDegraded:
+		return nil
+	default:
+		return fmt.Errorf("systemd is %s after booting", s)
+	}
+}
+
+// SystemdStatus returns the state of systemd inside the distro, starting the
+// distro if it is not running. If systemd is not PID 1, the error wraps
+// ErrSystemdNotPID1.
+func (d *Distro) SystemdStatus(ctx context.Context) (s SystemdState, err error) {
+	defer decorate.OnError(&err, "could not get systemd status in distro %s", d.name)
+
+	if err := d.checkSystemd(ctx); err != nil {
+		return s, err
+	}
+
+	// is-system-running exits with non-zero status for any state other than
+	// running, so only errors launching the command are taken into account.
+	out, err := d.Command(ctx, "systemctl is-system-running").Output()
+	if target := (&exec.ExitError{}); err != nil && !errors.As(err, &target) {
+		return s, err
+	}
+
+	return SystemdState(bytes.TrimSpace(out)), nil
+}
+
+// Service is a systemd unit inside a distro. Its methods fail with an error
+// wrapping ErrSystemdNotPID1 if the distro was not booted with systemd.
+//
+// The methods that change the unit run systemctl as root.
+type Service struct {
+	distro *Distro
+	unit   string
+}
+
+// ServiceStatus is the state of a systemd unit, as reported by `systemctl show`.
+type ServiceStatus struct {
+	LoadState     string // Whether the unit file was found and loaded (loaded, not-found, masked, ...)
+	ActiveState   string // High-level activation state (active, inactive, failed, activating, ...)
+	SubState      string // Unit-type-specific activation state (running, exited, dead, ...)
+	UnitFileState string // Whether the unit is enabled (enabled, disabled, static, ...)
+}
+
+// Service returns the systemd unit with the given name. The unit is not
+// checked for existence: use Status for that.
+func (d *Distro) Service(unit string) Service {
+	return Service{distro: d, unit: unit}
+}
+
+// Name returns the name of the unit.
+func (s Service) Name() string {
+	return s.unit
+}
+
+// Start starts the unit and waits until it is active. Equivalent to:
+//
+//	systemctl start <unit>
+func (s Service) Start(ctx context.Context) (err error) {
+	defer decorate.OnError(&err, "could not start service %s in distro %s", s.unit, s.distro.name)
+	return s.systemctl(ctx, "start")
+}
+
+// Stop stops the unit. Equivalent to:
+//
+//	systemctl stop <unit>
+func (s Service) Stop(ctx context.Context) (err error) {
+	defer decorate.OnError(&err, "could not stop service %s in distro %s", s.unit, s.distro.name)
+	return s.systemctl(ctx, "stop")
+}
+
+// Enable enables the unit so that it starts when the distro boots. It does
+// not start the unit. Equivalent to:
+//
+//	systemctl enable <unit>
+func (s Service) Enable(ctx context.Context) (err error) {
+	defer decorate.OnError(&err, "could not enable service %s in distro %s", s.unit, s.distro.name)
+	return s.systemctl(ctx, "enable")
+}
+
+// Disable disables the unit so that it does not start when the distro boots.
+// It does not stop the unit. Equivalent to:
+//
+//	systemctl disable <unit>
+func (s Service) Disable(ctx context.Context) (err error) {
+	defer decorate.OnError(&err, "could not disable service %s in distro %s", s.unit, s.distro.name)
+	return s.systemctl(ctx, "disable")
+}
+
+// Status returns the state of the unit. Units that do not exist are not an
+// error: they are reported with LoadState "not-found".
+func (s Service) Status(ctx context.Context) (status ServiceStatus, err error) {
+	defer decorate.OnError(&err, "could not get status of service %s in distro %s", s.unit, s.distro.name)
+
+	if err := validUnitName(s.unit); err != nil {
+		return status, err
+	}
+
+	if err := s.distro.checkSystemd(ctx); err != nil {
+		return status, err
+	}
+
+	cmd := fmt.Sprintf("systemctl show --property=LoadState,ActiveState,SubState,UnitFileState -- '%s'", s.unit)
+	out, err := s.distro.Command(ctx, cmd).Output()
+	if target := (&exec.ExitError{}); errors.As(err, &target) {
+		return status, fmt.Errorf("%v: %s", err, bytes.TrimSpace(target.Stderr))
+	} else if err != nil {
+		return status, err
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		key, value, _ := strings.Cut(sc.Text(), "=")
+		switch key {
+		case "LoadState":
+			status.LoadState = value
+		case "ActiveState":
+			status.ActiveState = value
+		case "SubState":
+			status.SubState = value
+		case "UnitFileState":
+			status.UnitFileState = value
+		}
+	}
+
+	return status, sc.Err()
+}
+
+// systemctl runs `systemctl <verb> <unit>` as root.
+func (s Service) systemctl(ctx context.Context, verb string) error {
+	if err := validUnitName(s.unit); err != nil {
+		return err
+	}
+
+	if err := s.distro.checkSystemd(ctx); err != nil {
+		return err
+	}
+
+	cmd := s.distro.Command(ctx, fmt.Sprintf("systemctl %s -- '%s'", verb, s.unit))
+	cmd.User = "root"
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// checkSystemd returns an error wrapping ErrSystemdNotPID1 if the distro was
+// not booted with systemd.
+func (d *Distro) checkSystemd(ctx context.Context) error {
+	out, err := d.Command(ctx, "cat /proc/1/comm").Output()
+	if err != nil {
+		return fmt.Errorf("could not find out the name of PID 1: %v", err)
+	}
+
+	if comm := string(bytes.TrimSpace(out)); comm != "systemd" {
+		return fmt.Errorf("%w: PID 1 is %q", ErrSystemdNotPID1, comm)
+	}
+
+	return nil
+}
+
+// Unit names are passed to the shell in single quotes, so they are restricted to
+// the characters allowed by systemd.unit(5), including escape sequences.
+var unitNameRegex = regexp.MustCompile(`^[A-Za-z0-9:_.@\\-]+$`)
+
+func validUnitName(unit string) error {
+	if !unitNameRegex.MatchString(unit) || strings.HasPrefix(unit, "-") {
+		return fmt.Errorf("%q is not a valid unit name", unit)
+	}
+	return nil
+}
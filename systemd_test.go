@@ -0,0 +1,226 @@
+package gowsl_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/mock"
+	"github.com/ubuntu/gowsl/wslconf"
+)
+
+func TestEnableSystemd(t *testing.T) {
+	ctx := context.Background()
+	if wsl.MockAvailable() {
+		t.Parallel()
+		m := mock.New()
+		newFakeSystemd(m)
+		ctx = wsl.WithMock(ctx, m)
+	}
+
+	d := newTestDistro(t, ctx, rootFs)
+
+	err := d.Command(ctx, "mkdir -p /etc").Run()
+	require.NoError(t, err, "Setup: could not create /etc")
+
+	_, err = d.SystemdStatus(ctx)
+	require.ErrorIs(t, err, wsl.ErrSystemdNotPID1, "SystemdStatus should fail before enabling systemd")
+
+	err = d.Service("dbus.service").Start(ctx)
+	require.ErrorIs(t, err, wsl.ErrSystemdNotPID1, "Starting a service should fail before enabling systemd")
+
+	err = d.EnableSystemd(ctx)
+	require.NoError(t, err, "EnableSystemd should not fail")
+
+	conf, err := d.WSLConf(ctx)
+	require.NoError(t, err, "WSLConf should not fail")
+	c, err := conf.Config()
+	require.NoError(t, err, "Config should not fail")
+	require.NotNil(t, c.Systemd, "EnableSystemd should set boot.systemd in wsl.conf")
+	require.True(t, *c.Systemd, "EnableSystemd should enable boot.systemd in wsl.conf")
+
+	s, err := d.SystemdStatus(ctx)
+	require.NoError(t, err, "SystemdStatus should not fail after enabling systemd")
+	require.Contains(t, []wsl.SystemdState{wsl.SystemdRunning, wsl.SystemdDegraded}, s, "Systemd should have finished booting")
+
+	err = d.EnableSystemd(ctx)
+	require.NoError(t, err, "EnableSystemd should not fail when systemd is already enabled")
+
+	svc := d.Service("systemd-timesyncd.service")
+
+	err = svc.Stop(ctx)
+	require.NoError(t, err, "Stop should not fail")
+	status, err := svc.Status(ctx)
+	require.NoError(t, err, "Status should not fail")
+	require.Equal(t, "inactive", status.ActiveState, "Service should be inactive after stopping it")
+
+	err = svc.Start(ctx)
+	require.NoError(t, err, "Start should not fail")
+	status, err = svc.Status(ctx)
+	require.NoError(t, err, "Status should not fail")
+	require.Equal(t, "active", status.ActiveState, "Service should be active after starting it")
+
+	status, err = d.Service("not-a-real-unit.service").Status(ctx)
+	require.NoError(t, err, "Status should not fail for units that do not exist")
+	require.Equal(t, "not-found", status.LoadState, "Unexpected load state for a unit that does not exist")
+}
+
+func TestServiceInvalidUnit(t *testing.T) {
+	ctx := context.Background()
+	if wsl.MockAvailable() {
+		t.Parallel()
+		ctx = wsl.WithMock(ctx, mock.New())
+	}
+
+	d := newTestDistro(t, ctx, emptyRootFs)
+
+	testCases := map[string]string{
+		"Error on shell injection":    "ssh; rm -rf /",
+		"Error on quotes":             "it's.service",
+		"Error on leading dash":       "--now",
+		"Error on empty unit name":    "",
+		"Error on whitespace in name": "my service",
+	}
+
+	for name, unit := range testCases {
+		unit := unit
+		t.Run(name, func(t *testing.T) {
+			if wsl.MockAvailable() {
+				t.Parallel()
+			}
+
+			s := d.Service(unit)
+
+			require.Error(t, s.Start(ctx), "Start should fail")
+			require.Error(t, s.Stop(ctx), "Stop should fail")
+			require.Error(t, s.Enable(ctx), "Enable should fail")
+			require.Error(t, s.Disable(ctx), "Disable should fail")
+			_, err := s.Status(ctx)
+			require.Error(t, err, "Status should fail")
+		})
+	}
+}
+
+// The systemctl commands run by Service. The unit is the last submatch.
+var (
+	systemctlVerbRegex = regexp.MustCompile(`^systemctl (start|stop|enable|disable) -- '(.+)'$`)
+	systemctlShowRegex = regexp.MustCompile(`^systemctl show --property=\S+ -- '(.+)'$`)
+)
+
+// fakeSystemd mocks systemd and systemctl in the distros of a mocked back-end.
+// As in WSL, distros boot with systemd as PID 1 if wsl.conf enables it when they
+// start again after being terminated.
+type fakeSystemd struct {
+	m *mock.Backend
+
+	mu           sync.Mutex
+	terminations int               // Number of terminations seen, to find out when the distro boots again
+	pid1         string            // Name of PID 1
+	units        map[string]string // Active state of the loaded units
+}
+
+func newFakeSystemd(m *mock.Backend) *fakeSystemd {
+	s := &fakeSystemd{
+		m:    m,
+		pid1: "init",
+		units: map[string]string{
+			"dbus.service":              "active",
+			"systemd-timesyncd.service": "active",
+		},
+	}
+
+	m.HandleCommand("cat /proc/1/comm", func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+		fmt.Fprintln(stdout, s.comm(ctx))
+		return 0
+	})
+
+	isSystemRunning := func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+		if s.comm(ctx) != "systemd" {
+			fmt.Fprintln(stdout, "offline")
+			return 1
+		}
+		fmt.Fprintln(stdout, "running")
+		return 0
+	}
+	m.HandleCommand("systemctl is-system-running", isSystemRunning)
+	m.HandleCommand("systemctl is-system-running --wait", isSystemRunning)
+
+	m.HandleCommandRegexp(systemctlVerbRegex, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+		info, _ := mock.CommandInfoFromContext(ctx)
+		args := systemctlVerbRegex.FindStringSubmatch(info.Command)
+		verb, unit := args[1], args[2]
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if _, ok := s.units[unit]; !ok {
+			fmt.Fprintf(stderr, "Failed to %s %s: Unit %s not found.\n", verb, unit, unit)
+			return 5
+		}
+		switch verb {
+		case "start":
+			s.units[unit] = "active"
+		case "stop":
+			s.units[unit] = "inactive"
+		}
+		return 0
+	})
+
+	m.HandleCommandRegexp(systemctlShowRegex, func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+		info, _ := mock.CommandInfoFromContext(ctx)
+		unit := systemctlShowRegex.FindStringSubmatch(info.Command)[1]
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		state, ok := s.units[unit]
+		if !ok {
+			fmt.Fprint(stdout, "LoadState=not-found\nActiveState=inactive\nSubState=dead\nUnitFileState=\n")
+			return 0
+		}
+		sub := "dead"
+		if state == "active" {
+			sub = "running"
+		}
+		fmt.Fprintf(stdout, "LoadState=loaded\nActiveState=%s\nSubState=%s\nUnitFileState=enabled\n", state, sub)
+		return 0
+	})
+
+	return s
+}
+
+// comm returns the name of PID 1 in the distro of the command, which changes
+// only when the distro boots again.
+func (s *fakeSystemd) comm(ctx context.Context) string {
+	info, _ := mock.CommandInfoFromContext(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.m.CallsTo("Terminate", info.Distro))
+	if n == s.terminations {
+		return s.pid1
+	}
+	s.terminations = n
+
+	s.pid1 = "init"
+	out, err := s.m.ReadFile(info.Distro, wslconf.Path)
+	if err != nil {
+		return s.pid1
+	}
+	f, err := wslconf.Parse(bytes.NewReader(out))
+	if err != nil {
+		return s.pid1
+	}
+	if c, err := f.Config(); err == nil && c.Systemd != nil && *c.Systemd {
+		s.pid1 = "systemd"
+	}
+
+	return s.pid1
+}
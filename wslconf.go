@@ -0,0 +1,145 @@
+package gowsl
+
+// This file contains utilities to read and write the distro's /etc/wsl.conf.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/wslconf"
+)
+
+// WSLConf reads the distro's /etc/wsl.conf. If the file does not exist,
+// an empty one is returned.
+func (d *Distro) WSLConf(ctx context.Context) (conf *wslconf.File, err error) {
+	defer decorate.OnError(&err, "could not read %s in distro %s", wslconf.Path, d.name)
+
+	out, err := d.Command(ctx, "cat "+wslconf.Path).Output()
+	if target := (&exec.ExitError{}); errors.As(err, &target) {
+		// cat failed: find out if it is because the file does not exist.
+		if e := d.Command(ctx, "ls "+wslconf.Path).Run(); e != nil {
+			return wslconf.New(), nil
+		}
+		return nil, fmt.Errorf("%v: %s", err, bytes.TrimSpace(target.Stderr))
+	} else if err != nil {
+		return nil, err
+	}
+
+	return wslconf.Parse(bytes.NewReader(out))
+}
+
+// SetWSLConf validates conf and writes it into the distro's /etc/wsl.conf.
+// Changes take effect the next time the distro starts (see Terminate).
+//
+// The file is written as root, regardless of the default user of the distro.
+func (d *Distro) SetWSLConf(ctx context.Context, conf *wslconf.File) (err error) {
+	defer decorate.OnError(&err, "could not write %s in distro %s", wslconf.Path, d.name)
+
+	if _, err := conf.Validate(); err != nil {
+		return err
+	}
+
+	cmd := d.Command(ctx, "tee "+wslconf.Path)
+	cmd.User = "root"
+	cmd.Stdin = strings.NewReader(conf.String())
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// WSLConfConflict is a setting in wsl.conf that disagrees with the distro's
+// configuration in the registry (see GetConfiguration). When this happens, the
+// behaviour of the distro may not be the one that GetConfiguration suggests.
+type WSLConfConflict struct {
+	Setting       string // Setting in wsl.conf, in the format section.key
+	WSLConfValue  string // Value of the setting in wsl.conf
+	RegistryValue string // Value of the equivalent setting in the registry
+}
+
+func (c WSLConfConflict) String() string {
+	return fmt.Sprintf("%s is %s in wsl.conf, but %s in the registry", c.Setting, c.WSLConfValue, c.RegistryValue)
+}
+
+// WSLConfConflicts reports the settings in conf that disagree with the distro's
+// configuration in the registry. Settings that are not present in conf are never
+// in conflict.
+//
+// The default user in conf is resolved to a UID inside the distro in order to
+// compare it with DefaultUID.
+func (d *Distro) WSLConfConflicts(ctx context.Context, conf *wslconf.File) (conflicts []WSLConfConflict, err error) {
+	defer decorate.OnError(&err, "could not compare wsl.conf with the registry for distro %s", d.name)
+
+	c, err := conf.Config()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	reg, err := d.GetConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	flagConflicts := []struct {
+		setting  string
+		wslConf  *bool
+		registry bool
+		flag     string
+	}{
+		{"automount.enabled", c.AutomountEnabled, reg.DriveMountingEnabled, "ENABLE_DRIVE_MOUNTING"},
+		{"interop.enabled", c.InteropEnabled, reg.InteropEnabled, "ENABLE_INTEROP"},
+		{"interop.appendWindowsPath", c.AppendWindowsPath, reg.PathAppended, "APPEND_NT_PATH"},
+	}
+
+	for _, f := range flagConflicts {
+		if f.wslConf == nil || *f.wslConf == f.registry {
+			continue
+		}
+		conflicts = append(conflicts, WSLConfConflict{
+			Setting:       f.setting,
+			WSLConfValue:  strconv.FormatBool(*f.wslConf),
+			RegistryValue: fmt.Sprintf("%s=%t", f.flag, f.registry),
+		})
+	}
+
+	if c.DefaultUser == "" {
+		return conflicts, nil
+	}
+
+	// User names have been validated, so they are safe to pass to the shell.
+	value := fmt.Sprintf("%s (unknown user)", c.DefaultUser)
+	out, err := d.Command(ctx, "id -u "+c.DefaultUser).Output()
+	if target := (&exec.ExitError{}); err != nil && !errors.As(err, &target) {
+		return nil, err
+	} else if err == nil {
+		uid, err := strconv.ParseUint(string(bytes.TrimSpace(out)), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse UID of user %s: %v", c.DefaultUser, err)
+		}
+		if uint32(uid) == reg.DefaultUID {
+			return conflicts, nil
+		}
+		value = fmt.Sprintf("%s (UID %d)", c.DefaultUser, uid)
+	}
+
+	conflicts = append(conflicts, WSLConfConflict{
+		Setting:       "user.default",
+		WSLConfValue:  value,
+		RegistryValue: fmt.Sprintf("DefaultUID=%d", reg.DefaultUID),
+	})
+
+	return conflicts, nil
+}
@@ -0,0 +1,176 @@
+// Package wslconf reads, validates and writes the per-distro WSL configuration
+// file, located at /etc/wsl.conf inside each distro.
+//
+// Files are edited in place: comments, key order and unknown settings are
+// preserved when writing a configuration back. Use gowsl's (*Distro).WSLConf
+// and (*Distro).SetWSLConf to access the file of a particular distro.
+package wslconf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/internal/ini"
+)
+
+// Path is the location of the file inside the distro.
+const Path = "/etc/wsl.conf"
+
+// Config is the typed contents of a wsl.conf file. Nil pointers and empty
+// strings represent settings that are not present in the file, in which case
+// WSL uses its default value.
+type Config struct {
+	// Section [automount]
+	AutomountEnabled    *bool  // Whether Windows drives are mounted under AutomountRoot
+	AutomountMountFsTab *bool  // Whether /etc/fstab is processed on start-up
+	AutomountRoot       string // Directory where Windows drives are mounted
+	AutomountOptions    string // Mount options for Windows drives
+
+	// Section [network]
+	GenerateHosts      *bool  // Whether WSL generates /etc/hosts
+	GenerateResolvConf *bool  // Whether WSL generates /etc/resolv.conf
+	Hostname           string // Hostname of the distro
+
+	// Section [interop]
+	InteropEnabled    *bool // Whether Windows executables can be launched from the distro
+	AppendWindowsPath *bool // Whether Windows' PATH is appended to the distro's $PATH
+
+	// Section [user]
+	DefaultUser string // Name of the user that WSL logs in as
+
+	// Section [boot]
+	Systemd     *bool  // Whether systemd is started as PID 1
+	BootCommand string // Command run as root when the distro starts
+
+	// Section [time]
+	UseWindowsTimezone *bool // Whether the distro's timezone is synced with Windows'
+}
+
+// File is a wsl.conf file. Create it with New or Parse.
+type File struct {
+	doc *ini.File
+}
+
+// Warning is a non-fatal problem found while validating a File.
+type Warning = ini.Warning
+
+// New returns an empty wsl.conf file.
+func New() *File {
+	return &File{doc: &ini.File{}}
+}
+
+// Parse reads a wsl.conf file from r.
+func Parse(r io.Reader) (*File, error) {
+	doc, err := ini.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse wsl.conf: %v", err)
+	}
+	return &File{doc: doc}, nil
+}
+
+// Config returns the settings in the file. Unknown settings are ignored,
+// use Validate to find out about them.
+func (f *File) Config() (c Config, err error) {
+	defer decorate.OnError(&err, "could not read wsl.conf")
+	return schema.Decode(f.doc)
+}
+
+// SetConfig overwrites the settings in the file with the ones in c, after
+// validating them. Settings that are not set in c are removed from the file.
+// Unknown settings and comments are left untouched.
+func (f *File) SetConfig(c Config) (err error) {
+	defer decorate.OnError(&err, "could not write wsl.conf")
+	return schema.Encode(f.doc, c)
+}
+
+// Validate checks that all known settings have valid values and reports
+// unknown sections and keys as warnings, as WSL ignores them.
+func (f *File) Validate() (warnings []Warning, err error) {
+	warnings = schema.Unknown(f.doc)
+
+	c, err := f.Config()
+	if err != nil {
+		return warnings, err
+	}
+
+	return warnings, c.Validate()
+}
+
+// WriteTo writes the file into w.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	return f.doc.WriteTo(w)
+}
+
+// String returns the contents of the file.
+func (f *File) String() string {
+	return f.doc.String()
+}
+
+// Validate checks that all settings have valid values.
+func (c Config) Validate() (err error) {
+	defer decorate.OnError(&err, "invalid wsl.conf")
+	return schema.Validate(c)
+}
+
+// ApplyRequiresRestart returns true if going from the old to the new
+// configuration requires terminating the distro (see gowsl's (*Distro).Terminate)
+// for the changes to take effect.
+//
+// All settings in wsl.conf are read when the distro boots, so any change
+// requires a restart.
+func ApplyRequiresRestart(oldConf, newConf Config) bool {
+	return len(schema.Diff(oldConf, newConf)) != 0
+}
+
+var schema = ini.Schema[Config]{
+	ini.Bool("automount", "enabled", func(c *Config) **bool { return &c.AutomountEnabled }),
+	ini.Bool("automount", "mountFsTab", func(c *Config) **bool { return &c.AutomountMountFsTab }),
+	ini.String("automount", "root", func(c *Config) *string { return &c.AutomountRoot }, validLinuxPath),
+	ini.String("automount", "options", func(c *Config) *string { return &c.AutomountOptions }, nil),
+
+	ini.Bool("network", "generateHosts", func(c *Config) **bool { return &c.GenerateHosts }),
+	ini.Bool("network", "generateResolvConf", func(c *Config) **bool { return &c.GenerateResolvConf }),
+	ini.String("network", "hostname", func(c *Config) *string { return &c.Hostname }, validHostname),
+
+	ini.Bool("interop", "enabled", func(c *Config) **bool { return &c.InteropEnabled }),
+	ini.Bool("interop", "appendWindowsPath", func(c *Config) **bool { return &c.AppendWindowsPath }),
+
+	ini.String("user", "default", func(c *Config) *string { return &c.DefaultUser }, validUserName),
+
+	ini.Bool("boot", "systemd", func(c *Config) **bool { return &c.Systemd }),
+	ini.String("boot", "command", func(c *Config) *string { return &c.BootCommand }, nil),
+
+	ini.Bool("time", "useWindowsTimezone", func(c *Config) **bool { return &c.UseWindowsTimezone }),
+}
+
+func validLinuxPath(path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("%q is not an absolute path", path)
+	}
+	return nil
+}
+
+var hostnameRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+func validHostname(name string) error {
+	if !hostnameRegex.MatchString(name) {
+		return fmt.Errorf("%q is not a valid hostname", name)
+	}
+	return nil
+}
+
+var userNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*\$?$`)
+
+func validUserName(name string) error {
+	if !userNameRegex.MatchString(name) {
+		return fmt.Errorf("%q is not a valid user name", name)
+	}
+	if len(name) > 32 {
+		return errors.New("user name is longer than 32 characters")
+	}
+	return nil
+}
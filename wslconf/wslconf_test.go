@@ -0,0 +1,185 @@
+package wslconf_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/wslconf"
+)
+
+const sampleConf = `# Set by the provisioning script
+[boot]
+systemd=true
+
+[automount]
+root = /windir/
+options = "metadata,umask=22,fmask=11"
+
+[user]
+default = ubuntu # Created at install time
+`
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+
+		want    wslconf.Config
+		wantErr bool
+	}{
+		"Empty file": {},
+		"Sample file": {input: sampleConf, want: wslconf.Config{
+			Systemd:          ptr(true),
+			AutomountRoot:    "/windir/",
+			AutomountOptions: "metadata,umask=22,fmask=11",
+			DefaultUser:      "ubuntu",
+		}},
+		"All sections": {input: `[automount]
+enabled=false
+mountFsTab=true
+[network]
+generateHosts=false
+generateResolvConf=false
+hostname=devbox
+[interop]
+enabled=false
+appendWindowsPath=false
+[boot]
+command=service docker start
+[time]
+useWindowsTimezone=true`, want: wslconf.Config{
+			AutomountEnabled:    ptr(false),
+			AutomountMountFsTab: ptr(true),
+			GenerateHosts:       ptr(false),
+			GenerateResolvConf:  ptr(false),
+			Hostname:            "devbox",
+			InteropEnabled:      ptr(false),
+			AppendWindowsPath:   ptr(false),
+			BootCommand:         "service docker start",
+			UseWindowsTimezone:  ptr(true),
+		}},
+
+		// Error cases
+		"Error on invalid boolean": {input: "[boot]\nsystemd=1", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := wslconf.Parse(strings.NewReader(tc.input))
+			require.NoError(t, err, "Setup: Parse should not have failed")
+
+			got, err := f.Config()
+			if tc.wantErr {
+				require.Error(t, err, "Config should have failed")
+				return
+			}
+			require.NoError(t, err, "Config should not have failed")
+			require.Equal(t, tc.want, got, "Unexpected configuration")
+		})
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	t.Parallel()
+
+	f, err := wslconf.Parse(strings.NewReader(sampleConf))
+	require.NoError(t, err, "Setup: Parse should not have failed")
+
+	c, err := f.Config()
+	require.NoError(t, err, "Setup: Config should not have failed")
+
+	c.Systemd = ptr(false)
+	c.DefaultUser = "root"
+	c.AutomountOptions = ""
+	c.InteropEnabled = ptr(false)
+
+	err = f.SetConfig(c)
+	require.NoError(t, err, "SetConfig should not have failed")
+
+	want := `# Set by the provisioning script
+[boot]
+systemd=false
+
+[automount]
+root = /windir/
+
+[user]
+default = root # Created at install time
+
+[interop]
+enabled=false
+`
+	require.Equal(t, want, f.String(), "Unexpected file contents after SetConfig")
+
+	c.AutomountRoot = "relative/path"
+	err = f.SetConfig(c)
+	require.Error(t, err, "SetConfig should fail with an invalid config")
+	require.Equal(t, want, f.String(), "SetConfig should not modify the file when it fails")
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+
+		wantWarnings []string
+		wantErr      bool
+	}{
+		"Empty file":  {},
+		"Sample file": {input: sampleConf},
+		"Warn on unknown keys and sections": {input: "[boot]\nsystemd=true\nsystem=true\n[gpu]\nenabled=true",
+			wantWarnings: []string{
+				`line 3: unknown key "system" in section [boot]`,
+				`line 5: unknown section [gpu]`,
+			}},
+
+		// Error cases
+		"Error on relative automount root": {input: "[automount]\nroot=mnt", wantErr: true},
+		"Error on invalid hostname":        {input: "[network]\nhostname=my_host", wantErr: true},
+		"Error on invalid user name":       {input: "[user]\ndefault=$(rm -rf /)", wantErr: true},
+		"Error on too long user name":      {input: "[user]\ndefault=" + strings.Repeat("u", 33), wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := wslconf.Parse(strings.NewReader(tc.input))
+			require.NoError(t, err, "Setup: Parse should not have failed")
+
+			warnings, err := f.Validate()
+			if tc.wantErr {
+				require.Error(t, err, "Validate should have failed")
+				return
+			}
+			require.NoError(t, err, "Validate should not have failed")
+
+			var got []string
+			for _, w := range warnings {
+				got = append(got, w.String())
+			}
+			require.Equal(t, tc.wantWarnings, got, "Unexpected warnings")
+		})
+	}
+}
+
+func TestApplyRequiresRestart(t *testing.T) {
+	t.Parallel()
+
+	base := wslconf.Config{Systemd: ptr(true)}
+
+	require.False(t, wslconf.ApplyRequiresRestart(base, wslconf.Config{Systemd: ptr(true)}), "Equal configs should not require a restart")
+	require.True(t, wslconf.ApplyRequiresRestart(base, wslconf.Config{}), "Removing a setting should require a restart")
+	require.True(t, wslconf.ApplyRequiresRestart(base, wslconf.Config{Systemd: ptr(true), Hostname: "a"}), "Adding a setting should require a restart")
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,134 @@
+package gowsl_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/mock"
+	"github.com/ubuntu/gowsl/wslconf"
+)
+
+func TestWSLConf(t *testing.T) {
+	ctx := context.Background()
+	if wsl.MockAvailable() {
+		t.Parallel()
+		ctx = wsl.WithMock(ctx, mock.New())
+	}
+
+	d := newTestDistro(t, ctx, rootFs)
+
+	err := d.Command(ctx, "mkdir -p /etc").Run()
+	require.NoError(t, err, "Setup: could not create /etc")
+
+	conf, err := d.WSLConf(ctx)
+	require.NoError(t, err, "WSLConf should not fail")
+
+	c, err := conf.Config()
+	require.NoError(t, err, "Config should not fail")
+
+	c.Hostname = "gowsl-test"
+	c.AppendWindowsPath = ptr(false)
+	err = conf.SetConfig(c)
+	require.NoError(t, err, "Setup: SetConfig should not fail")
+
+	err = d.SetWSLConf(ctx, conf)
+	require.NoError(t, err, "SetWSLConf should not fail")
+
+	got, err := d.WSLConf(ctx)
+	require.NoError(t, err, "WSLConf should not fail after SetWSLConf")
+	require.Equal(t, conf.String(), got.String(), "WSLConf should return the file written by SetWSLConf")
+
+	invalid, err := wslconf.Parse(strings.NewReader("[network]\nhostname=not_valid"))
+	require.NoError(t, err, "Setup: Parse should not fail")
+	err = d.SetWSLConf(ctx, invalid)
+	require.Error(t, err, "SetWSLConf should fail with an invalid file")
+}
+
+func TestSetWSLConfAsRoot(t *testing.T) {
+	if !wsl.MockAvailable() {
+		t.Skip("Skipping test because it relies on the command handlers of the mock")
+	}
+	t.Parallel()
+
+	m := mock.New()
+	ctx := wsl.WithMock(context.Background(), m)
+	d := newTestDistro(t, ctx, emptyRootFs)
+	require.NoError(t, d.DefaultUID(1000), "Setup: could not set the default UID")
+
+	m.HandleCommand("tee "+wslconf.Path, func(ctx context.Context, stdin io.Reader, _, stderr io.Writer) int {
+		_, _ = io.Copy(io.Discard, stdin)
+
+		if info, _ := mock.CommandInfoFromContext(ctx); info.User != "root" {
+			fmt.Fprintf(stderr, "not running as root: running as %q", info.User)
+			return 1
+		}
+		return 0
+	})
+	m.ResetCalls()
+
+	err := d.SetWSLConf(ctx, wslconf.New())
+	require.NoError(t, err, "SetWSLConf should have written the file as root")
+
+	m.AssertNumberOfCalls(t, 0, "WslConfigureDistribution")
+
+	conf, err := d.GetConfiguration()
+	require.NoError(t, err, "GetConfiguration should not fail")
+	require.Equal(t, uint32(1000), conf.DefaultUID, "The default UID should not have changed")
+}
+
+func TestWSLConfConflicts(t *testing.T) {
+	ctx := context.Background()
+	if wsl.MockAvailable() {
+		t.Parallel()
+		ctx = wsl.WithMock(ctx, mock.New())
+	}
+
+	d := newTestDistro(t, ctx, emptyRootFs)
+
+	err := d.InteropEnabled(false)
+	require.NoError(t, err, "Setup: could not disable interop")
+
+	testCases := map[string]struct {
+		conf string
+
+		want []string
+	}{
+		"No conflicts on empty file":     {},
+		"No conflicts on matching flags": {conf: "[interop]\nenabled=false\nappendWindowsPath=true\n[automount]\nenabled=true"},
+		"Conflicting flags": {conf: "[interop]\nenabled=true\nappendWindowsPath=false\n[automount]\nenabled=false", want: []string{
+			"automount.enabled is false in wsl.conf, but ENABLE_DRIVE_MOUNTING=true in the registry",
+			"interop.enabled is true in wsl.conf, but ENABLE_INTEROP=false in the registry",
+			"interop.appendWindowsPath is false in wsl.conf, but APPEND_NT_PATH=true in the registry",
+		}},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			if wsl.MockAvailable() {
+				t.Parallel()
+			}
+
+			conf, err := wslconf.Parse(strings.NewReader(tc.conf))
+			require.NoError(t, err, "Setup: Parse should not fail")
+
+			conflicts, err := d.WSLConfConflicts(ctx, conf)
+			require.NoError(t, err, "WSLConfConflicts should not fail")
+
+			var got []string
+			for _, c := range conflicts {
+				got = append(got, c.String())
+			}
+			require.Equal(t, tc.want, got, "Unexpected conflicts")
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
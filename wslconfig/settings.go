@@ -0,0 +1,64 @@
+package wslconfig
+
+// This file contains the list of known settings.
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/ubuntu/gowsl/internal/ini"
+)
+
+var schema = ini.Schema[Config]{
+	ini.String("wsl2", "kernel", func(c *Config) *string { return &c.Kernel }, validWindowsPath),
+	ini.String("wsl2", "kernelCommandLine", func(c *Config) *string { return &c.KernelCommandLine }, nil),
+	size("wsl2", "memory", func(c *Config) **ByteSize { return &c.Memory }, func(s ByteSize) error {
+		if s == 0 {
+			return errors.New("must be greater than zero")
+		}
+		return nil
+	}),
+	ini.Int("wsl2", "processors", func(c *Config) **int { return &c.Processors }, func(n int) error {
+		if n < 1 {
+			return errors.New("must be at least 1")
+		}
+		return nil
+	}),
+	size("wsl2", "swap", func(c *Config) **ByteSize { return &c.Swap }, nil),
+	ini.String("wsl2", "swapFile", func(c *Config) *string { return &c.SwapFile }, validWindowsPath),
+	ini.Bool("wsl2", "localhostForwarding", func(c *Config) **bool { return &c.LocalhostForwarding }),
+	ini.Bool("wsl2", "nestedVirtualization", func(c *Config) **bool { return &c.NestedVirtualization }),
+	ini.Bool("wsl2", "guiApplications", func(c *Config) **bool { return &c.GUIApplications }),
+	ini.Bool("wsl2", "debugConsole", func(c *Config) **bool { return &c.DebugConsole }),
+	ini.Bool("wsl2", "pageReporting", func(c *Config) **bool { return &c.PageReporting }),
+	ini.Int("wsl2", "vmIdleTimeout", func(c *Config) **int { return &c.VMIdleTimeout }, nil),
+	experimental(ini.Enum("wsl2", "networkingMode", func(c *Config) *NetworkingMode { return &c.NetworkingMode },
+		NetworkingNAT, NetworkingMirrored, NetworkingNone, NetworkingBridged, NetworkingVirtioProxy)),
+	experimental(ini.Bool("wsl2", "firewall", func(c *Config) **bool { return &c.Firewall })),
+	experimental(ini.Bool("wsl2", "dnsTunneling", func(c *Config) **bool { return &c.DNSTunneling })),
+	experimental(ini.Bool("wsl2", "autoProxy", func(c *Config) **bool { return &c.AutoProxy })),
+
+	ini.Enum("experimental", "autoMemoryReclaim", func(c *Config) *AutoMemoryReclaim { return &c.AutoMemoryReclaim },
+		ReclaimDisabled, ReclaimGradual, ReclaimDropCache),
+	ini.Bool("experimental", "sparseVhd", func(c *Config) **bool { return &c.SparseVHD }),
+}
+
+// experimental marks a setting as previously belonging to the experimental section.
+func experimental(s ini.Setting[Config]) ini.Setting[Config] {
+	s.LegacySection = "experimental"
+	return s
+}
+
+func size(section, key string, field func(*Config) **ByteSize, validate func(ByteSize) error) ini.Setting[Config] {
+	return ini.Optional(section, key, field, ParseByteSize, ByteSize.String, validate)
+}
+
+var windowsAbsPath = regexp.MustCompile(`^([A-Za-z]:|\\\\[^\\]+)[\\/]`)
+
+func validWindowsPath(path string) error {
+	if !windowsAbsPath.MatchString(path) {
+		return fmt.Errorf("%q is not an absolute Windows path", path)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package wslconfig
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is an amount of memory or disk space, in bytes.
+type ByteSize uint64
+
+// Units accepted by WSL. Note that they are powers of 1024.
+const (
+	B  ByteSize = 1
+	KB          = 1024 * B
+	MB          = 1024 * KB
+	GB          = 1024 * MB
+	TB          = 1024 * GB
+)
+
+// ParseByteSize parses sizes in the format used in .wslconfig, such as 512MB or 4GB.
+// A number without a unit is interpreted as bytes.
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	end := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if end == -1 {
+		end = len(s)
+	}
+
+	n, err := strconv.ParseUint(s[:end], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	var unit ByteSize
+	switch strings.ToUpper(strings.TrimSpace(s[end:])) {
+	case "", "B":
+		unit = B
+	case "K", "KB":
+		unit = KB
+	case "M", "MB":
+		unit = MB
+	case "G", "GB":
+		unit = GB
+	case "T", "TB":
+		unit = TB
+	default:
+		return 0, fmt.Errorf("invalid size %q: unknown unit", s)
+	}
+
+	if n > math.MaxUint64/uint64(unit) {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+
+	return ByteSize(n) * unit, nil
+}
+
+// String formats the size using the largest unit that represents it exactly.
+func (s ByteSize) String() string {
+	units := []struct {
+		size   ByteSize
+		suffix string
+	}{{TB, "TB"}, {GB, "GB"}, {MB, "MB"}, {KB, "KB"}}
+
+	for _, u := range units {
+		if s != 0 && s%u.size == 0 {
+			return fmt.Sprintf("%d%s", s/u.size, u.suffix)
+		}
+	}
+
+	return fmt.Sprintf("%dB", uint64(s))
+}
@@ -0,0 +1,170 @@
+// Package wslconfig reads, validates and writes the global WSL configuration
+// file, located at %UserProfile%\.wslconfig.
+//
+// Files are edited in place: comments, key order and unknown settings are
+// preserved when writing a configuration back.
+package wslconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ubuntu/decorate"
+	"github.com/ubuntu/gowsl/internal/ini"
+)
+
+// Config is the typed contents of a .wslconfig file. Nil pointers and empty
+// strings represent settings that are not present in the file, in which case
+// WSL uses its default value.
+type Config struct {
+	// Section [wsl2]
+	Kernel               string         // Absolute Windows path to a custom Linux kernel
+	KernelCommandLine    string         // Additional kernel command line arguments
+	Memory               *ByteSize      // Memory assigned to the WSL 2 VM
+	Processors           *int           // Number of logical processors assigned to the WSL 2 VM
+	Swap                 *ByteSize      // Swap space added to the WSL 2 VM, 0 for no swap file
+	SwapFile             string         // Absolute Windows path to the swap virtual hard disk
+	LocalhostForwarding  *bool          // Whether ports bound in the VM are reachable from Windows' localhost
+	NestedVirtualization *bool          // Whether other VMs can be nested inside WSL 2
+	GUIApplications      *bool          // Whether WSLg is enabled
+	DebugConsole         *bool          // Whether a dmesg console window is shown on start-up
+	PageReporting        *bool          // Whether Windows can reclaim unused memory from the VM
+	VMIdleTimeout        *int           // Milliseconds that the VM stays idle before being shut down
+	NetworkingMode       NetworkingMode // Networking architecture of the VM
+	Firewall             *bool          // Whether Windows firewall rules apply to WSL
+	DNSTunneling         *bool          // Whether DNS requests are tunneled through virtualization
+	AutoProxy            *bool          // Whether Windows' HTTP proxy settings are used in WSL
+
+	// Section [experimental]
+	AutoMemoryReclaim AutoMemoryReclaim // Policy to release cached memory back to Windows
+	SparseVHD         *bool             // Whether new virtual hard disks are sparse
+}
+
+// NetworkingMode is the networking architecture of the WSL 2 VM.
+type NetworkingMode string
+
+// Supported networking modes.
+const (
+	NetworkingNAT         NetworkingMode = "NAT"
+	NetworkingMirrored    NetworkingMode = "mirrored"
+	NetworkingNone        NetworkingMode = "none"
+	NetworkingBridged     NetworkingMode = "bridged"
+	NetworkingVirtioProxy NetworkingMode = "virtioproxy"
+)
+
+// AutoMemoryReclaim is the policy used to release cached memory back to Windows.
+type AutoMemoryReclaim string
+
+// Supported memory reclaim policies.
+const (
+	ReclaimDisabled  AutoMemoryReclaim = "disabled"
+	ReclaimGradual   AutoMemoryReclaim = "gradual"
+	ReclaimDropCache AutoMemoryReclaim = "dropcache"
+)
+
+// File is a .wslconfig file. Create it with Load or Parse.
+type File struct {
+	doc *ini.File
+}
+
+// Warning is a non-fatal problem found while validating a File.
+type Warning = ini.Warning
+
+// DefaultPath returns the path to the current user's .wslconfig file.
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find .wslconfig: %v", err)
+	}
+	return filepath.Join(home, ".wslconfig"), nil
+}
+
+// Load reads the .wslconfig file at the specified path. A missing
+// file is not an error: it is equivalent to an empty one.
+func Load(path string) (f *File, err error) {
+	defer decorate.OnError(&err, "could not load %s", path)
+
+	out, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &File{doc: &ini.File{}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return Parse(bytes.NewReader(out))
+}
+
+// Parse reads a .wslconfig file from r.
+func Parse(r io.Reader) (*File, error) {
+	doc, err := ini.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse .wslconfig: %v", err)
+	}
+	return &File{doc: doc}, nil
+}
+
+// Config returns the settings in the file. Unknown settings are ignored,
+// use Validate to find out about them.
+func (f *File) Config() (c Config, err error) {
+	defer decorate.OnError(&err, "could not read .wslconfig")
+	return schema.Decode(f.doc)
+}
+
+// SetConfig overwrites the settings in the file with the ones in c, after
+// validating them. Settings that are not set in c are removed from the file.
+// Unknown settings and comments are left untouched.
+func (f *File) SetConfig(c Config) (err error) {
+	defer decorate.OnError(&err, "could not write .wslconfig")
+	return schema.Encode(f.doc, c)
+}
+
+// Validate checks that all known settings have valid values and reports
+// unknown sections and keys as warnings, as WSL ignores them.
+func (f *File) Validate() (warnings []Warning, err error) {
+	warnings = schema.Unknown(f.doc)
+
+	c, err := f.Config()
+	if err != nil {
+		return warnings, err
+	}
+
+	return warnings, c.Validate()
+}
+
+// WriteTo writes the file into w.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	return f.doc.WriteTo(w)
+}
+
+// Save writes the file at the specified path.
+func (f *File) Save(path string) (err error) {
+	defer decorate.OnError(&err, "could not save %s", path)
+
+	var buff bytes.Buffer
+	if _, err := f.WriteTo(&buff); err != nil {
+		return err
+	}
+
+	//nolint:gosec // .wslconfig is not a secret, and WSL needs to read it.
+	return os.WriteFile(path, buff.Bytes(), 0644)
+}
+
+// Validate checks that all settings have valid values.
+func (c Config) Validate() (err error) {
+	defer decorate.OnError(&err, "invalid .wslconfig")
+	return schema.Validate(c)
+}
+
+// ApplyRequiresShutdown returns true if going from the old to the new
+// configuration requires shutting WSL down (see gowsl.Shutdown) for the
+// changes to take effect.
+//
+// All settings in .wslconfig are read when the WSL 2 VM boots, so any change
+// requires a shutdown.
+func ApplyRequiresShutdown(oldConf, newConf Config) bool {
+	return len(schema.Diff(oldConf, newConf)) != 0
+}
@@ -0,0 +1,287 @@
+package wslconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/wslconfig"
+)
+
+const sampleConfig = `# Managed by IT
+[wsl2]
+memory=4GB # Half of the host
+processors=2
+swap=0
+kernel=C:\\Users\\me\\kernel
+localhostForwarding=true
+
+[experimental]
+autoMemoryReclaim=gradual
+networkingMode=mirrored
+`
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+
+		want    wslconfig.Config
+		wantErr bool
+	}{
+		"Empty file": {},
+		"Sample file": {input: sampleConfig, want: wslconfig.Config{
+			Memory:              ptr(4 * wslconfig.GB),
+			Processors:          ptr(2),
+			Swap:                ptr(wslconfig.ByteSize(0)),
+			Kernel:              `C:\Users\me\kernel`,
+			LocalhostForwarding: ptr(true),
+			AutoMemoryReclaim:   wslconfig.ReclaimGradual,
+			NetworkingMode:      wslconfig.NetworkingMirrored,
+		}},
+		"Case-insensitive keys and values": {input: "[WSL2]\nMEMORY=512mb\nnetworkingmode=nat\nguiApplications=FALSE", want: wslconfig.Config{
+			Memory:          ptr(512 * wslconfig.MB),
+			NetworkingMode:  wslconfig.NetworkingNAT,
+			GUIApplications: ptr(false),
+		}},
+
+		// Error cases
+		"Error on invalid size":    {input: "[wsl2]\nmemory=lots", wantErr: true},
+		"Error on invalid integer": {input: "[wsl2]\nprocessors=two", wantErr: true},
+		"Error on invalid boolean": {input: "[wsl2]\nfirewall=yes", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := wslconfig.Parse(strings.NewReader(tc.input))
+			require.NoError(t, err, "Setup: Parse should not have failed")
+
+			got, err := f.Config()
+			if tc.wantErr {
+				require.Error(t, err, "Config should have failed")
+				return
+			}
+			require.NoError(t, err, "Config should not have failed")
+			require.Equal(t, tc.want, got, "Unexpected configuration")
+		})
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	t.Parallel()
+
+	f, err := wslconfig.Parse(strings.NewReader(sampleConfig))
+	require.NoError(t, err, "Setup: Parse should not have failed")
+
+	c, err := f.Config()
+	require.NoError(t, err, "Setup: Config should not have failed")
+
+	// No changes
+	err = f.SetConfig(c)
+	require.NoError(t, err, "SetConfig should not fail")
+	require.Equal(t, sampleConfig, stringify(t, f), "SetConfig with an unchanged config should not modify the file")
+
+	// Changes
+	c.Memory = ptr(8 * wslconfig.GB)
+	c.Swap = nil
+	c.NetworkingMode = wslconfig.NetworkingNAT
+	c.SparseVHD = ptr(true)
+	c.SwapFile = `D:\swap.vhdx`
+
+	err = f.SetConfig(c)
+	require.NoError(t, err, "SetConfig should not fail")
+
+	want := `# Managed by IT
+[wsl2]
+memory=8GB # Half of the host
+processors=2
+kernel=C:\\Users\\me\\kernel
+localhostForwarding=true
+swapFile=D:\\swap.vhdx
+
+[experimental]
+autoMemoryReclaim=gradual
+networkingMode=NAT
+sparseVhd=true
+`
+	require.Equal(t, want, stringify(t, f), "Unexpected file contents after SetConfig")
+
+	got, err := f.Config()
+	require.NoError(t, err, "Config should not fail after SetConfig")
+	require.Equal(t, c, got, "Config should return the values written by SetConfig")
+
+	// Invalid changes
+	c.Processors = ptr(0)
+	err = f.SetConfig(c)
+	require.Error(t, err, "SetConfig should fail with an invalid config")
+	require.Equal(t, want, stringify(t, f), "SetConfig should not modify the file when it fails")
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+
+		wantWarnings []string
+		wantErr      bool
+	}{
+		"Empty file":  {},
+		"Sample file": {input: sampleConfig},
+		"Warn on unknown keys and sections": {input: "orphan=1\n[wsl2]\nmemmory=4GB\n[wsl3]\nmemory=4GB",
+			wantWarnings: []string{
+				`line 1: key "orphan" is outside of any section`,
+				`line 3: unknown key "memmory" in section [wsl2]`,
+				`line 5: unknown section [wsl3]`,
+			}},
+
+		// Error cases
+		"Error on zero memory":             {input: "[wsl2]\nmemory=0GB", wantErr: true},
+		"Error on zero processors":         {input: "[wsl2]\nprocessors=0", wantErr: true},
+		"Error on unknown networking mode": {input: "[wsl2]\nnetworkingMode=magic", wantErr: true},
+		"Error on unknown reclaim policy":  {input: "[experimental]\nautoMemoryReclaim=sometimes", wantErr: true},
+		"Error on relative kernel path":    {input: "[wsl2]\nkernel=kernel.bin", wantErr: true},
+		"Error on Linux swap file path":    {input: "[wsl2]\nswapFile=/swap.vhdx", wantErr: true},
+		"Error on unparsable value":        {input: "[wsl2]\nswap=a lot", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := wslconfig.Parse(strings.NewReader(tc.input))
+			require.NoError(t, err, "Setup: Parse should not have failed")
+
+			warnings, err := f.Validate()
+			if tc.wantErr {
+				require.Error(t, err, "Validate should have failed")
+				return
+			}
+			require.NoError(t, err, "Validate should not have failed")
+
+			var got []string
+			for _, w := range warnings {
+				got = append(got, w.String())
+			}
+			require.Equal(t, tc.wantWarnings, got, "Unexpected warnings")
+		})
+	}
+}
+
+func TestApplyRequiresShutdown(t *testing.T) {
+	t.Parallel()
+
+	base := wslconfig.Config{Memory: ptr(4 * wslconfig.GB), NetworkingMode: wslconfig.NetworkingMirrored}
+
+	testCases := map[string]struct {
+		modify func(*wslconfig.Config)
+
+		want bool
+	}{
+		"No changes":               {modify: func(*wslconfig.Config) {}},
+		"Same value, new pointer":  {modify: func(c *wslconfig.Config) { c.Memory = ptr(4 * wslconfig.GB) }},
+		"Changed memory":           {modify: func(c *wslconfig.Config) { c.Memory = ptr(8 * wslconfig.GB) }, want: true},
+		"Removed memory":           {modify: func(c *wslconfig.Config) { c.Memory = nil }, want: true},
+		"Added processors":         {modify: func(c *wslconfig.Config) { c.Processors = ptr(4) }, want: true},
+		"Changed networking mode":  {modify: func(c *wslconfig.Config) { c.NetworkingMode = wslconfig.NetworkingNAT }, want: true},
+		"Changed experimental key": {modify: func(c *wslconfig.Config) { c.SparseVHD = ptr(true) }, want: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			after := base
+			tc.modify(&after)
+
+			got := wslconfig.ApplyRequiresShutdown(base, after)
+			require.Equal(t, tc.want, got, "Unexpected result from ApplyRequiresShutdown")
+		})
+	}
+}
+
+func TestLoadAndSave(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), ".wslconfig")
+
+	f, err := wslconfig.Load(path)
+	require.NoError(t, err, "Load should not fail when the file does not exist")
+
+	err = f.SetConfig(wslconfig.Config{Processors: ptr(4)})
+	require.NoError(t, err, "Setup: SetConfig should not fail")
+
+	err = f.Save(path)
+	require.NoError(t, err, "Save should not fail")
+
+	out, err := os.ReadFile(path)
+	require.NoError(t, err, "Setup: could not read saved file")
+	require.Equal(t, "[wsl2]\nprocessors=4\n", string(out), "Unexpected contents in saved file")
+
+	f, err = wslconfig.Load(path)
+	require.NoError(t, err, "Load should not fail")
+	c, err := f.Config()
+	require.NoError(t, err, "Config should not fail")
+	require.Equal(t, wslconfig.Config{Processors: ptr(4)}, c, "Loaded config should match the saved one")
+}
+
+func TestByteSize(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+
+		want       wslconfig.ByteSize
+		wantString string
+		wantErr    bool
+	}{
+		"Bytes":             {input: "1000", want: 1000, wantString: "1000B"},
+		"Kilobytes":         {input: "2KB", want: 2048, wantString: "2KB"},
+		"Megabytes":         {input: "512MB", want: 512 * wslconfig.MB, wantString: "512MB"},
+		"Gigabytes":         {input: "4GB", want: 4 * wslconfig.GB, wantString: "4GB"},
+		"Short unit":        {input: "1T", want: wslconfig.TB, wantString: "1TB"},
+		"Lowercase unit":    {input: "1536mb", want: 1536 * wslconfig.MB, wantString: "1536MB"},
+		"Zero":              {input: "0", want: 0, wantString: "0B"},
+		"Error on no value": {input: "GB", wantErr: true},
+		"Error on bad unit": {input: "4GiB", wantErr: true},
+		"Error on overflow": {input: "99999999999TB", wantErr: true},
+		"Error on negative": {input: "-1GB", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := wslconfig.ParseByteSize(tc.input)
+			if tc.wantErr {
+				require.Error(t, err, "ParseByteSize should have failed")
+				return
+			}
+			require.NoError(t, err, "ParseByteSize should not have failed")
+			require.Equal(t, tc.want, got, "Unexpected size")
+			require.Equal(t, tc.wantString, got.String(), "Unexpected string representation")
+		})
+	}
+}
+
+func stringify(t *testing.T, f *wslconfig.File) string {
+	t.Helper()
+
+	var sb strings.Builder
+	_, err := f.WriteTo(&sb)
+	require.NoError(t, err, "WriteTo should not fail")
+	return sb.String()
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
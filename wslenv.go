@@ -0,0 +1,211 @@
+package gowsl
+
+// This file contains utilities to build the WSLENV variable, used to forward
+// environment variables between Windows and WSL.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WSLEnvFlag is a flag that controls how a variable listed in WSLENV is
+// forwarded between Windows and WSL.
+type WSLEnvFlag byte
+
+// These are the flags supported by WSL.
+const (
+	WSLEnvPath      WSLEnvFlag = 'p' // The value is a path, translated between Windows and Linux formats
+	WSLEnvPathList  WSLEnvFlag = 'l' // The value is a list of paths, translated between Windows and Linux formats
+	WSLEnvToLinux   WSLEnvFlag = 'u' // The variable is only forwarded when launching WSL from Windows
+	WSLEnvToWindows WSLEnvFlag = 'w' // The variable is only forwarded when launching Windows executables from WSL
+)
+
+// WSLEnvVar is an entry in WSLENV: the name of a variable to forward,
+// and the flags that apply to it.
+type WSLEnvVar struct {
+	Name  string // Name of the variable
+	Flags string // Flags, as they appear after the slash. See WSLEnvFlag.
+
+	slash bool // Whether the entry had a slash with no flags after it, kept to round-trip parsed values
+}
+
+// Has returns true if flag is present in the entry.
+func (v WSLEnvVar) Has(flag WSLEnvFlag) bool {
+	return strings.IndexByte(v.Flags, byte(flag)) != -1
+}
+
+// Validate checks that the entry has a name, and only known flags,
+// none of them repeated.
+func (v WSLEnvVar) Validate() error {
+	if v.Name == "" {
+		return fmt.Errorf("entry %q has no variable name", v)
+	}
+	if strings.ContainsAny(v.Name, ":/=") {
+		return fmt.Errorf("entry %q has an invalid variable name", v)
+	}
+
+	for i := 0; i < len(v.Flags); i++ {
+		switch f := WSLEnvFlag(v.Flags[i]); f {
+		case WSLEnvPath, WSLEnvPathList, WSLEnvToLinux, WSLEnvToWindows:
+			if strings.IndexByte(v.Flags[i+1:], byte(f)) != -1 {
+				return fmt.Errorf("entry %q has a repeated flag %q", v, f)
+			}
+		default:
+			return fmt.Errorf("entry %q has an unknown flag %q", v, f)
+		}
+	}
+
+	if v.Has(WSLEnvPath) && v.Has(WSLEnvPathList) {
+		return fmt.Errorf("entry %q cannot be both a path and a path list", v)
+	}
+
+	return nil
+}
+
+func (v WSLEnvVar) String() string {
+	if v.Flags == "" && !v.slash {
+		return v.Name
+	}
+	return v.Name + "/" + v.Flags
+}
+
+// WSLEnv is the parsed contents of the WSLENV variable: a list of variables
+// to forward between Windows and WSL, in order.
+//
+// Use ParseWSLEnv to read an existing value. The zero value is an empty WSLENV.
+type WSLEnv []WSLEnvVar
+
+// ParseWSLEnv parses the value of WSLENV. It never fails, so that any
+// existing value can be modified and rendered back: String returns the
+// original value unless the WSLEnv is modified. Use Validate to check
+// the entries.
+func ParseWSLEnv(s string) WSLEnv {
+	if s == "" {
+		return nil
+	}
+
+	entries := strings.Split(s, ":")
+	env := make(WSLEnv, 0, len(entries))
+	for _, e := range entries {
+		name, flags, slash := strings.Cut(e, "/")
+		env = append(env, WSLEnvVar{Name: name, Flags: flags, slash: slash && flags == ""})
+	}
+
+	return env
+}
+
+// String renders the value of WSLENV.
+func (e WSLEnv) String() string {
+	entries := make([]string, 0, len(e))
+	for _, v := range e {
+		entries = append(entries, v.String())
+	}
+	return strings.Join(entries, ":")
+}
+
+// Validate checks all entries, ignoring empty ones (as WSL does).
+func (e WSLEnv) Validate() error {
+	for _, v := range e {
+		if v == (WSLEnvVar{}) {
+			continue
+		}
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("invalid WSLENV: %v", err)
+		}
+	}
+	return nil
+}
+
+// Get returns the entry for the named variable. Variable names are
+// compared case-insensitively, as Windows does.
+func (e WSLEnv) Get(name string) (v WSLEnvVar, ok bool) {
+	if i := e.index(name); i != -1 {
+		return e[i], true
+	}
+	return v, false
+}
+
+// Set adds the named variable with the given flags, or replaces the flags
+// of an existing entry, keeping its position.
+func (e *WSLEnv) Set(name string, flags ...WSLEnvFlag) {
+	v := WSLEnvVar{Name: name}
+	for _, f := range flags {
+		v.Flags += string(f)
+	}
+
+	if i := e.index(name); i != -1 {
+		(*e)[i] = v
+		return
+	}
+	*e = append(*e, v)
+}
+
+// Unset removes all entries for the named variable.
+func (e *WSLEnv) Unset(name string) {
+	out := (*e)[:0]
+	for _, v := range *e {
+		if !strings.EqualFold(v.Name, name) {
+			out = append(out, v)
+		}
+	}
+	*e = out
+}
+
+// Merge returns a new WSLEnv with the entries of e followed by those of other.
+// Entries in other take precedence: if a variable appears in both, it keeps its
+// position in e but takes the flags in other.
+func (e WSLEnv) Merge(other WSLEnv) WSLEnv {
+	out := append(WSLEnv{}, e...)
+	for _, v := range other {
+		if v.Name == "" {
+			continue
+		}
+		if i := out.index(v.Name); i != -1 {
+			out[i] = v
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func (e WSLEnv) index(name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, v := range e {
+		if strings.EqualFold(v.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// launchEnv returns the variables to launch a command with: the ones in env, and
+// WSLENV to forward them into the distro with the flags in wslEnv. WSL reads both
+// from the environment of wsl.exe, so they are passed to the back-end through
+// backend.EnvLauncher, which sets them on the launched wsl.exe only: the
+// environment of the current process is left alone. It returns nil if there are none.
+func launchEnv(env []string, wslEnv WSLEnv) ([]string, error) {
+	if len(env) == 0 && len(wslEnv) == 0 {
+		return nil, nil
+	}
+
+	var forward WSLEnv
+	for _, kv := range env {
+		name, _, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid environment variable %q: expected key=value", kv)
+		}
+		if _, ok := forward.Get(name); !ok {
+			forward.Set(name)
+		}
+	}
+
+	forward = forward.Merge(wslEnv)
+	if err := forward.Validate(); err != nil {
+		return nil, err
+	}
+
+	return append(append([]string{}, env...), "WSLENV="+forward.String()), nil
+}
@@ -0,0 +1,142 @@
+package gowsl_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	wsl "github.com/ubuntu/gowsl"
+	"github.com/ubuntu/gowsl/mock"
+)
+
+func TestParseWSLEnv(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		value string
+
+		want        wsl.WSLEnv
+		wantInvalid bool
+	}{
+		"Empty value":        {value: ""},
+		"Variable":           {value: "HOME", want: wsl.WSLEnv{{Name: "HOME"}}},
+		"Variable with flag": {value: "GOPATH/l", want: wsl.WSLEnv{{Name: "GOPATH", Flags: "l"}}},
+		"Many variables": {value: "USERPROFILE/pu:GOPATH/l:DISPLAY/u:TERM", want: wsl.WSLEnv{
+			{Name: "USERPROFILE", Flags: "pu"},
+			{Name: "GOPATH", Flags: "l"},
+			{Name: "DISPLAY", Flags: "u"},
+			{Name: "TERM"},
+		}},
+		"Empty entries are kept": {value: "A::B:", want: wsl.WSLEnv{{Name: "A"}, {}, {Name: "B"}, {}}},
+
+		// Invalid values still round-trip
+		"Unknown flag":            {value: "A/x", want: wsl.WSLEnv{{Name: "A", Flags: "x"}}, wantInvalid: true},
+		"Repeated flag":           {value: "A/pp", want: wsl.WSLEnv{{Name: "A", Flags: "pp"}}, wantInvalid: true},
+		"Path and path list":      {value: "A/pl", want: wsl.WSLEnv{{Name: "A", Flags: "pl"}}, wantInvalid: true},
+		"Flags without name":      {value: "/p", want: wsl.WSLEnv{{Flags: "p"}}, wantInvalid: true},
+		"Several slashes":         {value: "A/p/u", want: wsl.WSLEnv{{Name: "A", Flags: "p/u"}}, wantInvalid: true},
+		"Slash without any flags": {value: "A/:B", wantInvalid: false},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := wsl.ParseWSLEnv(tc.value)
+			if tc.want != nil {
+				require.Equal(t, tc.want, got, "Unexpected entries")
+			}
+			require.Equal(t, tc.value, got.String(), "WSLENV should round-trip")
+
+			if tc.wantInvalid {
+				require.Error(t, got.Validate(), "Validate should have failed")
+				return
+			}
+			require.NoError(t, got.Validate(), "Validate should not have failed")
+		})
+	}
+}
+
+func TestWSLEnvEdit(t *testing.T) {
+	t.Parallel()
+
+	env := wsl.ParseWSLEnv("USERPROFILE/pu:GOPATH/l:TERM")
+
+	v, ok := env.Get("gopath")
+	require.True(t, ok, "Get should find variables case-insensitively")
+	require.True(t, v.Has(wsl.WSLEnvPathList), "GOPATH should have the path list flag")
+	require.False(t, v.Has(wsl.WSLEnvPath), "GOPATH should not have the path flag")
+
+	env.Set("TERM", wsl.WSLEnvToLinux)
+	env.Set("PROJECT", wsl.WSLEnvPath, wsl.WSLEnvToLinux)
+	require.Equal(t, "USERPROFILE/pu:GOPATH/l:TERM/u:PROJECT/pu", env.String(), "Unexpected WSLENV after Set")
+
+	env.Unset("userprofile")
+	require.Equal(t, "GOPATH/l:TERM/u:PROJECT/pu", env.String(), "Unexpected WSLENV after Unset")
+
+	_, ok = env.Get("USERPROFILE")
+	require.False(t, ok, "Get should not find unset variables")
+
+	merged := env.Merge(wsl.ParseWSLEnv("TERM:DISPLAY/u::"))
+	require.Equal(t, "GOPATH/l:TERM:PROJECT/pu:DISPLAY/u", merged.String(), "Unexpected WSLENV after Merge")
+	require.Equal(t, "GOPATH/l:TERM/u:PROJECT/pu", env.String(), "Merge should not modify the original WSLENV")
+}
+
+func TestCommandEnv(t *testing.T) {
+	ctx := context.Background()
+	if wsl.MockAvailable() {
+		t.Parallel()
+		m := mock.New()
+		m.HandleCommand("printenv", func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) int {
+			info, _ := mock.CommandInfoFromContext(ctx)
+			for _, kv := range info.Env {
+				fmt.Fprintln(stdout, kv)
+			}
+			return 0
+		})
+		ctx = wsl.WithMock(ctx, m)
+	}
+
+	d := newTestDistro(t, ctx, rootFs)
+
+	wslEnvBefore, wslEnvWasSet := os.LookupEnv("WSLENV")
+
+	if !wsl.MockAvailable() {
+		cmd := d.Command(ctx, `echo "$GOWSL_TEST_PATH:$GOWSL_TEST_VAR"`)
+		cmd.Setenv("GOWSL_TEST_PATH", `C:\Users`, wsl.WSLEnvPath)
+		cmd.Env = append(cmd.Env, "GOWSL_TEST_VAR=hello")
+
+		out, err := cmd.Output()
+		require.NoError(t, err, "Output should not fail")
+		require.Equal(t, "/mnt/c/Users:hello", strings.TrimSpace(string(out)), "Variables should be forwarded into the distro")
+	} else {
+		cmd := d.Command(ctx, "printenv")
+		cmd.Setenv("GOWSL_TEST_PATH", `C:\Users`, wsl.WSLEnvPath)
+		cmd.Env = append(cmd.Env, "GOWSL_TEST_VAR=hello")
+
+		out, err := cmd.Output()
+		require.NoError(t, err, "Output should not fail")
+		// The mock does not translate paths
+		require.Contains(t, string(out), "GOWSL_TEST_PATH=C:\\Users\n", "Variables should be forwarded into the distro")
+		require.Contains(t, string(out), "GOWSL_TEST_VAR=hello\n", "Variables should be forwarded into the distro")
+	}
+
+	_, ok := os.LookupEnv("GOWSL_TEST_PATH")
+	require.False(t, ok, "Variables should not be set in the environment of the current process")
+	wslEnvAfter, wslEnvIsSet := os.LookupEnv("WSLENV")
+	require.Equal(t, wslEnvWasSet, wslEnvIsSet, "WSLENV of the current process should be left untouched")
+	require.Equal(t, wslEnvBefore, wslEnvAfter, "WSLENV of the current process should be left untouched")
+
+	cmd := d.Command(ctx, "exit 0")
+	cmd.Env = []string{"NOT_A_KEY_VALUE_PAIR"}
+	require.Error(t, cmd.Run(), "Run should fail with an invalid variable")
+
+	cmd = d.Command(ctx, "exit 0")
+	cmd.Setenv("GOWSL_TEST_PATH", `C:\Users`, 'x')
+	require.Error(t, cmd.Run(), "Run should fail with an invalid WSLENV flag")
+}